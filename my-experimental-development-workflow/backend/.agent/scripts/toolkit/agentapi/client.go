@@ -0,0 +1,325 @@
+package agentapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Request is a single call against the env of a Client, relative to
+// api_base. Headers are "Key: Value" strings.
+type Request struct {
+	Method    string
+	Path      string
+	TokenName string
+	Body      string
+	Headers   []string
+	// Stream, if set, is called once the response headers arrive. When it
+	// returns a writer the body is copied to it as it is read instead of
+	// being buffered, so memory stays bounded however large the response;
+	// Response.Body then keeps only the first StreamKeepBytes. A writer
+	// returning ErrStopBody ends the call early, without error.
+	Stream func(status int, header http.Header) io.Writer
+	// Raw lets Method be any HTTP method (see EnforceRawMode) and skips
+	// the strict check, which no spec can pass for such a call. The
+	// caller has the user acknowledge it, as `api call raw --unsafe` does.
+	Raw bool
+}
+
+// StreamKeepBytes is how much of a streamed body Response.Body keeps, for
+// OnExchange observers such as the request history.
+const StreamKeepBytes = 1 << 20
+
+// ErrStopBody is returned by a Request.Stream writer that needs no more of
+// the body (e.g. an output limit was reached); the rest is not read.
+var ErrStopBody = errors.New("agentapi: stop reading the response body")
+
+// Response is the backend response of a performed Request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Size is the number of body bytes read.
+	Size int64
+	// Truncated reports that Body holds only a prefix of a streamed body.
+	Truncated bool
+}
+
+// Exchange describes one request that reached the network, for OnExchange.
+// Response is nil when Err is set.
+type Exchange struct {
+	Start       time.Time
+	Duration    time.Duration
+	Request     *http.Request
+	RequestBody string
+	Response    *Response
+	Err         error
+}
+
+// Client performs guardrailed calls for one env: api_mode and strict checks
+// first, then the configured token is injected and the request sent.
+type Client struct {
+	Config *Config
+	// Doer sends the requests (default: DefaultDoer, else an *http.Client).
+	Doer Doer
+	// Transport overrides http.DefaultTransport (e.g. a cassette); ignored
+	// when Doer is set.
+	Transport http.RoundTripper
+	// Spec is used for strict validation as-is; when nil and strict is on,
+	// it is fetched with LoadSpecPaths on every call.
+	Spec map[string]any
+	// Timeout bounds each call (default 30s).
+	Timeout time.Duration
+	// OnExchange, if set, observes every request that reached the network.
+	OnExchange func(Exchange)
+}
+
+// Do checks the request against the policy and executes it. Cancelling
+// ctx aborts the spec fetch or the in-flight call with ExitInterrupted.
+func (c *Client) Do(ctx context.Context, r Request) (*Response, error) {
+	enforce := EnforceMode
+	if r.Raw {
+		enforce = EnforceRawMode
+	}
+	if err := enforce(c.Config, r.Method, r.Body); err != nil {
+		return nil, err
+	}
+	if err := EnforceHeaders(c.Config, r.Method, r.Headers); err != nil {
+		return nil, err
+	}
+	fullURL := c.Config.BuildURL(r.Path)
+	// offHost is the spec server the call goes to when it is not on
+	// api_base's host.
+	offHost := ""
+	if c.Config.Strict && !r.Raw {
+		spec := c.Spec
+		if spec == nil {
+			var err error
+			if spec, err = LoadSpecPaths(ctx, c.Config); err != nil {
+				return nil, err
+			}
+		}
+		if err := ValidateAgainstOpenAPI(spec, r.Method, r.Path); err != nil {
+			return nil, err
+		}
+		// path_bases are set for the env on purpose and win over the spec.
+		if base := operationBase(c.Config, spec, r.Method, r.Path); base != "" && c.Config.BaseFor(r.Path) == c.Config.APIBase {
+			fullURL = base + r.Path
+			if !sameHost(base, c.Config.APIBase) {
+				offHost = base
+			}
+		}
+	}
+
+	_, tokenValue, err := ResolveToken(c.Config, r.TokenName)
+	if err != nil {
+		return nil, err
+	}
+
+	reqHeaders, _ := WithRequestID(c.Config, r.Headers)
+	headers, err := headersListToMap(reqHeaders)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := headers["Authorization"]; !ok {
+		// The env's token is for api_base: another host gets it only when
+		// the env trusts it.
+		if offHost != "" && !allowsSpecServer(c.Config, offHost) {
+			server := offHost
+			if u, err := url.Parse(offHost); err == nil {
+				server = u.Scheme + "://" + u.Host
+			}
+			return nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("The spec sends %s %s to %s, off the host of api_base %s; the env's token is not sent there", r.Method, r.Path, offHost, c.Config.APIBase), fmt.Sprintf(`Trust the server with allow_spec_servers = ["%s"] under [projects.%s.envs.%s], or send its own Authorization header.`, server, c.Config.ActiveProject, c.Config.ActiveEnv))
+		}
+		headers["Authorization"] = "Bearer " + tokenValue
+	}
+	if _, ok := headers["Accept"]; !ok {
+		headers["Accept"] = "application/json"
+	}
+
+	var body io.Reader
+	if r.Body != "" {
+		body = strings.NewReader(r.Body)
+		if _, ok := headers["Content-Type"]; !ok {
+			headers["Content-Type"] = "application/json"
+		}
+	}
+
+	// The query is left out of the span: it may carry secrets.
+	spanURL, _, _ := strings.Cut(fullURL, "?")
+	ctx, endSpan := StartSpan(ctx, r.Method, "http.request.method", r.Method, "url.full", spanURL, "agent_api.env", c.Config.ActiveEnv)
+	req, err := http.NewRequestWithContext(ctx, r.Method, fullURL, body)
+	if err != nil {
+		endSpan(err)
+		return nil, WrapError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err), err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if tp := TraceParent(ctx); tp != "" && req.Header.Get("traceparent") == "" {
+		req.Header.Set("traceparent", tp)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	client := c.Doer
+	switch {
+	case client != nil:
+	case c.Transport != nil:
+		client = &http.Client{Timeout: timeout, Transport: c.Transport}
+	default:
+		client = NewDoer(timeout)
+	}
+	start := time.Now()
+	observe := func(resp *Response, err error) {
+		if resp != nil {
+			endSpan(nil, "http.response.status_code", resp.StatusCode, "http.response.body.size", resp.Size)
+		} else {
+			endSpan(err)
+		}
+		if c.OnExchange != nil {
+			c.OnExchange(Exchange{Start: start, Duration: time.Since(start), Request: req, RequestBody: r.Body, Response: resp, Err: err})
+		}
+	}
+	Logger.Debug("http request", "method", r.Method, "url", fullURL, "body_bytes", len(r.Body))
+	resp, err := client.Do(req)
+	if err != nil {
+		Logger.Debug("http request failed", "method", r.Method, "url", fullURL, "error", err.Error())
+		observe(nil, err)
+		if ctx.Err() != nil {
+			return nil, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: %s %s cancelled after %s, no response received", r.Method, r.Path, time.Since(start).Round(time.Millisecond)), err)
+		}
+		return nil, &Error{Code: ExitUnexpected, Message: fmt.Sprintf("HTTP request failed: %v", err), Suggestion: fmt.Sprintf("Check that %s is reachable: api health.", c.Config.BaseFor(r.Path)), Cause: err}
+	}
+	defer resp.Body.Close()
+
+	var out *Response
+	if r.Stream != nil {
+		if w := r.Stream(resp.StatusCode, resp.Header); w != nil {
+			out, err = StreamBody(resp, w)
+		}
+	}
+	if out == nil && err == nil {
+		var respBody []byte
+		respBody, err = io.ReadAll(resp.Body)
+		out = &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody, Size: int64(len(respBody))}
+	}
+	if err != nil {
+		Logger.Debug("http response read failed", "method", r.Method, "url", fullURL, "error", err.Error())
+		observe(nil, err)
+		if ctx.Err() != nil {
+			return nil, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: %s %s cancelled after %s, HTTP %d with %d bytes of the body received", r.Method, r.Path, time.Since(start).Round(time.Millisecond), resp.StatusCode, out.Size), err)
+		}
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
+		return nil, WrapError(ExitUnexpected, fmt.Sprintf("HTTP request failed: %v", err), err)
+	}
+	Logger.Debug("http response", "method", r.Method, "url", fullURL, "status", resp.StatusCode, "bytes", out.Size, "truncated", out.Truncated, "duration_ms", time.Since(start).Milliseconds())
+	observe(out, nil)
+	return out, nil
+}
+
+// operationBase returns the base URL that the servers declared by the
+// operation serving method and path, or by its path item, give it; "" when
+// it declares none. A relative server URL is resolved against openapi_url,
+// as OpenAPI specifies.
+func operationBase(cfg *Config, spec map[string]any, method, path string) string {
+	p, _, _ := strings.Cut(path, "?")
+	op, _, ok := documentFor(spec).Match(method, p)
+	if !ok || len(op.Servers) == 0 {
+		return ""
+	}
+	server, err := url.Parse(op.Servers[0])
+	if err != nil {
+		return ""
+	}
+	if !server.IsAbs() {
+		specURL, err := url.Parse(cfg.OpenAPIURL)
+		if err != nil {
+			return ""
+		}
+		server = specURL.ResolveReference(server)
+	}
+	return strings.TrimRight(server.String(), "/")
+}
+
+// allowsSpecServer reports whether the env's allow_spec_servers lists the
+// host of base.
+func allowsSpecServer(cfg *Config, base string) bool {
+	for _, server := range cfg.AllowSpecServers {
+		if sameHost(server, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHost reports whether two URLs have the same scheme and host.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// streamSink copies a streamed body to its writer, keeping a prefix.
+type streamSink struct {
+	w    io.Writer
+	out  *Response
+	werr error
+}
+
+func (s *streamSink) Write(p []byte) (int, error) {
+	if room := StreamKeepBytes - len(s.out.Body); room > 0 {
+		s.out.Body = append(s.out.Body, p[:min(room, len(p))]...)
+	}
+	s.out.Size += int64(len(p))
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.werr = err
+	}
+	return n, err
+}
+
+// StreamBody copies resp's body to w the way Do does for a Request with
+// Stream, keeping a prefix in Body. The returned Response is never nil, so
+// a read error can still report how much arrived; write errors other than
+// ErrStopBody come back as *Error.
+func StreamBody(resp *http.Response, w io.Writer) (*Response, error) {
+	out := &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+	sink := &streamSink{w: w, out: out}
+	_, err := io.Copy(sink, resp.Body)
+	out.Truncated = out.Size > int64(len(out.Body))
+	switch {
+	case errors.Is(sink.werr, ErrStopBody):
+		out.Truncated = true
+		return out, nil
+	case sink.werr != nil:
+		return out, WrapError(ExitUnexpected, fmt.Sprintf("Failed to write the response body: %v", sink.werr), sink.werr)
+	}
+	return out, err
+}
+
+func headersListToMap(items []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, h := range items {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid header format (expected 'Key: Value'): %s", h), `Pass headers as -H "Name: value".`)
+		}
+		k := strings.TrimSpace(parts[0])
+		v := strings.TrimSpace(parts[1])
+		if k == "" {
+			return nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid header key: %s", h), `Pass headers as -H "Name: value".`)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package agentapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvSpec is what the spec of one env publishes, for comparing envs.
+type EnvSpec struct {
+	Config  *Config
+	Version string
+	// Operations maps the OperationKey of each operation to its
+	// "METHOD /path" as the env spells it.
+	Operations map[string]string
+	Err        error
+}
+
+// OperationKey identifies an operation across specs that name the same
+// path parameter differently: GET /products/{id} and GET
+// /products/{productId} share the key "GET /products/{}".
+func OperationKey(method, path string) string {
+	segs := NormalizeSegments(path)
+	for i, s := range segs {
+		if isTemplateSegment(s) {
+			segs[i] = "{}"
+		}
+	}
+	return strings.ToUpper(method) + " /" + strings.Join(segs, "/")
+}
+
+// LoadEnvSpecs fetches the spec of every cfg concurrently, at most
+// concurrency at a time, refreshing their caches like PullSpecs. Results
+// keep the order of cfgs; see EnvSpecError to aggregate the failures.
+func LoadEnvSpecs(ctx context.Context, cfgs []*Config, concurrency int) []EnvSpec {
+	if concurrency <= 0 {
+		concurrency = DefaultPullConcurrency
+	}
+	out := make([]EnvSpec, len(cfgs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, cfg := range cfgs {
+		out[i].Config = cfg
+		wg.Add(1)
+		go func(e *EnvSpec) {
+			defer wg.Done()
+			e.Err = loadEnvSpec(ctx, sem, e)
+		}(&out[i])
+	}
+	wg.Wait()
+	return out
+}
+
+func loadEnvSpec(ctx context.Context, sem chan struct{}, e *EnvSpec) error {
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: spec fetch of %s cancelled", e.Config.ActiveEnv), ctx.Err())
+	}
+	spec, err := LoadFreshSpecPaths(ctx, e.Config)
+	if err != nil {
+		return err
+	}
+	if info, ok := AsMap(spec["info"]); ok && info["version"] != nil {
+		e.Version = fmt.Sprint(info["version"])
+	}
+	e.Operations = map[string]string{}
+	for _, op := range IterOperations(spec) {
+		e.Operations[OperationKey(op.Method, op.Path)] = op.Method + " " + op.Path
+	}
+	return nil
+}
+
+// DriftedOperations lists the keys of the operations that some of specs
+// lack, sorted by path and method. Specs that failed to load are left out.
+func DriftedOperations(specs []EnvSpec) []string {
+	loaded := 0
+	seen := map[string]int{}
+	for _, e := range specs {
+		if e.Err != nil {
+			continue
+		}
+		loaded++
+		for k := range e.Operations {
+			seen[k]++
+		}
+	}
+	out := make([]string, 0)
+	for k, n := range seen {
+		if n < loaded {
+			out = append(out, k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		mi, pi, _ := strings.Cut(out[i], " ")
+		mj, pj, _ := strings.Cut(out[j], " ")
+		if pi != pj {
+			return pi < pj
+		}
+		return mi < mj
+	})
+	return out
+}
+
+// EnvSpecError aggregates the failures of LoadEnvSpecs like PullError.
+func EnvSpecError(specs []EnvSpec) error {
+	envs := make([]string, len(specs))
+	errs := make([]error, len(specs))
+	for i, e := range specs {
+		envs[i], errs[i] = e.Config.ActiveEnv, e.Err
+	}
+	return envError("spec fetches", envs, errs)
+}
@@ -0,0 +1,151 @@
+package agentapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes classify every error; the CLIs use them as process exit codes.
+const (
+	ExitSuccess         = 0
+	ExitUnexpected      = 1
+	ExitConfig          = 2
+	ExitToken           = 3
+	ExitOpenAPIFetch    = 4
+	ExitOpenAPIParse    = 5
+	ExitNotFound        = 6
+	ExitBlockedByMode   = 7
+	ExitMarkerMissing   = 8
+	ExitRequestBuild    = 9
+	ExitHTTPErrorStatus = 10
+	ExitAssertionFailed = 11
+	// ExitSpecUnavailable is a spec fetch that kept failing in a way that
+	// usually passes (the server down or restarting, HTTP 429/502/503/504)
+	// with no cached spec to fall back on; unlike ExitOpenAPIFetch it is
+	// worth retrying as is.
+	ExitSpecUnavailable = 12
+	// ExitHeaderMissing is a write without a header the env's
+	// required_headers declares, or with a value not in its format.
+	ExitHeaderMissing = 13
+	// ExitInterrupted reports a call cancelled through its context (the
+	// CLIs cancel on SIGINT/SIGTERM); 130 is the shell convention for ^C.
+	ExitInterrupted = 130
+)
+
+// exitCodeNames are the stable symbolic names of the exit codes, for
+// harnesses that prefer names to numbers.
+var exitCodeNames = map[int]string{
+	ExitSuccess:         "OK",
+	ExitUnexpected:      "ERR_UNEXPECTED",
+	ExitConfig:          "ERR_CONFIG",
+	ExitToken:           "ERR_TOKEN",
+	ExitOpenAPIFetch:    "ERR_SPEC_FETCH",
+	ExitOpenAPIParse:    "ERR_SPEC_PARSE",
+	ExitNotFound:        "ERR_NOT_FOUND",
+	ExitBlockedByMode:   "ERR_BLOCKED_BY_MODE",
+	ExitMarkerMissing:   "ERR_MARKER_MISSING",
+	ExitRequestBuild:    "ERR_REQUEST_BUILD",
+	ExitHTTPErrorStatus: "ERR_HTTP_STATUS",
+	ExitAssertionFailed: "ERR_ASSERTION_FAILED",
+	ExitSpecUnavailable: "ERR_SPEC_UNAVAILABLE",
+	ExitHeaderMissing:   "ERR_HEADER_MISSING",
+	ExitInterrupted:     "ERR_INTERRUPTED",
+}
+
+// ExitCodeName returns the symbolic name of an exit code, e.g.
+// ERR_MARKER_MISSING for 8.
+func ExitCodeName(code int) string {
+	if name, ok := exitCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("ERR_%d", code)
+}
+
+// defaultSuggestions are the next step offered for an error that carries
+// no more specific suggestion of its own.
+var defaultSuggestions = map[int]string{
+	ExitUnexpected:      "Re-run with --log-level debug to see which step failed.",
+	ExitConfig:          "Compare config.toml with config.example.toml.",
+	ExitToken:           "Add the token under [projects.<project>.envs.<env>.tokens] or pick another one with --token <name>.",
+	ExitOpenAPIFetch:    "Check openapi_url and that the API is reachable: api health.",
+	ExitOpenAPIParse:    "Check that openapi_url serves an OpenAPI JSON/YAML document with a 'paths' object.",
+	ExitNotFound:        "Search the spec with: api find <keywords>.",
+	ExitBlockedByMode:   "Switch active_env to an env whose api_mode allows the method.",
+	ExitMarkerMissing:   "Include agent_marker in a string field of the JSON body.",
+	ExitRequestBuild:    "Check the command usage with --help.",
+	ExitAssertionFailed: "See the failed checks reported above.",
+	ExitSpecUnavailable: "Retry in a moment; once a spec is cached, commands fall back on it while the server is down.",
+	ExitHeaderMissing:   "Add the header with -H \"Name: value\"; required_headers in config.toml lists what writes need.",
+}
+
+// Error is the error type returned throughout the package.
+type Error struct {
+	Code    int
+	Message string
+	// Suggestion is the next step that usually resolves the error; see
+	// Suggestion() for the per-code fallback.
+	Suggestion string
+	// Cause is the underlying error, visible to errors.Is and errors.As.
+	Cause error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func NewError(code int, msg string) error {
+	return &Error{Code: code, Message: msg}
+}
+
+// NewErrorHint is NewError with a specific suggested next step.
+func NewErrorHint(code int, msg, suggestion string) error {
+	return &Error{Code: code, Message: msg, Suggestion: suggestion}
+}
+
+// WrapError is NewError with the underlying cause kept for errors.Is/As.
+func WrapError(code int, msg string, cause error) error {
+	return &Error{Code: code, Message: msg, Cause: cause}
+}
+
+// Suggestion returns the suggested next step for err: its own, else the
+// default for its exit code, else "".
+func Suggestion(err error) string {
+	if err == nil {
+		return ""
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if ce, ok := e.(*Error); ok && ce.Suggestion != "" {
+			return ce.Suggestion
+		}
+	}
+	return defaultSuggestions[ExitCode(err)]
+}
+
+// ExitCode returns the code of an *Error, ExitUnexpected for any other
+// error and ExitSuccess for nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	var ce *Error
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return ExitUnexpected
+}
+
+// ExitMessage returns the message of an *Error or describes any other error.
+func ExitMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	var ce *Error
+	if errors.As(err, &ce) {
+		return ce.Message
+	}
+	return fmt.Sprintf("Unexpected error: %v", err)
+}
@@ -0,0 +1,294 @@
+package agentapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileNames are the names a config may have, in the order they are
+// looked for in a directory: the same schema in TOML, YAML or JSON.
+var ConfigFileNames = []string{"config.toml", "config.yaml", "config.yml", "config.json"}
+
+// FindConfigIn returns the path of the config in dir (ConfigFileNames), or
+// "" when it holds none.
+func FindConfigIn(dir string) string {
+	for _, name := range ConfigFileNames {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// GlobalConfigPath is the user's config shared by every project: the
+// config of agent-api under $XDG_CONFIG_HOME, or under the platform's
+// config directory when it is unset (~/.config on Linux). It is the path
+// of agent-api/config.toml when there is none yet, and "" when neither
+// directory is known.
+func GlobalConfigPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		base, _ = os.UserConfigDir()
+	}
+	if base == "" {
+		return ""
+	}
+	dir := filepath.Join(base, "agent-api")
+	if p := FindConfigIn(dir); p != "" {
+		return p
+	}
+	return filepath.Join(dir, ConfigFileNames[0])
+}
+
+// ConfigFormat is the format of a config file by its extension: "YAML",
+// "JSON", or "TOML" for any other.
+func ConfigFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".json":
+		return "JSON"
+	}
+	return "TOML"
+}
+
+// ConfigLayers lists the files the config at configPath is read from, the
+// global one first: the global config is a layer under every other config
+// that exists, so teams share project and env definitions in the repo
+// while each user keeps tokens in their own file.
+func ConfigLayers(configPath string) []string {
+	global := GlobalConfigPath()
+	if global == "" || sameFile(global, configPath) {
+		return []string{configPath}
+	}
+	if _, err := os.Stat(global); err != nil {
+		return []string{configPath}
+	}
+	return []string{global, configPath}
+}
+
+// layeredConfig is a config read over the global config
+// (readLayeredConfig).
+type layeredConfig struct {
+	// merged is the config as TOML, whatever the format of the files.
+	merged []byte
+	// all is the bytes of every layer, which fingerprint the config.
+	all    []byte
+	layers []string
+	// sources lists, by dotted key, the layers that set a value: the last
+	// one for a value, each one adding keys for a table.
+	sources map[string][]string
+}
+
+// readLayeredConfig reads the config at configPath over the global config
+// (ConfigLayers): tables are merged key by key and any other value of the
+// later file, arrays included, replaces the earlier one. Each layer is
+// checked against the schema on its own first, so an error names the
+// file it is in and, for TOML, the line.
+func readLayeredConfig(configPath string) (*layeredConfig, error) {
+	lc := &layeredConfig{layers: ConfigLayers(configPath), sources: map[string][]string{}}
+	var merged map[string]any
+	for _, path := range lc.layers {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, &Error{Code: ExitConfig, Message: fmt.Sprintf("Config file not found: %s", path), Suggestion: "Run inside the project holding config.toml, set AGENT_API_CONFIG, or copy config.example.toml to config.toml.", Cause: err}
+		}
+		lc.all = append(lc.all, raw...)
+		if len(lc.layers) == 1 && ConfigFormat(path) == "TOML" {
+			// Parsed as it is, so errors point into the file.
+			lc.merged = raw
+			return lc, nil
+		}
+		m, err := decodeConfigFile(path, raw)
+		if err != nil {
+			return nil, err
+		}
+		checked := raw
+		if ConfigFormat(path) != "TOML" {
+			if checked, err = toml.Marshal(m); err != nil {
+				return nil, configParseError(path, err)
+			}
+		}
+		if err := toml.Unmarshal(checked, &fileConfig{}); err != nil {
+			return nil, configParseError(path, err)
+		}
+		recordSources(lc.sources, "", m, path)
+		merged = mergeTables(merged, m)
+	}
+	raw, err := toml.Marshal(merged)
+	if err != nil {
+		return nil, WrapError(ExitConfig, fmt.Sprintf("Failed to merge %s over %s: %v", configPath, lc.layers[0], err), err)
+	}
+	lc.merged = raw
+	return lc, nil
+}
+
+// recordSources notes path as a source of every key of m (layeredConfig).
+func recordSources(sources map[string][]string, prefix string, m map[string]any, path string) {
+	for k, v := range m {
+		key := prefix + k
+		sub, isTable := v.(map[string]any)
+		if !isTable {
+			sources[key] = []string{path}
+			continue
+		}
+		if files := sources[key]; len(files) == 0 || files[len(files)-1] != path {
+			sources[key] = append(files, path)
+		}
+		recordSources(sources, key+".", sub, path)
+	}
+}
+
+// decodeLayered reads the config at configPath over the global config into
+// a fileConfig that knows where its settings came from, without checking
+// them. It also returns the bytes of every layer.
+func decodeLayered(configPath string) (*fileConfig, []byte, error) {
+	lc, err := readLayeredConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fc fileConfig
+	if err := toml.Unmarshal(lc.merged, &fc); err != nil {
+		return nil, nil, configParseError(configPath, err)
+	}
+	fc.layers, fc.sources = lc.layers, lc.sources
+	return &fc, lc.all, nil
+}
+
+// source is the config file that sets key, given as its dotted parts:
+// the files, in layer order, that set keys under it for a table, and ""
+// when none does. A config that is a single file is the source of
+// everything.
+func (fc *fileConfig) source(key ...string) string {
+	if len(fc.layers) == 1 {
+		return fc.layers[0]
+	}
+	return strings.Join(fc.sources[strings.Join(key, ".")], ", ")
+}
+
+// setIn is " (set in <file>)" for key when the config has layers, to say
+// which file a setting in an error comes from, and "" otherwise.
+func (fc *fileConfig) setIn(key ...string) string {
+	if len(fc.layers) < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (set in %s)", fc.source(key...))
+}
+
+// decodeConfigFile decodes a config of any ConfigFormat to its tables.
+// Nulls are dropped and integral JSON numbers made integers, so the
+// result reads back as TOML the way the same config written in TOML does.
+func decodeConfigFile(path string, raw []byte) (map[string]any, error) {
+	format := ConfigFormat(path)
+	m := map[string]any{}
+	var err error
+	switch format {
+	case "YAML":
+		err = yaml.Unmarshal(raw, &m)
+	case "JSON":
+		err = json.Unmarshal(raw, &m)
+	default:
+		err = toml.Unmarshal(raw, &m)
+	}
+	if err != nil {
+		return nil, &Error{Code: ExitConfig, Message: fmt.Sprintf("Failed to parse %s config %s: %s", format, path, tomlErrorAt(err)), Suggestion: fmt.Sprintf("Fix the %s syntax at the position reported above.", format), Cause: err}
+	}
+	out, ok := tomlValue(m).(map[string]any)
+	if !ok {
+		return nil, NewError(ExitConfig, fmt.Sprintf("Failed to parse %s config %s: not a mapping of settings", format, path))
+	}
+	return out, nil
+}
+
+// configParseError reports a config that does not decode into the schema.
+// A YAML or JSON config is decoded through TOML (readLayeredConfig) once
+// its syntax is checked, so its error is about a value's type and is told
+// without TOML terms.
+func configParseError(configPath string, err error) error {
+	format := ConfigFormat(configPath)
+	if format == "TOML" {
+		return &Error{Code: ExitConfig, Message: fmt.Sprintf("Failed to parse TOML config %s: %s", configPath, tomlErrorAt(err)), Suggestion: "Fix the TOML syntax at the position reported above.", Cause: err}
+	}
+	msg := strings.Replace(strings.TrimPrefix(err.Error(), "toml: "), "TOML ", "", 1)
+	return &Error{Code: ExitConfig, Message: fmt.Sprintf("Invalid value in %s config %s: %s", format, configPath, msg), Suggestion: "Give the setting the type config.example.toml shows for it.", Cause: err}
+}
+
+// tomlErrorAt is a TOML decoding error with the line and column it is at;
+// other errors, which tell their own position, are left as they are.
+func tomlErrorAt(err error) string {
+	var de *toml.DecodeError
+	if errors.As(err, &de) {
+		line, col := de.Position()
+		return fmt.Sprintf("line %d, column %d: %v", line, col, err)
+	}
+	return err.Error()
+}
+
+// tomlValue converts a decoded YAML or JSON value to one TOML can encode.
+func tomlValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			if e != nil {
+				out[k] = tomlValue(e)
+			}
+		}
+		return out
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			if e != nil {
+				out[fmt.Sprint(k)] = tomlValue(e)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, e := range v {
+			if e != nil {
+				out = append(out, tomlValue(e))
+			}
+		}
+		return out
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	}
+	return v
+}
+
+// mergeTables sets the keys of over into base, merging the tables both
+// have.
+func mergeTables(base, over map[string]any) map[string]any {
+	if base == nil {
+		base = map[string]any{}
+	}
+	for k, v := range over {
+		sub, isTable := v.(map[string]any)
+		prev, hadTable := base[k].(map[string]any)
+		if isTable && hadTable {
+			base[k] = mergeTables(prev, sub)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
+
+// sameFile reports whether two paths name the same existing file.
+func sameFile(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
+}
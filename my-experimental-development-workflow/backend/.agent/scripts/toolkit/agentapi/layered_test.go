@@ -0,0 +1,98 @@
+package agentapi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const localConfig = `active_project = "q"
+active_env = "dev"
+default_token = "default"
+agent_marker = "[agent-test]"
+strict = true
+
+[projects.q.envs.dev]
+api_base = "http://localhost:8080/api"
+openapi_url = "http://localhost:8080/openapi.json"
+api_mode = "read-only"
+tokens = { default = "secret" }
+`
+
+// writeLayers writes the global config under a fresh XDG_CONFIG_HOME and
+// the project config next to it, returning the paths of both.
+func writeLayers(t *testing.T, globalName, global string) (string, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	globalPath := filepath.Join(home, "agent-api", globalName)
+	if err := os.MkdirAll(filepath.Dir(globalPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(globalPath, []byte(global), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(localPath, []byte(localConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return globalPath, localPath
+}
+
+func TestLayeredConfigSources(t *testing.T) {
+	globalPath, localPath := writeLayers(t, "config.toml", `[projects.p.envs.stray]
+api_base = "http://localhost:9090/api"
+openapi_url = "http://localhost:9090/openapi.json"
+api_mode = "read-only"
+tokens = { default = "${AGENT_API_TEST_UNSET_VAR}" }
+
+[projects.q.envs.dev.tokens]
+admin = "global-secret"
+`)
+
+	envs, err := ListEnvs(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{}
+	for _, e := range envs {
+		sources[e.Project+"/"+e.Env] = e.Source
+	}
+	if sources["p/stray"] != globalPath || sources["q/dev"] != globalPath+", "+localPath {
+		t.Errorf("ListEnvs sources = %v, want p/stray from %s and q/dev from both files", sources, globalPath)
+	}
+
+	reports, err := ValidateConfig(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		switch r.Project + "/" + r.Env {
+		case "p/stray":
+			if len(r.Problems) != 1 || r.Problems[0].Source != globalPath {
+				t.Errorf("p/stray problems = %+v, want the unset token reported in %s", r.Problems, globalPath)
+			}
+		case "q/dev":
+			if len(r.Problems) != 0 {
+				t.Errorf("q/dev problems = %+v, want none", r.Problems)
+			}
+		}
+	}
+}
+
+func TestLayeredConfigErrorsNameTheFile(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, global, want string
+	}{
+		{"TOML syntax", "config.toml", "[projects.p\n", "line 1"},
+		{"TOML type", "config.toml", "strict = \"yes\"\n", "line 1"},
+		{"YAML type", "config.yaml", "strict: [1]\n", "Invalid value in YAML config"},
+	} {
+		globalPath, localPath := writeLayers(t, tc.file, tc.global)
+		_, err := ValidateConfig(localPath)
+		if err == nil || !strings.Contains(err.Error(), globalPath) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: ValidateConfig error = %v, want it in %s (%s)", tc.name, err, globalPath, tc.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package agentapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// The paths view of a spec is what search and strict validation read:
+// every operation's operationId, summary, description, tags, parameters,
+// servers and deprecated flag, plus the parameter and path item components
+// they may $ref and the title and version of info.
+// Schemas, request bodies and responses, usually most of a large spec,
+// are skipped by the decoder instead of being built into maps, and the
+// view is an ordinary spec map, so every map-based helper accepts it.
+// Commands that print schemas (show, tools, ui) need the full LoadSpec.
+
+// pathsDoc is the subset of an OpenAPI document the paths view decodes.
+type pathsDoc struct {
+	Info       *pathsInfo           `json:"info"`
+	Paths      map[string]pathsItem `json:"paths"`
+	Components struct {
+		Parameters map[string]any `json:"parameters"`
+		PathItems  map[string]any `json:"pathItems"`
+	} `json:"components"`
+	// Parameters holds Swagger 2 shared parameters (#/parameters/X).
+	Parameters map[string]any `json:"parameters"`
+}
+
+type pathsInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type pathsItem struct {
+	Ref        string   `json:"$ref"`
+	Parameters []any    `json:"parameters"`
+	Servers    []any    `json:"servers"`
+	Get        *pathsOp `json:"get"`
+	Put        *pathsOp `json:"put"`
+	Post       *pathsOp `json:"post"`
+	Delete     *pathsOp `json:"delete"`
+	Options    *pathsOp `json:"options"`
+	Head       *pathsOp `json:"head"`
+	Patch      *pathsOp `json:"patch"`
+	Trace      *pathsOp `json:"trace"`
+}
+
+type pathsOp struct {
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Tags        []any  `json:"tags"`
+	Parameters  []any  `json:"parameters"`
+	Servers     []any  `json:"servers"`
+	Deprecated  bool   `json:"deprecated"`
+}
+
+func (op *pathsOp) toMap() map[string]any {
+	m := map[string]any{}
+	if op.OperationID != "" {
+		m["operationId"] = op.OperationID
+	}
+	if op.Summary != "" {
+		m["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		m["description"] = op.Description
+	}
+	if op.Tags != nil {
+		m["tags"] = op.Tags
+	}
+	if op.Parameters != nil {
+		m["parameters"] = op.Parameters
+	}
+	if op.Servers != nil {
+		m["servers"] = op.Servers
+	}
+	if op.Deprecated {
+		m["deprecated"] = true
+	}
+	return m
+}
+
+func (it pathsItem) toMap() map[string]any {
+	m := map[string]any{}
+	if it.Ref != "" {
+		m["$ref"] = it.Ref
+	}
+	if it.Parameters != nil {
+		m["parameters"] = it.Parameters
+	}
+	if it.Servers != nil {
+		m["servers"] = it.Servers
+	}
+	for method, op := range map[string]*pathsOp{"get": it.Get, "put": it.Put, "post": it.Post, "delete": it.Delete, "options": it.Options, "head": it.Head, "patch": it.Patch, "trace": it.Trace} {
+		if op != nil {
+			m[method] = op.toMap()
+		}
+	}
+	return m
+}
+
+// ParseSpecPaths decodes the paths view of an OpenAPI document. JSON is
+// decoded selectively; YAML, or JSON whose fields have unexpected types,
+// goes through ParseSpec and is then trimmed to the same view.
+func ParseSpecPaths(body []byte) (map[string]any, error) {
+	var doc pathsDoc
+	if err := json.Unmarshal(body, &doc); err != nil {
+		spec, err := ParseSpec(body)
+		if err != nil {
+			return nil, err
+		}
+		return trimToPaths(spec), nil
+	}
+	if len(doc.Paths) == 0 {
+		return nil, NewError(ExitOpenAPIParse, "OpenAPI spec is missing a valid 'paths' object")
+	}
+	paths := make(map[string]any, len(doc.Paths))
+	for template, item := range doc.Paths {
+		paths[template] = item.toMap()
+	}
+	spec := map[string]any{"paths": paths}
+	if doc.Info != nil {
+		spec["info"] = map[string]any{"title": doc.Info.Title, "version": doc.Info.Version}
+	}
+	components := map[string]any{}
+	if doc.Components.Parameters != nil {
+		components["parameters"] = doc.Components.Parameters
+	}
+	if doc.Components.PathItems != nil {
+		components["pathItems"] = doc.Components.PathItems
+	}
+	if len(components) > 0 {
+		spec["components"] = components
+	}
+	if doc.Parameters != nil {
+		spec["parameters"] = doc.Parameters
+	}
+	return spec, nil
+}
+
+// trimToPaths reduces a fully decoded spec to the paths view.
+func trimToPaths(full map[string]any) map[string]any {
+	spec := map[string]any{}
+	if paths, ok := AsMap(full["paths"]); ok {
+		trimmed := make(map[string]any, len(paths))
+		for template, itemAny := range paths {
+			item, ok := AsMap(itemAny)
+			if !ok {
+				continue
+			}
+			out := map[string]any{}
+			for key, v := range item {
+				if _, isMethod := openapiMethods[strings.ToLower(key)]; !isMethod {
+					if key == "$ref" || key == "parameters" || key == "servers" {
+						out[key] = v
+					}
+					continue
+				}
+				op, ok := AsMap(v)
+				if !ok {
+					continue
+				}
+				lean := map[string]any{}
+				for _, field := range []string{"operationId", "summary", "description", "tags", "parameters", "servers", "deprecated"} {
+					if fv, ok := op[field]; ok {
+						lean[field] = fv
+					}
+				}
+				out[key] = lean
+			}
+			trimmed[template] = out
+		}
+		spec["paths"] = trimmed
+	}
+	if components, ok := AsMap(full["components"]); ok {
+		kept := map[string]any{}
+		for _, key := range []string{"parameters", "pathItems"} {
+			if v, ok := components[key]; ok {
+				kept[key] = v
+			}
+		}
+		spec["components"] = kept
+	}
+	if params, ok := full["parameters"]; ok {
+		spec["parameters"] = params
+	}
+	if info, ok := AsMap(full["info"]); ok {
+		spec["info"] = map[string]any{"title": info["title"], "version": info["version"]}
+	}
+	return spec
+}
+
+// LoadSpecPaths is LoadSpec returning the paths view: the full document
+// is still cached, so LoadCachedSpec and later LoadSpec calls see it all.
+func LoadSpecPaths(ctx context.Context, cfg *Config) (map[string]any, error) {
+	return loadSpec(ctx, cfg, ParseSpecPaths, true)
+}
+
+// LoadFreshSpecPaths is LoadSpecPaths without the fallback on the cache,
+// for callers that report on the spec the server publishes now.
+func LoadFreshSpecPaths(ctx context.Context, cfg *Config) (map[string]any, error) {
+	return loadSpec(ctx, cfg, ParseSpecPaths, false)
+}
+
+// LoadCachedSpecPaths is LoadCachedSpec returning the paths view.
+func LoadCachedSpecPaths(cfg *Config) (map[string]any, error) {
+	body, err := readCachedSpec(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpecPaths(body)
+}
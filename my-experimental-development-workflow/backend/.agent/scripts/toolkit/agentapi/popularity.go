@@ -0,0 +1,139 @@
+package agentapi
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Call is one request a project made, as a method and a concrete path.
+type Call struct {
+	Method string
+	Path   string
+	Time   time.Time
+	Failed bool
+}
+
+// OperationUsage is how often one operation was called.
+type OperationUsage struct {
+	Operation
+	Calls    int
+	Failures int
+	Last     time.Time
+}
+
+// maxUsageBonus caps what popularity adds to a search score: about one
+// field match, so it orders close results without outranking relevance.
+const maxUsageBonus = 8
+
+// UsageBonus is the search score added for an operation called n times:
+// 2 per doubling of the count, up to maxUsageBonus.
+func UsageBonus(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return min(2*bits.Len(uint(n)), maxUsageBonus)
+}
+
+// CountCalls tallies calls by the operation of ops serving them, most
+// called first. Calls no operation serves are counted under an Operation
+// with only the method and the concrete path, so they are not lost.
+func CountCalls(ops []Operation, calls []Call) []OperationUsage {
+	type key struct{ method, path string }
+	byKey := map[key]*OperationUsage{}
+	// A history repeats the same few paths: match each once.
+	served := map[key]Operation{}
+	for _, c := range calls {
+		ck := key{strings.ToUpper(c.Method), c.Path}
+		op, seen := served[ck]
+		if !seen {
+			var ok bool
+			if op, ok = operationServing(ops, ck.method, ck.path); !ok {
+				op = Operation{Method: ck.method, Path: ck.path}
+			}
+			served[ck] = op
+		}
+		k := key{op.Method, op.Path}
+		u := byKey[k]
+		if u == nil {
+			u = &OperationUsage{Operation: op}
+			byKey[k] = u
+		}
+		u.Calls++
+		if c.Failed {
+			u.Failures++
+		}
+		if c.Time.After(u.Last) {
+			u.Last = c.Time
+		}
+	}
+	out := make([]OperationUsage, 0, len(byKey))
+	for _, u := range byKey {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Calls != out[j].Calls {
+			return out[i].Calls > out[j].Calls
+		}
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// BoostByUsage raises the Score of search results by the UsageBonus of
+// their successful calls and re-sorts them, so the operations a project
+// actually uses come first among comparable matches.
+func BoostByUsage(ops []Operation, calls []Call) []Operation {
+	ok := make([]Call, 0, len(calls))
+	for _, c := range calls {
+		if !c.Failed {
+			ok = append(ok, c)
+		}
+	}
+	counts := map[string]int{}
+	for _, u := range CountCalls(ops, ok) {
+		counts[u.Method+" "+u.Path] = u.Calls
+	}
+	out := make([]Operation, len(ops))
+	for i, op := range ops {
+		op.Score += UsageBonus(counts[op.Method+" "+op.Path])
+		out[i] = op
+	}
+	sortByScore(out)
+	return out
+}
+
+// operationServing finds the operation of ops for a method and concrete
+// path, preferring the template with the most literal segments
+// (/users/me over /users/{id}).
+func operationServing(ops []Operation, method, path string) (Operation, bool) {
+	method = strings.ToUpper(method)
+	segs := NormalizeSegments(path)
+	best, bestLiterals := -1, -1
+	for i, op := range ops {
+		if op.Method != method {
+			continue
+		}
+		tmpl := NormalizeSegments(op.Path)
+		if len(tmpl) != len(segs) || !segmentsFit(tmpl, segs) {
+			continue
+		}
+		literals := 0
+		for _, t := range tmpl {
+			if !isTemplateSegment(t) {
+				literals++
+			}
+		}
+		if literals > bestLiterals {
+			best, bestLiterals = i, literals
+		}
+	}
+	if best < 0 {
+		return Operation{}, false
+	}
+	return ops[best], true
+}
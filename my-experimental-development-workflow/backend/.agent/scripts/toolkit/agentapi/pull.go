@@ -0,0 +1,133 @@
+package agentapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPullConcurrency bounds PullSpecs when the caller passes no limit.
+const DefaultPullConcurrency = 4
+
+// SpecPull is the outcome of refreshing one env's spec with PullSpecs.
+type SpecPull struct {
+	Config     *Config
+	Operations int
+	Bytes      int
+	Duration   time.Duration
+	Err        error
+}
+
+// PullSpecs fetches the spec of every cfg concurrently, at most concurrency
+// at a time, and refreshes their caches. Envs sharing an openapi_url fetch
+// it once. With force, the fetches also ask any HTTP cache on the way (a
+// CDN, a proxy) to revalidate with the server rather than answer with the
+// copy it holds. Results keep the order of cfgs; see PullError to
+// aggregate the failures.
+func PullSpecs(ctx context.Context, cfgs []*Config, concurrency int, force bool) []SpecPull {
+	if concurrency <= 0 {
+		concurrency = DefaultPullConcurrency
+	}
+	if force {
+		ctx = context.WithValue(ctx, noCacheKey{}, true)
+	}
+	out := make([]SpecPull, len(cfgs))
+	byURL := make(map[string][]int)
+	urls := make([]string, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		out[i].Config = cfg
+		if _, ok := byURL[cfg.OpenAPIURL]; !ok {
+			urls = append(urls, cfg.OpenAPIURL)
+		}
+		byURL[cfg.OpenAPIURL] = append(byURL[cfg.OpenAPIURL], i)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			start := time.Now()
+			body, ops, err := pullOne(ctx, sem, u)
+			for _, i := range byURL[u] {
+				p := &out[i]
+				p.Duration, p.Err = time.Since(start), err
+				if err != nil {
+					continue
+				}
+				p.Bytes, p.Operations = len(body), ops
+				if err := storeSpec(p.Config, body); err != nil {
+					p.Err = WrapError(ExitUnexpected, fmt.Sprintf("Failed to cache spec at %s: %v", SpecCachePath(p.Config), err), err)
+				}
+			}
+		}(u)
+	}
+	wg.Wait()
+	return out
+}
+
+// pullOne fetches and parses one spec once a slot in sem is free.
+func pullOne(ctx context.Context, sem chan struct{}, openapiURL string) ([]byte, int, error) {
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return nil, 0, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: OpenAPI fetch from %s cancelled", openapiURL), ctx.Err())
+	}
+	body, err := fetchSpecBody(ctx, openapiURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	spec, err := ParseSpecPaths(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, len(NewDocument(spec).operations), nil
+}
+
+// PullError aggregates the failures of pulls into one error, nil when all
+// succeeded. Its code is ExitInterrupted if any pull was cancelled, the
+// shared code when all failures agree, else ExitOpenAPIFetch; every
+// failure stays reachable through errors.Is/As.
+func PullError(pulls []SpecPull) error {
+	envs := make([]string, len(pulls))
+	errs := make([]error, len(pulls))
+	for i, p := range pulls {
+		envs[i], errs[i] = p.Config.ActiveEnv, p.Err
+	}
+	return envError("spec pulls", envs, errs)
+}
+
+// envError combines the non-nil errs of a per-env operation; what names
+// it in the message ("3 of 4 spec pulls failed: ...").
+func envError(what string, envs []string, errs []error) error {
+	failed := make([]string, 0)
+	causes := make([]error, 0)
+	code := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s", envs[i], ExitMessage(err)))
+		causes = append(causes, err)
+		switch c := ExitCode(err); {
+		case code == ExitInterrupted:
+		case c == ExitInterrupted, code == 0:
+			code = c
+		case c != code:
+			code = ExitOpenAPIFetch
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	e := &Error{Code: code, Message: fmt.Sprintf("%d of %d %s failed: %s", len(failed), len(errs), what, strings.Join(failed, "; ")), Cause: errors.Join(causes...)}
+	if len(causes) == 1 {
+		e.Suggestion = Suggestion(causes[0])
+	}
+	return e
+}
@@ -0,0 +1,123 @@
+package agentapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SpecMatch is an operation found by SearchSpecs with the env whose spec
+// it came from. Relevance is its score relative to the best match in that
+// spec (1 for the best), so ranks from specs of different sizes and
+// vocabularies compare.
+type SpecMatch struct {
+	Operation
+	Env       string  `json:"env"`
+	Relevance float64 `json:"relevance"`
+}
+
+// SpecSearch is the outcome of searching one env's spec with SearchSpecs.
+type SpecSearch struct {
+	Config   *Config
+	Matches  int
+	Duration time.Duration
+	Err      error
+}
+
+// SearchSpecs loads the paths view of every cfg's spec and ranks its
+// operations against query, at most concurrency specs at a time, so the
+// total takes about as long as the slowest spec. Matches of all specs are
+// merged by Relevance; ties go to the better rank within its own spec and
+// then to the order of cfgs, which interleaves the specs' results. The
+// searches keep the order of cfgs; see SearchError to aggregate failures.
+func SearchSpecs(ctx context.Context, cfgs []*Config, query, methodFilter string, concurrency int) ([]SpecMatch, []SpecSearch) {
+	if concurrency <= 0 {
+		concurrency = DefaultPullConcurrency
+	}
+	searches := make([]SpecSearch, len(cfgs))
+	found := make([][]Operation, len(cfgs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, cfg := range cfgs {
+		searches[i].Config = cfg
+		wg.Add(1)
+		go func(i int, cfg *Config) {
+			defer wg.Done()
+			start := time.Now()
+			found[i], searches[i].Err = searchOne(ctx, sem, cfg, query, methodFilter)
+			searches[i].Matches, searches[i].Duration = len(found[i]), time.Since(start)
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	type ranked struct {
+		SpecMatch
+		rank, spec int
+	}
+	all := make([]ranked, 0)
+	for i, ops := range found {
+		for rank, op := range ops {
+			// SearchOperations sorts best first, so ops[0] holds the top score.
+			rel := float64(op.Score) / float64(ops[0].Score)
+			all = append(all, ranked{SpecMatch{Operation: op, Env: cfgs[i].ActiveEnv, Relevance: rel}, rank, i})
+		}
+	}
+	sort.SliceStable(all, func(a, b int) bool {
+		if all[a].Relevance != all[b].Relevance {
+			return all[a].Relevance > all[b].Relevance
+		}
+		if all[a].rank != all[b].rank {
+			return all[a].rank < all[b].rank
+		}
+		return all[a].spec < all[b].spec
+	})
+	out := make([]SpecMatch, len(all))
+	for i, r := range all {
+		out[i] = r.SpecMatch
+	}
+	return out, searches
+}
+
+// searchOne searches one env's spec once a slot in sem is free.
+func searchOne(ctx context.Context, sem chan struct{}, cfg *Config, query, methodFilter string) ([]Operation, error) {
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return nil, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: search of %s cancelled", cfg.ActiveEnv), ctx.Err())
+	}
+	spec, err := LoadSpecPaths(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return FindOperations(spec, query, methodFilter), nil
+}
+
+// SearchError aggregates the failures of searches like PullError.
+func SearchError(searches []SpecSearch) error {
+	envs := make([]string, len(searches))
+	errs := make([]error, len(searches))
+	for i, s := range searches {
+		envs[i], errs[i] = s.Config.ActiveEnv, s.Err
+	}
+	return envError("spec searches", envs, errs)
+}
+
+// DefaultSearchLimit is how many matches `api find` prints unless --limit
+// says otherwise.
+const DefaultSearchLimit = 20
+
+// Page returns the page of items starting at offset, at most limit long
+// (everything from offset when limit <= 0), and how many items follow it.
+func Page[T any](items []T, offset, limit int) ([]T, int) {
+	if offset >= len(items) {
+		return items[:0], 0
+	}
+	items = items[max(offset, 0):]
+	if limit <= 0 || limit >= len(items) {
+		return items, 0
+	}
+	return items[:limit], len(items) - limit
+}
@@ -0,0 +1,75 @@
+package agentapi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// syntheticSpec builds an OpenAPI document of n operations over n/2 paths
+// (a GET and a POST each) with operationIds, summaries, descriptions and
+// tags drawn from small vocabularies, so queries match a spread of them.
+func syntheticSpec(n int) map[string]any {
+	resources := []string{"users", "orders", "invoices", "activities", "payments", "shipments", "reports", "accounts", "sessions", "webhooks"}
+	actions := []string{"archive", "approve", "export", "history", "status", "summary", "notes", "audit"}
+	paths := map[string]any{}
+	for i := 0; i < n/2; i++ {
+		res := resources[i%len(resources)]
+		act := actions[(i/len(resources))%len(actions)]
+		path := fmt.Sprintf("/v%d/%s/{id}/%s/%d", i%3+1, res, act, i)
+		op := func(verb string) map[string]any {
+			return map[string]any{
+				"operationId": fmt.Sprintf("%s%s%s%d", verb, res, act, i),
+				"summary":     fmt.Sprintf("%s the %s %s of a %s", verb, act, res, res),
+				"description": fmt.Sprintf("Returns or changes the %s of one of the %s, entry %d.", act, res, i),
+				"tags":        []any{res},
+			}
+		}
+		paths[path] = map[string]any{"get": op("get"), "post": op("create")}
+	}
+	return map[string]any{"openapi": "3.0.0", "info": map[string]any{"title": "synthetic", "version": "1"}, "paths": paths}
+}
+
+var searchQueries = []string{"users", "invoice history", "approve payments", "audit", "ship", "nothing-matches-this"}
+
+func TestSearchIndexMatchesScan(t *testing.T) {
+	spec := syntheticSpec(500)
+	ix := NewSpecIndex(spec)
+	for _, q := range searchQueries {
+		for _, method := range []string{"", "POST"} {
+			want := SearchOperations(ix.Operations, q, method)
+			got := ix.Search(q, method)
+			if len(want) == 0 && len(got) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Search(%q, %q): index returned %d results, scan %d, or a different order", q, method, len(got), len(want))
+			}
+		}
+	}
+}
+
+// BenchmarkSearch compares the linear scan (SearchOperations) with the
+// token index (SpecIndex.Search) on a 5k-operation spec. The index is
+// built before the timer starts, as a long-lived caller (serve, daemon)
+// builds it once.
+func BenchmarkSearch(b *testing.B) {
+	spec := syntheticSpec(5000)
+	ix := NewSpecIndex(spec)
+	ix.Search("warm", "")
+	if len(ix.Operations) != 5000 {
+		b.Fatalf("synthetic spec has %d operations, want 5000", len(ix.Operations))
+	}
+	for _, q := range searchQueries {
+		b.Run("scan/"+q, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				SearchOperations(ix.Operations, q, "")
+			}
+		})
+		b.Run("index/"+q, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ix.Search(q, "")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package agentapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SessionEnv names the environment variable holding the session id, so
+// agents sharing one config each mark their data with their own id.
+const SessionEnv = "AGENT_API_SESSION"
+
+// SessionPlaceholder in agent_marker is replaced by the session id, as in
+// agent_marker = "[agent-test:{session}]".
+const SessionPlaceholder = "{session}"
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// MarkerSessions returns the session ids of the markers made from template
+// that appear in text, in order of appearance: whose data a body or a
+// record is. A template without the placeholder yields none.
+func MarkerSessions(template, text string) []string {
+	before, after, ok := strings.Cut(template, SessionPlaceholder)
+	if !ok {
+		return nil
+	}
+	re := regexp.MustCompile(regexp.QuoteMeta(before) + `([A-Za-z0-9._-]{1,64})` + regexp.QuoteMeta(strings.ReplaceAll(after, SessionPlaceholder, "")))
+	out := make([]string, 0)
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		out = append(out, m[1])
+	}
+	return out
+}
+
+// SessionFile holds the session id used when SessionEnv is unset.
+func SessionFile(configDir string) string {
+	return filepath.Join(configDir, "state", "session")
+}
+
+// NewSessionID returns a fresh session id such as session-8f2a1c.
+func NewSessionID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return "session-" + hex.EncodeToString(b)
+}
+
+// ValidSessionID reports whether id may be embedded in a marker: 1 to 64
+// letters, digits, '.', '_' or '-'.
+func ValidSessionID(id string) bool {
+	return sessionIDPattern.MatchString(id)
+}
+
+// ResolveSession returns the session id: SessionEnv when set, otherwise the
+// id stored in SessionFile, which is generated on first use. Processes
+// starting together agree on one id: the first to take the file's lock
+// writes it, the others read it.
+func ResolveSession(configDir string) (string, error) {
+	if id, ok := os.LookupEnv(SessionEnv); ok {
+		id = strings.TrimSpace(id)
+		if !ValidSessionID(id) {
+			return "", NewErrorHint(ExitConfig, fmt.Sprintf("Invalid %s %q", SessionEnv, id), "Use 1 to 64 letters, digits, '.', '_' or '-', e.g. session-8f2a1c.")
+		}
+		return id, nil
+	}
+	path := SessionFile(configDir)
+	if id, ok := readSession(path); ok {
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", WrapError(ExitConfig, fmt.Sprintf("Failed to store the session id in %s: %v", path, err), err)
+	}
+	unlock, err := LockFile(path)
+	if err != nil {
+		return "", WrapError(ExitConfig, fmt.Sprintf("Failed to store the session id in %s: %v", path, err), err)
+	}
+	defer unlock()
+	if id, ok := readSession(path); ok {
+		// Another process created it while we waited: use its id.
+		return id, nil
+	}
+	id := NewSessionID()
+	if err := WriteFileAtomic(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", WrapError(ExitConfig, fmt.Sprintf("Failed to store the session id in %s: %v", path, err), err)
+	}
+	return id, nil
+}
+
+func readSession(path string) (string, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil || !ValidSessionID(strings.TrimSpace(string(raw))) {
+		return "", false
+	}
+	return strings.TrimSpace(string(raw)), true
+}
+
+// WriteSession stores id in SessionFile. Without replace, an existing file
+// is left alone and the error wraps os.ErrExist.
+func WriteSession(configDir string, id string, replace bool) error {
+	path := SessionFile(configDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	unlock, err := LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(path); err == nil && !replace {
+		return &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+	}
+	return WriteFileAtomic(path, []byte(id+"\n"), 0o600)
+}
@@ -0,0 +1,452 @@
+package agentapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FetchSpec downloads and parses an OpenAPI document (JSON or YAML).
+func FetchSpec(ctx context.Context, openapiURL string) (map[string]any, error) {
+	body, err := fetchSpecBody(ctx, openapiURL)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(body)
+}
+
+// LoadSpec fetches the spec of the active env and refreshes its local
+// cache, which offline helpers such as shell completion read from. When
+// the spec is only temporarily unavailable (ExitSpecUnavailable) it falls
+// back on that cache, with a warning; a spec that fails to parse is never
+// replaced by it.
+func LoadSpec(ctx context.Context, cfg *Config) (map[string]any, error) {
+	return loadSpec(ctx, cfg, ParseSpec, true)
+}
+
+func loadSpec(ctx context.Context, cfg *Config, parse func([]byte) (map[string]any, error), stale bool) (map[string]any, error) {
+	body, err := fetchSpecBody(ctx, cfg.OpenAPIURL)
+	if err != nil {
+		if stale && ExitCode(err) == ExitSpecUnavailable {
+			return loadStaleSpec(cfg, parse, err)
+		}
+		return nil, err
+	}
+	spec, err := parse(body)
+	if err != nil {
+		return nil, err
+	}
+	_ = storeSpec(cfg, body)
+	return spec, nil
+}
+
+// loadStaleSpec parses the cached spec in place of one that could not be
+// fetched, returning fetchErr when there is none.
+func loadStaleSpec(cfg *Config, parse func([]byte) (map[string]any, error), fetchErr error) (map[string]any, error) {
+	info, statErr := os.Stat(SpecCachePath(cfg))
+	body, err := readCachedSpec(cfg)
+	if err != nil || statErr != nil {
+		return nil, fetchErr
+	}
+	spec, err := parse(body)
+	if err != nil {
+		return nil, fetchErr
+	}
+	Logger.Warn("OpenAPI spec temporarily unavailable, using the stale cache", "env", cfg.ActiveProject+"/"+cfg.ActiveEnv, "cached", info.ModTime().Format(time.RFC3339), "error", ExitMessage(fetchErr))
+	staleSpecs.add(StaleSpec{Project: cfg.ActiveProject, Env: cfg.ActiveEnv, CachedAt: info.ModTime(), Err: ExitMessage(fetchErr)})
+	return spec, nil
+}
+
+// StaleSpec is a spec LoadSpec served from the cache because it could not
+// be fetched: whatever was built from it may be outdated.
+type StaleSpec struct {
+	Project, Env string
+	// CachedAt is when the cache was last refreshed.
+	CachedAt time.Time
+	// Err is why the fetch failed.
+	Err string
+}
+
+var staleSpecs staleSpecLog
+
+type staleSpecLog struct {
+	mu   sync.Mutex
+	list []StaleSpec
+}
+
+func (l *staleSpecLog) add(s StaleSpec) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, seen := range l.list {
+		if seen.Project == s.Project && seen.Env == s.Env {
+			return
+		}
+	}
+	l.list = append(l.list, s)
+}
+
+// StaleSpecs returns the specs this process has served from a stale cache,
+// one per env, in the order it first did.
+func StaleSpecs() []StaleSpec {
+	staleSpecs.mu.Lock()
+	defer staleSpecs.mu.Unlock()
+	return append([]StaleSpec(nil), staleSpecs.list...)
+}
+
+// storeSpec writes a fetched spec body to cfg's cache.
+func storeSpec(cfg *Config, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(SpecCachePath(cfg)), 0o755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(SpecCachePath(cfg), body, 0o644)
+}
+
+// LoadCachedSpec reads the spec last stored by LoadSpec without
+// touching the network.
+func LoadCachedSpec(cfg *Config) (map[string]any, error) {
+	body, err := readCachedSpec(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(body)
+}
+
+func readCachedSpec(cfg *Config) ([]byte, error) {
+	body, err := os.ReadFile(SpecCachePath(cfg))
+	if err != nil {
+		return nil, &Error{Code: ExitOpenAPIFetch, Message: fmt.Sprintf("No cached OpenAPI spec for %s/%s", cfg.ActiveProject, cfg.ActiveEnv), Suggestion: "Run any online command once (e.g. api find <keywords>) to cache the spec.", Cause: err}
+	}
+	return body, nil
+}
+
+// SpecCachePath is where LoadSpec stores the spec of cfg's env.
+func SpecCachePath(cfg *Config) string {
+	return filepath.Join(cfg.ConfigDir, "cache", fmt.Sprintf("openapi-%s-%s.json", SafeFileName(cfg.ActiveProject), SafeFileName(cfg.ActiveEnv)))
+}
+
+// noCacheKey marks a context whose spec fetches must not be answered from
+// an HTTP cache (PullSpecs with force).
+type noCacheKey struct{}
+
+// Spec fetches make specFetchAttempts attempts in all when they fail with
+// ExitSpecUnavailable, waiting specRetryDelay, then twice as long, or
+// what Retry-After asks up to specRetryMaxDelay.
+const (
+	specFetchAttempts = 3
+	specRetryDelay    = 500 * time.Millisecond
+	specRetryMaxDelay = 5 * time.Second
+)
+
+// transientSpecStatus are the statuses of a spec server that is briefly
+// overloaded, restarting or behind a gateway that is.
+var transientSpecStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+func fetchSpecBody(ctx context.Context, openapiURL string) ([]byte, error) {
+	start := time.Now()
+	ctx, endSpan := StartSpan(ctx, "spec fetch", "url.full", openapiURL)
+	var body []byte
+	var err error
+	delay := specRetryDelay
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		body, retryAfter, err = doFetchSpecBody(ctx, openapiURL)
+		if err == nil || ExitCode(err) != ExitSpecUnavailable {
+			break
+		}
+		if attempt == specFetchAttempts {
+			err = &Error{Code: ExitSpecUnavailable, Message: fmt.Sprintf("OpenAPI spec temporarily unavailable (%d attempts): %s", attempt, strings.TrimPrefix(ExitMessage(err), "Failed to fetch OpenAPI spec: ")), Suggestion: Suggestion(err), Cause: err}
+			break
+		}
+		wait := delay
+		if retryAfter > 0 {
+			wait = min(retryAfter, specRetryMaxDelay)
+		}
+		Logger.Debug("openapi fetch retry", "url", openapiURL, "attempt", attempt, "wait_ms", wait.Milliseconds(), "error", ExitMessage(err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			err = WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: OpenAPI fetch from %s cancelled", openapiURL), ctx.Err())
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay *= 2
+	}
+	endSpan(err, "http.response.body.size", len(body))
+	if err != nil {
+		Logger.Debug("openapi fetch failed", "url", openapiURL, "error", ExitMessage(err))
+		return nil, err
+	}
+	Logger.Debug("openapi fetched", "url", openapiURL, "bytes", len(body), "duration_ms", time.Since(start).Milliseconds())
+	return body, nil
+}
+
+// doFetchSpecBody makes one attempt; a failure worth retrying has code
+// ExitSpecUnavailable, with the wait a Retry-After header asks for.
+func doFetchSpecBody(ctx context.Context, openapiURL string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, openapiURL, nil)
+	if err != nil {
+		return nil, 0, &Error{Code: ExitOpenAPIFetch, Message: fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err), Suggestion: "Fix openapi_url in config.toml: it must be an absolute http(s) URL.", Cause: err}
+	}
+	req.Header.Set("Accept", "application/json")
+	if tp := TraceParent(ctx); tp != "" {
+		req.Header.Set("traceparent", tp)
+	}
+	if ctx.Value(noCacheKey{}) != nil {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	}
+
+	resp, err := NewDoer(30 * time.Second).Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: OpenAPI fetch from %s cancelled", openapiURL), err)
+		}
+		return nil, 0, &Error{Code: ExitSpecUnavailable, Message: fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err), Suggestion: fmt.Sprintf("Check that %s is reachable (VPN, tunnel, server running); api health probes every env.", openapiURL), Cause: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, WrapError(ExitInterrupted, fmt.Sprintf("Interrupted: OpenAPI fetch from %s cancelled after %d bytes", openapiURL, len(body)), err)
+		}
+		return nil, 0, WrapError(ExitSpecUnavailable, fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err), err)
+	}
+	if transientSpecStatus[resp.StatusCode] {
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get("Retry-After"))); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, retryAfter, NewErrorHint(ExitSpecUnavailable, fmt.Sprintf("Failed to fetch OpenAPI spec: HTTP %d", resp.StatusCode), fmt.Sprintf("The server of %s is overloaded or restarting; retry in a moment.", openapiURL))
+	}
+	if resp.StatusCode >= 400 {
+		return nil, 0, NewErrorHint(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch OpenAPI spec: HTTP %d", resp.StatusCode), fmt.Sprintf("Check that openapi_url (%s) points at the spec document and needs no auth.", openapiURL))
+	}
+	return body, 0, nil
+}
+
+// ParseSpec decodes an OpenAPI document and checks it has paths.
+func ParseSpec(body []byte) (map[string]any, error) {
+	var spec map[string]any
+	if err := json.Unmarshal(body, &spec); err != nil {
+		if errY := yaml.Unmarshal(body, &spec); errY != nil {
+			return nil, WrapError(ExitOpenAPIParse, fmt.Sprintf("Failed to parse OpenAPI spec as JSON/YAML: %v", errY), errY)
+		}
+	}
+	paths, ok := AsMap(spec["paths"])
+	if !ok || len(paths) == 0 {
+		return nil, NewError(ExitOpenAPIParse, "OpenAPI spec is missing a valid 'paths' object")
+	}
+	rememberSpecHash(spec, body)
+	return spec, nil
+}
+
+// specHashes remembers the document hash of the specs ParseSpec decoded
+// most recently, like docCache.
+var specHashes struct {
+	sync.Mutex
+	entries []specHash
+}
+
+type specHash struct {
+	spec map[string]any
+	hash string
+}
+
+func rememberSpecHash(spec map[string]any, body []byte) {
+	sum := sha256.Sum256(body)
+	specHashes.Lock()
+	defer specHashes.Unlock()
+	specHashes.entries = append([]specHash{{spec, hex.EncodeToString(sum[:])}}, specHashes.entries...)
+	if len(specHashes.entries) > docCacheSize {
+		specHashes.entries = specHashes.entries[:docCacheSize]
+	}
+}
+
+// SpecHash returns the sha256 (hex) of the document spec was decoded from
+// by a recent ParseSpec or LoadSpec, or "" when unknown (including for
+// the paths view). Caches derived from a spec are keyed by it.
+func SpecHash(spec map[string]any) string {
+	key := reflect.ValueOf(spec).UnsafePointer()
+	specHashes.Lock()
+	defer specHashes.Unlock()
+	for _, e := range specHashes.entries {
+		if reflect.ValueOf(e.spec).UnsafePointer() == key {
+			return e.hash
+		}
+	}
+	return ""
+}
+
+// Operation is one method of one path of a spec.
+type Operation struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	OperationID string   `json:"operation_id"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Parameters are merged from the path item and the operation, with
+	// $refs resolved.
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Servers are the operation's own servers, else its path item's, with
+	// variables set to their defaults; empty when the root servers apply.
+	Servers []string       `json:"servers,omitempty"`
+	Raw     map[string]any `json:"raw,omitempty"`
+	Score   int            `json:"-"`
+}
+
+// IterOperations lists every operation of a spec, sorted by path and
+// method.
+func IterOperations(spec map[string]any) []Operation {
+	return documentFor(spec).Operations()
+}
+
+// TermVariants returns the singular/plural spellings matched for a search
+// term.
+func TermVariants(term string) []string {
+	variants := map[string]struct{}{term: {}}
+	if strings.HasSuffix(term, "y") && len(term) > 1 {
+		variants[term[:len(term)-1]+"ies"] = struct{}{}
+	}
+	if strings.HasSuffix(term, "ies") && len(term) > 3 {
+		variants[term[:len(term)-3]+"y"] = struct{}{}
+	}
+	if !strings.HasSuffix(term, "s") {
+		variants[term+"s"] = struct{}{}
+	}
+	out := make([]string, 0, len(variants))
+	for v := range variants {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func scoreOperation(op Operation, query string) int {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return 0
+	}
+	hay := []string{
+		strings.ToLower(op.Path),
+		strings.ToLower(op.OperationID),
+		strings.ToLower(op.Summary),
+		strings.ToLower(op.Description),
+		strings.ToLower(strings.Join(op.Tags, " ")),
+	}
+	score := 0
+	for _, term := range terms {
+		vars := TermVariants(term)
+		for i, h := range hay {
+			for _, v := range vars {
+				if strings.Contains(h, v) {
+					score += 10 - min(i, 4)
+					break
+				}
+			}
+		}
+	}
+	return score
+}
+
+// FindOperations ranks the operations of spec against query by scanning
+// them, the cheapest way to run a single search; callers searching
+// repeatedly should keep a SpecIndex.
+func FindOperations(spec map[string]any, query string, methodFilter string) []Operation {
+	return SearchOperations(IterOperations(spec), query, methodFilter)
+}
+
+// SearchOperations ranks an already extracted operation list by scanning
+// it, so callers that keep the list in memory skip re-walking the spec.
+func SearchOperations(ops []Operation, query string, methodFilter string) []Operation {
+	methodFilter = strings.ToUpper(strings.TrimSpace(methodFilter))
+	out := make([]Operation, 0)
+	for _, op := range ops {
+		if methodFilter != "" && op.Method != methodFilter {
+			continue
+		}
+		score := scoreOperation(op, query)
+		if score > 0 {
+			op.Score = score
+			out = append(out, op)
+		}
+	}
+	sortByScore(out)
+	return out
+}
+
+// sortByScore orders search results best first, then by path and method.
+func sortByScore(out []Operation) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+}
+
+// FindOperationByRef resolves an operationId or "METHOD /path".
+func FindOperationByRef(spec map[string]any, ref string) (*Operation, error) {
+	return documentFor(spec).Lookup(ref)
+}
+
+// OperationsForPath returns the operations serving a concrete request path
+// (query string allowed), one per method.
+func OperationsForPath(spec map[string]any, pathWithQuery string) []*Operation {
+	path, _, _ := strings.Cut(pathWithQuery, "?")
+	return documentFor(spec).MatchAll(path)
+}
+
+// SpecIndex is a parsed spec with its typed Document built once, for
+// callers that search or validate repeatedly.
+type SpecIndex struct {
+	Spec       map[string]any
+	Doc        *Document
+	Operations []Operation
+}
+
+func NewSpecIndex(spec map[string]any) *SpecIndex {
+	doc := NewDocument(spec)
+	return &SpecIndex{Spec: spec, Doc: doc, Operations: doc.Operations()}
+}
+
+// Search ranks operations against query, optionally for one method, with
+// the same results as SearchOperations but through Doc's token index.
+func (ix *SpecIndex) Search(query, method string) []Operation {
+	return ix.Doc.Search(query, method)
+}
+
+// Find resolves an operationId or "METHOD /path".
+func (ix *SpecIndex) Find(ref string) (*Operation, error) {
+	return ix.Doc.Lookup(ref)
+}
+
+// Validate applies strict-mode validation to a request.
+func (ix *SpecIndex) Validate(method, pathWithQuery string) error {
+	return ix.Doc.Validate(method, pathWithQuery)
+}
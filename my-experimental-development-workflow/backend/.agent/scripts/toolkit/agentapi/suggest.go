@@ -0,0 +1,91 @@
+package agentapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSuggestions caps how many near misses DidYouMean names.
+const maxSuggestions = 3
+
+// Closest returns the candidates nearest to s by case-insensitive edit
+// distance (insertions, deletions, substitutions and swaps of adjacent
+// characters), all tied ones in the order of candidates. Nothing is
+// returned when the nearest is further than a third of the longer string
+// (but at least 1), so unrelated names are not offered.
+func Closest(s string, candidates []string) []string {
+	type near struct {
+		name string
+		dist int
+	}
+	src := []rune(strings.ToLower(s))
+	var found []near
+	for _, c := range candidates {
+		if c == s {
+			continue
+		}
+		dst := []rune(strings.ToLower(c))
+		limit := max(1, max(len(src), len(dst))/3)
+		if d := editDistance(src, dst); d <= limit {
+			found = append(found, near{c, d})
+		}
+	}
+	best := -1
+	for _, n := range found {
+		if best < 0 || n.dist < best {
+			best = n.dist
+		}
+	}
+	out := make([]string, 0)
+	for _, n := range found {
+		if n.dist == best {
+			out = append(out, n.name)
+		}
+	}
+	return out
+}
+
+// DidYouMean renders the closest candidates to s as " (did you mean 'a' or
+// 'b'?)", ready to append to an error message, or "" when none is close.
+func DidYouMean(s string, candidates []string) string {
+	names := Closest(s, candidates)
+	if len(names) == 0 {
+		return ""
+	}
+	if len(names) > maxSuggestions {
+		names = names[:maxSuggestions]
+	}
+	for i, n := range names {
+		names[i] = "'" + n + "'"
+	}
+	if len(names) == 1 {
+		return fmt.Sprintf(" (did you mean %s?)", names[0])
+	}
+	return fmt.Sprintf(" (did you mean %s or %s?)", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+// editDistance is the optimal string alignment distance between a and b.
+func editDistance(a, b []rune) int {
+	// Three rows suffice: a swap looks two rows back.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
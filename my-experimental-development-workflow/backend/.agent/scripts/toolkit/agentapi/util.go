@@ -0,0 +1,70 @@
+package agentapi
+
+import "sort"
+
+var (
+	httpMethods = map[string]struct{}{
+		"GET":     {},
+		"POST":    {},
+		"PUT":     {},
+		"PATCH":   {},
+		"DELETE":  {},
+		"HEAD":    {},
+		"OPTIONS": {},
+	}
+	openapiMethods = map[string]struct{}{
+		"get":     {},
+		"post":    {},
+		"put":     {},
+		"patch":   {},
+		"delete":  {},
+		"head":    {},
+		"options": {},
+		"trace":   {},
+	}
+)
+
+// AsMap returns v as a map with string keys. YAML decodes some mappings as
+// map[any]any; their non-string keys are dropped.
+func AsMap(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if ok {
+		return m, true
+	}
+	m2, ok := v.(map[any]any)
+	if !ok {
+		return nil, false
+	}
+	out := make(map[string]any, len(m2))
+	for k, val := range m2 {
+		ks, ok := k.(string)
+		if !ok {
+			continue
+		}
+		out[ks] = val
+	}
+	return out, true
+}
+
+// AsSlice returns v as a slice when it decoded from a JSON or YAML array.
+func AsSlice(v any) ([]any, bool) {
+	s, ok := v.([]any)
+	return s, ok
+}
+
+// AsString returns v when it is a string, else "".
+func AsString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// SortedKeys returns the keys of m in order, for output that does not
+// change from run to run.
+func SortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
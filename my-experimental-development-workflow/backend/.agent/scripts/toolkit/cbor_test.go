@@ -0,0 +1,117 @@
+package main
+
+import "testing"
+
+func TestCBORRoundTrip(t *testing.T) {
+	testRoundTrip(t, cborCodec{}, []codecCase{
+		{name: "null", json: "null"},
+		{name: "true", json: "true"},
+		{name: "false", json: "false"},
+		{name: "immediate uint", json: "23"},
+		{name: "uint8", json: "24"},
+		{name: "uint16", json: "256"},
+		{name: "uint32", json: "65536"},
+		{name: "uint64", json: "4294967296"},
+		{name: "max uint64", json: "18446744073709551615"},
+		{name: "immediate negative", json: "-24"},
+		{name: "negative uint8", json: "-25"},
+		{name: "negative uint16", json: "-257"},
+		{name: "negative uint32", json: "-65537"},
+		{name: "negative uint64", json: "-9223372036854775808"},
+		{name: "float64", json: "1.5"},
+		{name: "large float64", json: "-1e+300"},
+		{name: "integral float", json: "2.0", want: "2"},
+		{name: "empty text", json: `""`},
+		{name: "immediate text", json: jsonStringOf(23)},
+		{name: "text8", json: jsonStringOf(24)},
+		{name: "text16", json: jsonStringOf(256)},
+		{name: "text32", json: jsonStringOf(65536)},
+		{name: "utf-8", json: `"héllo ✓"`},
+		{name: "empty array", json: "[]"},
+		{name: "immediate array", json: jsonArrayOf(23)},
+		{name: "array8", json: jsonArrayOf(24)},
+		{name: "array32", json: jsonArrayOf(65536)},
+		{name: "empty map", json: "{}"},
+		{name: "immediate map", json: jsonObjectOf(23)},
+		{name: "map8", json: jsonObjectOf(24)},
+		{name: "map32", json: jsonObjectOf(65536)},
+		{name: "mixed", json: `{"a":[1,-1,1.5,"s",null,true,{"b":[]}],"c":{}}`},
+	})
+}
+
+func TestCBORDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{"byte string", []byte{0x43, 1, 2, 3}, `"AQID"`},
+		{"half float", []byte{0xf9, 0x3e, 0x00}, `1.5`},
+		{"half float infinity", []byte{0xf9, 0x7c, 0x00}, `"Infinity"`},
+		{"half float subnormal", []byte{0xf9, 0x00, 0x01}, `5.960464477539063e-8`},
+		{"float32", []byte{0xfa, 0x3f, 0xc0, 0, 0}, `1.5`},
+		{"undefined", []byte{0xf7}, `null`},
+		{"simple value", []byte{0xf0}, `16`},
+		{"epoch tag", []byte{0xc1, 0x1a, 0, 0, 0, 60}, `60`},
+		{"bignum", []byte{0xc2, 0x42, 0x01, 0x00}, `"256"`},
+		{"negative bignum", []byte{0xc3, 0x42, 0x01, 0x00}, `"-257"`},
+		{"negative past int64", []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, `"-18446744073709551616"`},
+		{"indefinite array", []byte{0x9f, 0x01, 0x02, 0xff}, `[1,2]`},
+		{"indefinite map", []byte{0xbf, 0x61, 'a', 0x01, 0xff}, `{"a":1}`},
+		{"indefinite text", []byte{0x7f, 0x62, 'a', 'b', 0x61, 'c', 0xff}, `"abc"`},
+		{"indefinite bytes", []byte{0x5f, 0x41, 1, 0x42, 2, 3, 0xff}, `"AQID"`},
+		{"integer key", []byte{0xa1, 0x01, 0x02}, `{"1":2}`},
+	} {
+		got, err := decodeBody(cborCodec{}, tc.body)
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s: % x decoded to %s, %v; want %s", tc.name, tc.body, got, err, tc.want)
+		}
+	}
+}
+
+func TestCBORDecodeErrors(t *testing.T) {
+	testDecodeErrors(t, cborCodec{}, map[string][]byte{
+		"empty":                      {},
+		"lone break":                 {0xff},
+		"reserved info":              {0x1c},
+		"trailing bytes":             {0x01, 0x02},
+		"break in definite array":    {0x81, 0xff},
+		"unterminated indefinite":    {0x9f, 0x01},
+		"text chunk in bytes":        {0x5f, 0x61, 'a', 0xff},
+		"nested indefinite chunk":    {0x7f, 0x7f, 0xff, 0xff},
+		"text8 too long":             {0x78, 0x05, 'a', 'b'},
+		"text64 too long":            {0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"bytes32 too long":           {0x5a, 0xff, 0xff, 0xff, 0xff, 0x00},
+		"array64 too long":           {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"map32 too long":             {0xba, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02},
+		"map short value":            {0xa1, 0x01},
+		"argument truncated":         {0x19, 0x01},
+		"float64 truncated":          {0xfb, 0x3f, 0xf0},
+		"tag without content":        {0xc2},
+		"break as tagged content":    {0x81, 0xc1, 0xff},
+		"break as map value":         {0xa1, 0x01, 0xff},
+		"break as indefinite value":  {0xbf, 0x01, 0xff},
+		"tagged break in indefinite": {0x9f, 0xc1, 0xff, 0xff},
+	})
+	testPrefixesFail(t, cborCodec{}, `{"a":[1,-200,70000,1.5,"str",null,true],"b":{"c":18446744073709551615}}`)
+}
+
+func TestCBORDepthLimit(t *testing.T) {
+	testDepthLimit(t, cborCodec{})
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, json := range []string{`null`, `-1`, `1.5`, `"s"`, `[1,[2]]`, `{"a":{"b":[true,false]}}`, `18446744073709551615`} {
+		b, err := encodeBody(cborCodec{}, "test", json)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(b))
+	}
+	f.Add([]byte{0x9f, 0x01, 0xbf, 0x61, 'a', 0x5f, 0x41, 1, 0xff, 0xff, 0xff})
+	f.Add([]byte{0xc3, 0x42, 0x01, 0x00})
+	f.Add([]byte{0xf9, 0x7c, 0x01})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		fuzzDecode(t, cborCodec{}, body)
+	})
+}
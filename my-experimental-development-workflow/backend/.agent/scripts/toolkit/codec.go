@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bodyCodec converts a body between the JSON acurl reads (-d) and prints
+// and a binary media type. Encode takes a value decoded with UseNumber;
+// Decode returns one that encoding/json can marshal.
+type bodyCodec interface {
+	Encode(v any) ([]byte, error)
+	Decode(body []byte) (any, error)
+}
+
+// codecs builds the codec of a media type from its parameters and the
+// --proto-descriptor files. Self-describing formats ignore both.
+var codecs = map[string]func(params map[string]string, descriptors []string) (bodyCodec, error){
+	"application/msgpack":             selfDescribing(msgpackCodec{}),
+	"application/x-msgpack":           selfDescribing(msgpackCodec{}),
+	"application/vnd.msgpack":         selfDescribing(msgpackCodec{}),
+	"application/cbor":                selfDescribing(cborCodec{}),
+	"application/x-protobuf":          newProtoCodec,
+	"application/protobuf":            newProtoCodec,
+	"application/vnd.google.protobuf": newProtoCodec,
+}
+
+func selfDescribing(c bodyCodec) func(map[string]string, []string) (bodyCodec, error) {
+	return func(map[string]string, []string) (bodyCodec, error) { return c, nil }
+}
+
+// lookupCodec returns the codec of a Content-Type or Accept value, nil
+// when its media type has none (JSON, text, ...).
+func lookupCodec(contentType string, descriptors []string) (bodyCodec, error) {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil
+	}
+	build, ok := codecs[mt]
+	if !ok {
+		return nil, nil
+	}
+	return build(params, descriptors)
+}
+
+// selfDescribingCodec returns the codec of a media type that needs no
+// descriptor, such as msgpack or CBOR; nil for any other.
+func selfDescribingCodec(contentType string) bodyCodec {
+	codec, err := lookupCodec(contentType, nil)
+	if err != nil {
+		return nil
+	}
+	return codec
+}
+
+// responseCodec returns the codec acurl decodes a response with: that of
+// its Content-Type, taking parameters it lacks (the protobuf message) from
+// --accept when that names the same media type.
+func responseCodec(header http.Header, opts *acurlOptions) (bodyCodec, error) {
+	mt, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+	if _, ok := codecs[mt]; !ok {
+		return nil, nil
+	}
+	if amt, aparams, err := mime.ParseMediaType(opts.Accept); err == nil && amt == mt {
+		for k, v := range aparams {
+			if _, ok := params[k]; !ok {
+				params[k] = v
+			}
+		}
+	}
+	return codecs[mt](params, opts.ProtoDescriptors)
+}
+
+// encodeBody converts a JSON body for a codec.
+func encodeBody(codec bodyCodec, contentType, body string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid -d for %s: %v", contentType, err), "Give the body as JSON; it is converted to the media type of --content-type.")
+	}
+	out, err := codec.Encode(v)
+	if err != nil {
+		return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Cannot encode the body as %s: %v", contentType, err))
+	}
+	return string(out), nil
+}
+
+// decodeBody converts a body for a codec to compact JSON.
+func decodeBody(codec bodyCodec, body []byte) ([]byte, error) {
+	v, err := codec.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(jsonSafe(v)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// jsonSafe replaces the floats JSON cannot hold with the strings proto3
+// JSON uses for them.
+func jsonSafe(v any) any {
+	switch t := v.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(t):
+			return "NaN"
+		case math.IsInf(t, 1):
+			return "Infinity"
+		case math.IsInf(t, -1):
+			return "-Infinity"
+		}
+	case []any:
+		for i := range t {
+			t[i] = jsonSafe(t[i])
+		}
+	case map[string]any:
+		for k := range t {
+			t[k] = jsonSafe(t[k])
+		}
+	}
+	return v
+}
+
+// codecNumber reads the numbers a codec may be handed: json.Number from
+// -d, or the Go numbers its own Decode returns. Integers come back as
+// int64, or uint64 past its range; anything else as float64.
+func codecNumber(v any) (i int64, u uint64, f float64, kind byte, ok bool) {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, 0, 0, 'i', true
+		}
+		if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return 0, u, 0, 'u', true
+		}
+		f, err := n.Float64()
+		return 0, 0, f, 'f', err == nil
+	case int64:
+		return n, 0, 0, 'i', true
+	case int:
+		return int64(n), 0, 0, 'i', true
+	case uint64:
+		return 0, n, 0, 'u', true
+	case float64:
+		return 0, 0, n, 'f', true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// codecKey spells a map key of a binary format as a JSON object key.
+func codecKey(k any) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+// applyContentType sets the Content-Type header of --content-type and, when
+// the media type has a codec, converts the JSON of -d to it.
+func applyContentType(opts *acurlOptions) error {
+	if len(opts.PatchOps) > 0 || opts.Merge != "" {
+		return NewCliError(ExitRequestBuild, "--patch-op and --merge set the Content-Type header; drop --content-type")
+	}
+	for _, h := range opts.Headers {
+		if k, _, _ := strings.Cut(h, ":"); strings.EqualFold(strings.TrimSpace(k), "Content-Type") {
+			return NewCliError(ExitRequestBuild, "--content-type and -H \"Content-Type: ...\" both set the Content-Type header; use one")
+		}
+	}
+	codec, err := lookupCodec(opts.ContentType, opts.ProtoDescriptors)
+	if err != nil {
+		return err
+	}
+	if codec != nil && opts.Data != "" {
+		if opts.Data, err = encodeBody(codec, opts.ContentType, opts.Data); err != nil {
+			return err
+		}
+	}
+	opts.Headers = append(opts.Headers, "Content-Type: "+opts.ContentType)
+	return nil
+}
+
+// hasCodec reports whether acurl decodes a body of this Content-Type.
+func hasCodec(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := codecs[mt]
+	return ok
+}
+
+// decodeResponse replaces a body acurl has a codec for with its JSON, masked
+// by redact_fields, and its Content-Type with application/json. On failure
+// the response is left as received.
+func decodeResponse(resp *APIResponse, opts *acurlOptions, redact []string) error {
+	codec, err := responseCodec(resp.Header, opts)
+	if err != nil {
+		return err
+	}
+	if resp.Truncated {
+		return fmt.Errorf("only a prefix of the body was kept")
+	}
+	body, err := decodeBody(codec, resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = redactBody(redact, body)
+	resp.Size = int64(len(resp.Body))
+	resp.Header = resp.Header.Clone()
+	resp.Header.Set("Content-Type", "application/json")
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Collection is a named set of saved requests stored in
+// collections/<name>.yaml next to config.toml. Each request uses the test
+// step format, so saved calls can carry captures and assertions.
+type Collection struct {
+	Vars     map[string]string   `yaml:"vars"`
+	Requests map[string]TestStep `yaml:"requests"`
+}
+
+func collectionsDir(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "collections")
+}
+
+func collectionPath(cfg *ResolvedConfig, name string) string {
+	return filepath.Join(collectionsDir(cfg), name+".yaml")
+}
+
+// LoadCollection reads collections/<name>.yaml.
+func LoadCollection(cfg *ResolvedConfig, name string) (*Collection, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid collection name: %q", name))
+	}
+	path := collectionPath(cfg, name)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewCliError(ExitNotFound, fmt.Sprintf("Collection not found: %s", path))
+	}
+	var c Collection
+	if err := yaml.Unmarshal(raw, &c); err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to parse collection %s: %v", path, err), err)
+	}
+	for name, st := range c.Requests {
+		if (st.Request == "") == (st.Operation == "") {
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Request %q in %s needs exactly one of 'request' or 'operation'", name, path))
+		}
+	}
+	return &c, nil
+}
+
+// LoadSavedRequest resolves "<collection>/<request>" into a one-step suite
+// carrying the collection vars.
+func LoadSavedRequest(cfg *ResolvedConfig, ref string) (*TestSuite, error) {
+	collName, reqName, ok := strings.Cut(ref, "/")
+	if !ok || reqName == "" {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Saved request must be <collection>/<request>, got %q", ref))
+	}
+	c, err := LoadCollection(cfg, collName)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := c.Requests[reqName]
+	if !ok {
+		return nil, NewCliError(ExitNotFound, fmt.Sprintf("Request %q not found in collection %s", reqName, collName))
+	}
+	if st.Name == "" {
+		st.Name = ref
+	}
+	return &TestSuite{Name: ref, Vars: c.Vars, Steps: []TestStep{st}}, nil
+}
+
+// RunCollectionCommand implements `api collection list [name]` and
+// `api collection run <collection/request> [--report ...] [--yes]`.
+func RunCollectionCommand(cfg *ResolvedConfig, args []string) error {
+	if len(args) == 0 {
+		return NewCliError(ExitRequestBuild, "Usage: api collection <list [name]|run <collection/request>>")
+	}
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			c, err := LoadCollection(cfg, args[1])
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(c.Requests))
+			for name := range c.Requests {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				st := c.Requests[name]
+				target := st.Request
+				if target == "" {
+					target = "operation " + st.Operation
+				}
+				fmt.Printf("%s/%s  %s\n", args[1], name, target)
+			}
+			return nil
+		}
+		entries, err := os.ReadDir(collectionsDir(cfg))
+		if err != nil && !os.IsNotExist(err) {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read %s: %v", collectionsDir(cfg), err), err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".yaml") {
+				fmt.Println(strings.TrimSuffix(e.Name(), ".yaml"))
+			}
+		}
+		return nil
+	case "run":
+		positional, report, assumeYes, err := parseSuiteFlags(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return NewCliError(ExitRequestBuild, "Usage: api collection run <collection/request> [--report text|json|junit] [--yes]")
+		}
+		suite, err := LoadSavedRequest(cfg, positional[0])
+		if err != nil {
+			return err
+		}
+		return executeSuite(cfg, suite, report, assumeYes)
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown collection action: %s (expected list|run)", args[0]))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const contextUsage = "Usage: api context env-export [--env <env>] [--format shell|json]"
+
+// contextVar is one exported context value.
+type contextVar struct {
+	Name, Value string
+}
+
+// contextVars are the values of cfg other scripts of an agent pipeline
+// need to act in the same context, under AGENT_API_* names. No token
+// value is among them, only the default token's name. AGENT_API_SESSION
+// is agentapi.SessionEnv, so tools run with these exports share the
+// session's marker.
+func contextVars(configPath string, cfg *ResolvedConfig) []contextVar {
+	abs, err := filepath.Abs(configPath)
+	if err != nil {
+		abs = configPath
+	}
+	vars := []contextVar{
+		{"AGENT_API_CONFIG", abs},
+		{"AGENT_API_PROJECT", cfg.ActiveProject},
+		{"AGENT_API_ENV", cfg.ActiveEnv},
+		{"AGENT_API_BASE", cfg.APIBase},
+		{"AGENT_API_MODE", cfg.APIMode},
+		{"AGENT_API_OPENAPI_URL", cfg.OpenAPIURL},
+		{"AGENT_API_MARKER", cfg.AgentMarker},
+		{"AGENT_API_DEFAULT_TOKEN", cfg.DefaultTokenName},
+	}
+	if cfg.Session != "" {
+		vars = append(vars, contextVar{agentapi.SessionEnv, cfg.Session})
+	}
+	return vars
+}
+
+// RunContextCommand implements `api context env-export`: the active
+// context (or that of --env) as shell export lines to eval, or as a JSON
+// object, so other scripts use the same context without parsing the TOML.
+func RunContextCommand(configPath string, cfg *ResolvedConfig, args []string) error {
+	if len(args) == 0 || args[0] != "env-export" {
+		return NewCliError(ExitRequestBuild, contextUsage)
+	}
+	env, format := "", "shell"
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--env", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			if flag == "--env" {
+				env = args[i]
+			} else {
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, contextUsage)
+		}
+	}
+	if format != "shell" && format != "json" {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --format: %s (expected shell|json)", format))
+	}
+	if env != "" && env != cfg.ActiveEnv {
+		var err error
+		if cfg, err = agentapi.LoadConfigForEnv(configPath, env); err != nil {
+			return err
+		}
+	}
+	vars := contextVars(configPath, cfg)
+	if format == "json" {
+		m := make(map[string]string, len(vars))
+		for _, v := range vars {
+			m[v.Name] = v.Value
+		}
+		return printJSONIndent(m)
+	}
+	for _, v := range vars {
+		fmt.Printf("export %s=%s\n", v.Name, shellQuote(v.Value))
+	}
+	return nil
+}
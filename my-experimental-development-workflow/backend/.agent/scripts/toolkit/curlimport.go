@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurlCall is a pasted curl command reduced to what acurl needs: a method,
+// a path relative to api_base, headers and a body. Credentials are dropped.
+type CurlCall struct {
+	Method  string
+	Path    string
+	Headers map[string]string
+	Body    string
+	// Dropped lists the credentials that were removed.
+	Dropped []string
+}
+
+// curlIgnoredFlags take no value and do not change the request.
+var curlIgnoredFlags = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true, "-k": true, "--insecure": true,
+	"-L": true, "--location": true, "-i": true, "--include": true, "-v": true, "--verbose": true,
+	"--compressed": true, "-f": true, "--fail": true, "-g": true, "--globoff": true,
+}
+
+// curlValueFlags take a value that does not change the request.
+var curlValueFlags = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-A": true, "--user-agent": true, "-e": true, "--referer": true, "-w": true, "--write-out": true,
+}
+
+// droppedCurlHeaders are implied by acurl or tied to the original client.
+var droppedCurlHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "User-Agent": true, "Connection": true, "Accept-Encoding": true,
+}
+
+// splitShellWords tokenizes a command line the way a POSIX shell would for
+// quoting purposes: single quotes are literal, double quotes honour
+// backslash escapes, and backslash-newline continues the line.
+func splitShellWords(s string) ([]string, error) {
+	words := make([]string, 0)
+	var cur strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] != '\n' && s[i] != '\r' {
+				cur.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// ParseCurl parses a curl command line and maps its URL onto apiBase: the
+// host is ignored (bug reports often come from another env) and the
+// api_base path prefix is stripped when present.
+func ParseCurl(command, apiBase string) (*CurlCall, error) {
+	words, err := splitShellWords(strings.TrimSpace(command))
+	if err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid curl command: %v", err), err)
+	}
+	if len(words) > 0 && (words[0] == "curl" || strings.HasSuffix(words[0], "/curl")) {
+		words = words[1:]
+	}
+	call := &CurlCall{Headers: map[string]string{}}
+	rawURL := ""
+	data := make([]string, 0)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		// Values come from the next word, --flag=value or a short flag's
+		// attached form (-XPOST).
+		flag, inline, hasInline := strings.Cut(w, "=")
+		if !strings.HasPrefix(w, "--") {
+			flag, inline, hasInline = w, "", false
+			if len(w) > 2 && w[0] == '-' && strings.IndexByte("XHdubomAew", w[1]) >= 0 {
+				flag, inline, hasInline = w[:2], w[2:], true
+			}
+		}
+		value := func() (string, error) {
+			if hasInline {
+				return inline, nil
+			}
+			i++
+			if i >= len(words) {
+				return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s in curl command", w))
+			}
+			return words[i], nil
+		}
+		switch {
+		case flag == "-X" || flag == "--request":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			call.Method = strings.ToUpper(v)
+		case flag == "-H" || flag == "--header":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			name, val, ok := strings.Cut(v, ":")
+			if !ok {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid header in curl command: %s", v))
+			}
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if _, secret := redactedHeaders[name]; secret {
+				call.Dropped = append(call.Dropped, "header "+name)
+				continue
+			}
+			if droppedCurlHeaders[name] {
+				continue
+			}
+			call.Headers[name] = strings.TrimSpace(val)
+		case flag == "-d" || flag == "--data" || flag == "--data-raw" || flag == "--data-binary" || flag == "--data-ascii":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(v, "@") && flag != "--data-raw" {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Body from file (%s) is not supported; paste the body inline", v))
+			}
+			data = append(data, v)
+		case flag == "--json":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, v)
+			call.Headers["Content-Type"] = "application/json"
+		case flag == "-u" || flag == "--user" || flag == "-b" || flag == "--cookie" || flag == "--oauth2-bearer":
+			if _, err := value(); err != nil {
+				return nil, err
+			}
+			call.Dropped = append(call.Dropped, flag+" credentials")
+		case flag == "--url":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			rawURL = v
+		case curlIgnoredFlags[flag]:
+		case curlValueFlags[flag]:
+			if _, err := value(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(w, "-"):
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Unsupported curl option: %s", w))
+		default:
+			if rawURL != "" {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("curl command has more than one URL: %s", w))
+			}
+			rawURL = w
+		}
+	}
+	if rawURL == "" {
+		return nil, NewCliError(ExitRequestBuild, "No URL found in curl command")
+	}
+	call.Body = strings.Join(data, "&")
+	if call.Method == "" {
+		call.Method = "GET"
+		if call.Body != "" {
+			call.Method = "POST"
+		}
+	}
+
+	if !strings.Contains(rawURL, "://") && !strings.HasPrefix(rawURL, "/") {
+		rawURL = "http://" + rawURL // curl assumes http for bare hosts
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" && u.Host == "" {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid URL in curl command: %s", rawURL))
+	}
+	if u.User != nil {
+		call.Dropped = append(call.Dropped, "URL credentials")
+	}
+	basePath := ""
+	if b, err := url.Parse(apiBase); err == nil {
+		basePath = strings.TrimRight(b.Path, "/")
+	}
+	path := u.EscapedPath()
+	if basePath != "" && (path == basePath || strings.HasPrefix(path, basePath+"/")) {
+		path = strings.TrimPrefix(path, basePath)
+	}
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	call.Path = path
+	if call.Headers["Accept"] == "application/json" {
+		delete(call.Headers, "Accept")
+	}
+	if call.Headers["Content-Type"] == "application/json" {
+		delete(call.Headers, "Content-Type")
+	}
+	return call, nil
+}
+
+// shellQuote quotes s for a POSIX shell when needed.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ACurlCommand renders the call as an acurl invocation.
+func (c *CurlCall) ACurlCommand() string {
+	parts := []string{"acurl", c.Method, shellQuote(c.Path)}
+	names := make([]string, 0, len(c.Headers))
+	for k := range c.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		parts = append(parts, "-H", shellQuote(k+": "+c.Headers[k]))
+	}
+	if c.Body != "" {
+		parts = append(parts, "-d", shellQuote(c.Body))
+	}
+	return strings.Join(parts, " ")
+}
+
+// savedCurlRequest is the collection entry written by --save; unlike
+// TestStep it omits empty fields.
+type savedCurlRequest struct {
+	Request string            `yaml:"request"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    any               `yaml:"body,omitempty"`
+}
+
+// SaveToCollection adds the call as <collection>/<name>, creating the
+// collection file if needed and keeping existing content and comments.
+func (c *CurlCall) SaveToCollection(cfg *ResolvedConfig, ref string) error {
+	collName, reqName, ok := strings.Cut(ref, "/")
+	if !ok || collName == "" || reqName == "" || strings.ContainsAny(collName, `/\`) {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("--save needs <collection>/<request>, got %q", ref))
+	}
+	path := collectionPath(cfg, collName)
+	var doc yaml.Node
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to parse collection %s: %v", path, err), err)
+		}
+	case os.IsNotExist(err):
+	default:
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read %s: %v", path, err), err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Collection %s is not a mapping", path))
+	}
+	var requests *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "requests" {
+			requests = root.Content[i+1]
+		}
+	}
+	if requests == nil {
+		requests = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "requests"}, requests)
+	}
+	for i := 0; i+1 < len(requests.Content); i += 2 {
+		if requests.Content[i].Value == reqName {
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Request %q already exists in collection %s", reqName, collName))
+		}
+	}
+
+	entry := savedCurlRequest{Request: c.Method + " " + c.Path}
+	if len(c.Headers) > 0 {
+		entry.Headers = c.Headers
+	}
+	if c.Body != "" {
+		var body any
+		if json.Unmarshal([]byte(c.Body), &body) == nil {
+			entry.Body = body
+		} else {
+			entry.Body = c.Body
+		}
+	}
+	var value yaml.Node
+	if err := value.Encode(entry); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode request: %v", err), err)
+	}
+	requests.Content = append(requests.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: reqName}, &value)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write %s: %v", path, err), err)
+	}
+	defer f.Close()
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write %s: %v", path, err), err)
+	}
+	return enc.Close()
+}
+
+// RunImportCurl implements `api import-curl '<curl command>' [--save <collection>/<request>]`.
+func RunImportCurl(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api import-curl '<curl command>' [--save <collection>/<request>]"
+	command, save := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--save":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --save")
+			}
+			save = args[i]
+		default:
+			if command != "" {
+				return NewCliError(ExitRequestBuild, usage+" (quote the whole curl command)")
+			}
+			command = args[i]
+		}
+	}
+	if command == "" {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	call, err := ParseCurl(command, cfg.APIBase)
+	if err != nil {
+		return err
+	}
+	for _, d := range call.Dropped {
+		infof("dropped %s (acurl injects the configured token)\n", d)
+	}
+	if err := CheckPolicy(cfg, APIRequest{Method: call.Method, Path: call.Path, Body: call.Body}); err != nil {
+		fmt.Fprintf(os.Stderr, "note: %s/%s guardrails would reject this call: %s\n", cfg.ActiveProject, cfg.ActiveEnv, ExitMessage(err))
+	}
+	if save != "" {
+		if err := call.SaveToCollection(cfg, save); err != nil {
+			return err
+		}
+		fmt.Printf("Saved as %s; run it with: api collection run %s\n", save, save)
+		return nil
+	}
+	fmt.Println(call.ACurlCommand())
+	return nil
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// introspectionQuery fetches every type with its fields, arguments and
+// input fields; type references are resolved four wrappers deep, which
+// covers shapes such as [[T!]!]!.
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind name description
+      fields(includeDeprecated: true) {
+        name description isDeprecated
+        args { name description type { ...TypeRef } defaultValue }
+        type { ...TypeRef }
+      }
+      inputFields { name description type { ...TypeRef } defaultValue }
+      enumValues(includeDeprecated: true) { name description }
+      interfaces { name }
+      possibleTypes { name }
+    }
+  }
+}
+fragment TypeRef on __Type {
+  kind name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } }
+}`
+
+// GraphQLSchema is the decoded `__schema` of an introspection result.
+type GraphQLSchema struct {
+	QueryType        *gqlNamed `json:"queryType"`
+	MutationType     *gqlNamed `json:"mutationType"`
+	SubscriptionType *gqlNamed `json:"subscriptionType"`
+	Types            []GQLType `json:"types"`
+}
+
+type gqlNamed struct {
+	Name string `json:"name"`
+}
+
+type GQLType struct {
+	Kind          string     `json:"kind"`
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	Fields        []GQLField `json:"fields"`
+	InputFields   []GQLInput `json:"inputFields"`
+	EnumValues    []GQLEnum  `json:"enumValues"`
+	Interfaces    []gqlNamed `json:"interfaces"`
+	PossibleTypes []gqlNamed `json:"possibleTypes"`
+}
+
+type GQLField struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	IsDeprecated bool       `json:"isDeprecated"`
+	Args         []GQLInput `json:"args"`
+	Type         GQLTypeRef `json:"type"`
+}
+
+type GQLInput struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Type         GQLTypeRef `json:"type"`
+	DefaultValue *string    `json:"defaultValue"`
+}
+
+type GQLEnum struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type GQLTypeRef struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name"`
+	OfType *GQLTypeRef `json:"ofType"`
+}
+
+// String renders the reference in SDL notation, e.g. [Product!]!.
+func (t GQLTypeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		if t.OfType != nil {
+			return t.OfType.String() + "!"
+		}
+	case "LIST":
+		if t.OfType != nil {
+			return "[" + t.OfType.String() + "]"
+		}
+	}
+	return t.Name
+}
+
+func graphQLCachePath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "cache", fmt.Sprintf("graphql-%s-%s.json", agentapi.SafeFileName(cfg.ActiveProject), agentapi.SafeFileName(cfg.ActiveEnv)))
+}
+
+// PullGraphQLSchema runs the introspection query with the default token and
+// refreshes the local cache. Like the OpenAPI spec fetch, introspection is
+// schema discovery and is not subject to api_mode.
+func PullGraphQLSchema(cfg *ResolvedConfig) (*GraphQLSchema, error) {
+	if cfg.GraphQLURL == "" {
+		return nil, NewCliError(ExitConfig, fmt.Sprintf("Missing graphql_url for %s/%s", cfg.ActiveProject, cfg.ActiveEnv))
+	}
+	_, token, err := agentapi.ResolveToken(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	payload, _ := json.Marshal(map[string]any{"query": introspectionQuery, "operationName": "IntrospectionQuery"})
+	req, err := http.NewRequestWithContext(runCtx, http.MethodPost, cfg.GraphQLURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, WrapCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch GraphQL schema: %v", err), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	start := time.Now()
+	resp, err := agentapi.NewDoer(30 * time.Second).Do(req)
+	if err != nil && runCtx.Err() != nil {
+		return nil, NewCliError(ExitInterrupted, fmt.Sprintf("Interrupted: GraphQL introspection of %s cancelled", cfg.GraphQLURL))
+	}
+	if err != nil {
+		return nil, WrapCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch GraphQL schema: %v", err), err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, WrapCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch GraphQL schema: %v", err), err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, NewCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch GraphQL schema: HTTP %d", resp.StatusCode))
+	}
+	logger.Debug("graphql schema fetched", "url", cfg.GraphQLURL, "bytes", len(body), "duration_ms", time.Since(start).Milliseconds())
+
+	schema, err := parseGraphQLIntrospection(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(graphQLCachePath(cfg)), 0o755); err == nil {
+		_ = agentapi.WriteFileAtomic(graphQLCachePath(cfg), body, 0o644)
+	}
+	return schema, nil
+}
+
+// LoadGraphQLSchema reads the cached schema, pulling it on first use.
+func LoadGraphQLSchema(cfg *ResolvedConfig) (*GraphQLSchema, error) {
+	body, err := os.ReadFile(graphQLCachePath(cfg))
+	if err != nil {
+		return PullGraphQLSchema(cfg)
+	}
+	return parseGraphQLIntrospection(body)
+}
+
+func parseGraphQLIntrospection(body []byte) (*GraphQLSchema, error) {
+	var result struct {
+		Data struct {
+			Schema *GraphQLSchema `json:"__schema"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, WrapCliError(ExitOpenAPIParse, fmt.Sprintf("Failed to parse GraphQL introspection: %v", err), err)
+	}
+	if result.Data.Schema == nil {
+		msg := "no __schema in response"
+		if len(result.Errors) > 0 {
+			msg = result.Errors[0].Message
+		}
+		return nil, NewCliError(ExitOpenAPIParse, fmt.Sprintf("GraphQL introspection failed: %s", msg))
+	}
+	return result.Data.Schema, nil
+}
+
+// userTypes skips the introspection types (__Schema, __Type, ...).
+func (s *GraphQLSchema) userTypes() []GQLType {
+	out := make([]GQLType, 0, len(s.Types))
+	for _, t := range s.Types {
+		if !strings.HasPrefix(t.Name, "__") {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// rootLabel marks the query/mutation/subscription root types.
+func (s *GraphQLSchema) rootLabel(name string) string {
+	for label, root := range map[string]*gqlNamed{"query": s.QueryType, "mutation": s.MutationType, "subscription": s.SubscriptionType} {
+		if root != nil && root.Name == name {
+			return label
+		}
+	}
+	return ""
+}
+
+// SearchGraphQL scores types and fields against the query with the same
+// term matching as `api find`; names weigh more than descriptions.
+func SearchGraphQL(s *GraphQLSchema, query string) *Table {
+	t := &Table{
+		Columns: []string{"KIND", "NAME", "TYPE", "DESCRIPTION"},
+		Keys:    []string{"kind", "name", "type", "description"},
+		Empty:   "No matching types or fields found.",
+	}
+	type hit struct {
+		score int
+		row   []string
+	}
+	hits := make([]hit, 0)
+	terms := strings.Fields(strings.ToLower(query))
+	score := func(name, desc string) int {
+		total := 0
+		for _, term := range terms {
+			for _, v := range agentapi.TermVariants(term) {
+				if strings.Contains(strings.ToLower(name), v) {
+					total += 10
+					break
+				}
+			}
+			for _, v := range agentapi.TermVariants(term) {
+				if strings.Contains(strings.ToLower(desc), v) {
+					total += 3
+					break
+				}
+			}
+		}
+		return total
+	}
+	for _, typ := range s.userTypes() {
+		if sc := score(typ.Name, typ.Description); sc > 0 {
+			kind := strings.ToLower(typ.Kind)
+			if root := s.rootLabel(typ.Name); root != "" {
+				kind = root + " root"
+			}
+			hits = append(hits, hit{sc, []string{kind, typ.Name, "", firstLine(typ.Description)}})
+		}
+		kind := "field"
+		if root := s.rootLabel(typ.Name); root != "" {
+			kind = root
+		}
+		for _, f := range typ.Fields {
+			if sc := score(f.Name, f.Description); sc > 0 {
+				hits = append(hits, hit{sc + 1, []string{kind, typ.Name + "." + f.Name, f.Type.String(), firstLine(f.Description)}})
+			}
+		}
+		for _, f := range typ.InputFields {
+			if sc := score(f.Name, f.Description); sc > 0 {
+				hits = append(hits, hit{sc, []string{"input field", typ.Name + "." + f.Name, f.Type.String(), firstLine(f.Description)}})
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].row[1] < hits[j].row[1]
+	})
+	for _, h := range hits {
+		t.Rows = append(t.Rows, h.row)
+	}
+	return t
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// PrintGraphQLType prints a type in an SDL-like layout.
+func PrintGraphQLType(s *GraphQLSchema, name string) error {
+	for _, t := range s.Types {
+		if !strings.EqualFold(t.Name, name) {
+			continue
+		}
+		fmt.Printf("KIND: %s\n", t.Kind)
+		fmt.Printf("NAME: %s\n", t.Name)
+		if root := s.rootLabel(t.Name); root != "" {
+			fmt.Printf("ROOT: %s\n", root)
+		}
+		if t.Description != "" {
+			fmt.Printf("DESCRIPTION: %s\n", t.Description)
+		}
+		if len(t.Interfaces) > 0 {
+			names := make([]string, 0, len(t.Interfaces))
+			for _, i := range t.Interfaces {
+				names = append(names, i.Name)
+			}
+			fmt.Printf("IMPLEMENTS: %s\n", strings.Join(names, ", "))
+		}
+		if len(t.PossibleTypes) > 0 {
+			names := make([]string, 0, len(t.PossibleTypes))
+			for _, p := range t.PossibleTypes {
+				names = append(names, p.Name)
+			}
+			fmt.Printf("POSSIBLE TYPES: %s\n", strings.Join(names, ", "))
+		}
+		if len(t.Fields) > 0 {
+			fmt.Println("\nFIELDS:")
+			for _, f := range t.Fields {
+				args := make([]string, 0, len(f.Args))
+				for _, a := range f.Args {
+					args = append(args, formatGraphQLInput(a))
+				}
+				sig := f.Name
+				if len(args) > 0 {
+					sig += "(" + strings.Join(args, ", ") + ")"
+				}
+				line := fmt.Sprintf("  %s: %s", sig, f.Type.String())
+				if f.IsDeprecated {
+					line += "  (deprecated)"
+				}
+				if d := firstLine(f.Description); d != "" {
+					line += "  # " + d
+				}
+				fmt.Println(line)
+			}
+		}
+		if len(t.InputFields) > 0 {
+			fmt.Println("\nINPUT FIELDS:")
+			for _, f := range t.InputFields {
+				line := "  " + formatGraphQLInput(f)
+				if d := firstLine(f.Description); d != "" {
+					line += "  # " + d
+				}
+				fmt.Println(line)
+			}
+		}
+		if len(t.EnumValues) > 0 {
+			fmt.Println("\nVALUES:")
+			for _, v := range t.EnumValues {
+				fmt.Printf("  %s\n", v.Name)
+			}
+		}
+		return nil
+	}
+	return NewCliError(ExitNotFound, fmt.Sprintf("GraphQL type not found: %s", name))
+}
+
+func formatGraphQLInput(in GQLInput) string {
+	s := in.Name + ": " + in.Type.String()
+	if in.DefaultValue != nil {
+		s += " = " + *in.DefaultValue
+	}
+	return s
+}
+
+// RunGraphQLCommand implements `api graphql schema pull|search|show`.
+func RunGraphQLCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api graphql schema <pull|search <query> [--format ...]|show <Type>>"
+	if len(args) < 2 || args[0] != "schema" {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	switch args[1] {
+	case "pull":
+		s, err := PullGraphQLSchema(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pulled GraphQL schema: %d types -> %s\n", len(s.userTypes()), graphQLCachePath(cfg))
+		return nil
+	case "search":
+		format := "table"
+		parts := make([]string, 0)
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--format" {
+				i++
+				if i >= len(args) {
+					return NewCliError(ExitRequestBuild, "Missing value for --format")
+				}
+				format = args[i]
+				continue
+			}
+			parts = append(parts, args[i])
+		}
+		query := strings.TrimSpace(strings.Join(parts, " "))
+		if query == "" {
+			return NewCliError(ExitRequestBuild, "Query cannot be empty")
+		}
+		f, err := LookupFormatter(format)
+		if err != nil {
+			return err
+		}
+		s, err := LoadGraphQLSchema(cfg)
+		if err != nil {
+			return err
+		}
+		if err := f.Format(os.Stdout, SearchGraphQL(s, query)); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+		}
+		return nil
+	case "show":
+		if len(args) != 3 {
+			return NewCliError(ExitRequestBuild, "Usage: api graphql schema show <Type>")
+		}
+		s, err := LoadGraphQLSchema(cfg)
+		if err != nil {
+			return err
+		}
+		return PrintGraphQLType(s, args[2])
+	default:
+		return NewCliError(ExitRequestBuild, usage)
+	}
+}
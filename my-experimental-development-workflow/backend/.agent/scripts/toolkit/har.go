@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// secretQueryParams are masked in exported URLs; headers are redacted when
+// the history entry is written.
+var secretQueryParams = map[string]bool{
+	"token": true, "access_token": true, "api_key": true, "apikey": true, "key": true,
+	"secret": true, "password": true, "signature": true, "sig": true,
+}
+
+// HAR is the subset of HAR 1.2 written by `api history export --format har`.
+type HAR struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            int64       `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+func harHeaders(h map[string]string) []harNameValue {
+	out := make([]harNameValue, 0, len(h))
+	for _, k := range sortedStringKeys(h) {
+		out = append(out, harNameValue{Name: k, Value: h[k]})
+	}
+	return out
+}
+
+func headerValue(h map[string]string, name string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// redactURL masks secret-looking query parameters and returns the URL with
+// its query string entries.
+func redactURL(raw string) (string, []harNameValue) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw, []harNameValue{}
+	}
+	q := u.Query()
+	params := make([]harNameValue, 0, len(q))
+	for _, k := range sortedMapKeys(q) {
+		for i := range q[k] {
+			if secretQueryParams[strings.ToLower(k)] {
+				q[k][i] = "[redacted]"
+			}
+			params = append(params, harNameValue{Name: k, Value: q[k][i]})
+		}
+	}
+	if len(q) > 0 {
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), params
+}
+
+// BuildHAR converts history entries into a HAR document.
+func BuildHAR(entries []HistoryEntry) *HAR {
+	h := &HAR{Log: harLog{Version: "1.2", Creator: harCreator{Name: "agent-api-toolkit", Version: "1"}, Entries: make([]harEntry, 0, len(entries))}}
+	for _, e := range entries {
+		u, query := redactURL(e.URL)
+		req := harRequest{
+			Method:      e.Method,
+			URL:         u,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.RequestHeaders),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    len(e.RequestBody),
+		}
+		if e.RequestBody != "" {
+			mime := headerValue(e.RequestHeaders, "Content-Type")
+			if mime == "" {
+				mime = "application/json"
+			}
+			req.PostData = &harPostData{MimeType: mime, Text: e.RequestBody}
+		}
+		statusText := http.StatusText(e.Status)
+		if e.Error != "" {
+			statusText = e.Error
+		}
+		resp := harResponse{
+			Status:      e.Status,
+			StatusText:  statusText,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.ResponseHeaders),
+			Content:     harContent{Size: len(e.ResponseBody), MimeType: headerValue(e.ResponseHeaders, "Content-Type"), Text: e.ResponseBody},
+			HeadersSize: -1,
+			BodySize:    len(e.ResponseBody),
+		}
+		if resp.Content.MimeType == "" {
+			resp.Content.MimeType = "application/octet-stream"
+		}
+		comment := fmt.Sprintf("history:%s source=%s %s/%s", e.ID, e.Source, e.Project, e.Env)
+		if e.Truncated {
+			comment += " (bodies truncated)"
+		}
+		h.Log.Entries = append(h.Log.Entries, harEntry{
+			StartedDateTime: e.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+			Time:            e.DurationMS,
+			Request:         req,
+			Response:        resp,
+			Timings:         harTimings{Send: 0, Wait: e.DurationMS, Receive: 0},
+			Comment:         comment,
+		})
+	}
+	return h
+}
+
+// RunHistoryCommand implements `api history export --format har` and
+// `api history top` (see runHistoryTop).
+func RunHistoryCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api history export --format har [--out <file.har>] [--last <n>] [--source <name>] [--session <id>] [--all-envs]"
+	if len(args) > 0 && args[0] == "top" {
+		return runHistoryTop(cfg, args[1:])
+	}
+	if len(args) == 0 || args[0] != "export" {
+		return NewCliError(ExitRequestBuild, usage+" | "+strings.TrimPrefix(historyTopUsage, "Usage: api history "))
+	}
+	format, out, source, session := "", "", "", ""
+	last := 0
+	allEnvs := false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--all-envs":
+			allEnvs = true
+		case "--format", "--out", "--last", "--source", "--session":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--format":
+				format = args[i]
+			case "--out":
+				out = args[i]
+			case "--source":
+				source = args[i]
+			case "--session":
+				session = args[i]
+			default:
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n <= 0 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --last: %s", args[i]))
+				}
+				last = n
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown history export option: %s", args[i]))
+		}
+	}
+	if format != "har" {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+
+	all, err := LoadHistory(cfg)
+	if err != nil {
+		return err
+	}
+	entries := make([]HistoryEntry, 0, len(all))
+	for _, e := range all {
+		if !allEnvs && (e.Project != cfg.ActiveProject || e.Env != cfg.ActiveEnv) {
+			continue
+		}
+		if source != "" && e.Source != source && !strings.HasPrefix(e.Source, source+":") {
+			continue
+		}
+		if session != "" && e.Session != session {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	if last > 0 && len(entries) > last {
+		entries = entries[len(entries)-last:]
+	}
+
+	raw, err := json.MarshalIndent(BuildHAR(entries), "", "  ")
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode HAR: %v", err), err)
+	}
+	if out == "" {
+		fmt.Println(string(raw))
+		return nil
+	}
+	if err := os.WriteFile(out, append(raw, '\n'), 0o600); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write %s: %v", out, err), err)
+	}
+	fmt.Printf("Exported %d requests to %s\n", len(entries), out)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeHistory writes entries to the history file of cfg, oldest first.
+func writeHistory(t *testing.T, cfg *ResolvedConfig, entries []HistoryEntry) {
+	t.Helper()
+	var b strings.Builder
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(historyPath(cfg)), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(historyPath(cfg), []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanHistoryBackward(t *testing.T) {
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir()}
+	// Entries of varied sizes, some larger than a chunk, so lines straddle
+	// chunk boundaries.
+	entries := make([]HistoryEntry, 3000)
+	for i := range entries {
+		entries[i] = HistoryEntry{ID: fmt.Sprint(i), URL: "/items/" + strings.Repeat("x", i%97)}
+		if i%500 == 7 {
+			entries[i].ResponseBody = strings.Repeat("y", historyChunk+i)
+		}
+	}
+	writeHistory(t, cfg, entries)
+
+	var ids []string
+	if err := scanHistoryBackward(cfg, func(e HistoryEntry) bool {
+		ids = append(ids, e.ID)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(entries) {
+		t.Fatalf("scanned %d entries, want %d", len(ids), len(entries))
+	}
+	for i, id := range ids {
+		if want := fmt.Sprint(len(entries) - 1 - i); id != want {
+			t.Fatalf("entry %d scanned is %s, want %s", i, id, want)
+		}
+	}
+
+	n := 0
+	if err := scanHistoryBackward(cfg, func(HistoryEntry) bool { n++; return n < 3 }); err != nil || n != 3 {
+		t.Fatalf("scan stopped after %d entries (%v), want 3", n, err)
+	}
+}
+
+func TestRecentDuplicate(t *testing.T) {
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev"}
+	now := time.Now()
+	entry := func(id, fp, env string, age time.Duration) HistoryEntry {
+		return HistoryEntry{ID: id, Fingerprint: fp, Project: "p", Env: env, Time: now.Add(-age)}
+	}
+	writeHistory(t, cfg, []HistoryEntry{
+		entry("old", "fp-old", "dev", time.Minute),
+		entry("first", "fp", "dev", 5*time.Second),
+		entry("latest", "fp", "dev", 3*time.Second),
+		entry("other-env", "fp", "staging", time.Second),
+	})
+	if e := recentDuplicate(cfg, "fp", duplicateWindow); e == nil || e.ID != "latest" {
+		t.Errorf("recentDuplicate(fp) = %+v, want the latest dev entry", e)
+	}
+	if e := recentDuplicate(cfg, "fp-old", duplicateWindow); e != nil {
+		t.Errorf("recentDuplicate(fp-old) = %+v, want none: it is outside the window", e)
+	}
+}
+
+func TestAppendHistoryRotates(t *testing.T) {
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev"}
+	AppendHistory(cfg, HistoryEntry{Method: "GET", URL: "/first"})
+	// Grow the file to the cap without writing it.
+	if err := os.Truncate(historyPath(cfg), maxHistoryBytes); err != nil {
+		t.Fatal(err)
+	}
+	AppendHistory(cfg, HistoryEntry{Method: "GET", URL: "/second"})
+
+	if info, err := os.Stat(rotatedHistoryPath(cfg)); err != nil || info.Size() != maxHistoryBytes {
+		t.Fatalf("rotated history: %v, %v; want the full file", info, err)
+	}
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].URL != "/first" || entries[1].URL != "/second" {
+		t.Fatalf("LoadHistory after rotation = %+v, want /first then /second", entries)
+	}
+}
+
+func TestRankByHistoryCountsRecentCalls(t *testing.T) {
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev", APIBase: "http://api.test/v1"}
+	now := time.Now()
+	call := func(path string, i int) HistoryEntry {
+		return HistoryEntry{Project: "p", Env: "dev", Method: "GET", URL: "http://api.test/v1" + path, Status: 200, Time: now.Add(time.Duration(i) * time.Second)}
+	}
+	var entries []HistoryEntry
+	// /old was called most, but before the last rankHistoryCalls calls.
+	for i := 0; i < 3000; i++ {
+		entries = append(entries, call("/old", i))
+	}
+	for i := 0; i < 10; i++ {
+		entries = append(entries, call("/new", 3000+i))
+	}
+	for i := 0; i < rankHistoryCalls; i++ {
+		entries = append(entries, HistoryEntry{Project: "other", Env: "dev", Method: "GET", URL: "http://api.test/v1/old", Status: 200})
+	}
+	for i := 0; i < rankHistoryCalls-10; i++ {
+		entries = append(entries, call("/unlisted", 4000+i))
+	}
+	writeHistory(t, cfg, entries)
+
+	ranked := rankByHistory(cfg, []Operation{{Method: "GET", Path: "/old", Score: 10}, {Method: "GET", Path: "/new", Score: 10}})
+	if ranked[0].Path != "/new" || ranked[1].Score != 10 {
+		t.Fatalf("ranked %+v, want /new boosted first and /old unboosted", ranked)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const historyTopUsage = "Usage: api history top [--limit <n>] [--session <id>] [--all-envs] [--format table|csv|json|ndjson]"
+
+// projectCalls are the calls of the history made in cfg's project, by
+// default in cfg's env only, as paths of the API: the URL of an env
+// sharing cfg's base path is read the same, so the other envs of a project
+// count as well with allEnvs.
+func projectCalls(cfg *ResolvedConfig, entries []HistoryEntry, allEnvs bool, session string) []agentapi.Call {
+	basePath := ""
+	if u, err := url.Parse(cfg.APIBase); err == nil {
+		basePath = strings.TrimRight(u.Path, "/")
+	}
+	calls := make([]agentapi.Call, 0)
+	for _, e := range entries {
+		if e.Project != cfg.ActiveProject || (!allEnvs && e.Env != cfg.ActiveEnv) || (session != "" && e.Session != session) {
+			continue
+		}
+		path, ok := cfg.PathOf(e.URL)
+		if !ok {
+			u, err := url.Parse(e.URL)
+			if err != nil || !strings.HasPrefix(u.Path, basePath+"/") {
+				continue
+			}
+			path = strings.TrimPrefix(u.Path, basePath)
+		}
+		path, _, _ = strings.Cut(path, "?")
+		calls = append(calls, agentapi.Call{Method: e.Method, Path: path, Time: e.Time, Failed: e.Error != "" || e.Status < 200 || e.Status >= 400})
+	}
+	return calls
+}
+
+// rankHistoryCalls is how many of the project's latest calls rankByHistory
+// counts: enough to tell the endpoints in use, read from the end of the
+// history however long it is.
+const rankHistoryCalls = 2000
+
+// rankByHistory boosts find results by how often the project has called
+// them successfully (agentapi.BoostByUsage) in its last rankHistoryCalls
+// calls. Without a history the order is unchanged.
+func rankByHistory(cfg *ResolvedConfig, ops []Operation) []Operation {
+	entries := make([]HistoryEntry, 0)
+	err := scanHistoryBackward(cfg, func(e HistoryEntry) bool {
+		if e.Project == cfg.ActiveProject {
+			entries = append(entries, e)
+		}
+		return len(entries) < rankHistoryCalls
+	})
+	if err != nil || len(entries) == 0 {
+		return ops
+	}
+	return agentapi.BoostByUsage(ops, projectCalls(cfg, entries, true, ""))
+}
+
+// runHistoryTop implements `api history top`: the operations called most,
+// grouped by their spec path template, with failures and last use. Calls
+// the spec does not describe (or all of them, without a spec) are listed
+// by their concrete path.
+func runHistoryTop(cfg *ResolvedConfig, args []string) error {
+	limit, format, session := 20, "table", ""
+	allEnvs := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--all-envs":
+			allEnvs = true
+		case "--limit", "--session", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--limit":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 0 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --limit: %s (expected a non-negative integer)", args[i]))
+				}
+				limit = n
+			case "--session":
+				if !agentapi.ValidSessionID(args[i]) {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid session id: %s", args[i]))
+				}
+				session = args[i]
+			default:
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, historyTopUsage)
+		}
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return err
+	}
+	var ops []Operation
+	if spec, err := agentapi.LoadSpecPaths(runCtx, cfg); err == nil {
+		ops = agentapi.IterOperations(spec)
+	} else {
+		logger.Debug("history top without the spec", "error", ExitMessage(err))
+	}
+
+	usages := agentapi.CountCalls(ops, projectCalls(cfg, entries, allEnvs, session))
+	page, rest := agentapi.Page(usages, 0, limit)
+	t := &Table{
+		Columns: []string{"METHOD", "PATH", "OPERATION_ID", "CALLS", "FAILURES", "LAST_USED"},
+		Keys:    []string{"method", "path", "operation_id", "calls", "failures", "last_used"},
+		Empty:   "No calls in the history.",
+	}
+	for _, u := range page {
+		t.Rows = append(t.Rows, []string{u.Method, u.Path, u.OperationID, strconv.Itoa(u.Calls), strconv.Itoa(u.Failures), u.Last.UTC().Format(time.RFC3339)})
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	if rest > 0 {
+		infof("%d more operations; --limit 0 shows all.\n", rest)
+	}
+	return nil
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Observation is one request/response pair seen by the proxy, acurl or a
+// recorded cassette, with the path relative to api_base.
+type Observation struct {
+	Method       string
+	Path         string
+	Query        url.Values
+	RequestBody  string
+	Status       int
+	ResponseBody string
+}
+
+var (
+	uuidPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexIDPattern  = regexp.MustCompile(`^[0-9a-fA-F]{24,}$`)
+	digitPattern  = regexp.MustCompile(`\d`)
+	letterPattern = regexp.MustCompile(`[A-Za-z]`)
+)
+
+// looksLikeID reports whether a path segment is an identifier rather than a
+// resource name: numbers, UUIDs, long hex ids and long letter/digit tokens
+// (short ones such as "v2" are treated as names).
+func looksLikeID(seg string) bool {
+	if _, err := strconv.ParseInt(seg, 10, 64); err == nil {
+		return true
+	}
+	if uuidPattern.MatchString(seg) || hexIDPattern.MatchString(seg) {
+		return true
+	}
+	return len(seg) >= 8 && digitPattern.MatchString(seg) && letterPattern.MatchString(seg)
+}
+
+// templatePath replaces id-like segments with {param} placeholders named
+// after the preceding segment (products/42 -> products/{productId}).
+func templatePath(path string) (string, []string) {
+	segs := agentapi.NormalizeSegments(path)
+	names := make([]string, 0)
+	used := map[string]int{}
+	for i, seg := range segs {
+		if !looksLikeID(seg) {
+			continue
+		}
+		name := "id"
+		if i > 0 && !strings.HasPrefix(segs[i-1], "{") {
+			prev := strings.TrimSuffix(strings.TrimSuffix(segs[i-1], "s"), "ie")
+			if strings.HasSuffix(segs[i-1], "ies") {
+				prev += "y"
+			}
+			name = lowerCamel(prev) + "Id"
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, used[name])
+		}
+		segs[i] = "{" + name + "}"
+		names = append(names, name)
+	}
+	return "/" + strings.Join(segs, "/"), names
+}
+
+func lowerCamel(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	for i := range parts {
+		if i > 0 && parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// InferSchema derives a JSON schema from a decoded value.
+func InferSchema(v any) map[string]any {
+	switch t := v.(type) {
+	case nil:
+		return map[string]any{"nullable": true}
+	case bool:
+		return map[string]any{"type": "boolean"}
+	case float64:
+		if t == float64(int64(t)) {
+			return map[string]any{"type": "integer"}
+		}
+		return map[string]any{"type": "number"}
+	case string:
+		return map[string]any{"type": "string"}
+	case []any:
+		s := map[string]any{"type": "array"}
+		var items map[string]any
+		for _, it := range t {
+			items = MergeSchemas(items, InferSchema(it))
+		}
+		if items == nil {
+			items = map[string]any{}
+		}
+		s["items"] = items
+		return s
+	case map[string]any:
+		props := map[string]any{}
+		required := make([]any, 0, len(t))
+		for _, k := range agentapi.SortedKeys(t) {
+			props[k] = InferSchema(t[k])
+			required = append(required, k)
+		}
+		s := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]any{}
+}
+
+// MergeSchemas widens a to also accept every value b accepts: object
+// properties are unioned (required keeps the common keys), integer and
+// number widen to number, and conflicting types drop the type constraint.
+// An empty schema carries no information (e.g. items of an empty array).
+func MergeSchemas(a, b map[string]any) map[string]any {
+	switch {
+	case len(a) == 0:
+		return b
+	case len(b) == 0:
+		return a
+	case isNullOnly(a):
+		return withNullable(b)
+	case isNullOnly(b):
+		return withNullable(a)
+	}
+	out := map[string]any{}
+	if nullable, _ := a["nullable"].(bool); nullable {
+		out["nullable"] = true
+	}
+	if nullable, _ := b["nullable"].(bool); nullable {
+		out["nullable"] = true
+	}
+	ta, tb := agentapi.AsString(a["type"]), agentapi.AsString(b["type"])
+	switch {
+	case ta == "" || tb == "":
+		out["description"] = "Observed with mixed types"
+		return out
+	case ta == tb:
+		out["type"] = ta
+	case (ta == "integer" && tb == "number") || (ta == "number" && tb == "integer"):
+		out["type"] = "number"
+		return out
+	default:
+		out["description"] = "Observed with mixed types"
+		return out
+	}
+
+	switch ta {
+	case "array":
+		ia, _ := agentapi.AsMap(a["items"])
+		ib, _ := agentapi.AsMap(b["items"])
+		items := MergeSchemas(ia, ib)
+		if items == nil {
+			items = map[string]any{}
+		}
+		out["items"] = items
+	case "object":
+		pa, _ := agentapi.AsMap(a["properties"])
+		pb, _ := agentapi.AsMap(b["properties"])
+		props := map[string]any{}
+		for k, v := range pa {
+			props[k] = v
+		}
+		for k, v := range pb {
+			sa, _ := agentapi.AsMap(props[k])
+			sb, _ := agentapi.AsMap(v)
+			props[k] = MergeSchemas(sa, sb)
+		}
+		out["properties"] = props
+		inB := map[string]bool{}
+		if rb, ok := agentapi.AsSlice(b["required"]); ok {
+			for _, r := range rb {
+				inB[agentapi.AsString(r)] = true
+			}
+		}
+		required := make([]any, 0)
+		if ra, ok := agentapi.AsSlice(a["required"]); ok {
+			for _, r := range ra {
+				if inB[agentapi.AsString(r)] {
+					required = append(required, r)
+				}
+			}
+		}
+		if len(required) > 0 {
+			out["required"] = required
+		}
+	}
+	return out
+}
+
+func withNullable(s map[string]any) map[string]any {
+	out := make(map[string]any, len(s)+1)
+	for k, v := range s {
+		out[k] = v
+	}
+	out["nullable"] = true
+	return out
+}
+
+func isNullOnly(s map[string]any) bool {
+	nullable, _ := s["nullable"].(bool)
+	return nullable && len(s) == 1
+}
+
+type inferredOperation struct {
+	method    string
+	path      string
+	params    []string
+	count     int
+	query     map[string]map[string]any
+	request   map[string]any
+	responses map[int]map[string]any
+	noBody    map[int]bool
+}
+
+// InferSpec builds a draft OpenAPI 3 document from observations whose
+// endpoint is not in spec (nil spec: every observation is considered).
+func InferSpec(title string, spec map[string]any, observations []Observation) (map[string]any, int) {
+	known := agentapi.IterOperations(spec)
+	ops := map[string]*inferredOperation{}
+	for _, o := range observations {
+		// Transport failures and 404/405 say nothing about an endpoint.
+		if o.Status == 0 || o.Status == 404 || o.Status == 405 {
+			continue
+		}
+		documented := false
+		for _, op := range known {
+			if _, ok := agentapi.MatchOpenAPIPath(op.Path, o.Path); ok && op.Method == o.Method {
+				documented = true
+				break
+			}
+		}
+		if documented {
+			continue
+		}
+		tmpl, params := templatePath(o.Path)
+		key := o.Method + " " + tmpl
+		op := ops[key]
+		if op == nil {
+			op = &inferredOperation{method: o.Method, path: tmpl, params: params, query: map[string]map[string]any{}, responses: map[int]map[string]any{}, noBody: map[int]bool{}}
+			ops[key] = op
+		}
+		op.count++
+		for name, vals := range o.Query {
+			for _, v := range vals {
+				op.query[name] = MergeSchemas(op.query[name], InferSchema(scalarFromString(v)))
+			}
+		}
+		var reqDoc any
+		if strings.TrimSpace(o.RequestBody) != "" && json.Unmarshal([]byte(o.RequestBody), &reqDoc) == nil {
+			op.request = MergeSchemas(op.request, InferSchema(reqDoc))
+		}
+		var respDoc any
+		if strings.TrimSpace(o.ResponseBody) != "" && json.Unmarshal([]byte(o.ResponseBody), &respDoc) == nil {
+			op.responses[o.Status] = MergeSchemas(op.responses[o.Status], InferSchema(respDoc))
+		} else if _, seen := op.responses[o.Status]; !seen {
+			op.noBody[o.Status] = true
+		}
+	}
+
+	paths := map[string]any{}
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		op := ops[k]
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.render()
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       title,
+			"version":     "0.0.0-inferred",
+			"description": "Draft inferred from observed traffic. Review before publishing.",
+		},
+		"paths": paths,
+	}
+	return doc, len(ops)
+}
+
+func (op *inferredOperation) render() map[string]any {
+	out := map[string]any{
+		"summary":    fmt.Sprintf("Inferred from %d observed call(s)", op.count),
+		"x-inferred": true,
+	}
+	params := make([]any, 0)
+	for _, name := range op.params {
+		params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	for _, name := range sortedMapKeys(op.query) {
+		params = append(params, map[string]any{"name": name, "in": "query", "required": false, "schema": op.query[name]})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if op.request != nil {
+		out["requestBody"] = map[string]any{
+			"content": map[string]any{"application/json": map[string]any{"schema": op.request}},
+		}
+	}
+	responses := map[string]any{}
+	for status, schema := range op.responses {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": "Observed response",
+			"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+		}
+	}
+	for status := range op.noBody {
+		if _, ok := op.responses[status]; !ok {
+			responses[strconv.Itoa(status)] = map[string]any{"description": "Observed response"}
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// scalarFromString types a query value so ?page=2 infers an integer.
+func scalarFromString(v string) any {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return v
+}
+
+// relativeToBase strips the path prefix of the env's base (api_base or a
+// path_bases entry) from a request path.
+func relativeToBase(cfg *ResolvedConfig, requestURI string) (string, url.Values, bool) {
+	u, err := url.Parse(requestURI)
+	if err != nil {
+		return "", nil, false
+	}
+	for _, b := range cfg.Bases() {
+		base, err := url.Parse(b)
+		if err != nil || u.Host != "" && u.Host != base.Host {
+			continue
+		}
+		basePath := strings.TrimRight(base.Path, "/")
+		if !strings.HasPrefix(u.Path, basePath+"/") {
+			continue
+		}
+		path := strings.TrimPrefix(u.Path, basePath)
+		if cfg.BaseFor(path) != b {
+			continue // the same host under another base
+		}
+		return path, u.Query(), true
+	}
+	return "", nil, false
+}
+
+// historyObservations returns history entries for the active project/env.
+func historyObservations(cfg *ResolvedConfig) ([]Observation, error) {
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Observation, 0, len(entries))
+	for _, e := range entries {
+		if e.Project != cfg.ActiveProject || e.Env != cfg.ActiveEnv || e.Truncated {
+			continue
+		}
+		path, query, ok := relativeToBase(cfg, e.URL)
+		if !ok {
+			continue
+		}
+		out = append(out, Observation{Method: e.Method, Path: path, Query: query, RequestBody: e.RequestBody, Status: e.Status, ResponseBody: e.ResponseBody})
+	}
+	return out, nil
+}
+
+func cassetteObservations(cfg *ResolvedConfig, file string) ([]Observation, error) {
+	c, err := OpenReplayCassette(file)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Observation, 0, len(c.Interactions))
+	for _, it := range c.Interactions {
+		path, query, ok := relativeToBase(cfg, it.Request.Path)
+		if !ok {
+			continue
+		}
+		out = append(out, Observation{Method: it.Request.Method, Path: path, Query: query, RequestBody: it.Request.Body, Status: it.Response.Status, ResponseBody: it.Response.Body})
+	}
+	return out, nil
+}
+
+// runSpecInfer implements `api spec infer [--cassette <file>]... [--all] --out <file>`.
+func runSpecInfer(cfg *ResolvedConfig, args []string) error {
+	out := ""
+	cassettes := make([]string, 0)
+	useHistory, all := true, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out", "--cassette":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			if flag == "--out" {
+				out = args[i]
+			} else {
+				cassettes = append(cassettes, args[i])
+			}
+		case "--no-history":
+			useHistory = false
+		case "--all":
+			all = true
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown spec infer option: %s", args[i]))
+		}
+	}
+	if out == "" {
+		return NewCliError(ExitRequestBuild, specInferUsage)
+	}
+
+	observations := make([]Observation, 0)
+	if useHistory {
+		obs, err := historyObservations(cfg)
+		if err != nil {
+			return err
+		}
+		observations = append(observations, obs...)
+	}
+	for _, file := range cassettes {
+		obs, err := cassetteObservations(cfg, file)
+		if err != nil {
+			return err
+		}
+		observations = append(observations, obs...)
+	}
+
+	var spec map[string]any
+	if !all {
+		var err error
+		if spec, err = agentapi.LoadSpec(runCtx, cfg); err != nil {
+			return err
+		}
+	}
+	doc, n := InferSpec(fmt.Sprintf("%s (%s) inferred", cfg.ActiveProject, cfg.ActiveEnv), spec, observations)
+
+	var raw []byte
+	var err error
+	if strings.HasSuffix(strings.ToLower(out), ".json") {
+		raw, err = json.MarshalIndent(doc, "", "  ")
+		raw = append(raw, '\n')
+	} else {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(doc)
+		raw = buf.Bytes()
+	}
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode inferred spec: %v", err), err)
+	}
+	if err := os.WriteFile(out, raw, 0o644); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write %s: %v", out, err), err)
+	}
+	scope := "undocumented "
+	if all {
+		scope = ""
+	}
+	fmt.Printf("Inferred %d %soperations from %d observations -> %s\n", n, scope, len(observations), out)
+	return nil
+}
+
+// RunDescribeResponse implements `api describe-response [--from ...] [--yaml]`:
+// it prints the schema InferSchema derives from a stored response, with the
+// fields missing from some items of an array left out of required.
+func RunDescribeResponse(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api describe-response [--from last|history:<id>|<file>|-] [--yaml]"
+	from, asYAML := "last", false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--from":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --from")
+			}
+			from = args[i]
+		case "--yaml":
+			asYAML = true
+		default:
+			return NewCliError(ExitRequestBuild, usage)
+		}
+	}
+	body, label, err := loadQuerySource(cfg, from)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Response of %s is not JSON", label))
+	}
+	infof("Schema inferred from %s\n", label)
+	schema := InferSchema(doc)
+	if !asYAML {
+		return printJSONIndent(schema)
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(schema); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// lastLocationVar stands, in acurl arguments and test steps, for the
+// location of the resource created last.
+const lastLocationVar = "{{last.location}}"
+
+// createdLocation is where a 201, 202 or 3xx response to requestURL says
+// the resource is: its Location header resolved against requestURL, as a
+// path of the env when one of its bases serves it, else as the absolute
+// URL. It is "" for other responses and those without a Location.
+func createdLocation(cfg *ResolvedConfig, requestURL string, status int, h http.Header) string {
+	loc := h.Get("Location")
+	if loc == "" || (status != http.StatusCreated && status != http.StatusAccepted && (status < 300 || status > 399)) {
+		return ""
+	}
+	ref, err := url.Parse(loc)
+	if err != nil {
+		return ""
+	}
+	if base, err := url.Parse(requestURL); err == nil {
+		ref = base.ResolveReference(ref)
+	}
+	if path, ok := cfg.PathOf(ref.String()); ok {
+		return path
+	}
+	return ref.String()
+}
+
+// expandLastLocation replaces lastLocationVar in args with the newest
+// location the history holds for this session and env.
+func expandLastLocation(cfg *ResolvedConfig, args []string) ([]string, error) {
+	used := false
+	for _, a := range args {
+		used = used || strings.Contains(a, lastLocationVar)
+	}
+	if !used {
+		return args, nil
+	}
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	location := ""
+	for i := len(entries) - 1; i >= 0 && location == ""; i-- {
+		e := entries[i]
+		if e.Project == cfg.ActiveProject && e.Env == cfg.ActiveEnv && e.Session == cfg.Session {
+			location = e.Location
+		}
+	}
+	if location == "" {
+		return nil, NewCliErrorHint(ExitRequestBuild, "No created resource in the history for "+lastLocationVar, "It is the Location of the latest 201, 202 or 3xx response of this session and env: create the resource first.")
+	}
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = strings.ReplaceAll(a, lastLocationVar, location)
+	}
+	return out, nil
+}
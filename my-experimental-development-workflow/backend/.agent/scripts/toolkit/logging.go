@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// logger is the process-wide structured logger. It writes JSON lines to
+// stderr (or --log-file) and is configured by configureLogging before any
+// command runs. Debug covers config, spec, policy and HTTP internals
+// (failures there are also returned as errors, so they stay at debug to
+// avoid printing them twice); info is the default and carries what
+// long-running commands report.
+var logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+// GlobalOptions are flags accepted by every command of both tools.
+type GlobalOptions struct {
+	LogLevel string
+	LogFile  string
+	// NoDaemon skips a running daemon and does all work in-process.
+	NoDaemon bool
+	// Chaos is the --chaos fault injection spec (see ParseChaosSpec).
+	Chaos string
+	// Offline is the --offline fixtures cassette (see enableOffline).
+	Offline string
+	// JSONErrors forces single-line JSON errors on stderr (see writeError).
+	JSONErrors bool
+	// Quiet drops informational output: info logs and notes such as
+	// "Snapshot ... written". Warnings and errors remain.
+	Quiet bool
+	// Verbose logs at debug level and traces every HTTP exchange to stderr.
+	Verbose bool
+	// Wide keeps table cells whole on a terminal (see styleFor).
+	Wide bool
+}
+
+// extractGlobalFlags removes global flags from args wherever they appear.
+func extractGlobalFlags(args []string) ([]string, GlobalOptions, error) {
+	var opts GlobalOptions
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--no-daemon":
+			opts.NoDaemon = true
+		case "--json":
+			opts.JSONErrors = true
+		case "--quiet":
+			opts.Quiet = true
+		case "--verbose":
+			opts.Verbose = true
+		case "--wide":
+			opts.Wide = true
+		case "--log-level", "--log-file", "--chaos", "--offline":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return nil, opts, NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--log-level":
+				opts.LogLevel = args[i]
+			case "--log-file":
+				opts.LogFile = args[i]
+			case "--offline":
+				opts.Offline = args[i]
+			default:
+				opts.Chaos = args[i]
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	if opts.Quiet && opts.Verbose {
+		return nil, opts, NewCliError(ExitRequestBuild, "--quiet and --verbose are mutually exclusive")
+	}
+	if (opts.Quiet || opts.Verbose) && opts.LogLevel != "" {
+		return nil, opts, NewCliError(ExitRequestBuild, "--log-level cannot be combined with --quiet or --verbose")
+	}
+	return rest, opts, nil
+}
+
+// configureLogging installs the logger for the given options and returns a
+// function that releases the log file, if any.
+func configureLogging(opts GlobalOptions) (func(), error) {
+	level := slog.LevelInfo
+	quiet = opts.Quiet
+	switch {
+	case opts.Quiet:
+		level = slog.LevelWarn
+	case opts.Verbose:
+		level = slog.LevelDebug
+		traceOut = os.Stderr
+		agentapi.DefaultTransport = traced(http.DefaultTransport)
+	}
+	if opts.LogLevel != "" {
+		switch strings.ToLower(opts.LogLevel) {
+		case "debug":
+			level = slog.LevelDebug
+		case "info":
+			level = slog.LevelInfo
+		case "warn", "warning":
+			level = slog.LevelWarn
+		case "error":
+			level = slog.LevelError
+		default:
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --log-level: %s (expected debug|info|warn|error)", opts.LogLevel))
+		}
+	}
+
+	var out io.Writer = os.Stderr
+	closeFn := func() {}
+	if opts.LogFile != "" {
+		f, err := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, WrapCliError(ExitConfig, fmt.Sprintf("Failed to open --log-file %s: %v", opts.LogFile, err), err)
+		}
+		out = f
+		closeFn = func() { _ = f.Close() }
+	}
+	logger = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level}))
+	agentapi.Logger = logger
+	return closeFn, nil
+}
+
+// quiet is set by --quiet; infof checks it.
+var quiet bool
+
+// infof prints an informational note to stderr unless --quiet is set.
+func infof(format string, args ...any) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// traceOut receives the --verbose HTTP trace; nil disables tracing.
+var traceOut io.Writer
+
+// traced wraps next (nil: http.DefaultTransport) so each exchange is traced
+// to traceOut in curl -v style: the request line and headers after "> ",
+// the status line and headers after "< ", failures after "* ", then the
+// body sizes and the transfer time once the response body is read. Secret
+// headers are redacted as in the history; bodies are never traced, so
+// stdout data is not repeated on stderr. Without --verbose it returns next.
+func traced(next http.RoundTripper) http.RoundTripper {
+	if traceOut == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &traceTransport{next: next, out: traceOut}
+}
+
+type traceTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+	mu   sync.Mutex
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "> %s %s\n", req.Method, req.URL.Redacted())
+	writeTraceHeaders(&b, "> ", req.Header)
+	t.write(&b)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Milliseconds()
+	if err != nil {
+		fmt.Fprintf(&b, "* %s %s failed after %dms: %v\n", req.Method, req.URL.Redacted(), elapsed, err)
+	} else {
+		fmt.Fprintf(&b, "< %s %s (%dms)\n", resp.Proto, resp.Status, elapsed)
+		writeTraceHeaders(&b, "< ", resp.Header)
+		resp.Body = &tracedBody{ReadCloser: resp.Body, trace: t, sent: max(req.ContentLength, 0), start: start}
+	}
+	t.write(&b)
+	return resp, err
+}
+
+// tracedBody counts a response body and traces the transfer when it is
+// fully read or closed, whichever comes first.
+type tracedBody struct {
+	io.ReadCloser
+	trace    *traceTransport
+	sent     int64
+	received int64
+	start    time.Time
+	done     bool
+}
+
+func (t *tracedBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.received += int64(n)
+	if err == io.EOF {
+		t.report()
+	}
+	return n, err
+}
+
+func (t *tracedBody) Close() error {
+	t.report()
+	return t.ReadCloser.Close()
+}
+
+func (t *tracedBody) report() {
+	if t.done {
+		return
+	}
+	t.done = true
+	var b strings.Builder
+	fmt.Fprintf(&b, "* %d bytes sent, %d bytes received in %dms\n", t.sent, t.received, time.Since(t.start).Milliseconds())
+	t.trace.write(&b)
+}
+
+// write prints b as one block, so concurrent exchanges (spec pull,
+// find --all) do not interleave within a request or a response, and
+// resets it.
+func (t *traceTransport) write(b *strings.Builder) {
+	t.mu.Lock()
+	io.WriteString(t.out, b.String())
+	t.mu.Unlock()
+	b.Reset()
+}
+
+func writeTraceHeaders(b *strings.Builder, prefix string, h http.Header) {
+	redacted := redactHeaders(h)
+	keys := make([]string, 0, len(redacted))
+	for k := range redacted {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s%s: %s\n", prefix, k, redacted[k])
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// jsonArrayOf is a JSON array of n small integers.
+func jsonArrayOf(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprint(i % 100)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+// jsonObjectOf is a JSON object of n keys, in the order encoding/json
+// prints them.
+func jsonObjectOf(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`"k%06d":%d`, i, i%100)
+	}
+	return "{" + strings.Join(items, ",") + "}"
+}
+
+// jsonStringOf is a JSON string of n bytes.
+func jsonStringOf(n int) string {
+	return `"` + strings.Repeat("x", n) + `"`
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	testRoundTrip(t, msgpackCodec{}, []codecCase{
+		{name: "nil", json: "null"},
+		{name: "true", json: "true"},
+		{name: "false", json: "false"},
+		{name: "positive fixint", json: "127"},
+		{name: "uint8", json: "255"},
+		{name: "uint16", json: "65535"},
+		{name: "uint32", json: "4294967295"},
+		{name: "uint64", json: "4294967296"},
+		{name: "max int64", json: "9223372036854775807"},
+		{name: "max uint64", json: "18446744073709551615"},
+		{name: "negative fixint", json: "-32"},
+		{name: "int8", json: "-128"},
+		{name: "int16", json: "-32768"},
+		{name: "int32", json: "-2147483648"},
+		{name: "int64", json: "-9223372036854775808"},
+		{name: "float64", json: "1.5"},
+		{name: "large float64", json: "-1e+300"},
+		{name: "integral float", json: "2.0", want: "2"},
+		{name: "empty fixstr", json: `""`},
+		{name: "fixstr", json: jsonStringOf(31)},
+		{name: "str8", json: jsonStringOf(32)},
+		{name: "str16", json: jsonStringOf(256)},
+		{name: "str32", json: jsonStringOf(65536)},
+		{name: "utf-8", json: `"héllo ✓"`},
+		{name: "empty fixarray", json: "[]"},
+		{name: "fixarray", json: jsonArrayOf(15)},
+		{name: "array16", json: jsonArrayOf(16)},
+		{name: "array32", json: jsonArrayOf(65536)},
+		{name: "empty fixmap", json: "{}"},
+		{name: "fixmap", json: jsonObjectOf(15)},
+		{name: "map16", json: jsonObjectOf(16)},
+		{name: "map32", json: jsonObjectOf(65536)},
+		{name: "mixed", json: `{"a":[1,-1,1.5,"s",null,true,{"b":[]}],"c":{}}`},
+	})
+}
+
+func TestMsgpackDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{"bin8", []byte{0xc4, 0x03, 1, 2, 3}, `"AQID"`},
+		{"bin16", []byte{0xc5, 0x00, 0x01, 0xff}, `"/w=="`},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0, 0}, `1.5`},
+		{"NaN", []byte{0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1}, `"NaN"`},
+		{"uint8 as int", []byte{0xcc, 0x05}, `5`},
+		{"timestamp32", []byte{0xd6, 0xff, 0, 0, 0, 60}, `"1970-01-01T00:01:00Z"`},
+		{"timestamp96", []byte{0xc7, 12, 0xff, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 60}, `"1970-01-01T00:01:00.000000001Z"`},
+		{"fixext1", []byte{0xd4, 0x05, 0xaa}, `{"data":"qg==","ext_type":5}`},
+		{"integer key", []byte{0x81, 0x01, 0x02}, `{"1":2}`},
+	} {
+		got, err := decodeBody(msgpackCodec{}, tc.body)
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s: % x decoded to %s, %v; want %s", tc.name, tc.body, got, err, tc.want)
+		}
+	}
+}
+
+func TestMsgpackDecodeErrors(t *testing.T) {
+	testDecodeErrors(t, msgpackCodec{}, map[string][]byte{
+		"empty":              {},
+		"never used byte":    {0xc1},
+		"trailing bytes":     {0x01, 0x02},
+		"str8 too long":      {0xd9, 0x05, 'a', 'b'},
+		"str32 too long":     {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"bin32 too long":     {0xc6, 0xff, 0xff, 0xff, 0xff, 0x00},
+		"ext32 too long":     {0xc9, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"array16 too long":   {0xdc, 0x00, 0x03, 0x01},
+		"array32 too long":   {0xdd, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"map32 too long":     {0xdf, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02},
+		"fixmap short value": {0x81, 0x01},
+		"length truncated":   {0xda, 0x01},
+		"float64 truncated":  {0xcb, 0x3f, 0xf0},
+	})
+	testPrefixesFail(t, msgpackCodec{}, `{"a":[1,-200,70000,1.5,"str",null,true],"b":{"c":18446744073709551615}}`)
+}
+
+func TestMsgpackDepthLimit(t *testing.T) {
+	testDepthLimit(t, msgpackCodec{})
+}
+
+func FuzzDecodeMsgpack(f *testing.F) {
+	for _, json := range []string{`null`, `-1`, `1.5`, `"s"`, `[1,[2]]`, `{"a":{"b":[true,false]}}`, `18446744073709551615`} {
+		b, err := encodeBody(msgpackCodec{}, "test", json)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(b))
+	}
+	f.Add([]byte{0xd6, 0xff, 0, 0, 0, 60})
+	f.Add([]byte{0xc7, 12, 0xff, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 60})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		fuzzDecode(t, msgpackCodec{}, body)
+	})
+}
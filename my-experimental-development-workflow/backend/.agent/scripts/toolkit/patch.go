@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const (
+	jsonPatchType  = "application/json-patch+json"
+	mergePatchType = "application/merge-patch+json"
+)
+
+// parsePatchOp turns "replace /price 9.99" into a JSON Patch (RFC 6902)
+// operation. add, replace and test take a pointer and a value, read as
+// JSON when it parses and as a string otherwise; move and copy take the
+// pointer moved from and the one moved to; remove takes a pointer.
+func parsePatchOp(s string) (map[string]any, error) {
+	invalid := func(reason string) error {
+		return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid --patch-op %q: %s", s, reason), `Use "<op> <pointer> [value]", e.g. --patch-op 'replace /price 9.99' or --patch-op 'move /old /new'.`)
+	}
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[1], "/") {
+		return nil, invalid("expected an operation and a JSON pointer starting with /")
+	}
+	op := map[string]any{"op": parts[0], "path": parts[1]}
+	switch parts[0] {
+	case "remove":
+		if len(parts) == 3 {
+			return nil, invalid("remove takes no value")
+		}
+	case "add", "replace", "test":
+		if len(parts) < 3 {
+			return nil, invalid(parts[0] + " needs a value")
+		}
+		op["value"] = parseEditValue(parts[2])
+	case "move", "copy":
+		if len(parts) < 3 || !strings.HasPrefix(parts[2], "/") {
+			return nil, invalid(parts[0] + " needs the pointer to " + parts[0] + " to")
+		}
+		op["from"], op["path"] = parts[1], parts[2]
+	default:
+		return nil, invalid("the operation is one of add, remove, replace, move, copy or test")
+	}
+	return op, nil
+}
+
+// applyPatchOptions builds the body of --patch-op or --merge into
+// opts.Data with its Content-Type, after checking that the operation
+// accepts that media type when the spec declares its request body. The
+// method defaults to PATCH.
+func applyPatchOptions(cfg *ResolvedConfig, method, path string, opts *acurlOptions) (string, error) {
+	switch {
+	case len(opts.PatchOps) > 0 && opts.Merge != "":
+		return "", NewCliError(ExitRequestBuild, "--patch-op and --merge build different bodies; use one")
+	case opts.Data != "" || opts.Edit || opts.Soft:
+		return "", NewCliError(ExitRequestBuild, "--patch-op and --merge build the body; drop -d/--edit/--soft")
+	}
+	for _, h := range opts.Headers {
+		if k, _, _ := strings.Cut(h, ":"); strings.EqualFold(strings.TrimSpace(k), "Content-Type") {
+			return "", NewCliError(ExitRequestBuild, "--patch-op and --merge set the Content-Type header; drop -H \"Content-Type: ...\"")
+		}
+	}
+	if method == "" {
+		method = http.MethodPatch
+	}
+	if method != http.MethodPatch {
+		return "", NewCliError(ExitRequestBuild, fmt.Sprintf("--patch-op and --merge build a PATCH body, not a %s one", method))
+	}
+
+	mediaType := jsonPatchType
+	if opts.Merge != "" {
+		mediaType = mergePatchType
+		var v any
+		if err := json.Unmarshal([]byte(opts.Merge), &v); err != nil {
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --merge: %v", err))
+		}
+		if _, ok := v.(map[string]any); !ok {
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --merge: a merge patch is a JSON object, got %s", jsonTypeName(v)))
+		}
+		opts.Data = opts.Merge
+	} else {
+		ops := make([]any, 0, len(opts.PatchOps))
+		for _, s := range opts.PatchOps {
+			op, err := parsePatchOp(s)
+			if err != nil {
+				return "", err
+			}
+			ops = append(ops, op)
+		}
+		b, _ := json.Marshal(ops)
+		opts.Data = string(b)
+	}
+
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		logger.Debug("patch media type not checked, spec unavailable", "error", err)
+	} else if accepted := acceptedMediaTypes(spec, method, path); len(accepted) > 0 && !acceptMatches(strings.Join(accepted, ","), mediaType) {
+		return "", NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("%s %s does not accept %s (the spec lists %s)", method, path, mediaType, strings.Join(accepted, ", ")), "Send the body the operation accepts with -d instead.")
+	}
+	opts.Headers = append(opts.Headers, "Content-Type: "+mediaType)
+	return method, nil
+}
+
+// acceptedMediaTypes lists the request body media types the spec declares
+// for method on path; none when it declares no request body.
+func acceptedMediaTypes(spec map[string]any, method, path string) []string {
+	for _, op := range agentapi.OperationsForPath(spec, path) {
+		if op.Method != method {
+			continue
+		}
+		rb, ok := agentapi.AsMap(op.Raw["requestBody"])
+		if !ok {
+			return nil
+		}
+		content, _ := agentapi.AsMap(derefSchema(spec, rb)["content"])
+		return agentapi.SortedKeys(content)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Preflight is what the server says about a path: the methods its OPTIONS
+// answer allows (Allow, else Access-Control-Allow-Methods) or, when that
+// names none, the status of a HEAD.
+type Preflight struct {
+	Method string   `json:"method"`
+	Status int      `json:"status"`
+	Allow  []string `json:"allow,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// sendPreflight sends OPTIONS, then HEAD if OPTIONS names no methods. Both
+// are allowed in every api_mode; strict mode is skipped because specs
+// rarely declare them.
+func sendPreflight(cfg *ResolvedConfig, path, token string) Preflight {
+	unchecked := *cfg
+	unchecked.Strict = false
+	var p Preflight
+	for _, method := range []string{http.MethodOptions, http.MethodHead} {
+		p = Preflight{Method: method}
+		resp, err := PerformRequest(&unchecked, APIRequest{Method: method, Path: path, TokenName: token, Source: "preflight"})
+		if err != nil {
+			p.Error = ExitMessage(err)
+			return p
+		}
+		p.Status = resp.StatusCode
+		allow := resp.Header.Get("Allow")
+		if allow == "" {
+			allow = resp.Header.Get("Access-Control-Allow-Methods")
+		}
+		for _, m := range strings.Split(allow, ",") {
+			if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+				p.Allow = append(p.Allow, m)
+			}
+		}
+		if len(p.Allow) > 0 {
+			return p
+		}
+	}
+	return p
+}
+
+// serverAllows reports whether the preflight lets method through; known is
+// false when the server named no methods.
+func (p *Preflight) serverAllows(method string) (allowed, known bool) {
+	if p == nil || len(p.Allow) == 0 {
+		return false, false
+	}
+	for _, m := range p.Allow {
+		if m == method || m == "*" {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// MethodExplanation is the verdict on one method of a path: local policy
+// (api_mode and strict), the spec and, with a preflight, the server.
+type MethodExplanation struct {
+	Method  string
+	Policy  string
+	Spec    string
+	Server  string
+	Allowed bool
+}
+
+// explainPolicy explains each method of path: only, when given, else those
+// of the spec and the preflight, else the usual five. A write without a
+// body is judged as if it carried agent_marker, and every write as if it
+// sent the env's required_headers.
+func explainPolicy(cfg *ResolvedConfig, path, body, token, only string, pre *Preflight) []MethodExplanation {
+	declared := map[string]bool{}
+	specKnown := false
+	if spec, err := agentapi.LoadSpecPaths(runCtx, cfg); err == nil {
+		specKnown = true
+		for _, op := range agentapi.OperationsForPath(spec, path) {
+			declared[op.Method] = true
+		}
+	} else {
+		logger.Debug("policy explained without spec", "error", err)
+	}
+	methods := []string{only}
+	if only == "" {
+		methods = methods[:0]
+		for _, m := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+			if allowed, _ := pre.serverAllows(m); declared[m] || allowed {
+				methods = append(methods, m)
+			}
+		}
+		if len(methods) == 0 {
+			methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+		}
+	}
+
+	headerless := *cfg
+	headerless.RequiredHeaders = nil
+	headers := make([]string, len(cfg.RequiredHeaders))
+	for i, h := range cfg.RequiredHeaders {
+		headers[i] = h.Name
+	}
+	out := make([]MethodExplanation, 0, len(methods))
+	for _, m := range methods {
+		e := MethodExplanation{Method: m, Policy: "allowed"}
+		needs := make([]string, 0, 2)
+		b := body
+		if b == "" && (m == "POST" || m == "PUT" || m == "PATCH") {
+			b = cfg.AgentMarker
+			if cfg.APIMode == "safe-updates" {
+				needs = append(needs, cfg.AgentMarker+" in the body")
+			}
+		}
+		if len(headers) > 0 && (m == "POST" || m == "PUT" || m == "PATCH" || m == "DELETE") {
+			needs = append(needs, "header "+strings.Join(headers, ", "))
+		}
+		if len(needs) > 0 {
+			e.Policy = "allowed with " + strings.Join(needs, " and ")
+		}
+		err := CheckPolicy(&headerless, APIRequest{Method: m, Path: path, TokenName: token, Body: b})
+		if err != nil {
+			e.Policy = "blocked: " + ExitMessage(err)
+		}
+		switch {
+		case !specKnown:
+			e.Spec = "unknown"
+		case declared[m]:
+			e.Spec = "declared"
+		default:
+			e.Spec = "not declared"
+		}
+		serverOK := true
+		if pre != nil {
+			allowed, known := pre.serverAllows(m)
+			switch {
+			case !known:
+				e.Server = "unknown"
+			case allowed:
+				e.Server = "allowed"
+			default:
+				e.Server, serverOK = "not allowed", false
+			}
+		}
+		e.Allowed = err == nil && serverOK
+		out = append(out, e)
+	}
+	return out
+}
+
+// RunPolicyCommand implements `api policy explain [METHOD] <path> ...`.
+func RunPolicyCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api policy explain [METHOD] <path> [-d <json_body>] [--token <name>] [--preflight] [--format table|csv|json|ndjson]"
+	if len(args) < 2 || args[0] != "explain" {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	method, path, rest, err := normalizeMethodAndPath(args[1:])
+	if err != nil {
+		return err
+	}
+	body, token, format := "", "", "table"
+	preflight := false
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case "-d", "--data", "--token", "--format":
+			flag := rest[i]
+			i++
+			if i >= len(rest) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--token":
+				token = rest[i]
+			case "--format":
+				format = rest[i]
+			default:
+				body = rest[i]
+			}
+		case "--preflight":
+			preflight = true
+		default:
+			return NewCliError(ExitRequestBuild, usage)
+		}
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+
+	var pre *Preflight
+	if preflight {
+		p := sendPreflight(cfg, path, token)
+		pre = &p
+		switch {
+		case p.Error != "":
+			infof("Preflight %s %s failed: %s\n", p.Method, path, p.Error)
+		case len(p.Allow) > 0:
+			infof("Preflight %s %s: HTTP %d, allows %s\n", p.Method, path, p.Status, strings.Join(p.Allow, ", "))
+		default:
+			infof("Preflight %s %s: HTTP %d, no Allow header\n", p.Method, path, p.Status)
+		}
+	}
+	t := &Table{
+		Columns: []string{"METHOD", "POLICY", "SPEC", "SERVER", "VERDICT"},
+		Keys:    []string{"method", "policy", "spec", "server", "verdict"},
+	}
+	for _, e := range explainPolicy(cfg, path, body, token, method, pre) {
+		verdict := "no"
+		if e.Allowed {
+			verdict = "yes"
+		}
+		t.Rows = append(t.Rows, []string{e.Method, e.Policy, e.Spec, e.Server, verdict})
+	}
+	infof("%s/%s: api_mode=%s, strict=%t\n", cfg.ActiveProject, cfg.ActiveEnv, cfg.APIMode, cfg.Strict)
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const (
+	projectUsage = "Usage: api project use <name> [--env <env>] | list [--format table|csv|json|ndjson]"
+	envUsage     = "Usage: api env use <name> | list [--project <name> | --all] [--format table|csv|json|ndjson]"
+)
+
+// RunProjectCommand implements `api project use <name> [--env <env>]`:
+// the project becomes active_project in config.toml, keeping the active
+// env when the project has one of that name; and `api project list`. It
+// runs before the config is loaded, so it also repairs an active_project
+// that no longer exists.
+func RunProjectCommand(configPath string, args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		return runContextList(configPath, "project", args[1:])
+	}
+	if len(args) < 2 || args[0] != "use" {
+		return NewCliError(ExitRequestBuild, projectUsage)
+	}
+	project, env := args[1], ""
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--env":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --env")
+			}
+			env = args[i]
+		default:
+			return NewCliError(ExitRequestBuild, projectUsage)
+		}
+	}
+	return useActive(configPath, project, env)
+}
+
+// RunEnvCommand implements `api env use <name>`: the env of the active
+// project becomes active_env in config.toml; and `api env list`.
+func RunEnvCommand(configPath string, args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		return runContextList(configPath, "env", args[1:])
+	}
+	if len(args) != 2 || args[0] != "use" {
+		return NewCliError(ExitRequestBuild, envUsage)
+	}
+	return useActive(configPath, "", args[1])
+}
+
+// runContextList implements `api project list` (one row per project) and
+// `api env list` (one per env of the active project, of --project, or of
+// every project with --all), the active one marked, so the contexts to
+// switch to are known without reading the TOML.
+func runContextList(configPath, kind string, args []string) error {
+	usage := projectUsage
+	if kind == "env" {
+		usage = envUsage
+	}
+	format, project := "table", ""
+	all := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--all" && kind == "env":
+			all = true
+		case args[i] == "--format" || (args[i] == "--project" && kind == "env"):
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			if flag == "--format" {
+				format = args[i]
+			} else {
+				project = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, usage)
+		}
+	}
+	if all && project != "" {
+		return NewCliError(ExitRequestBuild, "--all and --project are mutually exclusive")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	envs, err := agentapi.ListEnvs(configPath)
+	if err != nil {
+		return err
+	}
+
+	var t *Table
+	if kind == "project" {
+		t = projectsTable(envs)
+	} else {
+		if !all && project == "" {
+			for _, e := range envs {
+				if e.Active {
+					project = e.Project
+				}
+			}
+			if project == "" {
+				return NewCliErrorHint(ExitConfig, "The active project or env is not configured", "Name a project with --project, list every env with --all, or switch with api project use.")
+			}
+		}
+		t = &Table{
+			Columns: []string{"PROJECT", "ENV", "API_MODE", "API_BASE", "TAGS", "ACTIVE", "SOURCE"},
+			Keys:    []string{"project", "env", "api_mode", "api_base", "tags", "active", "source"},
+			Empty:   "No envs configured.",
+		}
+		known, found := make([]string, 0), all
+		for _, e := range envs {
+			if len(known) == 0 || known[len(known)-1] != e.Project {
+				known = append(known, e.Project)
+			}
+			found = found || e.Project == project
+			if e.Env == "" || (!all && e.Project != project) {
+				continue
+			}
+			active := ""
+			if e.Active {
+				active = "yes"
+			}
+			t.Rows = append(t.Rows, []string{e.Project, e.Env, e.APIMode, e.APIBase, strings.Join(e.Tags, ","), active, e.Source})
+		}
+		if !found {
+			return NewCliErrorHint(ExitConfig, fmt.Sprintf("Project '%s' not found under [projects]%s", project, agentapi.DidYouMean(project, known)), fmt.Sprintf("Use one of: %s.", strings.Join(known, ", ")))
+		}
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
+
+// projectsTable has one row per project: its envs and whether it is the
+// active one.
+func projectsTable(envs []agentapi.EnvInfo) *Table {
+	t := &Table{
+		Columns: []string{"PROJECT", "ENVS", "COUNT", "ACTIVE", "SOURCE"},
+		Keys:    []string{"project", "envs", "count", "active", "source"},
+		Empty:   "No projects configured.",
+	}
+	for i := 0; i < len(envs); {
+		j, names, active := i, make([]string, 0), ""
+		sources, seen := make([]string, 0), map[string]bool{}
+		for ; j < len(envs) && envs[j].Project == envs[i].Project; j++ {
+			if envs[j].Env != "" {
+				names = append(names, envs[j].Env)
+			}
+			for _, s := range strings.Split(envs[j].Source, ", ") {
+				if s != "" && !seen[s] {
+					seen[s] = true
+					sources = append(sources, s)
+				}
+			}
+			switch {
+			case envs[j].Active && envs[j].Env != "":
+				active = "yes (" + envs[j].Env + ")"
+			case envs[j].Active:
+				active = "yes"
+			}
+		}
+		t.Rows = append(t.Rows, []string{envs[i].Project, strings.Join(names, ","), strconv.Itoa(len(names)), active, strings.Join(sources, ", ")})
+		i = j
+	}
+	return t
+}
+
+func useActive(configPath, project, env string) error {
+	fromProject, fromEnv, err := agentapi.SetActive(configPath, project, env)
+	if err != nil {
+		return err
+	}
+	cfg, err := agentapi.LoadConfig(configPath)
+	if err != nil {
+		return NewCliErrorHint(ExitCode(err), fmt.Sprintf("Switched from %s/%s, but the new active env does not load: %s", fromProject, fromEnv, ExitMessage(err)), agentapi.Suggestion(err))
+	}
+	infof("Active: %s/%s (%s), was %s/%s.\n", cfg.ActiveProject, cfg.ActiveEnv, cfg.APIMode, fromProject, fromEnv)
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pbBytes and pbVarint encode one field of a descriptor.
+func pbBytes(num uint64, val string) string {
+	b := binary.AppendUvarint(nil, num<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(val)))
+	return string(b) + val
+}
+
+func pbVarint(num, val uint64) string {
+	return string(binary.AppendUvarint(binary.AppendUvarint(nil, num<<3|wireVarint), val))
+}
+
+// pbField is a FieldDescriptorProto; typeName is set for messages and enums.
+func pbField(name string, number uint64, typ int, repeated bool, typeName string) string {
+	label := uint64(1)
+	if repeated {
+		label = 3
+	}
+	f := pbBytes(1, name) + pbVarint(3, number) + pbVarint(4, label) + pbVarint(5, uint64(typ))
+	if typeName != "" {
+		f += pbBytes(6, typeName)
+	}
+	return f
+}
+
+// testProtoCodec is the codec of t.Node, a proto3 message with a field of
+// every scalar type (numbered as the type), a nested message, an enum, a
+// packed and an unpacked repeated field and a map:
+//
+//	message Node {
+//	  double d = 1; float f = 2; int64 i64 = 3; uint64 u64 = 4; int32 i32 = 5;
+//	  fixed64 fx64 = 6; fixed32 fx32 = 7; bool b = 8; string s = 9;
+//	  Node child = 11; bytes by = 12; uint32 u32 = 13; Color color = 14;
+//	  sfixed32 sf32 = 15; sfixed64 sf64 = 16; sint32 si32 = 17; sint64 si64 = 18;
+//	  repeated int32 nums = 19; repeated string tags = 20;
+//	  map<string, int32> counts = 21; int32 snake_case = 22;
+//	}
+//	enum Color { RED = 0; BLUE = 1; }
+func testProtoCodec(t testing.TB) bodyCodec {
+	t.Helper()
+	fields := []string{
+		pbField("d", 1, protoDouble, false, ""),
+		pbField("f", 2, protoFloat, false, ""),
+		pbField("i64", 3, protoInt64, false, ""),
+		pbField("u64", 4, protoUint64, false, ""),
+		pbField("i32", 5, protoInt32, false, ""),
+		pbField("fx64", 6, protoFixed64, false, ""),
+		pbField("fx32", 7, protoFixed32, false, ""),
+		pbField("b", 8, protoBool, false, ""),
+		pbField("s", 9, protoString, false, ""),
+		pbField("child", 11, protoMessage, false, ".t.Node"),
+		pbField("by", 12, protoBytes, false, ""),
+		pbField("u32", 13, protoUint32, false, ""),
+		pbField("color", 14, protoEnum, false, ".t.Color"),
+		pbField("sf32", 15, protoSfixed32, false, ""),
+		pbField("sf64", 16, protoSfixed64, false, ""),
+		pbField("si32", 17, protoSint32, false, ""),
+		pbField("si64", 18, protoSint64, false, ""),
+		pbField("nums", 19, protoInt32, true, ""),
+		pbField("tags", 20, protoString, true, ""),
+		pbField("counts", 21, protoMessage, true, ".t.Node.CountsEntry"),
+		pbField("snake_case", 22, protoInt32, false, ""),
+	}
+	entry := pbBytes(1, "CountsEntry") +
+		pbBytes(2, pbField("key", 1, protoString, false, "")) +
+		pbBytes(2, pbField("value", 2, protoInt32, false, "")) +
+		pbBytes(7, pbVarint(7, 1))
+	node := pbBytes(1, "Node")
+	for _, f := range fields {
+		node += pbBytes(2, f)
+	}
+	node += pbBytes(3, entry)
+	color := pbBytes(1, "Color") + pbBytes(2, pbBytes(1, "RED")+pbVarint(2, 0)) + pbBytes(2, pbBytes(1, "BLUE")+pbVarint(2, 1))
+	file := pbBytes(1, "t.proto") + pbBytes(2, "t") + pbBytes(4, node) + pbBytes(5, color) + pbBytes(12, "proto3")
+
+	path := filepath.Join(t.TempDir(), "t.pb")
+	if err := os.WriteFile(path, []byte(pbBytes(1, file)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	codec, err := newProtoCodec(map[string]string{"proto": "t.Node"}, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	testRoundTrip(t, testProtoCodec(t), []codecCase{
+		{name: "empty", json: `{}`},
+		{name: "double", json: `{"d":1.5}`},
+		{name: "double NaN", json: `{"d":"NaN"}`},
+		{name: "double infinity", json: `{"d":"-Infinity"}`},
+		{name: "float", json: `{"f":0.25}`},
+		{name: "int64", json: `{"i64":"-5"}`},
+		{name: "int64 from number", json: `{"i64":-9223372036854775808}`, want: `{"i64":"-9223372036854775808"}`},
+		{name: "uint64", json: `{"u64":"18446744073709551615"}`},
+		{name: "int32", json: `{"i32":-7}`},
+		{name: "fixed64", json: `{"fx64":"9"}`},
+		{name: "fixed32", json: `{"fx32":4294967295}`},
+		{name: "bool", json: `{"b":true}`},
+		{name: "string", json: `{"s":"héllo ✓"}`},
+		{name: "bytes", json: `{"by":"AQID"}`},
+		{name: "uint32", json: `{"u32":4294967295}`},
+		{name: "enum", json: `{"color":"BLUE"}`},
+		{name: "enum by number", json: `{"color":1}`, want: `{"color":"BLUE"}`},
+		{name: "sfixed32", json: `{"sf32":-3}`},
+		{name: "sfixed64", json: `{"sf64":"-9"}`},
+		{name: "sint32", json: `{"si32":-100}`},
+		{name: "sint64", json: `{"si64":"-100000000000"}`},
+		{name: "packed", json: `{"nums":[1,-2,300]}`},
+		{name: "repeated string", json: `{"tags":["a","b"]}`},
+		{name: "map", json: `{"counts":{"x":1,"y":2}}`},
+		{name: "json name", json: `{"snake_case":4}`, want: `{"snakeCase":4}`},
+		{name: "nested", json: `{"child":{"child":{"i32":1},"s":"in"},"nums":[5]}`},
+	})
+}
+
+func TestProtobufDecodeErrors(t *testing.T) {
+	codec := testProtoCodec(t)
+	testDecodeErrors(t, codec, map[string][]byte{
+		"truncated key":             {0x80},
+		"truncated varint":          {0x28, 0x80},
+		"string too long":           {0x4a, 0x05, 'a'},
+		"length past 64 bits":       {0x4a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"length beyond the message": {0x4a, 0xff, 0xff, 0xff, 0xff, 0x0f, 'a'},
+		"fixed64 truncated":         {0x09, 0x01, 0x02},
+		"fixed32 truncated":         {0x3d, 0x01},
+		"packed varint truncated":   {0x9a, 0x01, 0x01, 0x80},
+		"packed fixed truncated":    {0x32, 0x03, 0x01, 0x02, 0x03},
+		"wrong wire type":           {0x48, 0x01},
+		"group wire type":           {0x0b},
+		"nested truncated":          {0x5a, 0x02, 0x28, 0x80},
+		"nested too long":           {0x5a, 0x05, 0x28, 0x01},
+	})
+}
+
+func TestProtobufDepthLimit(t *testing.T) {
+	codec := testProtoCodec(t)
+	nested := func(depth int) string {
+		return strings.Repeat(`{"child":`, depth) + `{"i32":1}` + strings.Repeat("}", depth)
+	}
+	ok, err := encodeBody(codec, "test", nested(maxCodecDepth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode([]byte(ok)); err != nil {
+		t.Errorf("nested %d deep: %v", maxCodecDepth, err)
+	}
+	deep, err := encodeBody(codec, "test", nested(maxCodecDepth+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode([]byte(deep)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("nested %d deep: %v, want the depth error", maxCodecDepth+1, err)
+	}
+}
+
+func FuzzDecodeProtobuf(f *testing.F) {
+	codec := testProtoCodec(f)
+	for _, json := range []string{`{}`, `{"d":1.5,"s":"x","nums":[1,2]}`, `{"child":{"child":{"color":"BLUE"}},"counts":{"a":1}}`, `{"si64":"-3","by":"AQID","tags":["a"]}`} {
+		b, err := encodeBody(codec, "test", json)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(b))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		fuzzDecode(t, codec, body)
+	})
+}
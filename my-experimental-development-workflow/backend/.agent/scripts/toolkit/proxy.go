@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// proxyTokenHeader lets a client pick a configured token by name; the token
+// value itself never leaves the proxy.
+const proxyTokenHeader = "X-Agent-Token"
+
+// hopHeaders are connection-level headers that must not be forwarded, plus
+// Authorization, which the proxy always injects itself.
+var hopHeaders = map[string]struct{}{
+	"Connection":          {},
+	"Keep-Alive":          {},
+	"Proxy-Authenticate":  {},
+	"Proxy-Authorization": {},
+	"Te":                  {},
+	"Trailer":             {},
+	"Transfer-Encoding":   {},
+	"Upgrade":             {},
+	"Content-Length":      {},
+	"Accept-Encoding":     {},
+	"Host":                {},
+	"Authorization":       {},
+}
+
+// ProxyHandler forwards local HTTP requests to api_base through
+// PerformRequest, so token injection, api_mode and strict validation apply
+// exactly as they do for acurl. Every request is logged at info level.
+type ProxyHandler struct {
+	cfg  *ResolvedConfig
+	spec map[string]any
+	// hosts are the Host values accepted (localRequestError).
+	hosts []string
+}
+
+// NewProxyHandler loads the spec once up front when strict validation is on.
+func NewProxyHandler(cfg *ResolvedConfig) (*ProxyHandler, error) {
+	h := &ProxyHandler{cfg: cfg}
+	if cfg.Strict {
+		spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		h.spec = spec
+	}
+	return h, nil
+}
+
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if err := localRequestError(r, h.hosts, ""); err != nil {
+		logProxyRequest(r, http.StatusForbidden, start, ExitMessage(err))
+		writeProxyError(w, http.StatusForbidden, err)
+		return
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to read request body: %v", err), err))
+		return
+	}
+
+	headers := make([]string, 0, len(r.Header))
+	for k, vals := range r.Header {
+		if _, skip := hopHeaders[k]; skip || k == proxyTokenHeader {
+			continue
+		}
+		headers = append(headers, k+": "+strings.Join(vals, ", "))
+	}
+
+	// The backend body is relayed as it arrives; it is never held whole.
+	streaming := false
+	resp, err := PerformRequest(h.cfg, APIRequest{
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		TokenName: r.Header.Get(proxyTokenHeader),
+		Body:      string(raw),
+		Headers:   headers,
+		Spec:      h.spec,
+		Source:    "proxy",
+		Stream: func(status int, header http.Header) io.Writer {
+			for k, vals := range header {
+				if _, skip := hopHeaders[k]; skip {
+					continue
+				}
+				for _, v := range vals {
+					w.Header().Add(k, v)
+				}
+			}
+			w.WriteHeader(status)
+			streaming = true
+			return w
+		},
+	})
+	if err != nil {
+		status := errorHTTPStatus(err)
+		logProxyRequest(r, status, start, ExitMessage(err))
+		metrics.RecordRequest("proxy", r.Method, status, time.Since(start), err)
+		if streaming {
+			// Headers are out: break the connection so the client sees a
+			// truncated body, not a complete one.
+			panic(http.ErrAbortHandler)
+		}
+		writeProxyError(w, status, err)
+		return
+	}
+	logProxyRequest(r, resp.StatusCode, start, "")
+	metrics.RecordRequest("proxy", r.Method, resp.StatusCode, time.Since(start), nil)
+}
+
+// loopbackHosts are the Host values of requests to a server listening on
+// 127.0.0.1:port.
+func loopbackHosts(port int) []string {
+	return []string{fmt.Sprintf("127.0.0.1:%d", port), fmt.Sprintf("localhost:%d", port)}
+}
+
+// localRequestError refuses what a web page open in the developer's
+// browser could make a loopback server send with an injected token: a
+// request whose Host is not one of hosts, as after DNS rebinding, and one
+// carrying an Origin other than allowOrigin, as every cross-site fetch or
+// form post does. Empty hosts skip the Host check, for the daemon's unix
+// socket, which no page can reach.
+func localRequestError(r *http.Request, hosts []string, allowOrigin string) error {
+	if len(hosts) > 0 {
+		known := false
+		for _, h := range hosts {
+			if strings.EqualFold(r.Host, h) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Host %q is not this server", r.Host), fmt.Sprintf("Address it as http://%s.", hosts[0]))
+		}
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && (allowOrigin == "" || origin != allowOrigin) {
+		return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Requests from web pages are refused (Origin: %s)", origin), "Call it from a local client; api serve accepts one page origin with --allow-origin.")
+	}
+	return nil
+}
+
+// errorHTTPStatus maps a guardrail or execution error to the status the
+// local servers answer with.
+func errorHTTPStatus(err error) int {
+	switch ExitCode(err) {
+	case ExitBlockedByMode, ExitMarkerMissing, ExitToken:
+		return http.StatusForbidden
+	case ExitRequestBuild:
+		return http.StatusBadRequest
+	case ExitNotFound:
+		return http.StatusNotFound
+	case ExitSpecUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+func writeProxyError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":      ExitMessage(err),
+		"code":       ExitCode(err),
+		"suggestion": agentapi.Suggestion(err),
+	})
+}
+
+func logProxyRequest(r *http.Request, status int, start time.Time, denial string) {
+	attrs := []any{"method", r.Method, "path", r.URL.RequestURI(), "status", status, "duration_ms", time.Since(start).Milliseconds()}
+	if denial != "" {
+		attrs = append(attrs, "error", denial)
+	}
+	logger.Info("proxy request", attrs...)
+}
+
+// RunProxy serves the guardrail proxy on localhost until interrupted.
+func RunProxy(cfg *ResolvedConfig, args []string) error {
+	port := 8080
+	metricsPort := 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--metrics-port":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --metrics-port")
+			}
+			p, err := parsePortFlag("--metrics-port", args[i])
+			if err != nil {
+				return err
+			}
+			metricsPort = p
+		case "--port":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --port")
+			}
+			p, err := parsePortFlag("--port", args[i])
+			if err != nil {
+				return err
+			}
+			port = p
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown proxy option: %s", args[i]))
+		}
+	}
+
+	handler, err := NewProxyHandler(cfg)
+	if err != nil {
+		return err
+	}
+	handler.hosts = loopbackHosts(port)
+	if metricsPort != 0 {
+		ServeMetrics(metricsPort)
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	logger.Info("proxy listening", "addr", "http://"+addr, "api_base", cfg.APIBase, "project", cfg.ActiveProject, "env", cfg.ActiveEnv, "api_mode", cfg.APIMode, "strict", cfg.Strict)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Proxy server failed: %v", err), err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces the response fields named by redact_fields, as
+// redactHeaders replaces credentials.
+const redactedValue = "[redacted]"
+
+// redactBody masks the fields of a JSON body, or of each line of an NDJSON
+// one, that patterns name (bare keys at any depth, "$..." paths with [*]
+// for any index, as diff_ignore). Any other body, and one without such
+// fields, is returned as it is; a masked one is re-encoded compact.
+func redactBody(patterns []string, body []byte) []byte {
+	if len(patterns) == 0 {
+		return body
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return body
+	}
+	if out, masked, ok := redactDocument(patterns, trimmed); ok {
+		if masked {
+			return out
+		}
+		return body
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	changed := false
+	for i, line := range lines {
+		if out, masked, _ := redactDocument(patterns, line); masked {
+			lines[i], changed = out, true
+		}
+	}
+	if !changed {
+		return body
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// redactDocument masks one JSON document; ok is false when raw is not one.
+func redactDocument(patterns []string, raw []byte) (out []byte, masked, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return nil, false, false
+	}
+	if !redactValue(doc, "$", patterns) {
+		return raw, false, true
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, false, false
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), true, true
+}
+
+// redactValue replaces, in place, the members and elements of v below path
+// that patterns name, reporting whether it replaced any.
+func redactValue(v any, path string, patterns []string) bool {
+	masked := false
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			p := childPath(path, k)
+			if diffIgnored(p, k, patterns) {
+				t[k], masked = redactedValue, true
+			} else if redactValue(child, p, patterns) {
+				masked = true
+			}
+		}
+	case []any:
+		for i, child := range t {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if diffIgnored(p, "", patterns) {
+				t[i], masked = redactedValue, true
+			} else if redactValue(child, p, patterns) {
+				masked = true
+			}
+		}
+	}
+	return masked
+}
+
+// redactedField reports whether the dotted field of api edit ("items.0.ssn")
+// is one that patterns name.
+func redactedField(patterns []string, field string) bool {
+	path, key := "$", ""
+	for _, seg := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(seg); err == nil {
+			path, key = path+"["+seg+"]", ""
+		} else {
+			path, key = childPath(path, seg), seg
+		}
+		if diffIgnored(path, key, patterns) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEncoded masks a body as redactBody does, decoding one of a
+// self-describing binary type (msgpack, CBOR) first and encoding it back.
+func redactEncoded(patterns []string, contentType string, body []byte) []byte {
+	codec := selfDescribingCodec(contentType)
+	if len(patterns) == 0 || codec == nil {
+		return redactBody(patterns, body)
+	}
+	v, err := codec.Decode(body)
+	if err != nil || !redactValue(v, "$", patterns) {
+		return body
+	}
+	out, err := codec.Encode(v)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// maskableBody reports whether a body of the given Content-Type may carry
+// fields that redactEncoded masks: JSON, NDJSON or +json, msgpack or CBOR,
+// or an unlabelled body. Such bodies are buffered rather than streamed
+// while redact_fields is set.
+func maskableBody(contentType string) bool {
+	if contentType == "" || selfDescribingCodec(contentType) != nil {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err != nil || strings.Contains(mt, "json")
+}
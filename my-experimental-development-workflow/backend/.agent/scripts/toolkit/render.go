@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRenderBytes is how much of an XML or HTML body is held to be
+// rendered; a larger body is printed as received, streaming as before.
+const maxRenderBytes = 8 << 20
+
+// maxHTMLSummary caps the text extracted from an HTML body, in runes.
+const maxHTMLSummary = 2000
+
+// markupKind classifies a Content-Type as "xml", "html" or "".
+func markupKind(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mt == "text/html" || mt == "application/xhtml+xml":
+		return "html"
+	case mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml"):
+		return "xml"
+	}
+	return ""
+}
+
+// verbatimTypes are media types acurl never reformats: exports whose bytes
+// an agent consumes as they are.
+var verbatimTypes = map[string]bool{
+	"text/csv":                  true,
+	"application/csv":           true,
+	"text/tab-separated-values": true,
+}
+
+// verbatimBody reports whether a body of the given Content-Type is printed
+// byte for byte: a CSV or TSV export, or any other body that is neither JSON
+// nor markup and is what --accept asked for.
+func verbatimBody(contentType, accept string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if verbatimTypes[mt] {
+		return true
+	}
+	if accept == "" || markupKind(contentType) != "" || mt == "application/json" || strings.HasSuffix(mt, "+json") {
+		return false
+	}
+	return acceptMatches(accept, contentType)
+}
+
+// acceptMatches reports whether contentType satisfies an Accept value: a
+// comma-separated list of media ranges, */* and type/* included.
+func acceptMatches(accept, contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, r := range strings.Split(accept, ",") {
+		want, _, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		if want == "*/*" || want == mt {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(want, "/*"); ok && strings.HasPrefix(mt, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// markupRenderer holds an XML or HTML body and writes it to dst rendered
+// on Close: XML indented (or converted to JSON), HTML reduced to its text.
+// Bodies over maxRenderBytes, and XML that does not parse, go to dst as
+// received.
+type markupRenderer struct {
+	dst     io.Writer
+	kind    string
+	xmlJSON bool
+	buf     bytes.Buffer
+	passing bool
+}
+
+// bodyWriter returns where acurl writes a body of the given Content-Type:
+// out itself, or a markupRenderer in front of it, which the caller closes.
+func bodyWriter(out io.Writer, header http.Header, opts *acurlOptions) io.Writer {
+	kind := markupKind(header.Get("Content-Type"))
+	if kind == "" || opts.Raw {
+		return out
+	}
+	return &markupRenderer{dst: out, kind: kind, xmlJSON: opts.XMLJSON}
+}
+
+func (m *markupRenderer) Write(p []byte) (int, error) {
+	if m.passing {
+		return m.dst.Write(p)
+	}
+	if m.buf.Len()+len(p) <= maxRenderBytes {
+		return m.buf.Write(p)
+	}
+	m.passing = true
+	logger.Debug("body too large to render, printed as received", "kind", m.kind, "max_bytes", maxRenderBytes)
+	if _, err := m.dst.Write(m.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	m.buf.Reset()
+	return m.dst.Write(p)
+}
+
+func (m *markupRenderer) Close() error {
+	if m.passing || m.buf.Len() == 0 {
+		return nil
+	}
+	body := m.buf.Bytes()
+	var out []byte
+	var err error
+	switch {
+	case m.kind == "html":
+		infof("HTML body (%d bytes) shown as text; --raw prints the markup.\n", len(body))
+		out = []byte(htmlSummary(body))
+	case m.xmlJSON:
+		out, err = xmlToJSON(body)
+	default:
+		out, err = indentXML(body)
+	}
+	if err != nil {
+		logger.Debug("XML not rendered, printed as received", "error", err)
+		out = body
+	}
+	_, err = m.dst.Write(out)
+	return err
+}
+
+// xmlTokens reads the tokens of an XML document with namespace prefixes
+// folded into local names ("soap:Envelope"), so they are written back as
+// they were instead of as xmlns attributes.
+func xmlTokens(body []byte, fn func(xml.Token) error) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	fold := func(n xml.Name) xml.Name {
+		if n.Space != "" {
+			return xml.Name{Local: n.Space + ":" + n.Local}
+		}
+		return n
+	}
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			t.Name = fold(t.Name)
+			attrs := make([]xml.Attr, len(t.Attr))
+			for i, a := range t.Attr {
+				attrs[i] = xml.Attr{Name: fold(a.Name), Value: a.Value}
+			}
+			t.Attr = attrs
+			tok = t
+		case xml.EndElement:
+			t.Name = fold(t.Name)
+			tok = t
+		}
+		if err := fn(xml.CopyToken(tok)); err != nil {
+			return err
+		}
+	}
+}
+
+// indentXML re-indents an XML document by two spaces per level.
+func indentXML(body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	enc := xml.NewEncoder(&out)
+	enc.Indent("", "  ")
+	err := xmlTokens(body, func(tok xml.Token) error {
+		if cd, ok := tok.(xml.CharData); ok && len(bytes.TrimSpace(cd)) == 0 {
+			return nil // the encoder lays out whitespace between elements
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.ProcInst); ok {
+			// The encoder only breaks lines before nested elements.
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+			out.WriteByte('\n')
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// xmlNode is an element while an XML document is converted to JSON.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// xmlToJSON converts an XML document to JSON: an element becomes an object
+// keyed by child element names (repeated children become an array), with
+// attributes under "@name" and text under "#text"; an element with only
+// text becomes that string. The root is keyed by its name.
+func xmlToJSON(body []byte) ([]byte, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	err := xmlTokens(body, func(tok xml.Token) error {
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.text.Write(t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(root.children) != 1 {
+		return nil, errors.New("XML document needs exactly one root element")
+	}
+	r := root.children[0]
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]any{r.name: r.value()}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (n *xmlNode) value() any {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return text
+	}
+	obj := map[string]any{}
+	for _, a := range n.attrs {
+		obj["@"+a.Name.Local] = a.Value
+	}
+	counts := map[string]int{}
+	for _, c := range n.children {
+		counts[c.name]++
+	}
+	for _, c := range n.children {
+		if counts[c.name] > 1 {
+			list, _ := obj[c.name].([]any)
+			obj[c.name] = append(list, c.value())
+		} else {
+			obj[c.name] = c.value()
+		}
+	}
+	if text != "" {
+		obj["#text"] = text
+	}
+	return obj
+}
+
+// htmlSkipped are elements whose content is never visible text.
+var htmlSkipped = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "svg": true, "head": true, "title": true}
+
+// htmlBlocks are elements that start a new line of text.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true, "section": true, "article": true,
+	"header": true, "footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true, "ul": true, "ol": true, "dt": true, "dd": true, "hr": true,
+}
+
+// htmlSummary extracts what a browser would show of an HTML page: its
+// title, then its visible text a line per block, whitespace collapsed and
+// cut off after maxHTMLSummary runes.
+func htmlSummary(body []byte) string {
+	s := string(body)
+	// Tags are matched in an ASCII-lowered copy, which keeps every byte
+	// offset of s.
+	lb := []byte(s)
+	for i, b := range lb {
+		if 'A' <= b && b <= 'Z' {
+			lb[i] = b + 'a' - 'A'
+		}
+	}
+	lower := string(lb)
+	var text strings.Builder
+	title := ""
+	if i := strings.Index(lower, "<title"); i >= 0 {
+		if open := strings.IndexByte(lower[i:], '>'); open >= 0 {
+			start := i + open + 1
+			if end := strings.Index(lower[start:], "</title"); end >= 0 {
+				title = strings.Join(strings.Fields(html.UnescapeString(s[start:start+end])), " ")
+			}
+		}
+	}
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			j := strings.IndexByte(s[i:], '<')
+			if j < 0 {
+				j = len(s) - i
+			}
+			text.WriteString(html.UnescapeString(s[i : i+j]))
+			i += j
+			continue
+		}
+		if strings.HasPrefix(s[i:], "<!--") {
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.TrimPrefix(lower[i+1:i+end], "/")
+		if k := strings.IndexAny(tag, " \t\r\n/"); k >= 0 {
+			tag = tag[:k]
+		}
+		closing := strings.HasPrefix(s[i+1:], "/")
+		i += end + 1
+		if htmlSkipped[tag] && !closing {
+			k := strings.Index(lower[i:], "</"+tag)
+			if k < 0 {
+				break
+			}
+			i += k
+			continue
+		}
+		if htmlBlocks[tag] {
+			text.WriteByte('\n')
+		}
+	}
+
+	lines := make([]string, 0)
+	if title != "" {
+		lines = append(lines, title)
+	}
+	for _, line := range strings.Split(text.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	out := strings.Join(lines, "\n")
+	if utf8.RuneCountInString(out) > maxHTMLSummary {
+		runes := []rune(out)
+		out = string(runes[:maxHTMLSummary]) + "… (cut off; --raw prints the whole page)"
+	}
+	return out
+}
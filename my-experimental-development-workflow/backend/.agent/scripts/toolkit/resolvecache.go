@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// resolvedOperation is an operation with every $ref inlined, kept as the
+// JSON show and tools print: its parameters, request body and responses
+// for OperationDetails, and the tool input schema for BuildToolDefinition.
+// Storing rendered JSON means a cache hit is a file read and a copy, not a
+// decode of what can be megabytes of flattened schema per operation.
+type resolvedOperation struct {
+	Parameters  json.RawMessage `json:"parameters"`
+	RequestBody json.RawMessage `json:"request_body"`
+	Responses   json.RawMessage `json:"responses"`
+	ToolInput   json.RawMessage `json:"tool_input"`
+}
+
+func resolveOperation(spec map[string]any, op *Operation) (resolvedOperation, error) {
+	params := make([]any, 0, len(op.Parameters))
+	for _, p := range op.Parameters {
+		params = append(params, InlineSchema(spec, p.Raw))
+	}
+	var ro resolvedOperation
+	var err error
+	for _, f := range []struct {
+		dst *json.RawMessage
+		v   any
+	}{
+		{&ro.Parameters, params},
+		{&ro.RequestBody, InlineSchema(spec, op.Raw["requestBody"])},
+		{&ro.Responses, InlineSchema(spec, op.Raw["responses"])},
+		{&ro.ToolInput, toolInputSchema(spec, *op)},
+	} {
+		if *f.dst, err = json.Marshal(f.v); err != nil {
+			return resolvedOperation{}, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode %s %s: %v", op.Method, op.Path, err), err)
+		}
+	}
+	return ro, nil
+}
+
+// resolvedCache keeps resolved operations in memory and on disk, one file
+// per operation in a directory next to the spec cache named after the
+// spec's hash, so show and tools stop walking deep $ref chains until the
+// spec changes. The directories of older specs are removed when a new one
+// is created. Disk failures only cost speed: the operation is resolved
+// again.
+type resolvedCache struct {
+	mu     sync.Mutex
+	prefix string
+	dir    string
+	ops    map[string]resolvedOperation
+}
+
+// openResolvedCache returns the cache for spec. A spec whose hash is
+// unknown gets an in-memory cache only.
+func openResolvedCache(cfg *ResolvedConfig, spec map[string]any) *resolvedCache {
+	c := &resolvedCache{ops: map[string]resolvedOperation{}}
+	if hash := agentapi.SpecHash(spec); hash != "" {
+		c.prefix = filepath.Join(cfg.ConfigDir, "cache", fmt.Sprintf("resolved-%s-%s-", agentapi.SafeFileName(cfg.ActiveProject), agentapi.SafeFileName(cfg.ActiveEnv)))
+		c.dir = c.prefix + hash[:16]
+	}
+	return c
+}
+
+// resolve returns op resolved against spec, from the cache when present.
+func (c *resolvedCache) resolve(spec map[string]any, op *Operation) (resolvedOperation, error) {
+	key := op.Method + " " + op.Path
+	c.mu.Lock()
+	ro, ok := c.ops[key]
+	c.mu.Unlock()
+	if ok {
+		return ro, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	file := ""
+	if c.dir != "" {
+		file = filepath.Join(c.dir, hex.EncodeToString(sum[:8])+".json")
+		if b, err := os.ReadFile(file); err == nil && json.Unmarshal(b, &ro) == nil && ro.ToolInput != nil {
+			c.remember(key, ro)
+			return ro, nil
+		}
+	}
+	ro, err := resolveOperation(spec, op)
+	if err != nil {
+		return resolvedOperation{}, err
+	}
+	c.remember(key, ro)
+	if file != "" {
+		if err := c.write(file, ro); err != nil {
+			logger.Debug("resolved cache not written", "file", file, "error", err)
+		}
+	}
+	return ro, nil
+}
+
+func (c *resolvedCache) remember(key string, ro resolvedOperation) {
+	c.mu.Lock()
+	c.ops[key] = ro
+	c.mu.Unlock()
+}
+
+func (c *resolvedCache) write(file string, ro resolvedOperation) error {
+	if _, err := os.Stat(c.dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(c.dir, 0o755); err != nil {
+			return err
+		}
+		c.pruneStale()
+	}
+	b, err := json.Marshal(ro)
+	if err != nil {
+		return err
+	}
+	return agentapi.WriteFileAtomic(file, b, 0o644)
+}
+
+// pruneStale removes the directories of this env's previous specs. The
+// prefix also matches envs whose name extends this one ("dev-eu" for
+// "dev"); their remainder contains a '-', a hash never does.
+func (c *resolvedCache) pruneStale() {
+	stale, _ := filepath.Glob(c.prefix + "*")
+	for _, dir := range stale {
+		if dir != c.dir && !strings.Contains(strings.TrimPrefix(dir, c.prefix), "-") {
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// PreflightSuite evaluates api_mode for every step (and rollback) before
+// anything is sent, so a scenario never stops halfway on a blocked method.
+// Bodies are interpolated with the initial vars; captures are not known yet,
+// but they cannot affect the method or the presence of agent_marker.
+func PreflightSuite(cfg *ResolvedConfig, suite *TestSuite) error {
+	r := newSuiteRunner(cfg, suite.Vars)
+	fmt.Printf("Plan for %s (%s/%s, api_mode=%s):\n", suite.Name, cfg.ActiveProject, cfg.ActiveEnv, cfg.APIMode)
+	var firstErr error
+	check := func(label string, st TestStep) {
+		req, err := r.buildRequest(st)
+		if err == nil {
+			err = agentapi.EnforceMode(cfg, req.Method, req.Body)
+		}
+		status := "allowed"
+		if err != nil {
+			status = "BLOCKED: " + ExitMessage(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		target := strings.TrimSpace(st.Request)
+		if target == "" {
+			target = "operation " + st.Operation
+		}
+		confirm := ""
+		if st.Confirm {
+			confirm = " [confirm]"
+		}
+		fmt.Printf("  %-28s %s%s  %s\n", label, target, confirm, status)
+	}
+	for i, st := range suite.Steps {
+		name := stepName(st, i)
+		check(name, st)
+		if st.Rollback != nil {
+			check("  rollback: "+name, *st.Rollback)
+		}
+	}
+	fmt.Println()
+	return firstErr
+}
+
+// RunScenarioCommand implements `api scenario <file.yaml> [--yes] [--report ...]`:
+// a policy preflight of every step, then execution with confirmations and
+// automatic rollback on failure.
+func RunScenarioCommand(cfg *ResolvedConfig, args []string) error {
+	path := ""
+	report := "text"
+	assumeYes := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--yes":
+			assumeYes = true
+		case "--report":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --report")
+			}
+			report = args[i]
+		default:
+			if path != "" {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown scenario option: %s", args[i]))
+			}
+			path = args[i]
+		}
+	}
+	if path == "" {
+		return NewCliError(ExitRequestBuild, "Usage: api scenario <file.yaml> [--yes] [--report text|json|junit]")
+	}
+	if report != "text" && report != "json" && report != "junit" {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --report: %s (expected text|json|junit)", report))
+	}
+	suite, err := LoadTestSuite(path)
+	if err != nil {
+		return err
+	}
+	if err := PreflightSuite(cfg, suite); err != nil {
+		return err
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	confirm := func(prompt string) bool {
+		if assumeYes {
+			return true
+		}
+		fmt.Printf("Confirm %s? [y/N] ", prompt)
+		line, _ := stdin.ReadString('\n')
+		return strings.EqualFold(strings.TrimSpace(line), "y")
+	}
+	res := RunTestSuite(cfg, suite, confirm)
+	PrintSuiteResult(res, report)
+	return res.err()
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Fixtures is the file format of `api seed`: resources created through the
+// API in dependency order. Values captured from one resource are available
+// to later ones as {{<resource>.<name>}}; the created id is {{<resource>.id}}.
+type Fixtures struct {
+	Name string `yaml:"name"`
+	// MarkerField is the body field that receives agent_marker when a
+	// create body does not contain it yet (default "name").
+	MarkerField string                  `yaml:"marker_field"`
+	Vars        map[string]string       `yaml:"vars"`
+	Resources   map[string]SeedResource `yaml:"resources"`
+}
+
+type SeedResource struct {
+	TestStep `yaml:",inline"`
+	// DependsOn lists resources that must be created first.
+	DependsOn []string `yaml:"depends_on"`
+	// ID is the JSONPath of the created id in the response (default "$.id").
+	ID string `yaml:"id"`
+	// Teardown is the "METHOD /path" that removes the resource; it is
+	// interpolated at apply time and stored with the seed state.
+	Teardown string `yaml:"teardown"`
+}
+
+// SeedState records what `seed apply` created, in creation order.
+type SeedState struct {
+	Fixtures string        `json:"fixtures"`
+	Project  string        `json:"project"`
+	Env      string        `json:"env"`
+	Session  string        `json:"session,omitempty"`
+	Created  []SeededEntry `json:"created"`
+}
+
+type SeededEntry struct {
+	Resource  string    `json:"resource"`
+	ID        string    `json:"id"`
+	Teardown  string    `json:"teardown,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoadFixtures reads and validates a fixtures file.
+func LoadFixtures(path string) (*Fixtures, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Fixtures file not found: %s", path))
+	}
+	var fx Fixtures
+	if err := yaml.Unmarshal(raw, &fx); err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to parse fixtures %s: %v", path, err), err)
+	}
+	if len(fx.Resources) == 0 {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Fixtures %s define no resources", path))
+	}
+	for name, res := range fx.Resources {
+		if (res.Request == "") == (res.Operation == "") {
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Resource %q in %s needs exactly one of 'request' or 'operation'", name, path))
+		}
+		for _, dep := range res.DependsOn {
+			if _, ok := fx.Resources[dep]; !ok {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Resource %q depends on unknown resource %q", name, dep))
+			}
+		}
+	}
+	if fx.Name == "" {
+		fx.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if fx.MarkerField == "" {
+		fx.MarkerField = "name"
+	}
+	return &fx, nil
+}
+
+// seedOrder sorts resources so dependencies come first; ties are broken by
+// name so runs are reproducible.
+func seedOrder(fx *Fixtures) ([]string, error) {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := map[string]int{}
+	order := make([]string, 0, len(fx.Resources))
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Dependency cycle: %s", strings.Join(append(chain, name), " -> ")))
+		}
+		state[name] = visiting
+		deps := append([]string(nil), fx.Resources[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+	names := make([]string, 0, len(fx.Resources))
+	for name := range fx.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// injectMarker appends agent_marker to MarkerField of an object body that
+// does not mention the marker anywhere.
+func injectMarker(body any, field, marker string) any {
+	obj, ok := body.(map[string]any)
+	if !ok {
+		return body
+	}
+	raw, _ := json.Marshal(obj)
+	if strings.Contains(string(raw), marker) {
+		return body
+	}
+	out := make(map[string]any, len(obj))
+	for k, v := range obj {
+		out[k] = v
+	}
+	if s, ok := out[field].(string); ok {
+		out[field] = strings.TrimSpace(s + " " + marker)
+	}
+	return out
+}
+
+// seedStatePath is per session when markers are, so each agent applies and
+// tears down its own copy of the fixtures.
+func seedStatePath(cfg *ResolvedConfig, name string) string {
+	project, env := agentapi.SafeFileName(cfg.ActiveProject), agentapi.SafeFileName(cfg.ActiveEnv)
+	file := fmt.Sprintf("seed-%s-%s-%s.json", project, env, name)
+	if cfg.Session != "" {
+		file = fmt.Sprintf("seed-%s-%s-%s-%s.json", project, env, name, cfg.Session)
+	}
+	return filepath.Join(cfg.ConfigDir, "state", file)
+}
+
+func loadSeedState(cfg *ResolvedConfig, name string) (*SeedState, error) {
+	raw, err := os.ReadFile(seedStatePath(cfg, name))
+	if os.IsNotExist(err) {
+		return &SeedState{Fixtures: name, Project: cfg.ActiveProject, Env: cfg.ActiveEnv, Session: cfg.Session}, nil
+	}
+	if err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read seed state: %v", err), err)
+	}
+	var st SeedState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to parse %s: %v", seedStatePath(cfg, name), err), err)
+	}
+	return &st, nil
+}
+
+func saveSeedState(cfg *ResolvedConfig, st *SeedState) error {
+	path := seedStatePath(cfg, st.Fixtures)
+	if len(st.Created) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to remove %s: %v", path, err), err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err), err)
+	}
+	raw, _ := json.MarshalIndent(st, "", "  ")
+	if err := agentapi.WriteFileAtomic(path, append(raw, '\n'), 0o600); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write seed state: %v", err), err)
+	}
+	return nil
+}
+
+// ApplyFixtures creates every resource in dependency order. The state is
+// saved after each creation, so a failed apply can still be torn down, and
+// locked throughout, so the same fixtures are not applied twice at once.
+func ApplyFixtures(cfg *ResolvedConfig, fx *Fixtures) (*SeedState, error) {
+	order, err := seedOrder(fx)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockState(seedStatePath(cfg, fx.Name))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	st, err := loadSeedState(cfg, fx.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(st.Created) > 0 {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Fixtures %s are already applied to %s/%s; run `api seed teardown` first", fx.Name, cfg.ActiveProject, cfg.ActiveEnv))
+	}
+
+	r := newSuiteRunner(cfg, fx.Vars)
+	r.source = "seed:" + fx.Name
+	prog := startProgress("seed apply", len(order))
+	defer prog.finish()
+	for _, name := range order {
+		res := fx.Resources[name]
+		step := res.TestStep
+		step.Body = injectMarker(step.Body, fx.MarkerField, cfg.AgentMarker)
+		idPath := res.ID
+		if idPath == "" {
+			idPath = "$.id"
+		}
+		captures := map[string]string{"id": idPath}
+		for k, v := range step.Capture {
+			captures[k] = v
+		}
+		step.Capture = map[string]string{}
+		for k, v := range captures {
+			step.Capture[name+"."+k] = v
+		}
+
+		sr := r.runStep(step)
+		prog.add(sr.Outcome == outcomeFailed)
+		if sr.Outcome == outcomeFailed {
+			return st, NewCliError(ExitAssertionFailed, fmt.Sprintf("Seeding %s failed: %s", name, strings.Join(sr.Failures, "; ")))
+		}
+		entry := SeededEntry{Resource: name, ID: r.vars[name+".id"], CreatedAt: time.Now().UTC()}
+		if res.Teardown != "" {
+			entry.Teardown = r.interpolate(res.Teardown)
+		}
+		st.Created = append(st.Created, entry)
+		if err := saveSeedState(cfg, st); err != nil {
+			return st, err
+		}
+		fmt.Printf("created %-20s id=%s  (%s %s -> %d)\n", name, entry.ID, sr.Method, sr.Path, sr.Status)
+	}
+	return st, nil
+}
+
+// TeardownFixtures runs the recorded teardown requests newest first.
+// Entries whose teardown succeeds (or returns 404) are dropped from the
+// state; failures stay so the teardown can be retried.
+func TeardownFixtures(cfg *ResolvedConfig, name string) error {
+	unlock, err := lockState(seedStatePath(cfg, name))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	st, err := loadSeedState(cfg, name)
+	if err != nil {
+		return err
+	}
+	if len(st.Created) == 0 {
+		fmt.Printf("Nothing to tear down for %s on %s/%s.\n", name, cfg.ActiveProject, cfg.ActiveEnv)
+		return nil
+	}
+	r := newSuiteRunner(cfg, nil)
+	r.source = "seed:" + name
+	prog := startProgress("seed teardown", len(st.Created))
+	defer prog.finish()
+	remaining := make([]SeededEntry, 0)
+	for i := len(st.Created) - 1; i >= 0; i-- {
+		e := st.Created[i]
+		if e.Teardown == "" {
+			fmt.Printf("kept    %-20s id=%s  (no teardown defined)\n", e.Resource, e.ID)
+			prog.add(false)
+			continue
+		}
+		sr := r.runStep(TestStep{Request: e.Teardown})
+		removed := sr.Status == 404 || (sr.Status >= 200 && sr.Status < 300)
+		prog.add(!removed)
+		if removed {
+			fmt.Printf("removed %-20s id=%s  (%s -> %d)\n", e.Resource, e.ID, e.Teardown, sr.Status)
+			continue
+		}
+		msg := strings.Join(sr.Failures, "; ")
+		if msg == "" {
+			msg = fmt.Sprintf("HTTP %d", sr.Status)
+		}
+		fmt.Printf("FAILED  %-20s id=%s  (%s): %s\n", e.Resource, e.ID, e.Teardown, msg)
+		remaining = append([]SeededEntry{e}, remaining...)
+	}
+	st.Created = remaining
+	if err := saveSeedState(cfg, st); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return NewCliError(ExitAssertionFailed, fmt.Sprintf("%d resources could not be torn down; state kept in %s", len(remaining), seedStatePath(cfg, name)))
+	}
+	return nil
+}
+
+// RunSeedCommand implements `api seed apply|teardown <fixtures.yaml>`.
+// teardown --session removes what another agent session seeded.
+func RunSeedCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api seed <apply|teardown> <fixtures.yaml> (teardown also takes --session <id>)"
+	if len(args) == 4 && args[0] == "teardown" && args[2] == "--session" {
+		if cfg.Session == "" {
+			return NewCliErrorHint(ExitRequestBuild, "--session needs a per-session agent_marker", `Set agent_marker = "[agent-test:{session}]" to seed per session.`)
+		}
+		if !agentapi.ValidSessionID(args[3]) {
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid session id: %s", args[3]))
+		}
+		other := *cfg
+		other.Session = args[3]
+		cfg, args = &other, args[:2]
+	}
+	if len(args) != 2 || (args[0] != "apply" && args[0] != "teardown") {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	fx, err := LoadFixtures(args[1])
+	if err != nil {
+		return err
+	}
+	if args[0] == "teardown" {
+		return TeardownFixtures(cfg, fx.Name)
+	}
+	st, err := ApplyFixtures(cfg, fx)
+	if err != nil {
+		if st != nil && len(st.Created) > 0 {
+			fmt.Fprintf(os.Stderr, "%d resources were created before the failure; remove them with: api seed teardown %s\n", len(st.Created), args[1])
+		}
+		return err
+	}
+	fmt.Printf("\nSeeded %d resources (%s/%s); ids recorded in %s\n", len(st.Created), cfg.ActiveProject, cfg.ActiveEnv, seedStatePath(cfg, fx.Name))
+	return nil
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// APIServer exposes the toolkit over localhost REST for editors, browser
+// extensions and non-CLI agents. Every call goes through the same
+// guardrails as acurl; the spec is loaded once and kept in memory.
+type APIServer struct {
+	cfg         *ResolvedConfig
+	allowOrigin string
+	// hosts are the Host values accepted (localRequestError); the daemon,
+	// on a unix socket, has none.
+	hosts []string
+	// source labels metrics and history entries ("serve" or "daemon").
+	source string
+
+	mu       sync.Mutex
+	spec     map[string]any
+	index    *agentapi.SpecIndex
+	resolved *resolvedCache
+}
+
+// POST /call?stream=1 answers with the raw backend body, relayed as it
+// arrives; the backend status and headers (a JSON object) travel in these
+// response headers. Errors detected before the body starts are the usual
+// JSON error reply.
+const (
+	streamStatusHeader  = "X-Agent-Status"
+	streamHeadersHeader = "X-Agent-Headers"
+)
+
+// callPayload is the body accepted by POST /call and POST /policy/check.
+// Body may be a JSON value (sent compacted) or a JSON string (sent as-is).
+type callPayload struct {
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Token   string          `json:"token"`
+	Headers []string        `json:"headers"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func NewAPIServer(cfg *ResolvedConfig, allowOrigin string) *APIServer {
+	return &APIServer{cfg: cfg, allowOrigin: allowOrigin, source: "serve"}
+}
+
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/context", s.handleContext)
+	mux.HandleFunc("/spec/search", s.handleSearch)
+	mux.HandleFunc("/spec/show", s.handleShow)
+	mux.HandleFunc("/spec/operation", s.handleOperation)
+	mux.HandleFunc("/policy/check", s.handlePolicyCheck)
+	mux.HandleFunc("/call", s.handleCall)
+	mux.Handle("/metrics", metrics)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		if err := localRequestError(r, s.hosts, s.allowOrigin); err != nil {
+			logger.Info(s.source+" request refused", "method", r.Method, "path", r.URL.Path, "error", ExitMessage(err))
+			writeProxyError(w, http.StatusForbidden, err)
+			return
+		}
+		if s.allowOrigin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", s.allowOrigin)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		if hash := r.Header.Get(configHashHeader); hash != "" && hash != s.cfg.ConfigHash {
+			writeProxyError(w, http.StatusConflict, NewCliError(ExitConfig, "Config changed since the server started; restart it"))
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		logger.Info(s.source+" request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration_ms", time.Since(start).Milliseconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// loadSpec fetches the spec on first use and keeps it, together with the
+// search index built from it.
+func (s *APIServer) loadSpec() (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.spec == nil {
+		spec, err := agentapi.LoadSpec(runCtx, s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.spec = spec
+		s.index = agentapi.NewSpecIndex(spec)
+		s.resolved = openResolvedCache(s.cfg, spec)
+	}
+	return s.spec, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": fmt.Sprintf("use %s", method)})
+		return false
+	}
+	return true
+}
+
+func (s *APIServer) handleContext(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, contextInfo(s.cfg))
+}
+
+// contextInfo is the non-secret view of the active config.
+func contextInfo(cfg *ResolvedConfig) map[string]any {
+	return map[string]any{
+		"project":       cfg.ActiveProject,
+		"env":           cfg.ActiveEnv,
+		"api_base":      cfg.APIBase,
+		"path_bases":    pathBasesInfo(cfg),
+		"api_mode":      cfg.APIMode,
+		"strict":        cfg.Strict,
+		"agent_marker":  cfg.AgentMarker,
+		"session":       cfg.Session,
+		"default_token": cfg.DefaultTokenName,
+		"tokens":        completionTokenNames(cfg),
+	}
+}
+
+// pathBasesInfo maps each path_bases prefix to its base.
+func pathBasesInfo(cfg *ResolvedConfig) map[string]string {
+	out := make(map[string]string, len(cfg.PathBases))
+	for _, pb := range cfg.PathBases {
+		out[pb.Prefix] = pb.Base
+	}
+	return out
+}
+
+func (s *APIServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeProxyError(w, http.StatusBadRequest, NewCliError(ExitRequestBuild, "Query cannot be empty (?q=)"))
+		return
+	}
+	if _, err := s.loadSpec(); err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	var paging [2]int // offset, limit
+	for i, name := range []string{"offset", "limit"} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeProxyError(w, http.StatusBadRequest, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid %s: %s (expected a non-negative integer)", name, v)))
+			return
+		}
+		paging[i] = n
+	}
+	ops := s.index.Search(query, r.URL.Query().Get("method"))
+	page, _ := agentapi.Page(ops, paging[0], paging[1])
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(ops)))
+	writeJSON(w, http.StatusOK, tableRecords(FindResultsTable(page, nil)))
+}
+
+func (s *APIServer) handleShow(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	spec, err := s.loadSpec()
+	if err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	op, err := agentapi.FindOperationByRef(spec, r.URL.Query().Get("ref"))
+	if err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	ro, err := s.resolved.resolve(spec, op)
+	if err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, OperationDetails(op, ro))
+}
+
+// handleOperation returns the operation as extracted from the spec, raw
+// object included; the daemon client renders it like a local `api show`.
+func (s *APIServer) handleOperation(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	spec, err := s.loadSpec()
+	if err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	op, err := agentapi.FindOperationByRef(spec, r.URL.Query().Get("ref"))
+	if err != nil {
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, op)
+}
+
+// OperationDetails is the structured equivalent of PrintOperationDetails,
+// with path-level parameters merged and $refs inlined (see resolvedCache).
+func OperationDetails(op *Operation, ro resolvedOperation) map[string]any {
+	return map[string]any{
+		"method":       op.Method,
+		"path":         op.Path,
+		"operation_id": op.OperationID,
+		"summary":      op.Summary,
+		"description":  op.Description,
+		"tags":         op.Tags,
+		"parameters":   ro.Parameters,
+		"request_body": ro.RequestBody,
+		"responses":    ro.Responses,
+	}
+}
+
+func (s *APIServer) decodeCall(w http.ResponseWriter, r *http.Request) (APIRequest, bool) {
+	// A form or text/plain post needs no CORS preflight; JSON does.
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		writeProxyError(w, http.StatusUnsupportedMediaType, NewCliErrorHint(ExitRequestBuild, "Payload must be sent as Content-Type: application/json", "Add -H 'Content-Type: application/json'."))
+		return APIRequest{}, false
+	}
+	var p callPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeProxyError(w, http.StatusBadRequest, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid JSON payload: %v", err), err))
+		return APIRequest{}, false
+	}
+	method := strings.ToUpper(strings.TrimSpace(p.Method))
+	if method == "" && strings.HasPrefix(p.Path, "/") {
+		method = "GET"
+		if spec, err := s.loadSpec(); err == nil {
+			if method, err = inferMethod(spec, p.Path); err != nil {
+				writeProxyError(w, http.StatusBadRequest, err)
+				return APIRequest{}, false
+			}
+		}
+	}
+	if _, ok := httpMethods[method]; !ok || !strings.HasPrefix(p.Path, "/") {
+		writeProxyError(w, http.StatusBadRequest, NewCliError(ExitRequestBuild, "Payload needs a valid 'method' and a 'path' starting with '/'"))
+		return APIRequest{}, false
+	}
+	body := ""
+	if len(p.Body) > 0 && string(p.Body) != "null" {
+		var str string
+		if json.Unmarshal(p.Body, &str) == nil {
+			body = str
+		} else {
+			body = normalizeCassetteBody(string(p.Body))
+		}
+	}
+	req := APIRequest{Method: method, Path: p.Path, TokenName: p.Token, Body: body, Headers: p.Headers, Source: s.source}
+	if s.cfg.Strict {
+		spec, err := s.loadSpec()
+		if err != nil {
+			writeProxyError(w, errorHTTPStatus(err), err)
+			return APIRequest{}, false
+		}
+		req.Spec = spec
+	}
+	return req, true
+}
+
+func (s *APIServer) handlePolicyCheck(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	req, ok := s.decodeCall(w, r)
+	if !ok {
+		return
+	}
+	reply := map[string]any{"allowed": true}
+	if err := CheckPolicy(s.cfg, req); err != nil {
+		reply = map[string]any{"allowed": false, "code": ExitCode(err), "error": ExitMessage(err), "suggestion": agentapi.Suggestion(err)}
+	}
+	// ?preflight=1 also asks the server, whose answer does not change
+	// "allowed": local policy has the last word.
+	if r.URL.Query().Get("preflight") == "1" {
+		pre := sendPreflight(s.cfg, req.Path, req.TokenName)
+		reply["preflight"] = pre
+		if allowed, known := pre.serverAllows(req.Method); known {
+			reply["server_allows"] = allowed
+		}
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+func (s *APIServer) handleCall(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	start := time.Now()
+	req, ok := s.decodeCall(w, r)
+	if !ok {
+		return
+	}
+	var requestID string
+	req.Headers, requestID = agentapi.WithRequestID(s.cfg, req.Headers)
+	streaming := false
+	if r.URL.Query().Get("stream") == "1" {
+		req.Stream = func(status int, header http.Header) io.Writer {
+			h, _ := json.Marshal(flattenHeaders(header))
+			w.Header().Set(streamStatusHeader, strconv.Itoa(status))
+			w.Header().Set(streamHeadersHeader, string(h))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.WriteHeader(http.StatusOK)
+			streaming = true
+			return w
+		}
+	}
+	resp, err := PerformRequest(s.cfg, req)
+	if err != nil {
+		metrics.RecordRequest(s.source, req.Method, errorHTTPStatus(err), time.Since(start), err)
+		if streaming {
+			// Too late for an error reply: break the connection so the
+			// client sees a truncated body, not a complete one.
+			logger.Info("call relay failed", "method", req.Method, "path", req.Path, "error", ExitMessage(err))
+			panic(http.ErrAbortHandler)
+		}
+		writeProxyError(w, errorHTTPStatus(err), err)
+		return
+	}
+	if streaming {
+		metrics.RecordRequest(s.source, req.Method, resp.StatusCode, time.Since(start), nil)
+		return
+	}
+	metrics.RecordRequest(s.source, req.Method, resp.StatusCode, time.Since(start), nil)
+	var body any = string(resp.Body)
+	var decoded any
+	if len(resp.Body) > 0 && json.Unmarshal(resp.Body, &decoded) == nil {
+		body = decoded
+	}
+	reply := map[string]any{"status": resp.StatusCode, "headers": flattenHeaders(resp.Header), "body": body, "request_bytes": len(req.Body), "response_bytes": resp.Size, "duration_ms": time.Since(start).Milliseconds()}
+	if requestID != "" {
+		reply["request_id"] = requestID
+	}
+	if resp.StatusCode < 400 {
+		if next := detectNextPage(resp.Header, resp.Body); next != nil {
+			reply["next_page"] = next
+		}
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+func flattenHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// RunServe implements `api serve [--port N] [--allow-origin ORIGIN]`.
+func RunServe(cfg *ResolvedConfig, args []string) error {
+	port := 7700
+	allowOrigin := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--port":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --port")
+			}
+			p, err := parsePortFlag("--port", args[i])
+			if err != nil {
+				return err
+			}
+			port = p
+		case "--allow-origin":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --allow-origin")
+			}
+			allowOrigin = args[i]
+			if allowOrigin == "*" {
+				return NewCliError(ExitRequestBuild, "--allow-origin takes one origin, e.g. http://localhost:3000, not *")
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown serve option: %s", args[i]))
+		}
+	}
+	srv := NewAPIServer(cfg, allowOrigin)
+	srv.hosts = loopbackHosts(port)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	logger.Info("serve listening", "addr", "http://"+addr, "project", cfg.ActiveProject, "env", cfg.ActiveEnv, "api_mode", cfg.APIMode)
+	if err := http.ListenAndServe(addr, srv.Handler()); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("API server failed: %v", err), err)
+	}
+	return nil
+}
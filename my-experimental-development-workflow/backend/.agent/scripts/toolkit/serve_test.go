@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveRequest sends one request to an api serve handler listening on
+// 127.0.0.1:7700 and returns the response status.
+func serveRequest(t *testing.T, allowOrigin string, build func(*http.Request)) int {
+	t.Helper()
+	srv := NewAPIServer(&ResolvedConfig{}, allowOrigin)
+	srv.hosts = loopbackHosts(7700)
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:7700/call", strings.NewReader(`{"method":"GET"}`))
+	r.Header.Set("Content-Type", "application/json")
+	build(r)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestServeRejectsNonJSONContentType(t *testing.T) {
+	for _, ct := range []string{"", "text/plain", "application/x-www-form-urlencoded", "multipart/form-data; boundary=x"} {
+		got := serveRequest(t, "", func(r *http.Request) { r.Header.Set("Content-Type", ct) })
+		if got != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Type %q: status %d, want %d", ct, got, http.StatusUnsupportedMediaType)
+		}
+	}
+}
+
+func TestServeRejectsOrigin(t *testing.T) {
+	got := serveRequest(t, "", func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") })
+	if got != http.StatusForbidden {
+		t.Errorf("status %d, want %d", got, http.StatusForbidden)
+	}
+	got = serveRequest(t, "http://localhost:3000", func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") })
+	if got != http.StatusForbidden {
+		t.Errorf("with --allow-origin, other origin: status %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestServeRejectsForeignHost(t *testing.T) {
+	for _, host := range []string{"evil.example:7700", "127.0.0.1:7701", "localhost"} {
+		got := serveRequest(t, "", func(r *http.Request) { r.Host = host })
+		if got != http.StatusForbidden {
+			t.Errorf("Host %q: status %d, want %d", host, got, http.StatusForbidden)
+		}
+	}
+}
+
+func TestServeAcceptsLocalJSON(t *testing.T) {
+	cases := map[string]func(*http.Request){
+		"127.0.0.1":      func(r *http.Request) {},
+		"localhost":      func(r *http.Request) { r.Host = "localhost:7700" },
+		"charset":        func(r *http.Request) { r.Header.Set("Content-Type", "application/json; charset=utf-8") },
+		"allowed origin": func(r *http.Request) { r.Header.Set("Origin", "http://localhost:3000") },
+	}
+	for name, build := range cases {
+		// The payload has no path, so a request past the checks is a 400.
+		if got := serveRequest(t, "http://localhost:3000", build); got != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", name, got, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// sessionActivity is what the history says one session did. Sent and
+// Received count body bytes.
+type sessionActivity struct {
+	Session        string
+	Calls          int
+	Writes         int
+	Sent, Received int64
+	First, Last    time.Time
+}
+
+// sessionActivities groups the active env's history by session, most
+// recent first; calls made without a session marker are grouped under "".
+func sessionActivities(cfg *ResolvedConfig) ([]*sessionActivity, error) {
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*sessionActivity{}
+	for _, e := range entries {
+		if e.Project != cfg.ActiveProject || e.Env != cfg.ActiveEnv {
+			continue
+		}
+		a := byID[e.Session]
+		if a == nil {
+			a = &sessionActivity{Session: e.Session, First: e.Time}
+			byID[e.Session] = a
+		}
+		a.Calls++
+		if e.Method != "GET" && e.Method != "HEAD" && e.Method != "OPTIONS" {
+			a.Writes++
+		}
+		a.Sent += e.RequestBytes
+		a.Received += e.ResponseBytes
+		a.Last = e.Time
+	}
+	out := make([]*sessionActivity, 0, len(byID))
+	for _, a := range byID {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Last.After(out[j].Last) })
+	return out, nil
+}
+
+// formatBytes renders a byte count for people: 512 B, 3.4 KiB, 12.0 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// printSessionTraffic reports what the history holds for one session.
+func printSessionTraffic(cfg *ResolvedConfig, session string) error {
+	activities, err := sessionActivities(cfg)
+	if err != nil {
+		return err
+	}
+	for _, a := range activities {
+		if a.Session == session {
+			fmt.Printf("Traffic: %d calls (%d writes), %s sent, %s received, %s to %s\n", a.Calls, a.Writes, formatBytes(a.Sent), formatBytes(a.Received), a.First.UTC().Format(time.RFC3339), a.Last.UTC().Format(time.RFC3339))
+			return nil
+		}
+	}
+	fmt.Println("Traffic: no calls recorded yet")
+	return nil
+}
+
+// RunSessionCommand implements `api session [status|new|list]`.
+func RunSessionCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api session [status | new | list [--format table|csv|json|ndjson]]"
+	sub := "status"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "status", "show":
+		if len(args) > 0 {
+			return NewCliError(ExitRequestBuild, usage)
+		}
+		if cfg.Session == "" {
+			fmt.Printf("No session: agent_marker %q has no %s, so every agent shares it.\n", cfg.MarkerTemplate, agentapi.SessionPlaceholder)
+			return printSessionTraffic(cfg, "")
+		}
+		source := agentapi.SessionFile(cfg.ConfigDir)
+		if _, ok := os.LookupEnv(agentapi.SessionEnv); ok {
+			source = "$" + agentapi.SessionEnv
+		}
+		fmt.Printf("Session: %s (from %s)\nMarker:  %s\n", cfg.Session, source, cfg.AgentMarker)
+		return printSessionTraffic(cfg, cfg.Session)
+
+	case "new":
+		if len(args) > 0 {
+			return NewCliError(ExitRequestBuild, usage)
+		}
+		if cfg.Session == "" {
+			return NewCliErrorHint(ExitConfig, fmt.Sprintf("agent_marker %q has no %s placeholder", cfg.MarkerTemplate, agentapi.SessionPlaceholder), `Set agent_marker = "[agent-test:{session}]" to give each agent session its own marker.`)
+		}
+		id := agentapi.NewSessionID()
+		if err := agentapi.WriteSession(cfg.ConfigDir, id, true); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to store the session id: %v", err), err)
+		}
+		// Printed as a command so an agent can `eval "$(api session new)"`:
+		// the variable wins over the file for the processes that inherit it.
+		fmt.Printf("export %s=%s\n", agentapi.SessionEnv, id)
+		return nil
+
+	case "list":
+		format := "table"
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--format":
+				i++
+				if i >= len(args) {
+					return NewCliError(ExitRequestBuild, "Missing value for --format")
+				}
+				format = args[i]
+			default:
+				return NewCliError(ExitRequestBuild, usage)
+			}
+		}
+		f, err := LookupFormatter(format)
+		if err != nil {
+			return err
+		}
+		activities, err := sessionActivities(cfg)
+		if err != nil {
+			return err
+		}
+		t := &Table{
+			Columns: []string{"SESSION", "CALLS", "WRITES", "SENT_BYTES", "RECEIVED_BYTES", "FIRST", "LAST"},
+			Keys:    []string{"session", "calls", "writes", "sent_bytes", "received_bytes", "first", "last"},
+			Empty:   fmt.Sprintf("No session-marked calls in the history of %s/%s.", cfg.ActiveProject, cfg.ActiveEnv),
+		}
+		for _, a := range activities {
+			if a.Session == "" {
+				continue
+			}
+			t.Rows = append(t.Rows, []string{a.Session, strconv.Itoa(a.Calls), strconv.Itoa(a.Writes), strconv.FormatInt(a.Sent, 10), strconv.FormatInt(a.Received, 10), a.First.UTC().Format(time.RFC3339), a.Last.UTC().Format(time.RFC3339)})
+		}
+		if err := f.Format(os.Stdout, t); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+		}
+		return nil
+	}
+	return NewCliError(ExitRequestBuild, usage)
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestInferMethod(t *testing.T) {
+	op := func(id string) map[string]any { return map[string]any{"operationId": id} }
+	spec := map[string]any{
+		"openapi": "3.0.0",
+		"paths": map[string]any{
+			"/users":                   map[string]any{"get": op("listUsers"), "post": op("createUser")},
+			"/users/{id}":              map[string]any{"get": op("getUser"), "delete": op("deleteUser")},
+			"/users/{id}/reset":        map[string]any{"post": op("resetUser")},
+			"/users/{id}/sessions/{s}": map[string]any{"delete": op("endSession"), "patch": op("touchSession")},
+		},
+	}
+	for _, tc := range []struct {
+		path, want string
+		fails      bool
+	}{
+		{path: "/users", want: "GET"},
+		{path: "/users/1", want: "GET"},
+		{path: "/users/1?expand=roles", want: "GET"},
+		{path: "/unknown", want: "GET"},
+		{path: "/users/1/reset", fails: true},
+		{path: "/users/1/sessions/2", fails: true},
+	} {
+		got, err := inferMethod(spec, tc.path)
+		if tc.fails {
+			if err == nil || ExitCode(err) != ExitRequestBuild {
+				t.Errorf("%s: got %q, %v; want exit %d", tc.path, got, err, ExitRequestBuild)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v; want %s", tc.path, got, err, tc.want)
+		}
+	}
+}
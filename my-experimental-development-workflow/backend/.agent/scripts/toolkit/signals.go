@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runCtx is cancelled on SIGINT/SIGTERM for one-shot commands, aborting the
+// spec fetch or the in-flight request with a clean "Interrupted" error
+// (exit 130) instead of killing the process mid-write. Long-running
+// commands handle the signals themselves and keep the background context.
+var runCtx = context.Background()
+
+// selfSignalledCommands install their own shutdown handling (or, like ui,
+// rely on the default ^C behaviour).
+var selfSignalledCommands = map[string]bool{
+	"ui": true, "proxy": true, "listen": true, "serve": true, "daemon": true, "schedule": true,
+}
+
+// cancelOnSignal points runCtx at a context cancelled by SIGINT/SIGTERM,
+// keeping the command span it may carry, and returns the function
+// restoring default signal handling. A second signal after the first kills
+// the process as usual.
+func cancelOnSignal() func() {
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	runCtx = ctx
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return stop
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Snapshot is a golden response stored under
+// snapshots/<project>/<env>/<name>.json next to config.toml.
+type Snapshot struct {
+	Request   string    `json:"request"`
+	Status    int       `json:"status"`
+	Ignore    []string  `json:"ignore,omitempty"`
+	Body      any       `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func snapshotPath(cfg *ResolvedConfig, name string) string {
+	return filepath.Join(cfg.ConfigDir, "snapshots", agentapi.SafeFileName(cfg.ActiveProject), agentapi.SafeFileName(cfg.ActiveEnv), name+".json")
+}
+
+// CheckSnapshot writes the snapshot when it does not exist yet (or update
+// is set) and otherwise compares status and body structurally. Ignore paths
+// given when the snapshot is written are stored with it; diff_ignore and
+// the ignore paths passed at compare time apply on top.
+func CheckSnapshot(cfg *ResolvedConfig, name, method, path string, resp *APIResponse, ignore []string, update bool) error {
+	if name == "" || strings.Contains(name, "..") || filepath.IsAbs(name) {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid snapshot name: %q", name))
+	}
+	file := snapshotPath(cfg, name)
+	current := Snapshot{
+		Request:   method + " " + path,
+		Status:    resp.StatusCode,
+		Ignore:    ignore,
+		Body:      decodeResponseBody(resp.Body),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	raw, err := os.ReadFile(file)
+	if os.IsNotExist(err) || update {
+		if err := writeSnapshot(file, current); err != nil {
+			return err
+		}
+		infof("Snapshot %s written to %s\n", name, file)
+		return nil
+	}
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read snapshot %s: %v", file, err), err)
+	}
+	var golden Snapshot
+	if err := json.Unmarshal(raw, &golden); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to parse snapshot %s: %v", file, err), err)
+	}
+
+	skip := append(append(append([]string(nil), golden.Ignore...), ignore...), cfg.DiffIgnore...)
+	entries := JSONDiff(golden.Body, current.Body, skip)
+	if golden.Status != current.Status {
+		entries = append([]DiffEntry{{Path: "status", Kind: diffChanged, Left: golden.Status, Right: current.Status}}, entries...)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, e := range entries {
+		fmt.Fprintln(os.Stderr, formatDiffEntry(e, "snapshot", "response"))
+	}
+	return NewCliError(ExitAssertionFailed, fmt.Sprintf("Response differs from snapshot %s in %d places (rerun with --update-snapshot to accept)", name, len(entries)))
+}
+
+func writeSnapshot(file string, s Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(file), err), err)
+	}
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode snapshot: %v", err), err)
+	}
+	if err := agentapi.WriteFileAtomic(file, append(raw, '\n'), 0o644); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write snapshot %s: %v", file, err), err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// runSpecDrift implements `api spec drift`: the info.version and the
+// operations of the specs several envs publish, with one row for the
+// version and one per operation some env lacks.
+func runSpecDrift(configPath string, cfg *ResolvedConfig, args []string) error {
+	envList, envTag, format := "", "", "table"
+	all := false
+	concurrency := agentapi.DefaultPullConcurrency
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--all":
+			all = true
+		case "--envs", "--env-tag", "--concurrency", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			case "--concurrency":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --concurrency: %s (expected a positive integer)", args[i]))
+				}
+				concurrency = n
+			default:
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown spec drift option: %s", args[i]))
+		}
+	}
+	envList, err := taggedEnvList(configPath, envTag, envList, all)
+	if err != nil {
+		return err
+	}
+	if all == (envList != "") {
+		return NewCliError(ExitRequestBuild, "Usage: api spec drift --envs <env1>,<env2>[,...] | --env-tag <tag> | --all [--concurrency <n>] [--format table|json|ndjson|csv]")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	cfgs, err := selectEnvConfigs(configPath, cfg, all, envList)
+	if err != nil {
+		return err
+	}
+	if len(cfgs) < 2 {
+		return NewCliError(ExitRequestBuild, "spec drift compares at least two envs, e.g. --envs dev,staging")
+	}
+	seen := map[string]bool{}
+	for _, c := range cfgs {
+		if seen[c.ActiveEnv] {
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("--envs lists %s twice", c.ActiveEnv))
+		}
+		seen[c.ActiveEnv] = true
+	}
+
+	specs := agentapi.LoadEnvSpecs(runCtx, cfgs, concurrency)
+	t := &Table{Columns: []string{"ITEM"}, Keys: []string{"item"}}
+	version := []string{"info.version"}
+	versions := map[string]bool{}
+	names := make([]string, 0, len(specs))
+	for _, e := range specs {
+		env := e.Config.ActiveEnv
+		t.Columns = append(t.Columns, strings.ToUpper(env))
+		t.Keys = append(t.Keys, env)
+		switch {
+		case e.Err != nil:
+			version = append(version, "error: "+ExitMessage(e.Err))
+		case e.Version == "":
+			version = append(version, "(none)")
+		default:
+			version = append(version, e.Version)
+		}
+		if e.Err == nil {
+			versions[e.Version] = true
+			names = append(names, env)
+		}
+	}
+	t.Rows = append(t.Rows, version)
+	drifted := agentapi.DriftedOperations(specs)
+	for _, key := range drifted {
+		row := []string{""}
+		for _, e := range specs {
+			cell := ""
+			if e.Err == nil {
+				cell = "missing"
+				if route, ok := e.Operations[key]; ok {
+					cell, row[0] = "present", route
+				}
+			}
+			row = append(row, cell)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	if err := agentapi.EnvSpecError(specs); err != nil {
+		return err
+	}
+	if len(drifted) > 0 || len(versions) > 1 {
+		diffs := make([]string, 0, 2)
+		if len(versions) > 1 {
+			diffs = append(diffs, "info.version differs")
+		}
+		if len(drifted) > 0 {
+			diffs = append(diffs, fmt.Sprintf("%d operations are not in every env", len(drifted)))
+		}
+		return NewCliErrorHint(ExitAssertionFailed, fmt.Sprintf("Specs of %s differ: %s", strings.Join(names, ", "), strings.Join(diffs, " and ")), "Call an operation only in the envs that list it as present.")
+	}
+	infof("%s publish the same %d operations.\n", strings.Join(names, ", "), len(specs[0].Operations))
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const specParamsUsage = "Usage: api spec params <METHOD> <path> | <operationId> [--format table|csv|json|ndjson]"
+
+// paramIn orders parameters the way a call is written: path, then query,
+// then headers and cookies.
+var paramIn = map[string]int{"path": 0, "query": 1, "header": 2, "cookie": 3}
+
+// runSpecParams implements `api spec params`: each parameter of one
+// operation with its type and the values it takes, from its enum, or else
+// its examples and default, so a call can be written without reading the
+// spec. The path may be a template or a concrete path.
+func runSpecParams(cfg *ResolvedConfig, args []string) error {
+	format := "table"
+	refParts := make([]string, 0, 2)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			format = args[i]
+		default:
+			refParts = append(refParts, args[i])
+		}
+	}
+	if len(refParts) == 0 || len(refParts) > 2 {
+		return NewCliError(ExitRequestBuild, specParamsUsage)
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	op, err := paramsOperation(spec, refParts)
+	if err != nil {
+		return err
+	}
+
+	params := append([]agentapi.Parameter(nil), op.Parameters...)
+	sort.SliceStable(params, func(i, j int) bool { return paramIn[params[i].In] < paramIn[params[j].In] })
+	t := &Table{
+		Columns: []string{"IN", "NAME", "REQUIRED", "TYPE", "VALUES"},
+		Keys:    []string{"in", "name", "required", "type", "values"},
+		Empty:   fmt.Sprintf("%s %s takes no parameters.", op.Method, op.Path),
+	}
+	for _, p := range params {
+		required := ""
+		if p.Required {
+			required = "yes"
+		}
+		typ, values := parameterValues(spec, p.Raw)
+		t.Rows = append(t.Rows, []string{p.In, p.Name, required, typ, values})
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
+
+// paramsOperation finds the operation of `api spec params`: an
+// operationId, or a method and a path template, else the operation of
+// that method serving a concrete path.
+func paramsOperation(spec map[string]any, refParts []string) (*Operation, error) {
+	op, err := agentapi.FindOperationByRef(spec, strings.Join(refParts, " "))
+	if err == nil || len(refParts) != 2 {
+		return op, err
+	}
+	method := strings.ToUpper(refParts[0])
+	for _, served := range agentapi.OperationsForPath(spec, refParts[1]) {
+		if served.Method == method {
+			return served, nil
+		}
+	}
+	return nil, err
+}
+
+// parameterValues describes what a parameter takes: its type (with the
+// format, and the item type of an array) and its values, which are the
+// enum ("a|b|c"), else the examples ("e.g. x, y"), with the default
+// marked either way. Swagger 2 parameters carry their schema inline.
+func parameterValues(spec map[string]any, p map[string]any) (string, string) {
+	schema, ok := agentapi.AsMap(p["schema"])
+	if !ok {
+		schema = p
+	}
+	schema = derefSchema(spec, schema)
+	typ := schemaTypeLabel(schema)
+	valued := schema
+	if schemaType(schema) == "array" {
+		if items, ok := agentapi.AsMap(schema["items"]); ok {
+			items = derefSchema(spec, items)
+			typ = "array<" + schemaTypeLabel(items) + ">"
+			valued = items
+		}
+	}
+
+	def, hasDefault := schema["default"]
+	if !hasDefault {
+		def, hasDefault = valued["default"]
+	}
+	if enum, ok := agentapi.AsSlice(valued["enum"]); ok && len(enum) > 0 {
+		vals := make([]string, len(enum))
+		for i, v := range enum {
+			vals[i] = jsonScalarString(v)
+			if hasDefault && jsonScalarString(def) == vals[i] {
+				vals[i] += " (default)"
+				hasDefault = false
+			}
+		}
+		return typ, strings.Join(vals, "|")
+	}
+
+	examples := make([]string, 0)
+	seen := map[string]bool{}
+	add := func(v any) {
+		if s := jsonScalarString(v); !seen[s] {
+			seen[s] = true
+			examples = append(examples, s)
+		}
+	}
+	for _, obj := range []map[string]any{p, schema, valued} {
+		if v, ok := obj["example"]; ok {
+			add(v)
+		}
+		for _, key := range []string{"examples", "x-examples"} {
+			switch ex := obj[key].(type) {
+			case []any:
+				for _, v := range ex {
+					add(v)
+				}
+			case map[string]any:
+				for _, k := range agentapi.SortedKeys(ex) {
+					// OpenAPI example objects keep the value under "value".
+					if m, ok := agentapi.AsMap(ex[k]); ok {
+						if v, ok := m["value"]; ok {
+							add(v)
+						}
+						continue
+					}
+					add(ex[k])
+				}
+			}
+		}
+		if v, ok := obj["x-example"]; ok {
+			add(v)
+		}
+	}
+	out := ""
+	if len(examples) > 0 {
+		out = "e.g. " + strings.Join(examples, ", ")
+	}
+	if hasDefault {
+		out = strings.TrimPrefix(out+"; default "+jsonScalarString(def), "; ")
+	}
+	return typ, out
+}
+
+// schemaTypeLabel is the type of a schema with its format, e.g.
+// "string(uuid)".
+func schemaTypeLabel(schema map[string]any) string {
+	t := schemaType(schema)
+	if f := agentapi.AsString(schema["format"]); f != "" {
+		t += "(" + f + ")"
+	}
+	return t
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// valueColumn names the single column of an array of scalars.
+const valueColumn = "value"
+
+// ArrayTable lays out a decoded JSON array as a Table: one row per item
+// and one column per field. Columns are the fields of all objects, id
+// first and the rest by name, unless fields picks them; a field may be a
+// dotted path into nested objects (owner.name). Nested objects and arrays
+// are printed as compact JSON, null as an empty cell.
+func ArrayTable(v any, fields []string) (*Table, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Table output needs a JSON array, got %s", jsonTypeName(v)), "Select the array first, e.g. api query '$.items' --format table.")
+	}
+	if len(fields) == 0 {
+		fields = arrayFields(items)
+	}
+	// Field names head the columns as they are: upper-casing would lose
+	// the word breaks of camelCase names.
+	t := &Table{Columns: fields, Keys: fields, Rows: make([][]string, 0, len(items)), Empty: "Empty array."}
+	for _, item := range items {
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			row[i] = cellText(fieldValue(item, f))
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, nil
+}
+
+// arrayFields lists the fields of the objects among items, or valueColumn
+// when there are none.
+func arrayFields(items []any) []string {
+	seen := map[string]bool{}
+	fields := make([]string, 0)
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for k := range obj {
+			if !seen[k] {
+				seen[k] = true
+				fields = append(fields, k)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return []string{valueColumn}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if (fields[i] == "id") != (fields[j] == "id") {
+			return fields[i] == "id"
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
+
+func fieldValue(item any, field string) any {
+	obj, ok := item.(map[string]any)
+	if !ok {
+		if field == valueColumn {
+			return item
+		}
+		return nil
+	}
+	if v, ok := obj[field]; ok {
+		return v
+	}
+	var cur any = obj
+	for _, part := range strings.Split(field, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func cellText(v any) string {
+	if v == nil {
+		return ""
+	}
+	return jsonScalarString(v)
+}
+
+// splitFields parses a --fields list.
+func splitFields(list string) []string {
+	fields := make([]string, 0)
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// printArray renders a JSON document that is an array in format.
+func printArray(body []byte, format string, fields []string) error {
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return NewCliError(ExitRequestBuild, "Table output needs a JSON response")
+	}
+	t, err := ArrayTable(doc, fields)
+	if err != nil {
+		return err
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const tokenStatsUsage = "Usage: api token stats [--session <id>] [--envs <env1>,<env2> | --env-tag <tag> | --all] [--format table|csv|json|ndjson]"
+
+// tokenUsage is what the history says of one token of an env. Errors are
+// calls that failed or returned 4xx/5xx; AuthFailures the 401s and 403s
+// among them.
+type tokenUsage struct {
+	Env          string
+	Token        string
+	Configured   bool
+	Calls        int
+	Errors       int
+	AuthFailures int
+	Sessions     map[string]struct{}
+	Last         time.Time
+}
+
+// runTokenStats implements `api token stats`: per token, the calls the
+// history holds for it, how many failed and when it was last used, so
+// tokens agents never use (or only fail with) stand out for revocation.
+func runTokenStats(configPath string, cfg *ResolvedConfig, args []string) error {
+	envList, envTag, format, session := "", "", "table", ""
+	all := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--all":
+			all = true
+		case "--envs", "--env-tag", "--format", "--session":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			case "--format":
+				format = args[i]
+			default:
+				if !agentapi.ValidSessionID(args[i]) {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid session id: %s", args[i]))
+				}
+				session = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, tokenStatsUsage)
+		}
+	}
+	envList, err := taggedEnvList(configPath, envTag, envList, all)
+	if err != nil {
+		return err
+	}
+	if all && envList != "" {
+		return NewCliError(ExitRequestBuild, "--all and --envs are mutually exclusive")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	cfgs, err := selectEnvConfigs(configPath, cfg, all, envList)
+	if err != nil {
+		return err
+	}
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return err
+	}
+
+	t := &Table{
+		Columns: []string{"ENV", "TOKEN", "CALLS", "ERRORS", "ERROR_RATE", "AUTH_FAILURES", "SESSIONS", "LAST_USED"},
+		Keys:    []string{"env", "token", "calls", "errors", "error_rate", "auth_failures", "sessions", "last_used"},
+		Empty:   "No tokens configured or used.",
+	}
+	for _, c := range cfgs {
+		for _, u := range tokenUsages(c, entries, session) {
+			name, rate, last := u.Token, "", "never"
+			if !u.Configured {
+				name += " (not configured)"
+			}
+			if u.Calls > 0 {
+				rate = strconv.FormatFloat(100*float64(u.Errors)/float64(u.Calls), 'f', 1, 64) + "%"
+				last = u.Last.UTC().Format(time.RFC3339)
+			}
+			t.Rows = append(t.Rows, []string{u.Env, name, strconv.Itoa(u.Calls), strconv.Itoa(u.Errors), rate, strconv.Itoa(u.AuthFailures), strconv.Itoa(len(u.Sessions)), last})
+		}
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
+
+// tokenUsages tallies the history of c's env by token, limited to one
+// session when session is set: every configured token, used or not, and
+// the tokens calls were made with that the config no longer has. The most
+// used come first.
+func tokenUsages(c *ResolvedConfig, entries []HistoryEntry, session string) []*tokenUsage {
+	byName := map[string]*tokenUsage{}
+	for name := range c.Tokens {
+		byName[name] = &tokenUsage{Env: c.ActiveEnv, Token: name, Configured: true, Sessions: map[string]struct{}{}}
+	}
+	for _, e := range entries {
+		if e.Project != c.ActiveProject || e.Env != c.ActiveEnv || e.Token == "" || (session != "" && e.Session != session) {
+			continue
+		}
+		u := byName[e.Token]
+		if u == nil {
+			u = &tokenUsage{Env: c.ActiveEnv, Token: e.Token, Sessions: map[string]struct{}{}}
+			byName[e.Token] = u
+		}
+		u.Calls++
+		if e.Error != "" || e.Status >= 400 {
+			u.Errors++
+		}
+		if e.Status == 401 || e.Status == 403 {
+			u.AuthFailures++
+		}
+		if e.Session != "" {
+			u.Sessions[e.Session] = struct{}{}
+		}
+		if e.Time.After(u.Last) {
+			u.Last = e.Time
+		}
+	}
+	out := make([]*tokenUsage, 0, len(byName))
+	for _, u := range byName {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Calls != out[j].Calls {
+			return out[i].Calls > out[j].Calls
+		}
+		return out[i].Token < out[j].Token
+	})
+	return out
+}
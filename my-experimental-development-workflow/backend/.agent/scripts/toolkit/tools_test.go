@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUniqueToolNameDeduplicates(t *testing.T) {
+	long := "/" + strings.Repeat("segment/", 10)
+	ops := []Operation{
+		{Method: "GET", Path: "/a.b"},
+		{Method: "GET", Path: "/a_b"},
+		{Method: "GET", Path: long + "first"},
+		{Method: "GET", Path: long + "second"},
+		{Method: "POST", Path: "/x", OperationID: "same"},
+		{Method: "PUT", Path: "/x", OperationID: "same"},
+		{Method: "PUT", Path: "/x", OperationID: "same"},
+	}
+	used := map[string]bool{}
+	seen := map[string]string{}
+	for _, op := range ops {
+		name := uniqueToolName(used, toolName(op), op)
+		if len(name) > 64 || toolNameUnsafe.MatchString(name) {
+			t.Errorf("%s %s: name %q is not a valid tool name", op.Method, op.Path, name)
+		}
+		if prev, ok := seen[name]; ok {
+			t.Errorf("%s %s: name %q already used by %s", op.Method, op.Path, name, prev)
+		}
+		seen[name] = op.Method + " " + op.Path
+	}
+	if _, ok := seen["get__a_b"]; !ok {
+		t.Errorf("names = %v, want the first operation to keep get__a_b", seen)
+	}
+}
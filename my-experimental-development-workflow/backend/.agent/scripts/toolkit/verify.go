@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// collectionKeys are the wrapper fields commonly used for paged lists.
+var collectionKeys = []string{"items", "data", "results", "content", "records"}
+
+// RunVerify implements `api spec verify [--sample N] [--seed S]`: it calls a
+// random sample of GET operations and validates each response against the
+// schema the spec declares for the returned status.
+func RunVerify(cfg *ResolvedConfig, args []string) error {
+	sample := 10
+	seed := time.Now().UnixNano()
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--sample", "--seed":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || (flag == "--sample" && n <= 0) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid %s: %s", flag, args[i]))
+			}
+			if flag == "--sample" {
+				sample = int(n)
+			} else {
+				seed = n
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown spec verify option: %s", args[i]))
+		}
+	}
+
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	gets := make([]Operation, 0)
+	for _, op := range agentapi.IterOperations(spec) {
+		if op.Method == "GET" {
+			gets = append(gets, op)
+		}
+	}
+	sortOperations(gets)
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(gets), func(i, j int) { gets[i], gets[j] = gets[j], gets[i] })
+	if len(gets) > sample {
+		gets = gets[:sample]
+	}
+	// Collections first so their items can feed path params of detail routes.
+	sort.SliceStable(gets, func(i, j int) bool {
+		return strings.Count(gets[i].Path, "{") < strings.Count(gets[j].Path, "{")
+	})
+
+	firstItems := map[string]map[string]any{}
+	drift := 0
+	fmt.Printf("Verifying %d GET operations (seed %d)\n", len(gets), seed)
+	for _, op := range gets {
+		reqPath, missing := fillVerifyParams(spec, op, firstItems)
+		if missing != "" {
+			fmt.Printf("SKIP   GET %s: no value for %s\n", op.Path, missing)
+			continue
+		}
+		resp, err := PerformRequest(cfg, APIRequest{Method: "GET", Path: reqPath, Spec: spec, Source: "verify"})
+		if err != nil {
+			fmt.Printf("ERROR  GET %s: %s\n", reqPath, ExitMessage(err))
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			fmt.Printf("ERROR  GET %s: HTTP %d\n", reqPath, resp.StatusCode)
+			continue
+		}
+		var doc any
+		if err := json.Unmarshal(resp.Body, &doc); err != nil {
+			fmt.Printf("OK     GET %s (%d, non-JSON body)\n", reqPath, resp.StatusCode)
+			continue
+		}
+		if item := firstCollectionItem(doc); item != nil {
+			firstItems[op.Path] = item
+		}
+		schema, ok := responseSchema(spec, op.Raw, resp.StatusCode)
+		if !ok {
+			fmt.Printf("OK     GET %s (%d, no schema declared)\n", reqPath, resp.StatusCode)
+			continue
+		}
+		errs := ValidateSchema(spec, schema, doc)
+		if len(errs) == 0 {
+			fmt.Printf("OK     GET %s (%d)\n", reqPath, resp.StatusCode)
+			continue
+		}
+		drift++
+		fmt.Printf("DRIFT  GET %s (%d)\n", reqPath, resp.StatusCode)
+		for i, e := range errs {
+			if i == 10 {
+				fmt.Printf("         ... %d more\n", len(errs)-i)
+				break
+			}
+			fmt.Printf("         - %s\n", e)
+		}
+	}
+	fmt.Printf("\n%d of %d sampled operations drift from the spec\n", drift, len(gets))
+	if drift > 0 {
+		return NewCliError(ExitAssertionFailed, "")
+	}
+	return nil
+}
+
+// fillVerifyParams substitutes path params and required query params from
+// spec examples or from items captured off the parent collection. It returns
+// the name of the first param it could not fill.
+func fillVerifyParams(spec map[string]any, op Operation, firstItems map[string]map[string]any) (string, string) {
+	path := op.Path
+	query := url.Values{}
+	for _, p := range op.Parameters {
+		name, pin := p.Name, p.In
+		if pin != "path" && !(pin == "query" && p.Required) {
+			continue
+		}
+		val, ok := parameterExample(spec, p.Raw)
+		if !ok && pin == "path" {
+			val, ok = capturedParam(op.Path, name, firstItems)
+		}
+		if !ok {
+			return "", pin + ":" + name
+		}
+		if pin == "path" {
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(val))
+		} else {
+			query.Add(name, val)
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, ""
+}
+
+// parameterExample returns an example, default or first enum value declared
+// for a parameter.
+func parameterExample(spec map[string]any, p map[string]any) (string, bool) {
+	if v, ok := p["example"]; ok {
+		return jsonScalarString(v), true
+	}
+	if v, ok := p["x-example"]; ok {
+		return jsonScalarString(v), true
+	}
+	if examples, ok := agentapi.AsMap(p["examples"]); ok {
+		for _, k := range agentapi.SortedKeys(examples) {
+			if ex, ok := agentapi.AsMap(examples[k]); ok {
+				if v, ok := ex["value"]; ok {
+					return jsonScalarString(v), true
+				}
+			}
+		}
+	}
+	schema, ok := agentapi.AsMap(p["schema"])
+	if !ok {
+		schema = p // Swagger 2 puts type/enum on the parameter itself
+	}
+	schema = derefSchema(spec, schema)
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return jsonScalarString(v), true
+		}
+	}
+	if enum, ok := agentapi.AsSlice(schema["enum"]); ok && len(enum) > 0 {
+		return jsonScalarString(enum[0]), true
+	}
+	return "", false
+}
+
+// capturedParam looks up /things/{id} style params on the first item of the
+// parent collection (/things), trying the param name and then "id".
+func capturedParam(templatePath, name string, firstItems map[string]map[string]any) (string, bool) {
+	idx := strings.Index(templatePath, "/{"+name+"}")
+	if idx <= 0 {
+		return "", false
+	}
+	item, ok := firstItems[templatePath[:idx]]
+	if !ok {
+		return "", false
+	}
+	for _, key := range []string{name, "id"} {
+		if v, ok := item[key]; ok && v != nil {
+			return jsonScalarString(v), true
+		}
+	}
+	return "", false
+}
+
+func firstCollectionItem(doc any) map[string]any {
+	if arr, ok := doc.([]any); ok {
+		if len(arr) > 0 {
+			m, _ := arr[0].(map[string]any)
+			return m
+		}
+		return nil
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for _, key := range collectionKeys {
+		if arr, ok := obj[key].([]any); ok && len(arr) > 0 {
+			m, _ := arr[0].(map[string]any)
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version, commit and buildDate are stamped by scripts/release-toolkit.sh:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=... -X main.buildDate=..."
+//
+// Unstamped builds fall back to the VCS info go build embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// releasesURL hosts the release assets self-update downloads: one binary
+// per platform (see releaseAssetName) and a checksums.txt in sha256sum
+// format.
+const releasesURL = "https://github.com/Winds-AI/agents-config/releases"
+
+// updateTimeout bounds each self-update download.
+const updateTimeout = 5 * time.Minute
+
+// BuildInfo describes the running binary, as printed by `api version`.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// CurrentBuildInfo merges the ldflags stamps with the embedded VCS info.
+func CurrentBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func (b BuildInfo) String() string {
+	details := make([]string, 0, 3)
+	if b.Commit != "" {
+		c := b.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if b.Modified {
+			c += "-dirty"
+		}
+		details = append(details, "commit "+c)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	}
+	details = append(details, b.GoVersion+" "+b.Platform)
+	return fmt.Sprintf("agent-api %s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// RunVersion implements `api version [--format text|json]`.
+func RunVersion(args []string) error {
+	format := "text"
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			format = args[i]
+		default:
+			return NewCliError(ExitRequestBuild, "Usage: api version [--format text|json]")
+		}
+	}
+	info := CurrentBuildInfo()
+	switch format {
+	case "text":
+		fmt.Println(info)
+	case "json":
+		b, _ := json.Marshal(info)
+		fmt.Println(string(b))
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --format: %s (expected text|json)", format))
+	}
+	return nil
+}
+
+// releaseAssetName is the release file of the binary for this platform.
+func releaseAssetName() string {
+	name := fmt.Sprintf("agent-api_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// releaseSource reads release files from a base URL or a local directory.
+type releaseSource struct {
+	base string
+	http *http.Client
+}
+
+func (s releaseSource) open(name string) (io.ReadCloser, error) {
+	if !strings.Contains(s.base, "://") {
+		f, err := os.Open(filepath.Join(s.base, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, NewCliErrorHint(ExitNotFound, fmt.Sprintf("Release file not found: %s", filepath.Join(s.base, name)), "Point --from at a directory built by scripts/release-toolkit.sh.")
+			}
+			return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read %s: %v", name, err), err)
+		}
+		return f, nil
+	}
+	u := strings.TrimSuffix(s.base, "/") + "/" + name
+	req, err := http.NewRequestWithContext(runCtx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err), err)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		if runCtx.Err() != nil {
+			return nil, WrapCliError(ExitInterrupted, fmt.Sprintf("Interrupted: download of %s cancelled", u), err)
+		}
+		return nil, &CliError{Code: ExitUnexpected, Message: fmt.Sprintf("Download failed: %v", err), Suggestion: "Check network access, or download the release files and pass --from <dir>.", Cause: err}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, NewCliErrorHint(ExitNotFound, fmt.Sprintf("Release file not found: %s", u), "Check the tag passed to --version, or that the release publishes "+releaseAssetName()+".")
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, NewCliError(ExitHTTPErrorStatus, fmt.Sprintf("Download failed: %s returned HTTP %d", u, resp.StatusCode))
+	}
+	return resp.Body, nil
+}
+
+// releaseChecksum returns the sha256 that checksums.txt lists for asset.
+func (s releaseSource) releaseChecksum(asset string) (string, error) {
+	rc, err := s.open("checksums.txt")
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	sc := bufio.NewScanner(rc)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read checksums.txt: %v", err), err)
+	}
+	return "", NewCliErrorHint(ExitNotFound, fmt.Sprintf("checksums.txt lists no %s", asset), "This platform may not be published; build from source instead (see the README).")
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RunSelfUpdate implements `api self-update [--version <tag>] [--from
+// <url|dir>] [--check]`. The binary is replaced only once its sha256
+// matches checksums.txt; api and acurl symlinks follow automatically.
+func RunSelfUpdate(args []string) error {
+	tag := ""
+	from := ""
+	check := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--version", "--from":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			if flag == "--version" {
+				tag = args[i]
+			} else {
+				from = args[i]
+			}
+		case "--check":
+			check = true
+		default:
+			return NewCliError(ExitRequestBuild, "Usage: api self-update [--version <tag>] [--from <url|dir>] [--check]")
+		}
+	}
+	if from == "" {
+		from = releasesURL + "/latest/download"
+		if tag != "" {
+			from = releasesURL + "/download/" + tag
+		}
+	} else if tag != "" {
+		return NewCliError(ExitRequestBuild, "--version and --from are mutually exclusive")
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Cannot locate the running binary: %v", err), err)
+	}
+	current, err := fileSHA256(exe)
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read %s: %v", exe, err), err)
+	}
+
+	src := releaseSource{base: from, http: &http.Client{Timeout: updateTimeout, Transport: traced(nil)}}
+	asset := releaseAssetName()
+	want, err := src.releaseChecksum(asset)
+	if err != nil {
+		return err
+	}
+	if want == current {
+		fmt.Printf("Already up to date: %s matches %s/%s.\n", exe, from, asset)
+		return nil
+	}
+	if check {
+		fmt.Printf("Update available: %s/%s (sha256 %s).\n", from, asset, want)
+		return nil
+	}
+
+	rc, err := src.open(asset)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".agent-api-update-*")
+	if err != nil {
+		return &CliError{Code: ExitUnexpected, Message: fmt.Sprintf("Cannot write next to %s: %v", exe, err), Suggestion: "Re-run with write access to the binary's directory.", Cause: err}
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if runCtx.Err() != nil {
+			return WrapCliError(ExitInterrupted, fmt.Sprintf("Interrupted: download of %s cancelled; %s is unchanged", asset, exe), err)
+		}
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Download of %s failed: %v", asset, err), err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return NewCliErrorHint(ExitUnexpected, fmt.Sprintf("Checksum mismatch for %s: got %s, checksums.txt lists %s; %s is unchanged", asset, got, want, exe), "Retry; if it persists the release is corrupt or tampered with.")
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to chmod %s: %v", tmp.Name(), err), err)
+	}
+	if runtime.GOOS == "windows" {
+		// A running .exe cannot be replaced, only renamed out of the way.
+		_ = os.Remove(exe + ".old")
+		if err := os.Rename(exe, exe+".old"); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to move %s aside: %v", exe, err), err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to replace %s: %v", exe, err), err)
+	}
+	fmt.Printf("Updated %s from %s/%s (sha256 %s).\n", exe, from, asset, want)
+	return nil
+}
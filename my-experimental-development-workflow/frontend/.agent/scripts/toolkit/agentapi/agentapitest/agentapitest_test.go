@@ -0,0 +1,137 @@
+package agentapitest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"agent-api-toolkit/agentapi"
+	"agent-api-toolkit/agentapi/agentapitest"
+)
+
+func TestReadOnlyBlocksPost(t *testing.T) {
+	b := agentapitest.NewBackend(nil)
+	defer b.Close()
+	b.Handle("POST", "/users", http.StatusCreated, `{"id":"1"}`)
+
+	c := &agentapi.Client{Config: b.Config(t.TempDir(), "read-only", false)}
+	_, err := c.Do(context.Background(), agentapi.Request{Method: "POST", Path: "/users", Body: `{"name":"` + agentapitest.Marker + `"}`})
+	if code := agentapi.ExitCode(err); code != agentapi.ExitBlockedByMode {
+		t.Fatalf("POST in read-only: exit %d (%v), want %d", code, err, agentapi.ExitBlockedByMode)
+	}
+	if got := b.Received(); len(got) != 0 {
+		t.Fatalf("blocked request reached the backend: %+v", got)
+	}
+}
+
+func TestSafeUpdatesNeedsMarker(t *testing.T) {
+	b := agentapitest.NewBackend(nil)
+	defer b.Close()
+	b.Handle("POST", "/users", http.StatusCreated, `{"id":"1"}`)
+	c := &agentapi.Client{Config: b.Config(t.TempDir(), "safe-updates", false)}
+
+	_, err := c.Do(context.Background(), agentapi.Request{Method: "POST", Path: "/users", Body: `{"name":"bob"}`})
+	if code := agentapi.ExitCode(err); code != agentapi.ExitMarkerMissing {
+		t.Fatalf("POST without marker: exit %d (%v), want %d", code, err, agentapi.ExitMarkerMissing)
+	}
+	if got := b.Received(); len(got) != 0 {
+		t.Fatalf("blocked request reached the backend: %+v", got)
+	}
+
+	resp, err := c.Do(context.Background(), agentapi.Request{Method: "POST", Path: "/users", Body: `{"name":"bob ` + agentapitest.Marker + `"}`})
+	if err != nil {
+		t.Fatalf("POST with marker: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST with marker: status %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	got := b.Received()
+	if len(got) != 1 || got[0].Header.Get("Authorization") != "Bearer "+agentapitest.Token {
+		t.Fatalf("backend received %+v, want one request with the config's token", got)
+	}
+}
+
+func TestStrictRejectsUnknownPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	b := agentapitest.NewBackend(nil)
+	defer b.Close()
+	b.Handle("GET", "/users/7", http.StatusOK, `{"id":"7"}`)
+	path, err := b.WriteConfig(t.TempDir(), "read-only", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := agentapi.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(%s): %v", path, err)
+	}
+	c := &agentapi.Client{Config: cfg}
+
+	_, err = c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/accounts"})
+	if code := agentapi.ExitCode(err); code != agentapi.ExitRequestBuild {
+		t.Fatalf("GET /accounts in strict mode: exit %d (%v), want %d", code, err, agentapi.ExitRequestBuild)
+	}
+	if _, err = c.Do(context.Background(), agentapi.Request{Method: "DELETE", Path: "/users"}); agentapi.ExitCode(err) == 0 {
+		t.Fatal("DELETE /users, a method the spec lacks, was allowed")
+	}
+	if got := b.Received(); len(got) != 0 {
+		t.Fatalf("rejected requests reached the backend: %+v", got)
+	}
+
+	resp, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/users/7"})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /users/7 in strict mode: %v, %+v", err, resp)
+	}
+}
+
+func TestFixturesAnswerWithoutNetwork(t *testing.T) {
+	b := agentapitest.NewBackend(nil)
+	defer b.Close()
+	c := &agentapi.Client{Config: b.Config(t.TempDir(), "read-only", false), Doer: agentapitest.Fixtures{
+		"GET /api/users": {Status: http.StatusOK, Body: `[{"id":"1"}]`},
+	}}
+	resp, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/users"})
+	if err != nil || resp.StatusCode != http.StatusOK || string(resp.Body) != `[{"id":"1"}]` {
+		t.Fatalf("fixture GET /users: %v, %+v", err, resp)
+	}
+	if _, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/users/1"}); err == nil {
+		t.Fatal("request without a fixture succeeded")
+	}
+	if got := b.Received(); len(got) != 0 {
+		t.Fatalf("fixture requests reached the backend: %+v", got)
+	}
+}
+
+func TestSpecServerOffHostGetsNoToken(t *testing.T) {
+	files := agentapitest.NewBackend(nil)
+	defer files.Close()
+	files.Handle("GET", "/uploads", http.StatusOK, `[]`)
+	b := agentapitest.NewBackend(nil)
+	defer b.Close()
+	var spec map[string]any
+	if err := json.Unmarshal([]byte(`{"openapi": "3.0.0", "paths": {"/uploads": {"get": {"servers": [{"url": "`+files.URL+`"}], "responses": {"200": {"description": "ok"}}}}}}`), &spec); err != nil {
+		t.Fatal(err)
+	}
+	cfg := b.Config(t.TempDir(), "read-only", true)
+	c := &agentapi.Client{Config: cfg, Spec: spec}
+
+	_, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/uploads"})
+	if code := agentapi.ExitCode(err); code != agentapi.ExitRequestBuild {
+		t.Fatalf("GET /uploads off api_base: exit %d (%v), want %d", code, err, agentapi.ExitRequestBuild)
+	}
+	if got := files.Received(); len(got) != 0 {
+		t.Fatalf("the token was sent off api_base: %+v", got)
+	}
+
+	if _, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/uploads", Headers: []string{"Authorization: Bearer files-token"}}); err != nil {
+		t.Fatalf("GET /uploads with its own Authorization: %v", err)
+	}
+	cfg.AllowSpecServers = []string{files.URL}
+	if _, err := c.Do(context.Background(), agentapi.Request{Method: "GET", Path: "/uploads"}); err != nil {
+		t.Fatalf("GET /uploads to an allowed server: %v", err)
+	}
+	got := files.Received()
+	if len(got) != 2 || got[0].Header.Get("Authorization") != "Bearer files-token" || got[1].Header.Get("Authorization") != "Bearer "+agentapitest.Token {
+		t.Fatalf("server received %+v, want the given then the env's token", got)
+	}
+}
@@ -0,0 +1,29 @@
+package agentapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// Doer sends one HTTP request. *http.Client implements it; tests and the
+// CLIs' --offline mode substitute a fake backend or canned fixtures.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DefaultDoer, when set, carries every network call of the package: spec
+// fetches and Client calls that set neither Doer nor Transport.
+var DefaultDoer Doer
+
+// DefaultTransport, when set, replaces http.DefaultTransport in the
+// clients NewDoer builds; the CLIs wrap it to trace requests.
+var DefaultTransport http.RoundTripper
+
+// NewDoer returns DefaultDoer when set, else an *http.Client bounded by
+// timeout.
+func NewDoer(timeout time.Duration) Doer {
+	if DefaultDoer != nil {
+		return DefaultDoer
+	}
+	return &http.Client{Timeout: timeout, Transport: DefaultTransport}
+}
@@ -0,0 +1,449 @@
+package agentapi
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxRefDepth bounds $ref chains so a cyclic document cannot loop forever.
+const maxRefDepth = 32
+
+// Document is the typed view of a decoded spec that lookups and strict
+// validation run on. It is built once per spec: parameter $refs are
+// resolved, path-level parameters are inherited by every operation of the
+// path, and paths are ranked so literal segments win over templates
+// (/users/me before /users/{id}).
+type Document struct {
+	Raw   map[string]any
+	Paths []*PathItem
+
+	operations []Operation
+	byID       map[string]int
+	byRoute    map[string]int
+	// bySegments groups Paths by segment count, keeping their ranking, so
+	// Match only compares templates that can fit.
+	bySegments map[int][]*PathItem
+
+	searchOnce sync.Once
+	search     *searchIndex
+}
+
+// PathItem is one templated path with its operations keyed by upper-case
+// method.
+type PathItem struct {
+	Template   string
+	Operations map[string]*Operation
+
+	segments []string
+	literals int
+}
+
+// Parameter is a resolved path, query, header or cookie parameter.
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	// Raw is the parameter object after $ref resolution.
+	Raw map[string]any `json:"-"`
+}
+
+// ResolveRef follows a local JSON pointer such as "#/components/schemas/X"
+// (or "#/definitions/X" in Swagger 2 documents).
+func ResolveRef(spec map[string]any, ref string) (map[string]any, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+	var cur any = spec
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := AsMap(cur)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return AsMap(cur)
+}
+
+// deref follows a $ref chain to the referenced object.
+func deref(spec map[string]any, obj map[string]any) map[string]any {
+	for i := 0; i < maxRefDepth; i++ {
+		ref := AsString(obj["$ref"])
+		if ref == "" {
+			return obj
+		}
+		next, ok := ResolveRef(spec, ref)
+		if !ok {
+			return obj
+		}
+		obj = next
+	}
+	return obj
+}
+
+// NewDocument builds the typed model of spec. Malformed path items,
+// operations and parameters are skipped rather than rejected, matching
+// what ParseSpec accepts.
+func NewDocument(spec map[string]any) *Document {
+	d := &Document{Raw: spec, byID: map[string]int{}, byRoute: map[string]int{}, bySegments: map[int][]*PathItem{}}
+	paths, _ := AsMap(spec["paths"])
+	for template, itemAny := range paths {
+		item, ok := AsMap(itemAny)
+		if !ok {
+			continue
+		}
+		item = deref(spec, item)
+		pi := &PathItem{Template: template, Operations: map[string]*Operation{}, segments: NormalizeSegments(template)}
+		for _, s := range pi.segments {
+			if !isTemplateSegment(s) {
+				pi.literals++
+			}
+		}
+		inherited := parameters(spec, item["parameters"])
+		pathServers := serverURLs(item["servers"])
+		for method, opAny := range item {
+			if _, ok := openapiMethods[strings.ToLower(method)]; !ok {
+				continue
+			}
+			op, _ := AsMap(opAny)
+			tags := make([]string, 0)
+			if tagsAny, ok := AsSlice(op["tags"]); ok {
+				for _, t := range tagsAny {
+					if ts, ok := t.(string); ok {
+						tags = append(tags, ts)
+					}
+				}
+			}
+			servers := serverURLs(op["servers"])
+			if len(servers) == 0 {
+				servers = pathServers
+			}
+			d.operations = append(d.operations, Operation{
+				Method:      strings.ToUpper(method),
+				Path:        template,
+				OperationID: AsString(op["operationId"]),
+				Summary:     AsString(op["summary"]),
+				Description: AsString(op["description"]),
+				Tags:        tags,
+				Parameters:  mergeParameters(inherited, parameters(spec, op["parameters"])),
+				Servers:     servers,
+				Raw:         op,
+			})
+		}
+		d.Paths = append(d.Paths, pi)
+	}
+
+	sort.Slice(d.operations, func(i, j int) bool {
+		if d.operations[i].Path != d.operations[j].Path {
+			return d.operations[i].Path < d.operations[j].Path
+		}
+		return d.operations[i].Method < d.operations[j].Method
+	})
+	byTemplate := make(map[string]*PathItem, len(d.Paths))
+	for _, pi := range d.Paths {
+		byTemplate[pi.Template] = pi
+	}
+	for i := range d.operations {
+		op := &d.operations[i]
+		byTemplate[op.Path].Operations[op.Method] = op
+		d.byRoute[op.Method+" "+op.Path] = i
+		if _, dup := d.byID[op.OperationID]; op.OperationID != "" && !dup {
+			d.byID[op.OperationID] = i
+		}
+	}
+	sort.Slice(d.Paths, func(i, j int) bool {
+		if d.Paths[i].literals != d.Paths[j].literals {
+			return d.Paths[i].literals > d.Paths[j].literals
+		}
+		return d.Paths[i].Template < d.Paths[j].Template
+	})
+	for _, pi := range d.Paths {
+		d.bySegments[len(pi.segments)] = append(d.bySegments[len(pi.segments)], pi)
+	}
+	return d
+}
+
+// serverURLs reads an OpenAPI servers list, substituting each {variable}
+// with its default.
+func serverURLs(listAny any) []string {
+	list, _ := AsSlice(listAny)
+	out := make([]string, 0, len(list))
+	for _, sAny := range list {
+		server, _ := AsMap(sAny)
+		u := AsString(server["url"])
+		if u == "" {
+			continue
+		}
+		vars, _ := AsMap(server["variables"])
+		for name, vAny := range vars {
+			v, _ := AsMap(vAny)
+			u = strings.ReplaceAll(u, "{"+name+"}", AsString(v["default"]))
+		}
+		out = append(out, strings.TrimRight(u, "/"))
+	}
+	return out
+}
+
+// searchTerm picks the last literal segment of a path as an api find query.
+func searchTerm(path string) string {
+	segs := NormalizeSegments(path)
+	for i := len(segs) - 1; i >= 0; i-- {
+		if !isTemplateSegment(segs[i]) && strings.Trim(segs[i], "0123456789-") != "" {
+			return segs[i]
+		}
+	}
+	return "<keywords>"
+}
+
+func isTemplateSegment(s string) bool {
+	return strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") && len(s) > 2
+}
+
+// parameters decodes a parameters list, resolving $refs.
+func parameters(spec map[string]any, listAny any) []Parameter {
+	items, _ := AsSlice(listAny)
+	out := make([]Parameter, 0, len(items))
+	for _, pAny := range items {
+		p, ok := AsMap(pAny)
+		if !ok {
+			continue
+		}
+		p = deref(spec, p)
+		name := AsString(p["name"])
+		in := AsString(p["in"])
+		if name == "" || in == "" {
+			continue
+		}
+		required, _ := p["required"].(bool)
+		schema, _ := AsMap(p["schema"])
+		out = append(out, Parameter{Name: name, In: in, Description: AsString(p["description"]), Required: required || in == "path", Schema: schema, Raw: p})
+	}
+	return out
+}
+
+// mergeParameters combines path-level and operation-level parameters; the
+// operation wins on (in, name) conflicts. The result is sorted by in, name.
+func mergeParameters(inherited, own []Parameter) []Parameter {
+	merged := make(map[string]Parameter, len(inherited)+len(own))
+	for _, p := range inherited {
+		merged[p.In+":"+p.Name] = p
+	}
+	for _, p := range own {
+		merged[p.In+":"+p.Name] = p
+	}
+	out := make([]Parameter, 0, len(merged))
+	for _, p := range merged {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].In != out[j].In {
+			return out[i].In < out[j].In
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Operations returns a copy of every operation, sorted by path and method.
+func (d *Document) Operations() []Operation {
+	out := make([]Operation, len(d.operations))
+	copy(out, d.operations)
+	return out
+}
+
+// Search ranks the operations against query like SearchOperations, through
+// a token index built on the first call; worth it for a document searched
+// more than a few times.
+func (d *Document) Search(query, methodFilter string) []Operation {
+	d.searchOnce.Do(func() { d.search = newSearchIndex(d.operations) })
+	return d.search.search(query, methodFilter)
+}
+
+// Lookup resolves an operationId or "METHOD /path".
+func (d *Document) Lookup(ref string) (*Operation, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, NewError(ExitNotFound, "Empty endpoint reference")
+	}
+	parts := strings.SplitN(ref, " ", 2)
+	if len(parts) == 2 {
+		method := strings.ToUpper(strings.TrimSpace(parts[0]))
+		path := strings.TrimSpace(parts[1])
+		if _, ok := httpMethods[method]; ok && strings.HasPrefix(path, "/") {
+			if i, ok := d.byRoute[method+" "+path]; ok {
+				cp := d.operations[i]
+				return &cp, nil
+			}
+			return nil, NewErrorHint(ExitNotFound, fmt.Sprintf("Endpoint not found: %s %s%s", method, path, DidYouMean(method+" "+path, d.routes())), fmt.Sprintf("Paths are templates such as /users/{id}; search with: api find %s --method %s.", searchTerm(path), method))
+		}
+	}
+	if i, ok := d.byID[ref]; ok {
+		cp := d.operations[i]
+		return &cp, nil
+	}
+	return nil, NewError(ExitNotFound, fmt.Sprintf("Operation not found for ref: %s%s", ref, DidYouMean(ref, d.operationIDs())))
+}
+
+// routes lists "METHOD /path" of every operation, in spec order.
+func (d *Document) routes() []string {
+	out := make([]string, len(d.operations))
+	for i, op := range d.operations {
+		out[i] = op.Method + " " + op.Path
+	}
+	return out
+}
+
+// operationIDs lists the operationIds Lookup resolves, in spec order.
+func (d *Document) operationIDs() []string {
+	out := make([]string, 0, len(d.byID))
+	for i, op := range d.operations {
+		if j, ok := d.byID[op.OperationID]; ok && j == i {
+			out = append(out, op.OperationID)
+		}
+	}
+	return out
+}
+
+// Match finds the operation serving a concrete request path and returns
+// its decoded path params. Literal segments are preferred over templates.
+func (d *Document) Match(method, requestPath string) (*Operation, map[string]string, bool) {
+	method = strings.ToUpper(method)
+	segs := NormalizeSegments(requestPath)
+	for _, pi := range d.bySegments[len(segs)] {
+		op, ok := pi.Operations[method]
+		if !ok || !segmentsFit(pi.segments, segs) {
+			continue
+		}
+		if params, ok := MatchOpenAPIPath(pi.Template, requestPath); ok {
+			return op, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// methodOrder sorts the operations MatchAll returns.
+var methodOrder = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE"}
+
+// MatchAll returns every operation serving a concrete request path, one
+// per method and each the one Match would pick, in methodOrder.
+func (d *Document) MatchAll(requestPath string) []*Operation {
+	segs := NormalizeSegments(requestPath)
+	byMethod := map[string]*Operation{}
+	for _, pi := range d.bySegments[len(segs)] {
+		if !segmentsFit(pi.segments, segs) {
+			continue
+		}
+		if _, ok := MatchOpenAPIPath(pi.Template, requestPath); !ok {
+			continue
+		}
+		for method, op := range pi.Operations {
+			if _, seen := byMethod[method]; !seen {
+				byMethod[method] = op
+			}
+		}
+	}
+	out := make([]*Operation, 0, len(byMethod))
+	for _, method := range methodOrder {
+		if op, ok := byMethod[method]; ok {
+			out = append(out, op)
+		}
+	}
+	return out
+}
+
+// segmentsFit is the allocation-free pre-check of MatchOpenAPIPath: every
+// literal segment of the template equals the request's.
+func segmentsFit(template, request []string) bool {
+	for i, t := range template {
+		if !isTemplateSegment(t) && t != request[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the endpoint exists and that required path and query
+// params are present.
+func (d *Document) Validate(method, pathWithQuery string) error {
+	if len(d.Paths) == 0 {
+		return NewError(ExitOpenAPIParse, "OpenAPI spec is missing a valid 'paths' object")
+	}
+	u, err := url.Parse(pathWithQuery)
+	if err != nil {
+		return WrapError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err), err)
+	}
+	op, pathParams, ok := d.Match(method, u.Path)
+	if !ok {
+		return NewErrorHint(ExitRequestBuild, fmt.Sprintf("Strict mode: endpoint not found in OpenAPI spec for %s %s", method, u.Path), fmt.Sprintf("Look up the documented path with: api find %s --method %s.", searchTerm(u.Path), strings.ToUpper(method)))
+	}
+
+	query := u.Query()
+	missing := make([]string, 0)
+	for _, p := range op.Parameters {
+		if !p.Required {
+			continue
+		}
+		switch p.In {
+		case "path":
+			if strings.TrimSpace(pathParams[p.Name]) == "" {
+				missing = append(missing, "path:"+p.Name)
+			}
+		case "query":
+			nonEmpty := false
+			for _, v := range query[p.Name] {
+				if strings.TrimSpace(v) != "" {
+					nonEmpty = true
+					break
+				}
+			}
+			if !nonEmpty {
+				missing = append(missing, "query:"+p.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return NewErrorHint(ExitRequestBuild, fmt.Sprintf("Strict mode: missing required params: %s", strings.Join(missing, ", ")), fmt.Sprintf(`Fill them in; api show "%s %s" lists every parameter.`, op.Method, op.Path))
+	}
+	return nil
+}
+
+// docCacheSize is how many recently used specs keep their Document, so the
+// map-based helpers do not rebuild it on every call of a long-running
+// command. Cached entries hold a reference to their spec, so a key can
+// never be reused by a different map.
+const docCacheSize = 4
+
+var docCache struct {
+	sync.Mutex
+	entries []*Document
+}
+
+// documentFor returns the cached Document of spec, building it on a miss.
+// Specs are treated as immutable once loaded.
+func documentFor(spec map[string]any) *Document {
+	key := reflect.ValueOf(spec).UnsafePointer()
+	docCache.Lock()
+	defer docCache.Unlock()
+	for i, d := range docCache.entries {
+		if reflect.ValueOf(d.Raw).UnsafePointer() == key {
+			copy(docCache.entries[1:i+1], docCache.entries[:i])
+			docCache.entries[0] = d
+			return d
+		}
+	}
+	d := NewDocument(spec)
+	docCache.entries = append([]*Document{d}, docCache.entries...)
+	if len(docCache.entries) > docCacheSize {
+		docCache.entries = docCache.entries[:docCacheSize]
+	}
+	return d
+}
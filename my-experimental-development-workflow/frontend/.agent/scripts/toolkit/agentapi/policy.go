@@ -0,0 +1,191 @@
+package agentapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Policy is the guardrail decision for one env: api_mode always, and the
+// spec when strict is on.
+type Policy struct {
+	Config *Config
+	// Spec is required when Config.Strict is set.
+	Spec map[string]any
+}
+
+// Check evaluates a request without sending it.
+func (p Policy) Check(method, pathWithQuery, body string) error {
+	if err := EnforceMode(p.Config, method, body); err != nil {
+		return err
+	}
+	if !p.Config.Strict {
+		return nil
+	}
+	if p.Spec == nil {
+		return NewError(ExitOpenAPIFetch, fmt.Sprintf("Strict mode needs the OpenAPI spec of %s/%s", p.Config.ActiveProject, p.Config.ActiveEnv))
+	}
+	return ValidateAgainstOpenAPI(p.Spec, method, pathWithQuery)
+}
+
+// EnforceMode applies api_mode: the allowed methods and, in safe-updates,
+// the agent_marker requirement for write bodies.
+func EnforceMode(cfg *Config, method string, body string) error {
+	allowed := map[string]struct{}{}
+	switch cfg.APIMode {
+	case "read-only":
+		allowed["GET"] = struct{}{}
+		allowed["HEAD"] = struct{}{}
+		allowed["OPTIONS"] = struct{}{}
+	case "safe-updates":
+		allowed["GET"] = struct{}{}
+		allowed["HEAD"] = struct{}{}
+		allowed["OPTIONS"] = struct{}{}
+		allowed["POST"] = struct{}{}
+		allowed["PUT"] = struct{}{}
+		allowed["PATCH"] = struct{}{}
+	default: // full-access
+		for m := range httpMethods {
+			allowed[m] = struct{}{}
+		}
+	}
+	if _, ok := allowed[method]; !ok {
+		Logger.Debug("policy denied", "method", method, "api_mode", cfg.APIMode, "reason", "blocked_by_mode")
+		if method == "DELETE" && cfg.SoftDelete != nil {
+			if _, ok := allowed[cfg.SoftDelete.Method]; ok {
+				return NewErrorHint(ExitBlockedByMode, fmt.Sprintf("Method %s blocked by api_mode=%s", method, cfg.APIMode), fmt.Sprintf("This API soft-deletes: add --soft to send %s with %s instead.", cfg.SoftDelete.Method, cfg.SoftDelete.Body))
+			}
+		}
+		return NewErrorHint(ExitBlockedByMode, fmt.Sprintf("Method %s blocked by api_mode=%s", method, cfg.APIMode), fmt.Sprintf("%s needs api_mode=%s; use an env configured that way rather than loosening %s/%s.", method, modeAllowing(method), cfg.ActiveProject, cfg.ActiveEnv))
+	}
+	if cfg.APIMode == "safe-updates" && (method == "POST" || method == "PUT" || method == "PATCH") {
+		if body == "" || !strings.Contains(body, cfg.AgentMarker) {
+			Logger.Debug("policy denied", "method", method, "api_mode", cfg.APIMode, "reason", "marker_missing")
+			if others := MarkerSessions(cfg.MarkerTemplate, body); len(others) > 0 {
+				return NewErrorHint(ExitMarkerMissing, fmt.Sprintf("Request body carries the marker of session %s, not this session's '%s'", others[0], cfg.AgentMarker), fmt.Sprintf("Each agent marks its own data: use '%s', or set %s=%s to act as that session.", cfg.AgentMarker, SessionEnv, others[0]))
+			}
+			return NewErrorHint(ExitMarkerMissing, fmt.Sprintf("Missing required agent_marker '%s' in request body", cfg.AgentMarker), fmt.Sprintf(`Put the marker in a string field of the body, e.g. "name": "%s test".`, cfg.AgentMarker))
+		}
+	}
+	Logger.Debug("policy allowed", "method", method, "api_mode", cfg.APIMode)
+	return nil
+}
+
+// methodToken is the syntax of an HTTP method (RFC 9110 token).
+var methodToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// EnforceRawMode is EnforceMode for raw calls, which may use any method:
+// a method acurl knows is checked as usual; any other one has effects no
+// mode describes, so it needs api_mode=full-access. CONNECT and TRACE are
+// refused: one does not address a path, the other echoes the injected
+// token back.
+func EnforceRawMode(cfg *Config, method string, body string) error {
+	if _, ok := httpMethods[method]; ok {
+		return EnforceMode(cfg, method, body)
+	}
+	switch {
+	case !methodToken.MatchString(method):
+		return NewError(ExitRequestBuild, fmt.Sprintf("Invalid HTTP method: %q", method))
+	case strings.EqualFold(method, http.MethodConnect) || strings.EqualFold(method, http.MethodTrace):
+		return NewErrorHint(ExitBlockedByMode, fmt.Sprintf("Method %s is never sent", strings.ToUpper(method)), "To see what a path allows, use api policy explain <path> --preflight.")
+	case cfg.APIMode != "full-access":
+		Logger.Debug("policy denied", "method", method, "api_mode", cfg.APIMode, "reason", "blocked_by_mode")
+		return NewErrorHint(ExitBlockedByMode, fmt.Sprintf("Method %s blocked by api_mode=%s", method, cfg.APIMode), fmt.Sprintf("Methods other than GET, HEAD, OPTIONS, POST, PUT, PATCH and DELETE need api_mode=full-access; use an env configured that way rather than loosening %s/%s.", cfg.ActiveProject, cfg.ActiveEnv))
+	}
+	Logger.Debug("policy allowed", "method", method, "api_mode", cfg.APIMode, "raw", true)
+	return nil
+}
+
+// EnforceHeaders rejects a write (POST, PUT, PATCH, DELETE) that lacks a
+// header of the env's required_headers or whose value is not in its
+// format. headers are "Name: value" lines.
+func EnforceHeaders(cfg *Config, method string, headers []string) error {
+	if len(cfg.RequiredHeaders) == 0 || (method != "POST" && method != "PUT" && method != "PATCH" && method != "DELETE") {
+		return nil
+	}
+	given := map[string]string{}
+	for _, h := range headers {
+		k, v, _ := strings.Cut(h, ":")
+		given[http.CanonicalHeaderKey(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	for _, req := range cfg.RequiredHeaders {
+		example := req.Example
+		if example == "" {
+			example = "<value>"
+		}
+		format := ""
+		if req.Pattern != nil {
+			format = fmt.Sprintf(" (format: %s)", req.Pattern)
+		}
+		v, ok := given[req.Name]
+		switch {
+		case !ok || v == "":
+			Logger.Debug("policy denied", "method", method, "reason", "header_missing", "header", req.Name)
+			return NewErrorHint(ExitHeaderMissing, fmt.Sprintf("%s/%s requires header %s on %s", cfg.ActiveProject, cfg.ActiveEnv, req.Name, method), fmt.Sprintf(`Add -H "%s: %s"%s.`, req.Name, example, format))
+		case req.Pattern != nil && !req.Pattern.MatchString(v):
+			Logger.Debug("policy denied", "method", method, "reason", "header_format", "header", req.Name)
+			return NewErrorHint(ExitHeaderMissing, fmt.Sprintf("Header %s: %q is not in the format %s/%s requires", req.Name, v, cfg.ActiveProject, cfg.ActiveEnv), fmt.Sprintf(`Send a value matching %s, e.g. -H "%s: %s".`, req.Pattern, req.Name, example))
+		}
+	}
+	return nil
+}
+
+// modeAllowing names the least permissive api_mode that allows method.
+func modeAllowing(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return "read-only"
+	case "POST", "PUT", "PATCH":
+		return "safe-updates"
+	}
+	return "full-access"
+}
+
+// NormalizeSegments splits a path into segments, ignoring a trailing slash.
+func NormalizeSegments(path string) []string {
+	if path != "/" && strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+	}
+	stripped := strings.Trim(path, "/")
+	if stripped == "" {
+		return []string{}
+	}
+	return strings.Split(stripped, "/")
+}
+
+// MatchOpenAPIPath matches a request path against a path template and
+// returns the decoded path params.
+func MatchOpenAPIPath(templatePath, requestPath string) (map[string]string, bool) {
+	tSeg := NormalizeSegments(templatePath)
+	rSeg := NormalizeSegments(requestPath)
+	if len(tSeg) != len(rSeg) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i := range tSeg {
+		ts := tSeg[i]
+		rs := rSeg[i]
+		if strings.HasPrefix(ts, "{") && strings.HasSuffix(ts, "}") && len(ts) > 2 {
+			name := strings.TrimSpace(ts[1 : len(ts)-1])
+			if name == "" || rs == "" {
+				return nil, false
+			}
+			decoded, err := url.PathUnescape(rs)
+			if err != nil {
+				return nil, false
+			}
+			params[name] = decoded
+		} else if ts != rs {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ValidateAgainstOpenAPI checks that the endpoint exists and that required
+// path and query params are present.
+func ValidateAgainstOpenAPI(spec map[string]any, method string, pathWithQuery string) error {
+	return documentFor(spec).Validate(method, pathWithQuery)
+}
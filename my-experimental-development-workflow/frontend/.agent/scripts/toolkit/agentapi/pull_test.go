@@ -0,0 +1,32 @@
+package agentapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestPullSpecsForceSkipsHTTPCaches(t *testing.T) {
+	var cacheControl []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl = append(cacheControl, r.Header.Get("Cache-Control"))
+		_, _ = w.Write([]byte(`{"openapi": "3.0.0", "paths": {"/users": {"get": {}}}}`))
+	}))
+	defer srv.Close()
+	cfg := &Config{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev", OpenAPIURL: srv.URL}
+
+	for _, force := range []bool{false, true} {
+		pulls := PullSpecs(context.Background(), []*Config{cfg}, 1, force)
+		if err := PullError(pulls); err != nil || pulls[0].Operations != 1 {
+			t.Fatalf("PullSpecs(force %v) = %+v, %v", force, pulls, err)
+		}
+	}
+	if len(cacheControl) != 2 || cacheControl[0] != "" || cacheControl[1] != "no-cache" {
+		t.Fatalf("Cache-Control sent = %q, want none then no-cache", cacheControl)
+	}
+	if _, err := os.Stat(SpecCachePath(cfg)); err != nil {
+		t.Fatalf("spec not cached: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package agentapi
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultRequestIDHeader carries the id attached to every call when
+// config.toml sets no request_id_header.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// responseRequestIDHeaders are where backends commonly answer with their
+// own request id, checked after the configured header.
+var responseRequestIDHeaders = []string{"X-Request-Id", "X-Correlation-Id", "Request-Id", "X-Amzn-RequestId", "X-Amz-Request-Id", "X-Trace-Id"}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// WithRequestID returns headers with a new id in the request id header of
+// cfg, and the id the call will carry. Headers that already set it keep
+// their value; with request_id_header = "" nothing is added and the id is
+// empty.
+func WithRequestID(cfg *Config, headers []string) ([]string, string) {
+	name := cfg.RequestIDHeader
+	if name == "" {
+		return headers, ""
+	}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), name) {
+			return headers, strings.TrimSpace(v)
+		}
+	}
+	id := NewUUID()
+	return append(headers[:len(headers):len(headers)], name+": "+id), id
+}
+
+// ResponseRequestID returns the request id a backend answered with: the
+// configured header first, then the common ones, or "".
+func ResponseRequestID(cfg *Config, h http.Header) string {
+	if cfg.RequestIDHeader != "" {
+		if v := h.Get(cfg.RequestIDHeader); v != "" {
+			return v
+		}
+	}
+	for _, name := range responseRequestIDHeaders {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package agentapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ResourceActions are the CRUD actions a Resource may offer, in the order
+// they are listed.
+var ResourceActions = []string{"list", "get", "create", "update", "delete"}
+
+// Resource is a REST collection inferred from a spec's paths: a collection
+// path such as /products and its item path /products/{id}.
+type Resource struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ItemPath string `json:"item_path"`
+	// Actions maps each action the spec declares to its method: list and
+	// create on Path, get, update (PATCH when declared, else PUT) and
+	// delete on ItemPath.
+	Actions map[string]string `json:"actions"`
+}
+
+// Target returns the method and the path template of action, false when
+// the resource does not offer it.
+func (r *Resource) Target(action string) (string, string, bool) {
+	method, ok := r.Actions[action]
+	if !ok {
+		return "", "", false
+	}
+	if action == "list" || action == "create" {
+		return method, r.Path, true
+	}
+	return method, r.ItemPath, true
+}
+
+// Resources infers the REST collections of a spec, sorted by path: a path
+// ending in a literal segment with a path one template segment below it,
+// such as /products and /products/{id}.
+func Resources(spec map[string]any) []Resource {
+	methods := map[string]map[string]bool{}
+	for _, op := range IterOperations(spec) {
+		if methods[op.Path] == nil {
+			methods[op.Path] = map[string]bool{}
+		}
+		methods[op.Path][op.Method] = true
+	}
+	paths := make([]string, 0, len(methods))
+	for p := range methods {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	out := make([]Resource, 0)
+	for _, p := range paths {
+		segs := NormalizeSegments(p)
+		if len(segs) == 0 || isTemplateSegment(segs[len(segs)-1]) {
+			continue
+		}
+		item := ""
+		for _, q := range paths {
+			qs := NormalizeSegments(q)
+			if len(qs) == len(segs)+1 && strings.HasPrefix(q, strings.TrimSuffix(p, "/")+"/") && isTemplateSegment(qs[len(qs)-1]) {
+				item = q
+				break
+			}
+		}
+		if item == "" {
+			continue
+		}
+		r := Resource{Name: segs[len(segs)-1], Path: p, ItemPath: item, Actions: map[string]string{}}
+		if methods[p][http.MethodGet] {
+			r.Actions["list"] = http.MethodGet
+		}
+		if methods[p][http.MethodPost] {
+			r.Actions["create"] = http.MethodPost
+		}
+		if methods[item][http.MethodGet] {
+			r.Actions["get"] = http.MethodGet
+		}
+		switch {
+		case methods[item][http.MethodPatch]:
+			r.Actions["update"] = http.MethodPatch
+		case methods[item][http.MethodPut]:
+			r.Actions["update"] = http.MethodPut
+		}
+		if methods[item][http.MethodDelete] {
+			r.Actions["delete"] = http.MethodDelete
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// FindResource resolves a resource by name (singular or plural) or by its
+// collection path. A path may give values for the collection's own
+// template segments, as in /users/7/orders; the returned params hold them.
+func FindResource(resources []Resource, ref string) (*Resource, map[string]string, error) {
+	if strings.HasPrefix(ref, "/") {
+		for i := range resources {
+			if params, ok := MatchOpenAPIPath(resources[i].Path, ref); ok {
+				return &resources[i], params, nil
+			}
+		}
+		return nil, nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("No REST collection at %s", ref), "List the collections the spec declares with: api resource.")
+	}
+	variants := TermVariants(strings.ToLower(ref))
+	matches := make([]*Resource, 0)
+	for i := range resources {
+		for _, v := range variants {
+			if strings.ToLower(resources[i].Name) == v {
+				matches = append(matches, &resources[i])
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		names := make([]string, len(resources))
+		for i, r := range resources {
+			names[i] = r.Name
+		}
+		return nil, nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("No REST collection named %s%s", ref, DidYouMean(ref, names)), "List the collections the spec declares with: api resource.")
+	case 1:
+		if strings.Contains(matches[0].Path, "{") {
+			return nil, nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("%s is nested under %s", ref, matches[0].Path), fmt.Sprintf("Give the collection path with its values filled in instead of %s.", ref))
+		}
+		return matches[0], map[string]string{}, nil
+	}
+	paths := make([]string, len(matches))
+	for i, m := range matches {
+		paths[i] = m.Path
+	}
+	return nil, nil, NewErrorHint(ExitRequestBuild, fmt.Sprintf("%s names %d collections: %s", ref, len(matches), strings.Join(paths, ", ")), fmt.Sprintf("Give the collection path instead, e.g. %s.", paths[0]))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// defaultCallConcurrency is how many GETs `api call many` runs at a time.
+const defaultCallConcurrency = 4
+
+const callManyUsage = "Usage: api call many --path '/things/{id}' --ids <id1>,<id2>,... | --ids-file <file|-> [--concurrency <n>] [--token <name>] [--query key=value]..."
+
+// CallResult is one line of the NDJSON stream of `api call many`. Body is
+// the response as JSON when it is JSON, else as a string.
+type CallResult struct {
+	ID         string `json:"id"`
+	Path       string `json:"path"`
+	Status     int    `json:"status,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Body       any    `json:"body,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+}
+
+// RunCallCommand implements `api call many`: a GET of a path template for
+// each of a list of values, several at a time, each printed as an NDJSON
+// line as soon as it completes. `api call --request` is runCallRequest,
+// `api call raw` runCallRaw.
+func RunCallCommand(cfg *ResolvedConfig, args []string) error {
+	if len(args) > 0 && args[0] == "--request" {
+		return runCallRequest(cfg, args)
+	}
+	if len(args) > 0 && args[0] == "raw" {
+		return runCallRaw(cfg, args)
+	}
+	if len(args) == 0 || args[0] != "many" {
+		return NewCliError(ExitRequestBuild, callManyUsage+"\n"+callRequestUsage+"\n"+callRawUsage)
+	}
+	var template, idList, idsFile, token string
+	var query []string
+	concurrency := defaultCallConcurrency
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--path", "--ids", "--ids-file", "--concurrency", "--token", "--query":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--path":
+				template = args[i]
+			case "--ids":
+				idList = args[i]
+			case "--ids-file":
+				idsFile = args[i]
+			case "--token":
+				token = args[i]
+			case "--query":
+				query = append(query, args[i])
+			default:
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n <= 0 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --concurrency: %s (expected a positive integer)", args[i]))
+				}
+				concurrency = n
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown call many option: %s", args[i]))
+		}
+	}
+	switch {
+	case template == "" || (idList == "") == (idsFile == ""):
+		return NewCliError(ExitRequestBuild, callManyUsage)
+	case !strings.HasPrefix(template, "/"):
+		return NewCliError(ExitRequestBuild, "Path must start with '/'")
+	}
+	placeholder, err := pathPlaceholder(template)
+	if err != nil {
+		return err
+	}
+	ids, err := callIDs(idList, idsFile)
+	if err != nil {
+		return err
+	}
+	if template, err = appendQuery(template, query); err != nil {
+		return err
+	}
+
+	// Strict validation checks every path against one load of the spec.
+	var spec map[string]any
+	if cfg.Strict {
+		if spec, err = agentapi.LoadSpecPaths(runCtx, cfg); err != nil {
+			return err
+		}
+	}
+
+	results := make(chan CallResult)
+	go func() {
+		defer close(results)
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			sem <- struct{}{}
+			if runCtx.Err() != nil {
+				<-sem
+				break
+			}
+			wg.Add(1)
+			go func(id string) {
+				defer func() { <-sem; wg.Done() }()
+				results <- callOne(cfg, spec, token, id, strings.ReplaceAll(template, placeholder, url.PathEscape(id)))
+			}(id)
+		}
+		wg.Wait()
+	}()
+
+	w := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	done, failed := 0, 0
+	prog := startProgress("call many", len(ids))
+	defer prog.finish()
+	for r := range results {
+		done++
+		bad := r.Error != "" || r.Status >= 400
+		if bad {
+			failed++
+		}
+		prog.add(bad)
+		if err := enc.Encode(r); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+		}
+		_ = w.Flush()
+	}
+	if runCtx.Err() != nil {
+		return NewCliError(ExitInterrupted, fmt.Sprintf("Interrupted: %d of %d calls made", done, len(ids)))
+	}
+	if failed > 0 {
+		return NewCliError(ExitHTTPErrorStatus, fmt.Sprintf("%d of %d calls failed", failed, done))
+	}
+	return nil
+}
+
+// pathPlaceholder returns the one {name} of a path template, which may
+// appear more than once.
+func pathPlaceholder(template string) (string, error) {
+	found := ""
+	for rest := template; ; {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			break
+		}
+		p := rest[start : start+end+1]
+		if found != "" && p != found {
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("--path has several placeholders (%s, %s); give the others their value", found, p))
+		}
+		found, rest = p, rest[start+end+1:]
+	}
+	if found == "" {
+		return "", NewCliErrorHint(ExitRequestBuild, "--path has no placeholder for the ids", "Mark where each id goes, e.g. --path '/products/{id}'.")
+	}
+	return found, nil
+}
+
+// callIDs reads the comma-separated --ids, or --ids-file ("-" for stdin):
+// a JSON array of strings and numbers, as api query prints, or one id per
+// line. Blanks are skipped.
+func callIDs(list, file string) ([]string, error) {
+	var raw []string
+	if file != "" {
+		var b []byte
+		var err error
+		if file == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Cannot read --ids-file: %v", err), err)
+		}
+		if raw, err = jsonIDs(b); err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			raw = strings.Split(string(b), "\n")
+		}
+	} else {
+		raw = strings.Split(list, ",")
+	}
+	ids := make([]string, 0, len(raw))
+	for _, id := range raw {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, NewCliError(ExitRequestBuild, "No ids to call")
+	}
+	return ids, nil
+}
+
+// jsonIDs reads ids given as a JSON array; nil when b is not one.
+func jsonIDs(b []byte) ([]string, error) {
+	trimmed := bytes.TrimSpace(b)
+	if !bytes.HasPrefix(trimmed, []byte("[")) {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber()
+	var values []any
+	if err := dec.Decode(&values); err != nil {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		switch t := v.(type) {
+		case string:
+			ids = append(ids, t)
+		case json.Number:
+			ids = append(ids, t.String())
+		default:
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --ids-file: ids are strings or numbers, got %s", jsonTypeName(v)))
+		}
+	}
+	return ids, nil
+}
+
+func callOne(cfg *ResolvedConfig, spec map[string]any, token, id, path string) CallResult {
+	r := CallResult{ID: id, Path: path}
+	start := time.Now()
+	resp, err := PerformRequest(cfg, APIRequest{Method: http.MethodGet, Path: path, TokenName: token, Spec: spec, Source: "call many"})
+	r.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		r.Error, r.ExitCode = ExitMessage(err), ExitCode(err)
+		return r
+	}
+	r.Status = resp.StatusCode
+	if len(resp.Body) > 0 {
+		if json.Valid(resp.Body) {
+			r.Body = json.RawMessage(resp.Body)
+		} else {
+			r.Body = string(resp.Body)
+		}
+	}
+	return r
+}
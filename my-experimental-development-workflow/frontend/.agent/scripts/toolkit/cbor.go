@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// cborCodec converts between JSON and CBOR (RFC 8949). Byte strings decode
+// to base64 strings, bignums (tags 2 and 3) to decimal strings, other tags
+// to their content and undefined to null.
+type cborCodec struct{}
+
+func (cborCodec) Encode(v any) ([]byte, error) {
+	return appendCBOR(nil, v)
+}
+
+// appendCBORHead appends the initial byte of a major type with its
+// argument in the shortest form.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func appendCBOR(b []byte, v any) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if t {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case string:
+		return append(appendCBORHead(b, 3, uint64(len(t))), t...), nil
+	case []any:
+		b = appendCBORHead(b, 4, uint64(len(t)))
+		var err error
+		for _, e := range t {
+			if b, err = appendCBOR(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		b = appendCBORHead(b, 5, uint64(len(t)))
+		var err error
+		for _, k := range agentapi.SortedKeys(t) {
+			b, _ = appendCBOR(b, k)
+			if b, err = appendCBOR(b, t[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	i, u, f, kind, ok := codecNumber(v)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unsupported value %T", v)
+	case kind == 'u':
+		return appendCBORHead(b, 0, u), nil
+	case kind == 'f':
+		return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(f)), nil
+	case i >= 0:
+		return appendCBORHead(b, 0, uint64(i)), nil
+	}
+	return appendCBORHead(b, 1, uint64(-1-i)), nil
+}
+
+func (cborCodec) Decode(body []byte) (any, error) {
+	d := &cborDecoder{b: body}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, end := v.(cborBreak); end {
+		return nil, fmt.Errorf("cbor: unexpected break at byte 0")
+	}
+	if d.pos != len(body) {
+		return nil, fmt.Errorf("cbor: %d trailing bytes", len(body)-d.pos)
+	}
+	return v, nil
+}
+
+// cborBreak ends an indefinite-length item.
+type cborBreak struct{}
+
+type cborDecoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if uint64(len(d.b)-d.pos) < n {
+		return nil, fmt.Errorf("cbor: truncated at byte %d", d.pos)
+	}
+	out := d.b[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return out, nil
+}
+
+// head reads an initial byte and its argument; indefinite is set for
+// additional information 31.
+func (d *cborDecoder) head() (major, info byte, arg uint64, indefinite bool, err error) {
+	p, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = p[0]>>5, p[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info == 31:
+		return major, info, 0, true, nil
+	case info > 27:
+		return 0, 0, 0, false, fmt.Errorf("cbor: reserved additional information %d at byte %d", info, d.pos-1)
+	}
+	p, err = d.take(1 << (info - 24))
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	switch len(p) {
+	case 1:
+		arg = uint64(p[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(p))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(p))
+	default:
+		arg = binary.BigEndian.Uint64(p)
+	}
+	return major, info, arg, false, nil
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxCodecDepth {
+		return nil, fmt.Errorf("cbor: nested deeper than %d", maxCodecDepth)
+	}
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(arg)).String(), nil
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		raw, err := d.chunks(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(raw), nil
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case 4:
+		out := make([]any, 0)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, end := v.(cborBreak); end {
+				if !indefinite {
+					return nil, fmt.Errorf("cbor: unexpected break at byte %d", d.pos-1)
+				}
+				break
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case 5:
+		out := map[string]any{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, end := k.(cborBreak); end {
+				if !indefinite {
+					return nil, fmt.Errorf("cbor: unexpected break at byte %d", d.pos-1)
+				}
+				break
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, end := v.(cborBreak); end {
+				return nil, fmt.Errorf("cbor: unexpected break at byte %d", d.pos-1)
+			}
+			out[codecKey(k)] = v
+		}
+		return out, nil
+	case 6:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, end := v.(cborBreak); end {
+			return nil, fmt.Errorf("cbor: unexpected break at byte %d", d.pos-1)
+		}
+		if raw, ok := v.(string); ok && (arg == 2 || arg == 3) {
+			p, _ := base64.StdEncoding.DecodeString(raw)
+			n := new(big.Int).SetBytes(p)
+			if arg == 3 {
+				n.Sub(big.NewInt(-1), n)
+			}
+			return n.String(), nil
+		}
+		return v, nil
+	}
+	switch {
+	case indefinite:
+		return cborBreak{}, nil
+	case info == 20:
+		return false, nil
+	case info == 21:
+		return true, nil
+	case info == 22, info == 23:
+		return nil, nil
+	case info == 25:
+		return halfFloat(uint16(arg)), nil
+	case info == 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case info == 27:
+		return math.Float64frombits(arg), nil
+	}
+	return int64(arg), nil // an unassigned simple value
+}
+
+// chunks reads the content of a byte or text string, joining the chunks
+// of an indefinite-length one.
+func (d *cborDecoder) chunks(major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return d.take(n)
+	}
+	var out []byte
+	for {
+		m, _, arg, ind, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m == 7 && ind {
+			return out, nil
+		}
+		if m != major || ind {
+			return nil, fmt.Errorf("cbor: bad chunk in indefinite-length string at byte %d", d.pos-1)
+		}
+		p, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p...)
+	}
+}
+
+// halfFloat decodes an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp, frac := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 31:
+		f = math.Inf(1)
+		if frac != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
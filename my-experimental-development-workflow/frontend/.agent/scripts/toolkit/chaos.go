@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chaosHeader marks every response produced or delayed by chaos injection.
+const chaosHeader = "X-Agent-Chaos"
+
+const (
+	chaosLatency = "latency"
+	chaosTooMany = "429"
+	chaosReset   = "reset"
+)
+
+// defaultChaosLatency is the upper bound of injected delays.
+const defaultChaosLatency = 3 * time.Second
+
+// chaos is set by the global --chaos flag; PerformRequest routes every
+// outgoing request through it, so acurl, test, proxy, serve and the daemon
+// all see the same faults.
+var chaos *ChaosInjector
+
+// ChaosInjector disturbs a percentage of requests with one of the enabled
+// faults: a random delay up to MaxLatency, a synthetic 429, or a connection
+// reset. Injected faults are logged at warn level and labelled with the
+// X-Agent-Chaos response header or a "chaos:" error prefix.
+type ChaosInjector struct {
+	Percent    int
+	Faults     []string
+	MaxLatency time.Duration
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// ParseChaosSpec parses `<percent>[:fault,...]`, e.g. `20` or
+// `30:latency=2s,429,reset`. Without a fault list all three are enabled.
+func ParseChaosSpec(spec string) (*ChaosInjector, error) {
+	usage := fmt.Sprintf("Invalid --chaos %q (expected <percent>[:latency[=<max>],429,reset], e.g. 20 or 30:429,reset)", spec)
+	pct, faults, hasFaults := strings.Cut(strings.TrimSpace(spec), ":")
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(pct), "%"))
+	if err != nil || n < 0 || n > 100 {
+		return nil, NewCliError(ExitRequestBuild, usage)
+	}
+	c := &ChaosInjector{Percent: n, MaxLatency: defaultChaosLatency, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if !hasFaults {
+		c.Faults = []string{chaosLatency, chaosTooMany, chaosReset}
+		return c, nil
+	}
+	for _, f := range strings.Split(faults, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(f), "=")
+		switch {
+		case name == chaosLatency:
+			if hasValue {
+				d, err := time.ParseDuration(value)
+				if err != nil || d <= 0 {
+					return nil, NewCliError(ExitRequestBuild, usage)
+				}
+				c.MaxLatency = d
+			}
+		case (name == chaosTooMany || name == chaosReset) && !hasValue:
+		default:
+			return nil, NewCliError(ExitRequestBuild, usage)
+		}
+		c.Faults = append(c.Faults, name)
+	}
+	if len(c.Faults) == 0 {
+		return nil, NewCliError(ExitRequestBuild, usage)
+	}
+	return c, nil
+}
+
+// pick returns the fault for the next request, or "" to leave it alone.
+func (c *ChaosInjector) pick() (string, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rng.Intn(100) >= c.Percent {
+		return "", 0
+	}
+	fault := c.Faults[c.rng.Intn(len(c.Faults))]
+	return fault, time.Duration(c.rng.Int63n(int64(c.MaxLatency))) + time.Millisecond
+}
+
+// Wrap returns a transport that injects faults in front of next.
+func (c *ChaosInjector) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &chaosTransport{c: c, next: next}
+}
+
+type chaosTransport struct {
+	c    *ChaosInjector
+	next http.RoundTripper
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, delay := t.c.pick()
+	if fault == "" {
+		return t.next.RoundTrip(req)
+	}
+	metrics.Inc("agent_api_chaos_injected_total", "fault", fault)
+	switch fault {
+	case chaosTooMany:
+		logger.Warn("chaos: injected 429", "method", req.Method, "url", req.URL.String())
+		body := `{"error":"chaos: injected 429 Too Many Requests"}`
+		return &http.Response{
+			Status:     "429 Too Many Requests",
+			StatusCode: http.StatusTooManyRequests,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+				"Retry-After":  {"1"},
+				chaosHeader:    {chaosTooMany},
+			},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case chaosReset:
+		logger.Warn("chaos: injected connection reset", "method", req.Method, "url", req.URL.String())
+		return nil, errors.New("chaos: injected connection reset by peer")
+	}
+	logger.Warn("chaos: injected latency", "method", req.Method, "url", req.URL.String(), "delay_ms", delay.Milliseconds())
+	select {
+	case <-time.After(delay):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := t.next.RoundTrip(req)
+	if resp != nil {
+		resp.Header.Set(chaosHeader, fmt.Sprintf("%s=%dms", chaosLatency, delay.Milliseconds()))
+	}
+	return resp, err
+}
+
+// enableChaos installs the injector for --chaos, if given.
+func enableChaos(opts GlobalOptions) error {
+	if opts.Chaos == "" {
+		return nil
+	}
+	c, err := ParseChaosSpec(opts.Chaos)
+	if err != nil {
+		return err
+	}
+	chaos = c
+	logger.Warn("chaos injection enabled", "percent", c.Percent, "faults", strings.Join(c.Faults, ","), "max_latency", c.MaxLatency.String())
+	return nil
+}
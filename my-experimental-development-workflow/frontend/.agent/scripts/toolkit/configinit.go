@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const configInitUsage = "Usage: api config init [--force]"
+
+// configKey is what project, env and token names may be: bare TOML keys,
+// so the written tables need no quoting.
+var configKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// initAnswers is what `api config init` asks for: one project with one env.
+type initAnswers struct {
+	Project    string
+	Env        string
+	APIBase    string
+	APIMode    string
+	OpenAPIURL string
+	// Tokens keep the order they were entered in; the first is the default.
+	TokenNames []string
+	Tokens     map[string]string
+}
+
+// runConfigInit implements `api config init`: it asks on stderr for a
+// project, an env and its settings and tokens, re-asking until each answer
+// is valid, then writes config.toml (0600, it holds tokens) once the whole
+// file loads. An existing config is only replaced with --force.
+func runConfigInit(configPath string, args []string) error {
+	force := false
+	for _, a := range args {
+		if a != "--force" {
+			return NewCliError(ExitRequestBuild, configInitUsage)
+		}
+		force = true
+	}
+	if agentapi.ConfigFormat(configPath) != "TOML" {
+		return NewCliErrorHint(ExitConfig, fmt.Sprintf("Config already exists: %s", configPath), "api config init writes TOML: edit this file, or remove it first to create config.toml.")
+	}
+	if _, err := os.Stat(configPath); err == nil && !force {
+		return NewCliErrorHint(ExitConfig, fmt.Sprintf("Config already exists: %s", configPath), "Edit it, check it with api config validate, or run api config init --force to replace it.")
+	}
+
+	p := &initPrompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	fmt.Fprintf(p.out, "Creating %s (Ctrl-D to cancel).\n", configPath)
+	ans, err := p.answers()
+	if err != nil {
+		return err
+	}
+	if err := writeConfigFile(configPath, renderInitConfig(ans)); err != nil {
+		return err
+	}
+	infof("Wrote %s (active: %s/%s, default token %s).\n", configPath, ans.Project, ans.Env, ans.TokenNames[0])
+	infof("More settings (envs, path_bases, soft_delete, ...) are described in config.example.toml.\n")
+	return nil
+}
+
+// initPrompter asks the questions of config init, one line per answer.
+type initPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prompts until check accepts the answer (trimmed, or def when
+// empty), printing why it did not. The end of input cancels the init.
+func (p *initPrompter) ask(label, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", label)
+		}
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(p.out)
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("config init cancelled at %q: nothing written", label))
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if err := check(answer); err != nil {
+			fmt.Fprintf(p.out, "  %s\n", ExitMessage(err))
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func (p *initPrompter) answers() (*initAnswers, error) {
+	ans := &initAnswers{Tokens: map[string]string{}}
+	steps := []struct {
+		label, def string
+		dst        *string
+		check      func(string) error
+	}{
+		{"Project name", "", &ans.Project, checkConfigKey},
+		{"Env name", "dev", &ans.Env, checkConfigKey},
+		{"api_base (e.g. https://dev.example.com/api)", "", &ans.APIBase, checkHTTPURL},
+		{"api_mode (read-only|safe-updates|full-access)", "read-only", &ans.APIMode, checkAPIMode},
+		{"openapi_url (absolute, or a path under api_base)", "", &ans.OpenAPIURL, func(v string) error {
+			return checkHTTPURL(underBase(ans.APIBase, v))
+		}},
+	}
+	for _, st := range steps {
+		v, err := p.ask(st.label, st.def, st.check)
+		if err != nil {
+			return nil, err
+		}
+		*st.dst = v
+	}
+	ans.OpenAPIURL = underBase(ans.APIBase, ans.OpenAPIURL)
+
+	fmt.Fprintln(p.out, "Tokens: the first is the default token; a value may be ${VAR} to read it from the environment.")
+	for {
+		label, def := "Token name (empty when done)", ""
+		if len(ans.TokenNames) == 0 {
+			label, def = "Token name", "default"
+		}
+		name, err := p.ask(label, def, func(v string) error {
+			switch {
+			case v == "":
+				return nil
+			case ans.Tokens[v] != "":
+				return NewCliError(ExitConfig, fmt.Sprintf("Token %s was already entered", v))
+			}
+			return checkConfigKey(v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return ans, nil
+		}
+		value, err := p.ask("Value of "+name, "", func(v string) error {
+			if v == "" {
+				return NewCliError(ExitToken, "A token value cannot be empty")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		ans.TokenNames = append(ans.TokenNames, name)
+		ans.Tokens[name] = value
+	}
+}
+
+func checkConfigKey(v string) error {
+	if !configKey.MatchString(v) {
+		return NewCliError(ExitConfig, fmt.Sprintf("%q is not a valid name: use letters, digits, '_' and '-'", v))
+	}
+	return nil
+}
+
+func checkHTTPURL(v string) error {
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return NewCliError(ExitConfig, fmt.Sprintf("%q is not an absolute http(s) URL", v))
+	}
+	return nil
+}
+
+// underBase resolves a path starting with "/" against base.
+func underBase(base, v string) string {
+	if strings.HasPrefix(v, "/") {
+		return strings.TrimRight(base, "/") + v
+	}
+	return v
+}
+
+func checkAPIMode(v string) error {
+	if v != "read-only" && v != "safe-updates" && v != "full-access" {
+		return NewCliError(ExitConfig, fmt.Sprintf("%q is not an api_mode: use read-only, safe-updates or full-access", v))
+	}
+	return nil
+}
+
+// renderInitConfig writes the answers in the layout of config.example.toml.
+func renderInitConfig(ans *initAnswers) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by `api config init`; see config.example.toml for every setting.\n\n")
+	fmt.Fprintf(&b, "active_project = %s\n", tomlString(ans.Project))
+	fmt.Fprintf(&b, "active_env = %s\n", tomlString(ans.Env))
+	fmt.Fprintf(&b, "default_token = %s\n", tomlString(ans.TokenNames[0]))
+	fmt.Fprintf(&b, "agent_marker = %s\n", tomlString("[agent-test]"))
+	fmt.Fprintf(&b, "strict = true\n\n")
+	fmt.Fprintf(&b, "[projects.%s.envs.%s]\n", ans.Project, ans.Env)
+	fmt.Fprintf(&b, "api_base = %s\n", tomlString(ans.APIBase))
+	fmt.Fprintf(&b, "api_mode = %s\n", tomlString(ans.APIMode))
+	fmt.Fprintf(&b, "openapi_url = %s\n\n", tomlString(ans.OpenAPIURL))
+	fmt.Fprintf(&b, "[projects.%s.envs.%s.tokens]\n", ans.Project, ans.Env)
+	for _, name := range ans.TokenNames {
+		fmt.Fprintf(&b, "%s = %s\n", name, tomlString(ans.Tokens[name]))
+	}
+	return b.String()
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeConfigFile writes text to a temporary file next to path, loads it
+// as the config would be, and only then moves it into place, so a config
+// that would not load never replaces anything.
+func writeConfigFile(path, text string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", dir, err), err)
+	}
+	f, err := os.CreateTemp(dir, ".config-*.toml")
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write the config: %v", err), err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o600)
+	}
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write the config: %v", err), err)
+	}
+	if _, err := agentapi.LoadConfig(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write %s: %v", path, err), err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// configHashHeader carries the client's ConfigHash so a daemon started from
+// a different config answers 409 and the client falls back to local work.
+const configHashHeader = "X-Agent-Config-Hash"
+
+// errDaemonUnavailable is returned by daemonClient when the caller should
+// fall back to doing the work in-process: only when the request was never
+// written (no daemon listening) or the daemon refused it unread (409).
+var errDaemonUnavailable = NewCliError(ExitUnexpected, "daemon unavailable")
+
+// daemonSocketPath is the per project/env socket, next to the spec cache.
+func daemonSocketPath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "state", fmt.Sprintf("daemon-%s-%s.sock", agentapi.SafeFileName(cfg.ActiveProject), agentapi.SafeFileName(cfg.ActiveEnv)))
+}
+
+// daemonClient talks HTTP to a running daemon over its unix socket.
+type daemonClient struct {
+	cfg    *ResolvedConfig
+	socket string
+	http   *http.Client
+}
+
+func newDaemonClient(cfg *ResolvedConfig, socket string, timeout time.Duration) *daemonClient {
+	return &daemonClient{
+		cfg:    cfg,
+		socket: socket,
+		http: &http.Client{
+			Timeout: timeout,
+			Transport: traced(&http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			}),
+		},
+	}
+}
+
+// connectDaemon returns a client when a daemon socket exists for the active
+// project/env, or nil. Callers treat nil and any transport failure as "no
+// daemon" and do the work themselves.
+func connectDaemon(cfg *ResolvedConfig) *daemonClient {
+	socket := daemonSocketPath(cfg)
+	if _, err := os.Stat(socket); err != nil {
+		return nil
+	}
+	return newDaemonClient(cfg, socket, 35*time.Second)
+}
+
+// do sends one request and decodes the JSON reply into out. Guardrail and
+// lookup errors come back as CliErrors with the daemon's exit code.
+func (c *daemonClient) do(method, path string, query url.Values, payload any, out any) error {
+	resp, err := c.send(method, path, query, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return c.decode(method, path, resp, out)
+}
+
+// send issues one request; only a missing daemon is errDaemonUnavailable.
+// Once the socket accepted the connection the daemon may have acted on
+// the request, so any later failure is reported, not retried locally.
+func (c *daemonClient) send(method, path string, query url.Values, payload any) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to encode daemon request: %v", err), err)
+		}
+		body = bytes.NewReader(b)
+	}
+	u := "http://daemon" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(runCtx, method, u, body)
+	if err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err), err)
+	}
+	req.Header.Set(configHashHeader, c.cfg.ConfigHash)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil && runCtx.Err() != nil {
+		// Not a missing daemon: falling back would resend the request.
+		return nil, NewCliError(ExitInterrupted, fmt.Sprintf("Interrupted: daemon %s %s cancelled", method, path))
+	}
+	if err != nil && daemonDialFailed(err) {
+		logger.Debug("daemon unavailable", "socket", c.socket, "error", err.Error())
+		return nil, errDaemonUnavailable
+	}
+	if err != nil {
+		return nil, c.sentError(method, path, err)
+	}
+	return resp, nil
+}
+
+// decode reads a JSON reply into out, or the daemon's error.
+func (c *daemonClient) decode(method, path string, resp *http.Response, out any) error {
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil && runCtx.Err() != nil {
+		return NewCliError(ExitInterrupted, fmt.Sprintf("Interrupted: daemon %s %s cancelled after %d bytes", method, path, len(raw)))
+	}
+	if err != nil {
+		return c.sentError(method, path, err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		logger.Debug("daemon config stale", "socket", c.socket)
+		return errDaemonUnavailable
+	}
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error      string `json:"error"`
+			Code       int    `json:"code"`
+			Suggestion string `json:"suggestion"`
+		}
+		if json.Unmarshal(raw, &e) != nil || e.Code == 0 {
+			return NewCliError(ExitUnexpected, fmt.Sprintf("Daemon error (HTTP %d)", resp.StatusCode))
+		}
+		return NewCliErrorHint(e.Code, e.Error, e.Suggestion)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Invalid daemon response: %v", err), err)
+	}
+	return nil
+}
+
+// daemonDialFailed reports whether err is a failure to connect to the
+// socket (ECONNREFUSED from a stale socket, ENOENT, a dial timeout):
+// nothing was written, so the work can be done in-process.
+func daemonDialFailed(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// sentError reports a daemon request that failed after it was written:
+// the daemon dying mid-call, a reset, the client timeout. The daemon may
+// already have sent the call on, so, like streamError, it is never
+// errDaemonUnavailable (that would resend it).
+func (c *daemonClient) sentError(method, path string, err error) error {
+	logger.Debug("daemon request failed", "socket", c.socket, "error", err.Error())
+	return &CliError{Code: ExitUnexpected, Message: fmt.Sprintf("HTTP request failed: the daemon did not complete %s %s: %v", method, path, err), Suggestion: "The call may have reached the API: check before retrying it, with --no-daemon if the daemon is stuck.", Cause: err}
+}
+
+// Find runs a search in the daemon's warm index.
+func (c *daemonClient) Find(query, methodFilter string) ([]Operation, error) {
+	var ops []Operation
+	err := c.do(http.MethodGet, "/spec/search", url.Values{"q": {query}, "method": {methodFilter}}, nil, &ops)
+	return ops, err
+}
+
+// Operation resolves an operationId or "METHOD /path" reference.
+func (c *daemonClient) Operation(ref string) (*Operation, error) {
+	var op Operation
+	if err := c.do(http.MethodGet, "/spec/operation", url.Values{"ref": {ref}}, nil, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Show returns the operation with $refs inlined, as /spec/show serves it.
+func (c *daemonClient) Show(ref string) (map[string]any, error) {
+	var details map[string]any
+	if err := c.do(http.MethodGet, "/spec/show", url.Values{"ref": {ref}}, nil, &details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// callReply is the JSON reply of POST /call.
+type callReply struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+func (out callReply) response() *APIResponse {
+	body := []byte(out.Body)
+	var str string
+	if json.Unmarshal(out.Body, &str) == nil {
+		body = []byte(str)
+	}
+	header := http.Header{}
+	for k, v := range out.Headers {
+		header.Set(k, v)
+	}
+	return &APIResponse{StatusCode: out.Status, Header: header, Body: body, Size: int64(len(body))}
+}
+
+// Call performs the request through the daemon, guardrails included. With
+// r.Stream the daemon relays the raw body as it arrives (POST
+// /call?stream=1) and the returned response holds only its prefix.
+func (c *daemonClient) Call(r APIRequest) (*APIResponse, error) {
+	payload := map[string]any{
+		"method":  r.Method,
+		"path":    r.Path,
+		"token":   r.TokenName,
+		"headers": r.Headers,
+		"body":    r.Body,
+	}
+	if r.Stream == nil {
+		var out callReply
+		if err := c.do(http.MethodPost, "/call", nil, payload, &out); err != nil {
+			return nil, err
+		}
+		return out.response(), nil
+	}
+
+	resp, err := c.send(http.MethodPost, "/call", url.Values{"stream": {"1"}}, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	status, err := strconv.Atoi(resp.Header.Get(streamStatusHeader))
+	if err != nil {
+		// An error reply, or a daemon that predates streaming.
+		var out callReply
+		if err := c.decode(http.MethodPost, "/call", resp, &out); err != nil {
+			return nil, err
+		}
+		res := out.response()
+		if w := r.Stream(res.StatusCode, res.Header); w != nil {
+			if _, err := w.Write(res.Body); err != nil && !errors.Is(err, agentapi.ErrStopBody) {
+				return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write the response body: %v", err), err)
+			}
+		}
+		return res, nil
+	}
+	header := http.Header{}
+	var flat map[string]string
+	if json.Unmarshal([]byte(resp.Header.Get(streamHeadersHeader)), &flat) == nil {
+		for k, v := range flat {
+			header.Set(k, v)
+		}
+	}
+	w := r.Stream(status, header)
+	if w == nil {
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, c.streamError(r, err)
+		}
+		return &APIResponse{StatusCode: status, Header: header, Body: raw, Size: int64(len(raw))}, nil
+	}
+	res, err := agentapi.StreamBody(&http.Response{StatusCode: status, Header: header, Body: resp.Body}, w)
+	if _, ok := err.(*CliError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, c.streamError(r, err)
+	}
+	return res, nil
+}
+
+// streamError reports a relayed body that broke off. The call already
+// happened, so it is never errDaemonUnavailable (that would resend it).
+func (c *daemonClient) streamError(r APIRequest, err error) error {
+	if runCtx.Err() != nil {
+		return WrapCliError(ExitInterrupted, fmt.Sprintf("Interrupted: %s %s cancelled while the daemon relayed the body", r.Method, r.Path), err)
+	}
+	return WrapCliError(ExitUnexpected, fmt.Sprintf("HTTP request failed: the daemon relay of %s %s broke off: %v", r.Method, r.Path, err), err)
+}
+
+// RunDaemon implements `api daemon [start|stop|status]`. `start` runs in the
+// foreground; background it with your shell or service manager.
+func RunDaemon(cfg *ResolvedConfig, args []string) error {
+	action := "start"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	socket := daemonSocketPath(cfg)
+	switch action {
+	case "start":
+		return startDaemon(cfg, socket)
+	case "stop":
+		if err := newDaemonClient(cfg, socket, 5*time.Second).do(http.MethodPost, "/shutdown", nil, nil, nil); err != nil {
+			if err == errDaemonUnavailable {
+				return NewCliError(ExitNotFound, fmt.Sprintf("No daemon running on %s", socket))
+			}
+			return err
+		}
+		fmt.Println("Daemon stopped.")
+		return nil
+	case "status":
+		var ctx map[string]any
+		if err := newDaemonClient(cfg, socket, 5*time.Second).do(http.MethodGet, "/context", nil, nil, &ctx); err != nil {
+			if err == errDaemonUnavailable {
+				return NewCliError(ExitNotFound, fmt.Sprintf("No daemon running on %s (or it was started from another config)", socket))
+			}
+			return err
+		}
+		fmt.Printf("Daemon running on %s (%s/%s, api_mode=%s)\n", socket, ctx["project"], ctx["env"], ctx["api_mode"])
+		return nil
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown daemon action: %s (expected start|stop|status)", action))
+	}
+}
+
+func startDaemon(cfg *ResolvedConfig, socket string) error {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(socket), err), err)
+	}
+	if _, err := os.Stat(socket); err == nil {
+		if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+			conn.Close()
+			return NewCliError(ExitUnexpected, fmt.Sprintf("A daemon is already running on %s", socket))
+		}
+		_ = os.Remove(socket)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to listen on %s: %v", socket, err), err)
+	}
+	defer os.Remove(socket)
+	if err := os.Chmod(socket, 0o600); err != nil {
+		ln.Close()
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to restrict %s: %v", socket, err), err)
+	}
+
+	api := NewAPIServer(cfg, "")
+	api.source = "daemon"
+	if _, err := api.loadSpec(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	srv := &http.Server{}
+	mux := http.NewServeMux()
+	mux.Handle("/", api.Handler())
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		go srv.Shutdown(context.Background())
+	})
+	srv.Handler = mux
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		_ = srv.Shutdown(context.Background())
+	}()
+
+	logger.Info("daemon listening", "socket", socket, "project", cfg.ActiveProject, "env", cfg.ActiveEnv, "api_mode", cfg.APIMode)
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Daemon failed: %v", err), err)
+	}
+	return nil
+}
+
+// daemonFor returns the daemon client to use for this invocation, or nil.
+// --chaos forces in-process work so the faults apply to this invocation.
+func daemonFor(cfg *ResolvedConfig, opts GlobalOptions) *daemonClient {
+	if opts.NoDaemon || opts.Chaos != "" || opts.Offline != "" {
+		return nil
+	}
+	return connectDaemon(cfg)
+}
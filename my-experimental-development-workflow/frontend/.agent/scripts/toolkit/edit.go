@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// editorCommand is the editor --edit runs: $VISUAL, then $EDITOR, then vi.
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// bodyTemplate is the starting text of an --edit session: initial when
+// given with -d, otherwise a sample of the operation's JSON request body
+// schema with agent_marker in a text field, or {}.
+func bodyTemplate(cfg *ResolvedConfig, method, path, initial string) (string, map[string]any, any) {
+	var schema any
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		logger.Debug("no body template, spec unavailable", "error", err)
+	} else {
+		for _, op := range agentapi.OperationsForPath(spec, path) {
+			if op.Method == method {
+				schema, _ = requestBodySchema(spec, op)
+			}
+		}
+	}
+	if strings.TrimSpace(initial) != "" {
+		return initial, spec, schema
+	}
+	sample := any(map[string]any{})
+	if schema != nil {
+		sample = sampleFromSchema(spec, schema)
+	}
+	if obj, ok := sample.(map[string]any); ok {
+		if field := markerField(obj); field != "" {
+			sample = injectMarker(obj, field, cfg.AgentMarker)
+		}
+	}
+	b, _ := json.MarshalIndent(sample, "", "  ")
+	return string(b) + "\n", spec, schema
+}
+
+// markerField picks the string field of a body template that receives
+// agent_marker: name as in seed fixtures, another common text field, or
+// the first string field that is not an id.
+func markerField(obj map[string]any) string {
+	for _, k := range []string{"name", "title", "note", "description"} {
+		if _, ok := obj[k].(string); ok {
+			return k
+		}
+	}
+	for _, k := range agentapi.SortedKeys(obj) {
+		if _, ok := obj[k].(string); ok && !strings.HasSuffix(strings.ToLower(k), "id") {
+			return k
+		}
+	}
+	return ""
+}
+
+// editBody opens the request body in the user's editor and returns it once
+// it is valid JSON. Invalid JSON reopens the editor on request; a body
+// that does not match the operation's schema is reported and can be edited
+// again, sent anyway or dropped. An empty body aborts the call.
+func editBody(cfg *ResolvedConfig, method, path, initial string) (string, error) {
+	text, spec, schema := bodyTemplate(cfg, method, path, initial)
+	f, err := os.CreateTemp("", "acurl-body-*.json")
+	if err != nil {
+		return "", WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create the body file: %v", err), err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write the body file: %v", err), err)
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	// ask returns the lower-cased answer, or "" at the end of input, which
+	// every caller treats as giving up.
+	ask := func(prompt string) (string, bool) {
+		fmt.Fprint(os.Stderr, prompt)
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(os.Stderr)
+			return "", false
+		}
+		return strings.ToLower(strings.TrimSpace(line)), true
+	}
+	editor := editorCommand()
+	for {
+		cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Editor %s failed: %v", editor[0], err), "Set VISUAL or EDITOR to an editor that waits until the file is closed, e.g. EDITOR=\"code --wait\".")
+		}
+		raw, err := os.ReadFile(f.Name())
+		if err != nil {
+			return "", WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read the body file: %v", err), err)
+		}
+		body := strings.TrimSpace(string(raw))
+		if body == "" {
+			return "", NewCliError(ExitRequestBuild, "Empty body; request not sent")
+		}
+		var doc any
+		if err := json.Unmarshal([]byte(body), &doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Body is not valid JSON: %v\n", err)
+			if answer, ok := ask("Edit again? [Y/n] "); !ok || answer == "n" {
+				return "", NewCliError(ExitRequestBuild, "Body is not valid JSON; request not sent")
+			}
+			continue
+		}
+		if schema == nil {
+			return body, nil
+		}
+		problems := ValidateSchema(spec, schema, doc)
+		if len(problems) == 0 {
+			return body, nil
+		}
+		fmt.Fprintln(os.Stderr, "Body does not match the request schema:")
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", p)
+		}
+		answer, ok := ask("[e]dit again, [s]end anyway or [a]bort? [E/s/a] ")
+		switch {
+		case ok && answer == "s":
+			return body, nil
+		case !ok || answer == "a":
+			return "", NewCliError(ExitRequestBuild, "Body does not match the request schema; request not sent")
+		}
+	}
+}
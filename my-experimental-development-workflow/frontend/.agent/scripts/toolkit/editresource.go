@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const editUsage = `Usage: api edit <path> --set <field>=<value>... [--unset <field>]... [--method PUT|PATCH] [--token <name>] [-H "Key: Value"]... [--dry-run]`
+
+// fieldEdit is one --set or --unset of `api edit`. Field is a dotted path
+// into the resource; numeric segments index arrays.
+type fieldEdit struct {
+	Field string
+	Value any
+	Unset bool
+}
+
+// parseEditValue reads a --set value as JSON when it is (9.99, true, null,
+// {"a": 1}, "quoted"), otherwise as a plain string.
+func parseEditValue(s string) any {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err == nil {
+		return v
+	}
+	return s
+}
+
+// applyFieldEdit changes doc in place and returns the previous value, if
+// any. Missing objects along the path are created for --set.
+func applyFieldEdit(doc any, e fieldEdit) (any, error) {
+	segs := strings.Split(e.Field, ".")
+	cur := doc
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch node := cur.(type) {
+		case map[string]any:
+			if last {
+				old := node[seg]
+				if e.Unset {
+					delete(node, seg)
+				} else {
+					node[seg] = e.Value
+				}
+				return old, nil
+			}
+			next, ok := node[seg]
+			if !ok || next == nil {
+				if e.Unset {
+					return nil, nil
+				}
+				next = map[string]any{}
+				node[seg] = next
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("%s: no index %s in an array of %d", e.Field, seg, len(node)))
+			}
+			if last {
+				old := node[idx]
+				if e.Unset {
+					return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("%s: --unset cannot remove an array item; --set the array instead", e.Field))
+				}
+				node[idx] = e.Value
+				return old, nil
+			}
+			cur = node[idx]
+		default:
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("%s: %s is a %s, not an object or array", e.Field, strings.Join(segs[:i], "."), jsonTypeName(cur)))
+		}
+	}
+	return nil, nil
+}
+
+// mergePatch is the partial body PATCH sends: the --set fields with their
+// new values and the --unset ones as null, nested as in the resource.
+func mergePatch(edits []fieldEdit) map[string]any {
+	patch := map[string]any{}
+	for _, e := range edits {
+		segs := strings.Split(e.Field, ".")
+		node := patch
+		for _, seg := range segs[:len(segs)-1] {
+			next, ok := node[seg].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				node[seg] = next
+			}
+			node = next
+		}
+		if e.Unset {
+			node[segs[len(segs)-1]] = nil
+		} else {
+			node[segs[len(segs)-1]] = e.Value
+		}
+	}
+	return patch
+}
+
+// RunEditResource implements `api edit`: GET the resource, apply the edits
+// and write it back with If-Match, so a concurrent change fails with 412
+// instead of being overwritten. PUT sends the whole edited resource, PATCH
+// only the edited fields.
+func RunEditResource(cfg *ResolvedConfig, args []string) error {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "/") {
+		return NewCliError(ExitRequestBuild, editUsage)
+	}
+	path := args[0]
+	method, token := http.MethodPut, ""
+	dryRun := false
+	edits := make([]fieldEdit, 0)
+	var extraHeaders []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--set", "--unset", "--method", "--token", "-H", "--header":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--set":
+				field, value, ok := strings.Cut(args[i], "=")
+				if !ok || field == "" {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --set %q (expected <field>=<value>)", args[i]))
+				}
+				edits = append(edits, fieldEdit{Field: field, Value: parseEditValue(value)})
+			case "--unset":
+				edits = append(edits, fieldEdit{Field: args[i], Unset: true})
+			case "--method":
+				method = strings.ToUpper(args[i])
+				if method != http.MethodPut && method != http.MethodPatch {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --method %s (expected PUT or PATCH)", args[i]))
+				}
+			case "-H", "--header":
+				extraHeaders = append(extraHeaders, args[i])
+			default:
+				token = args[i]
+			}
+		case "--dry-run":
+			dryRun = true
+		default:
+			return NewCliError(ExitRequestBuild, editUsage)
+		}
+	}
+	if len(edits) == 0 {
+		return NewCliError(ExitRequestBuild, "Nothing to edit: give at least one --set or --unset")
+	}
+	// The body is not known yet: check that api_mode allows the write at
+	// all before reading anything.
+	if err := agentapi.EnforceMode(cfg, method, cfg.AgentMarker); err != nil {
+		return err
+	}
+	if err := agentapi.EnforceHeaders(cfg, method, extraHeaders); err != nil {
+		return err
+	}
+	if token != "" {
+		warnTokenSecurity(cfg, method, path, token)
+	}
+
+	// The document is written back whole: it must keep the fields
+	// redact_fields masks, so only what is printed of it is masked.
+	resp, err := PerformRequest(cfg, APIRequest{Method: http.MethodGet, Path: path, TokenName: token, Source: "edit", Unredacted: true})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return NewCliError(ExitHTTPErrorStatus, fmt.Sprintf("GET %s answered HTTP %d; nothing was changed", path, resp.StatusCode))
+	}
+	var doc any
+	if err := json.Unmarshal(resp.Body, &doc); err != nil {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("GET %s did not return JSON; api edit needs a JSON resource", path))
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("GET %s returned a JSON %s, not an object", path, jsonTypeName(doc)))
+	}
+	for _, e := range edits {
+		old, err := applyFieldEdit(doc, e)
+		if err != nil {
+			return err
+		}
+		before, _ := json.Marshal(old)
+		if redactedField(cfg.RedactFields, e.Field) {
+			before = []byte(redactedValue)
+		}
+		if e.Unset {
+			infof("%s: %s -> (removed)\n", e.Field, before)
+		} else {
+			after, _ := json.Marshal(e.Value)
+			if redactedField(cfg.RedactFields, e.Field) {
+				after = []byte(redactedValue)
+			}
+			infof("%s: %s -> %s\n", e.Field, before, after)
+		}
+	}
+
+	payload := doc
+	if method == http.MethodPatch {
+		payload = mergePatch(edits)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode the edited body: %v", err), err)
+	}
+	headers := append(make([]string, 0, len(extraHeaders)+1), extraHeaders...)
+	switch {
+	case resp.Header.Get("ETag") != "":
+		headers = append(headers, "If-Match: "+resp.Header.Get("ETag"))
+	case resp.Header.Get("Last-Modified") != "":
+		headers = append(headers, "If-Unmodified-Since: "+resp.Header.Get("Last-Modified"))
+	default:
+		infof("No ETag or Last-Modified on GET %s: writing without a precondition.\n", path)
+	}
+	write := APIRequest{Method: method, Path: path, TokenName: token, Body: string(body), Headers: headers, Source: "edit"}
+	if dryRun {
+		if err := CheckPolicy(cfg, write); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", method, path)
+		for _, h := range headers {
+			fmt.Println(h)
+		}
+		redactValue(payload, "$", cfg.RedactFields)
+		return printJSONIndent(payload)
+	}
+
+	resp, err = PerformRequest(cfg, write)
+	if err != nil {
+		return err
+	}
+	out := newCompactWriter(os.Stdout, 0)
+	_, _ = out.Write(resp.Body)
+	_ = out.Close()
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return NewCliErrorHint(ExitHTTPErrorStatus, fmt.Sprintf("%s %s failed its precondition: the resource changed since it was read", method, path), "Run the same api edit again to apply the edits to the current version.")
+	case resp.StatusCode >= 400:
+		return NewCliError(ExitHTTPErrorStatus, "")
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTableColumnWidth caps table columns on a terminal whose width is
+// unknown; longer cells are truncated.
+const maxTableColumnWidth = 80
+
+// Table is tabular command output, independent of how it is rendered.
+// Keys are the field names used by structured formats (json, ndjson, csv
+// header); Columns are the human headers used by the table format.
+type Table struct {
+	Columns []string
+	Keys    []string
+	Rows    [][]string
+	// Empty is printed by the table format when there are no rows.
+	Empty string
+}
+
+// Formatter renders a Table. Register additional formats with
+// RegisterFormatter (e.g. from an init func in a separate file) and they
+// become available to every command that accepts --format.
+type Formatter interface {
+	Format(w io.Writer, t *Table) error
+}
+
+// FormatterFunc adapts a function to the Formatter interface.
+type FormatterFunc func(w io.Writer, t *Table) error
+
+func (f FormatterFunc) Format(w io.Writer, t *Table) error { return f(w, t) }
+
+var formatters = map[string]Formatter{
+	"table":  FormatterFunc(formatTable),
+	"json":   FormatterFunc(formatJSON),
+	"ndjson": FormatterFunc(formatNDJSON),
+	"csv":    FormatterFunc(formatCSV),
+}
+
+// RegisterFormatter adds or replaces a named output format.
+func RegisterFormatter(name string, f Formatter) {
+	formatters[name] = f
+}
+
+// LookupFormatter returns the formatter registered under name.
+func LookupFormatter(name string) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown --format: %s (expected %s)", name, strings.Join(FormatterNames(), "|")))
+	}
+	return f, nil
+}
+
+func FormatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for n := range formatters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wideTables is set by the global --wide flag: tables on a terminal keep
+// every cell whole instead of fitting its width.
+var wideTables bool
+
+// minFittedColumn is the narrowest a column is squeezed to when fitting a
+// table to the terminal (or its header, when wider).
+const minFittedColumn = 8
+
+// tableStyle is how formatTable lays out for its writer: width is the
+// terminal width to fit (0: no fitting), limit caps each column when the
+// width is unknown, color enables ANSI colors.
+type tableStyle struct {
+	width, limit int
+	color        bool
+}
+
+// styleFor fits tables written to a terminal and colors them unless
+// NO_COLOR is set; anything else (pipes, files, buffers) gets whole cells
+// without colors, so scripts never see ellipses.
+func styleFor(w io.Writer) tableStyle {
+	f, ok := w.(*os.File)
+	if !ok || !isTerminal(f) {
+		return tableStyle{}
+	}
+	st := tableStyle{color: os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"}
+	if wideTables {
+		return st
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		st.width = n
+	} else if n := ttyColumns(f); n > 0 {
+		st.width = n
+	} else {
+		st.limit = maxTableColumnWidth
+	}
+	return st
+}
+
+// keyColumns identify a row (a path is useless once cut short), so
+// fitWidths narrows them only after every other column is at its floor,
+// and paths lose their middle rather than their end.
+var (
+	keyColumns  = map[string]bool{"ENV": true, "METHOD": true, "PATH": true, "OPERATION_ID": true, "STATUS": true, "NAME": true}
+	pathColumns = map[string]bool{"PATH": true, "URL": true}
+)
+
+// fitWidths narrows the widest columns, one character at a time and key
+// columns last, until the row fits in total characters or every column is
+// at its floor.
+func fitWidths(widths []int, headers []string, total int) {
+	floors := make([]int, len(widths))
+	used := 2 * (len(widths) - 1)
+	for i, w := range widths {
+		floors[i] = min(w, max(minFittedColumn, len([]rune(headers[i]))))
+		used += w
+	}
+	for _, keys := range []bool{false, true} {
+		for ; used > total; used-- {
+			widest := -1
+			for i, w := range widths {
+				if keyColumns[headers[i]] == keys && w > floors[i] && (widest < 0 || w > widths[widest]) {
+					widest = i
+				}
+			}
+			if widest < 0 {
+				break
+			}
+			widths[widest]--
+		}
+	}
+}
+
+// truncateCell shortens cell to width runes with an ellipsis: at the end,
+// or in the middle for paths and URLs, whose last segments tell them apart.
+func truncateCell(cell string, width int, column string) string {
+	r := []rune(cell)
+	if len(r) <= width {
+		return cell
+	}
+	if pathColumns[column] && width >= 5 {
+		head := (width - 1) / 2
+		return string(r[:head]) + "…" + string(r[len(r)-(width-1-head):])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// ANSI colors of table cells: methods by how much they change, status
+// codes by class.
+var (
+	methodColors = map[string]string{"GET": "32", "HEAD": "32", "OPTIONS": "32", "POST": "33", "PUT": "34", "PATCH": "34", "DELETE": "31"}
+	statusColors = map[byte]string{'2': "32", '3': "36", '4': "33", '5': "31"}
+)
+
+// cellColor returns the ANSI color of a cell in the named column, or "".
+func cellColor(column, cell string) string {
+	switch column {
+	case "METHOD":
+		return methodColors[cell]
+	case "STATUS", "CODE":
+		if len(cell) == 3 && cell[1] >= '0' && cell[1] <= '9' && cell[2] >= '0' && cell[2] <= '9' {
+			return statusColors[cell[0]]
+		}
+	}
+	return ""
+}
+
+func formatTable(w io.Writer, t *Table) error {
+	if len(t.Rows) == 0 && t.Empty != "" {
+		_, err := fmt.Fprintln(w, t.Empty)
+		return err
+	}
+	st := styleFor(w)
+	widths := make([]int, len(t.Columns))
+	for i, c := range t.Columns {
+		widths[i] = len([]rune(c))
+	}
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for i := range widths {
+		if st.limit > 0 && widths[i] > st.limit {
+			widths[i] = st.limit
+		}
+	}
+	if st.width > 0 {
+		fitWidths(widths, t.Columns, st.width)
+	}
+	// The last column is left unpadded and, unless fitting, whole.
+	last := len(t.Columns) - 1
+	writeRow := func(cells []string, header bool) error {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			if i < last || st.width > 0 {
+				cell = truncateCell(cell, widths[i], t.Columns[i])
+			}
+			pad := 0
+			if i < last {
+				pad = widths[i] - len([]rune(cell))
+			}
+			if c := cellColor(t.Columns[i], cells[i]); st.color && !header && c != "" {
+				cell = "\x1b[" + c + "m" + cell + "\x1b[0m"
+			}
+			parts[i] = cell + strings.Repeat(" ", pad)
+		}
+		_, err := fmt.Fprintln(w, strings.TrimRight(strings.Join(parts, "  "), " "))
+		return err
+	}
+	if err := writeRow(t.Columns, true); err != nil {
+		return err
+	}
+	dashes := make([]string, len(t.Columns))
+	for i := range t.Columns {
+		dashes[i] = strings.Repeat("-", widths[i])
+	}
+	if err := writeRow(dashes, true); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		if err := writeRow(row, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableRecords(t *Table) []map[string]string {
+	out := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		rec := make(map[string]string, len(t.Keys))
+		for i, k := range t.Keys {
+			rec[k] = row[i]
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func formatJSON(w io.Writer, t *Table) error {
+	b, err := json.Marshal(tableRecords(t))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func formatNDJSON(w io.Writer, t *Table) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range tableRecords(t) {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatCSV(w io.Writer, t *Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Keys); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
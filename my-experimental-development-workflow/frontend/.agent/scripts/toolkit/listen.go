@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultTunnelCommand is used by `listen --expose` when tunnel_command is
+// not configured. {port} is replaced with the listen port.
+const defaultTunnelCommand = "cloudflared tunnel --url http://localhost:{port}"
+
+var publicURLPattern = regexp.MustCompile(`https://[A-Za-z0-9.-]+\.[A-Za-z]{2,}\S*`)
+
+// webhookEvent is one received callback, printed as a line of NDJSON.
+type webhookEvent struct {
+	Time    string            `json:"time"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// webhookHandler acknowledges every request and writes it to out.
+type webhookHandler struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	ev := webhookEvent{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Headers: map[string]string{},
+	}
+	for k, v := range r.Header {
+		ev.Headers[k] = strings.Join(v, ", ")
+	}
+	if len(raw) > 0 {
+		var decoded any
+		if json.Unmarshal(raw, &decoded) == nil {
+			ev.Body = decoded
+		} else {
+			ev.Body = string(raw)
+		}
+	}
+	line, _ := json.Marshal(ev)
+	h.mu.Lock()
+	_, _ = h.out.Write(append(line, '\n'))
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}` + "\n"))
+}
+
+// RunListen implements `api listen [--port N] [--host H] [--expose]`.
+func RunListen(cfg *ResolvedConfig, args []string) error {
+	port := 9090
+	host := "127.0.0.1"
+	expose := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--port":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --port")
+			}
+			p, err := parsePortFlag("--port", args[i])
+			if err != nil {
+				return err
+			}
+			port = p
+		case "--host":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --host")
+			}
+			host = args[i]
+		case "--expose":
+			expose = true
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown listen option: %s", args[i]))
+		}
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	srv := &http.Server{Addr: addr, Handler: &webhookHandler{out: os.Stdout}}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	logger.Info("webhook listener started", "addr", "http://"+addr, "output", "stdout (NDJSON)")
+
+	var tunnel *exec.Cmd
+	if expose {
+		cmdline := cfg.TunnelCommand
+		if cmdline == "" {
+			cmdline = defaultTunnelCommand
+		}
+		var err error
+		if tunnel, err = startTunnel(strings.ReplaceAll(cmdline, "{port}", strconv.Itoa(port))); err != nil {
+			_ = srv.Close()
+			return err
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	var runErr error
+	select {
+	case <-sig:
+	case err := <-errCh:
+		runErr = WrapCliError(ExitUnexpected, fmt.Sprintf("Webhook listener failed: %v", err), err)
+	}
+	if tunnel != nil && tunnel.Process != nil {
+		_ = tunnel.Process.Kill()
+	}
+	_ = srv.Close()
+	return runErr
+}
+
+// startTunnel launches the tunnel command and reports the first public
+// https URL it prints.
+func startTunnel(cmdline string) (*exec.Cmd, error) {
+	fields := strings.Fields(cmdline)
+	if len(fields) == 0 {
+		return nil, NewCliError(ExitConfig, "Empty tunnel_command in config")
+	}
+	cmd := exec.Command(fields[0], fields[1:]...)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, WrapCliError(ExitConfig, fmt.Sprintf("Failed to start tunnel (%s): %v; set tunnel_command in config", fields[0], err), err)
+	}
+	go func() {
+		_ = cmd.Wait()
+		pw.Close()
+	}()
+	go func() {
+		sc := bufio.NewScanner(pr)
+		announced := false
+		for sc.Scan() {
+			if u := publicURLPattern.FindString(sc.Text()); u != "" && !announced {
+				announced = true
+				logger.Info("tunnel ready", "public_url", u)
+			}
+		}
+	}()
+	return cmd, nil
+}
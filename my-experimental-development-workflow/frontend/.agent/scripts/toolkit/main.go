@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// One binary serves both tools. It dispatches on the name it was invoked
+// as, so `api` and `acurl` symlinks (or copies) keep working, and on a
+// leading `api`/`acurl` subcommand otherwise: `agent-api acurl GET /x`.
+func main() {
+	err := dispatch(filepath.Base(os.Args[0]), os.Args[1:])
+	reportStaleSpecs(os.Stderr)
+	if err != nil {
+		writeError(os.Stderr, err)
+		os.Exit(ExitCode(err))
+	}
+	os.Exit(ExitSuccess)
+}
+
+func dispatch(name string, args []string) error {
+	configPath := findConfig()
+	switch strings.TrimSuffix(name, ".exe") {
+	case "acurl":
+		return RunACurl(configPath, args)
+	case "api":
+		return RunAPI(configPath, args)
+	}
+	if len(args) > 0 {
+		switch args[0] {
+		case "acurl":
+			return RunACurl(configPath, args[1:])
+		case "api":
+			return RunAPI(configPath, args[1:])
+		}
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Printf(MultiHelp, name)
+		return nil
+	}
+	return RunAPI(configPath, args)
+}
+
+// configDirs are where a config may sit in a directory, as the workflows
+// of this repo install the toolkit under .agent/scripts.
+var configDirs = []string{"", filepath.Join(".agent", "scripts")}
+
+// findConfig locates the config: $AGENT_API_CONFIG when set, else the
+// first directory from the working one up to the git root (or the
+// filesystem root) holding one (config.toml, .yaml, .yml or .json), else
+// the global config (agentapi.GlobalConfigPath). With none of them, it is
+// config.toml in the working directory, which is where the "not found"
+// error and `api config init` point.
+func findConfig() string {
+	if p := strings.TrimSpace(os.Getenv("AGENT_API_CONFIG")); p != "" {
+		return p
+	}
+	if p := agentapi.FindConfigIn("."); p != "" {
+		return p
+	}
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			for _, sub := range configDirs {
+				if p := agentapi.FindConfigIn(filepath.Join(dir, sub)); p != "" {
+					return p
+				}
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir || pathExists(filepath.Join(dir, ".git")) {
+				break
+			}
+			dir = parent
+		}
+	}
+	if p := agentapi.GlobalConfigPath(); p != "" && pathExists(p) {
+		return p
+	}
+	return agentapi.ConfigFileNames[0]
+}
+
+const MultiHelp = `NAME
+  %[1]s - api and acurl in one binary
+
+USAGE
+  %[1]s api <command> ...      same as ./api <command> ...
+  %[1]s acurl [METHOD] <path>  same as ./acurl [METHOD] <path> ...
+  %[1]s <command> ...          api commands without the prefix
+
+NOTES
+  Invoked through a symlink named api or acurl, the binary behaves as that tool:
+    ln -sf %[1]s api && ln -sf %[1]s acurl
+  See "%[1]s api --help" and "%[1]s acurl --help".
+`
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the request latency histogram bounds in seconds.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics is a small in-process registry rendered in the Prometheus text
+// exposition format. Long-running commands (proxy, serve, daemon) record
+// into the process-wide instance and expose it with ServeMetrics.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+	help       map[string]string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	total  uint64
+}
+
+var metrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+		help: map[string]string{
+			"agent_api_requests_total":            "Requests handled, by server mode, method and status code.",
+			"agent_api_request_duration_seconds":  "Request latency including the upstream call.",
+			"agent_api_policy_denials_total":      "Requests rejected by guardrails, by reason.",
+			"agent_api_spec_cache_requests_total": "Spec lookups served from memory (hit) or fetched (miss).",
+			"agent_api_chaos_injected_total":      "Faults injected by --chaos, by fault.",
+		},
+	}
+}
+
+// Inc adds one to a counter; labels are alternating name/value pairs.
+func (m *Metrics) Inc(name string, labels ...string) {
+	key := metricLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters[name] == nil {
+		m.counters[name] = map[string]float64{}
+	}
+	m.counters[name][key]++
+}
+
+// Observe records a duration in a histogram.
+func (m *Metrics) Observe(name string, d time.Duration, labels ...string) {
+	key := metricLabels(labels)
+	secs := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.histograms[name] == nil {
+		m.histograms[name] = map[string]*histogram{}
+	}
+	h := m.histograms[name][key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.histograms[name][key] = h
+	}
+	for i, b := range durationBuckets {
+		if secs <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.total++
+}
+
+// RecordRequest records the outcome of one request handled by a server mode.
+func (m *Metrics) RecordRequest(mode, method string, status int, d time.Duration, err error) {
+	m.Inc("agent_api_requests_total", "mode", mode, "method", method, "status", strconv.Itoa(status))
+	m.Observe("agent_api_request_duration_seconds", d, "mode", mode)
+	if reason := denialReason(err); reason != "" {
+		m.Inc("agent_api_policy_denials_total", "mode", mode, "reason", reason)
+	}
+}
+
+func denialReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch ExitCode(err) {
+	case ExitBlockedByMode:
+		return "blocked_by_mode"
+	case ExitMarkerMissing:
+		return "marker_missing"
+	case ExitToken:
+		return "token"
+	case ExitRequestBuild:
+		if strings.HasPrefix(ExitMessage(err), "Strict mode:") {
+			return "strict"
+		}
+	}
+	return ""
+}
+
+// Render writes every metric in the Prometheus text format.
+func (m *Metrics) Render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	for _, name := range sortedMapKeys(m.counters) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, m.help[name], name)
+		series := m.counters[name]
+		for _, key := range sortedMapKeys(series) {
+			fmt.Fprintf(&b, "%s%s %g\n", name, key, series[key])
+		}
+	}
+	for _, name := range sortedMapKeys(m.histograms) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", name, m.help[name], name)
+		series := m.histograms[name]
+		for _, key := range sortedMapKeys(series) {
+			h := series[key]
+			for i, bound := range durationBuckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", strconv.FormatFloat(bound, 'g', -1, 64)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), h.total)
+			fmt.Fprintf(&b, "%s_sum%s %g\n", name, key, h.sum)
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, h.total)
+		}
+	}
+	return b.String()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(m.Render()))
+}
+
+// ServeMetrics exposes /metrics on a separate localhost port so it never
+// shadows API paths served by the proxy.
+func ServeMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	logger.Info("metrics listening", "url", "http://"+addr+"/metrics")
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("metrics server failed", "error", err.Error())
+		}
+	}()
+}
+
+func metricLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func withLabel(key, name, value string) string {
+	label := fmt.Sprintf("%s=%q", name, value)
+	if key == "" {
+		return "{" + label + "}"
+	}
+	return key[:len(key)-1] + "," + label + "}"
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parsePortFlag validates a --port style value.
+func parsePortFlag(flag, value string) (int, error) {
+	p, err := strconv.Atoi(value)
+	if err != nil || p <= 0 || p > 65535 {
+		return 0, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid %s: %s", flag, value))
+	}
+	return p, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const (
+	// otelFlushInterval is how often long-running commands export the
+	// spans they have ended.
+	otelFlushInterval = 5 * time.Second
+	// otelExportTimeout bounds one OTLP export, so an unreachable collector
+	// delays a command by at most this much.
+	otelExportTimeout = 5 * time.Second
+	// otelScope names the instrumentation in exported spans.
+	otelScope = "agent-api-toolkit"
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	spanStatusError  = 2
+)
+
+// spanContext identifies a span in a trace, as a traceparent header does.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	flags   byte
+}
+
+func (sc spanContext) traceParent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.traceID, sc.spanID, sc.flags)
+}
+
+// parseTraceParent reads a W3C traceparent header value.
+func parseTraceParent(s string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	trace, err1 := hex.DecodeString(parts[1])
+	span, err2 := hex.DecodeString(parts[2])
+	flags, err3 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return sc, false
+	}
+	copy(sc.traceID[:], trace)
+	copy(sc.spanID[:], span)
+	sc.flags = flags[0]
+	if sc.traceID == ([16]byte{}) || sc.spanID == ([8]byte{}) {
+		return sc, false
+	}
+	return sc, true
+}
+
+type spanKey struct{}
+
+// otelTracer is the agentapi.Tracer of the CLIs. It keeps ended spans and
+// exports them to an OTLP/HTTP collector as JSON; without an endpoint it
+// only propagates the trace of TRACEPARENT to the backend.
+type otelTracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	// parent is the caller's span from TRACEPARENT, if any.
+	parent *spanContext
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []otlpSpan
+	warned  bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// otlpSpan and the types below are the OTLP/JSON encoding of a span.
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Status       *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpTracesEndpoint returns where spans are exported, from the standard
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, or "".
+func otlpTracesEndpoint() string {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return ""
+	}
+	if e := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")); e != "" {
+		return e
+	}
+	if e := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")); e != "" {
+		return strings.TrimRight(e, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// parseOTLPHeaders reads OTEL_EXPORTER_OTLP_HEADERS: "key=value,key2=value2"
+// with URL-encoded values.
+func parseOTLPHeaders(s string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if dv, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = dv
+		}
+		out[strings.TrimSpace(k)] = v
+	}
+	return out
+}
+
+// enableTracing installs an otelTracer when OTLP export is configured or
+// the CLI runs inside a trace (TRACEPARENT), and opens the span of the
+// command as the parent of every span of the run. Long-running commands
+// pass root=false: each of their calls is a trace of its own. The returned
+// function ends the command span and exports what is left.
+func enableTracing(tool, command string, root bool) func(err error) {
+	endpoint := otlpTracesEndpoint()
+	var parent *spanContext
+	if sc, ok := parseTraceParent(os.Getenv("TRACEPARENT")); ok {
+		parent = &sc
+	}
+	if endpoint == "" && parent == nil {
+		return func(error) {}
+	}
+	service := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME"))
+	if service == "" {
+		service = tool
+	}
+	t := &otelTracer{
+		endpoint: endpoint,
+		headers:  parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		service:  service,
+		parent:   parent,
+		// Exports bypass agentapi.DefaultTransport, so they are neither
+		// traced with --verbose nor subject to --chaos.
+		client:  &http.Client{Timeout: otelExportTimeout},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	agentapi.DefaultTracer = t
+	go t.flushLoop()
+	logger.Debug("tracing enabled", "endpoint", endpoint, "service", service, "parent", parent != nil)
+
+	end := func(error, ...any) {}
+	if root {
+		runCtx, end = t.Start(runCtx, strings.TrimSpace(tool+" "+command))
+	}
+	return func(err error) {
+		end(err)
+		close(t.stop)
+		<-t.stopped
+	}
+}
+
+// loadTracedConfig loads the config in a span of the command.
+func loadTracedConfig(configPath string) (*ResolvedConfig, error) {
+	_, end := agentapi.StartSpan(runCtx, "config load")
+	cfg, err := agentapi.LoadConfig(configPath)
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	end(nil, "agent_api.project", cfg.ActiveProject, "agent_api.env", cfg.ActiveEnv, "agent_api.mode", cfg.APIMode)
+	return cfg, nil
+}
+
+// Start implements agentapi.Tracer.
+func (t *otelTracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, func(err error, attrs ...any)) {
+	var sc spanContext
+	_, _ = rand.Read(sc.spanID[:])
+	var parentID string
+	switch p, ok := ctx.Value(spanKey{}).(spanContext); {
+	case ok:
+		sc.traceID, sc.flags, parentID = p.traceID, p.flags, hex.EncodeToString(p.spanID[:])
+	case t.parent != nil:
+		sc.traceID, sc.flags, parentID = t.parent.traceID, t.parent.flags, hex.EncodeToString(t.parent.spanID[:])
+	default:
+		_, _ = rand.Read(sc.traceID[:])
+		sc.flags = 1 // sampled
+	}
+	start := time.Now()
+	kind := spanKindInternal
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "http.request.method" {
+			kind = spanKindClient
+		}
+	}
+	var once sync.Once
+	return context.WithValue(ctx, spanKey{}, sc), func(err error, endAttrs ...any) {
+		if sc.flags&1 == 0 {
+			return // the caller's trace is not sampled: propagate only
+		}
+		once.Do(func() {
+			s := otlpSpan{
+				TraceID:      hex.EncodeToString(sc.traceID[:]),
+				SpanID:       hex.EncodeToString(sc.spanID[:]),
+				ParentSpanID: parentID,
+				Name:         name,
+				Kind:         kind,
+				Start:        strconv.FormatInt(start.UnixNano(), 10),
+				End:          strconv.FormatInt(time.Now().UnixNano(), 10),
+				Attributes:   otlpAttributes(append(attrs[:len(attrs):len(attrs)], endAttrs...)),
+			}
+			switch {
+			case err != nil:
+				s.Status = &otlpStatus{Code: spanStatusError, Message: ExitMessage(err)}
+			case kind == spanKindClient && httpErrorStatus(endAttrs):
+				s.Status = &otlpStatus{Code: spanStatusError}
+			}
+			t.record(s)
+		})
+	}
+}
+
+// TraceParent implements agentapi.Tracer.
+func (t *otelTracer) TraceParent(ctx context.Context) string {
+	if sc, ok := ctx.Value(spanKey{}).(spanContext); ok {
+		return sc.traceParent()
+	}
+	if t.parent != nil {
+		return t.parent.traceParent()
+	}
+	return ""
+}
+
+// httpErrorStatus reports an HTTP status of 400 or more among attrs, which
+// marks a client span as failed.
+func httpErrorStatus(attrs []any) bool {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "http.response.status_code" {
+			code, _ := attrs[i+1].(int)
+			return code >= 400
+		}
+	}
+	return false
+}
+
+func otlpAttributes(attrs []any) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		key, _ := attrs[i].(string)
+		var v map[string]any
+		switch x := attrs[i+1].(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(x)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpKeyValue{Key: key, Value: v})
+	}
+	return out
+}
+
+func (t *otelTracer) record(s otlpSpan) {
+	if t.endpoint == "" {
+		return
+	}
+	t.mu.Lock()
+	t.pending = append(t.pending, s)
+	t.mu.Unlock()
+}
+
+func (t *otelTracer) flushLoop() {
+	defer close(t.stopped)
+	tick := time.NewTicker(otelFlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// flush exports the ended spans. A failed export drops them, with one
+// warning per run.
+func (t *otelTracer) flush() {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	err := t.export(spans)
+	if err == nil {
+		logger.Debug("spans exported", "count", len(spans), "endpoint", t.endpoint)
+		return
+	}
+	t.mu.Lock()
+	warned := t.warned
+	t.warned = true
+	t.mu.Unlock()
+	if !warned {
+		logger.Warn("trace export failed", "endpoint", t.endpoint, "spans", len(spans), "error", err.Error())
+	}
+}
+
+func (t *otelTracer) export(spans []otlpSpan) error {
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes([]any{"service.name", t.service, "service.version", version})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": otelScope, "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
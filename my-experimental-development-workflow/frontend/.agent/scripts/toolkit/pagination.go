@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// pageContainers are objects paginated APIs commonly put their cursor in,
+// besides the top level of the body.
+var pageContainers = []string{"meta", "pagination", "paging", "page_info", "pageInfo", "links", "_links", "cursor"}
+
+// nextPageKeys name the field holding the next page's cursor or URL, in
+// order of preference.
+var nextPageKeys = []string{"next_cursor", "nextCursor", "next_page_token", "nextPageToken", "next_token", "nextToken", "continuation_token", "continuationToken", "next_url", "nextUrl", "next_page", "nextPage", "next"}
+
+// NextPage says a response is one page of several and how to get the next:
+// by URL, from a Link header or a body field, or by passing back a cursor.
+type NextPage struct {
+	URL    string `json:"url,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	// Source is where it was found: "Link header" or the field's path in
+	// the body, e.g. meta.next_cursor.
+	Source string `json:"source"`
+}
+
+// detectNextPage looks for a next page in an RFC 8288 Link header, then in
+// the cursor fields of a JSON body. body must be complete: a truncated
+// prefix does not parse and finds nothing.
+func detectNextPage(header http.Header, body []byte) *NextPage {
+	for _, link := range header.Values("Link") {
+		if u := linkRel(link, "next"); u != "" {
+			return &NextPage{URL: u, Source: "Link header"}
+		}
+	}
+	var doc any
+	if len(body) == 0 || json.Unmarshal(body, &doc) != nil {
+		return nil
+	}
+	root, ok := agentapi.AsMap(doc)
+	if !ok {
+		return nil
+	}
+	if next := nextPageIn(root, ""); next != nil {
+		return next
+	}
+	for _, k := range pageContainers {
+		if m, ok := agentapi.AsMap(root[k]); ok {
+			if next := nextPageIn(m, k+"."); next != nil {
+				return next
+			}
+		}
+	}
+	return nil
+}
+
+// nextPageIn reads the first non-empty next-page field of obj. A string
+// that looks like a URL or path is a URL, anything else a cursor. GraphQL
+// style pageInfo ({"hasNextPage": true, "endCursor": ...}) counts too.
+func nextPageIn(obj map[string]any, prefix string) *NextPage {
+	for _, k := range nextPageKeys {
+		var s string
+		switch v := obj[k].(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case map[string]any:
+			// HAL and JSON:API: {"next": {"href": "..."}}
+			s, _ = v["href"].(string)
+		}
+		if s == "" {
+			continue
+		}
+		if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "/") {
+			return &NextPage{URL: s, Source: prefix + k}
+		}
+		return &NextPage{Cursor: s, Source: prefix + k}
+	}
+	if more, _ := obj["hasNextPage"].(bool); more {
+		if c, _ := obj["endCursor"].(string); c != "" {
+			return &NextPage{Cursor: c, Source: prefix + "endCursor"}
+		}
+	}
+	return nil
+}
+
+// linkRel returns the target of the link with relation rel in a Link
+// header value, or "". Targets may contain commas, so links are split on
+// their angle brackets rather than on commas.
+func linkRel(value, rel string) string {
+	for value != "" {
+		start := strings.IndexByte(value, '<')
+		end := strings.IndexByte(value, '>')
+		if start < 0 || end < start {
+			return ""
+		}
+		target := value[start+1 : end]
+		params := value[end+1:]
+		if next := strings.IndexByte(params, '<'); next >= 0 {
+			value = params[next:]
+			params = params[:next]
+		} else {
+			value = ""
+		}
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "rel") {
+				continue
+			}
+			for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(v), `"`)) {
+				if strings.EqualFold(r, rel) {
+					return target
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// nextPageHint is the note acurl prints about a next page: the command
+// fetching it when the URL is known and under the env's base, otherwise
+// where the URL or cursor is.
+func nextPageHint(cfg *ResolvedConfig, method string, next *NextPage) string {
+	if next.Cursor != "" {
+		return fmt.Sprintf("More results: pass %s %q back to fetch the next page.", next.Source, next.Cursor)
+	}
+	if path, query, ok := relativeToBase(cfg, next.URL); ok {
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		return fmt.Sprintf("More results (%s); next page: acurl %s %s", next.Source, method, path)
+	}
+	return fmt.Sprintf("More results (%s); next page: %s", next.Source, next.URL)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often a long operation reports on stderr.
+const progressInterval = 2 * time.Second
+
+// ProgressEvent is one JSON line on stderr about a long operation: a
+// "progress" line every progressInterval while it runs, and a "done" line
+// at the end when there was at least one "progress" line before it.
+type ProgressEvent struct {
+	Event     string `json:"event"`
+	Operation string `json:"operation"`
+	Done      int    `json:"done"`
+	Total     int    `json:"total"`
+	Failed    int    `json:"failed,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	// ETAMS extrapolates the time left from the average time per item.
+	ETAMS int64 `json:"eta_ms,omitempty"`
+}
+
+// progress counts the items of an operation and reports them; a nil
+// progress (--quiet) counts nothing.
+type progress struct {
+	mu        sync.Mutex
+	operation string
+	total     int
+	done      int
+	failed    int
+	start     time.Time
+	reported  bool
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+// startProgress reports on operation (e.g. "call many") until finish.
+func startProgress(operation string, total int) *progress {
+	if quiet {
+		return nil
+	}
+	p := &progress{operation: operation, total: total, start: time.Now(), stop: make(chan struct{})}
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.emit("progress")
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add counts one finished item.
+func (p *progress) add(failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if failed {
+		p.failed++
+	}
+}
+
+// finish stops the reports, ending them with a "done" line if any were made.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.stopped.Wait()
+	p.mu.Lock()
+	reported := p.reported
+	p.mu.Unlock()
+	if reported {
+		p.emit("done")
+	}
+}
+
+func (p *progress) emit(event string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	e := ProgressEvent{Event: event, Operation: p.operation, Done: p.done, Total: p.total, Failed: p.failed, ElapsedMS: elapsed.Milliseconds()}
+	if event == "progress" && p.done > 0 && p.done < p.total {
+		e.ETAMS = (elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)).Milliseconds()
+	}
+	line, _ := json.Marshal(e)
+	fmt.Fprintln(os.Stderr, string(line))
+	p.reported = true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// proxyRequest sends a POST through an api proxy listening on
+// 127.0.0.1:8080 and returns its status and whether it reached the backend.
+func proxyRequest(t *testing.T, build func(*http.Request)) (int, bool) {
+	t.Helper()
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	h, err := NewProxyHandler(&ResolvedConfig{ConfigDir: t.TempDir(), APIBase: backend.URL, APIMode: "full-access", DefaultTokenName: "dev", Tokens: map[string]string{"dev": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.hosts = loopbackHosts(8080)
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8080/items", strings.NewReader(`{"note":"x"}`))
+	r.Header.Set("Content-Type", "application/json")
+	build(r)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, hits.Load() > 0
+}
+
+func TestProxyRejectsOrigin(t *testing.T) {
+	for _, origin := range []string{"https://evil.example", "http://localhost:3000", "null"} {
+		status, reached := proxyRequest(t, func(r *http.Request) { r.Header.Set("Origin", origin) })
+		if status != http.StatusForbidden || reached {
+			t.Errorf("Origin %q: status %d, reached backend %v; want 403, not forwarded", origin, status, reached)
+		}
+	}
+}
+
+func TestProxyRejectsForeignHost(t *testing.T) {
+	for _, host := range []string{"evil.example:8080", "127.0.0.1:9090", "localhost"} {
+		status, reached := proxyRequest(t, func(r *http.Request) { r.Host = host })
+		if status != http.StatusForbidden || reached {
+			t.Errorf("Host %q: status %d, reached backend %v; want 403, not forwarded", host, status, reached)
+		}
+	}
+}
+
+func TestProxyForwardsLocalRequest(t *testing.T) {
+	for _, host := range []string{"127.0.0.1:8080", "localhost:8080"} {
+		status, reached := proxyRequest(t, func(r *http.Request) { r.Host = host })
+		if status != http.StatusCreated || !reached {
+			t.Errorf("Host %q: status %d, reached backend %v; want 201, forwarded", host, status, reached)
+		}
+	}
+}
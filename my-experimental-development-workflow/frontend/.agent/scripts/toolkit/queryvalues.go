@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// relativeTimePattern matches the offset of a relative time value such as
+// @-7d or @+90m.
+var relativeTimePattern = regexp.MustCompile(`^([+-])(\d+)([smhdw])$`)
+
+var timeUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// expandQueryValue replaces a convenience value with what it stands for:
+// @now, @today (midnight) and @-7d / @+2h style offsets from now become
+// ISO-8601 UTC timestamps and @uuid a random UUID. A leading @@ is an
+// escaped literal @; any other value is returned unchanged.
+func expandQueryValue(v string) (string, error) {
+	if !strings.HasPrefix(v, "@") {
+		return v, nil
+	}
+	word := v[1:]
+	now := time.Now().UTC()
+	switch {
+	case strings.HasPrefix(word, "@"):
+		return word, nil
+	case word == "now":
+		return now.Format(time.RFC3339), nil
+	case word == "today":
+		return now.Truncate(24 * time.Hour).Format(time.RFC3339), nil
+	case word == "uuid":
+		return agentapi.NewUUID(), nil
+	case strings.HasPrefix(word, "-") || strings.HasPrefix(word, "+"):
+		m := relativeTimePattern.FindStringSubmatch(word)
+		if m == nil {
+			return "", NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid relative time: %s", v), "Use @-<n><unit> or @+<n><unit> with unit s, m, h, d or w, e.g. @-7d; @@ sends a literal @.")
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid relative time: %s", v))
+		}
+		offset := time.Duration(n) * timeUnits[m[3]]
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return now.Add(offset).Format(time.RFC3339), nil
+	}
+	return v, nil
+}
+
+// appendQuery adds "key=value" params, with their values expanded, to the
+// query string of path.
+func appendQuery(path string, params []string) (string, error) {
+	if len(params) == 0 {
+		return path, nil
+	}
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return "", NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --query: %s (expected key=value)", p))
+		}
+		v, err := expandQueryValue(v)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + strings.Join(parts, "&"), nil
+}
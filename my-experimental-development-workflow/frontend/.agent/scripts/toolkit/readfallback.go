@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// blockedWrite handles a write the env's api_mode refuses. The refusal
+// also offers the GET of the same path, when the spec has one, so an agent
+// can keep reading instead of stalling; with --read-fallback that GET is
+// sent and printed, and the call still fails with the refusal so the write
+// is not mistaken for done.
+func blockedWrite(cfg *ResolvedConfig, globalOpts GlobalOptions, method, path string, opts *acurlOptions, source string, blocked error) error {
+	if !readableInSpec(cfg, path) {
+		return blocked
+	}
+	if !opts.ReadFallback {
+		return NewCliErrorHint(ExitBlockedByMode, ExitMessage(blocked), fmt.Sprintf("%s To keep reading, run acurl GET %s, or add --read-fallback to send it whenever a write is blocked.", agentapi.Suggestion(blocked), path))
+	}
+	infof("%s %s blocked by api_mode=%s; sending GET %s instead.\n", method, path, cfg.APIMode, path)
+	if err := sendACurl(cfg, globalOpts, http.MethodGet, path, readOptions(opts), source); err != nil {
+		return err
+	}
+	return NewCliErrorHint(ExitBlockedByMode, fmt.Sprintf("%s; sent GET %s instead", ExitMessage(blocked), path), agentapi.Suggestion(blocked))
+}
+
+// readableInSpec reports whether a GET of path is worth offering: the spec
+// declares one, does not know the path, or could not be loaded.
+func readableInSpec(cfg *ResolvedConfig, path string) bool {
+	spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
+	if err != nil {
+		logger.Debug("read fallback unchecked, spec unavailable", "error", err)
+		return true
+	}
+	ops := agentapi.OperationsForPath(spec, path)
+	for _, op := range ops {
+		if op.Method == http.MethodGet {
+			return true
+		}
+	}
+	return len(ops) == 0
+}
+
+// readOptions are the options of a GET acurl sends in place of, or after,
+// a write: the same output options without the body. The path already
+// carries --query and the headers --accept.
+func readOptions(opts *acurlOptions) *acurlOptions {
+	read := *opts
+	read.Data, read.Edit, read.PatchOps, read.Merge, read.Soft = "", false, nil, "", false
+	read.ContentType, read.Query, read.Accept = "", nil, ""
+	read.ReadFallback, read.FollowCreated = false, false
+	return &read
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// minScheduleInterval keeps a typo like `--every 1ms` from hammering the API.
+const minScheduleInterval = time.Second
+
+// ScheduledJob runs a saved request every Every; jobs live in
+// state/schedules.json and are executed by `api schedule run`.
+type ScheduledJob struct {
+	ID      string    `json:"id"`
+	Request string    `json:"request"`
+	Every   string    `json:"every"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ScheduleRun is the NDJSON line printed for every execution.
+type ScheduleRun struct {
+	Time     time.Time `json:"time"`
+	Schedule string    `json:"schedule"`
+	Request  string    `json:"request"`
+	StepResult
+}
+
+func schedulesPath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "state", "schedules.json")
+}
+
+// LoadSchedules returns the configured jobs; a missing file means none.
+func LoadSchedules(cfg *ResolvedConfig) ([]ScheduledJob, error) {
+	raw, err := os.ReadFile(schedulesPath(cfg))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read schedules: %v", err), err)
+	}
+	var jobs []ScheduledJob
+	if err := json.Unmarshal(raw, &jobs); err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to parse %s: %v", schedulesPath(cfg), err), err)
+	}
+	return jobs, nil
+}
+
+func saveSchedules(cfg *ResolvedConfig, jobs []ScheduledJob) error {
+	path := schedulesPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err), err)
+	}
+	raw, _ := json.MarshalIndent(jobs, "", "  ")
+	if err := agentapi.WriteFileAtomic(path, append(raw, '\n'), 0o600); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write schedules: %v", err), err)
+	}
+	return nil
+}
+
+func parseScheduleInterval(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < minScheduleInterval {
+		return 0, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --every: %s (expected a duration such as 30s, 5m or 1h, at least %s)", v, minScheduleInterval))
+	}
+	return d, nil
+}
+
+// RunScheduleCommand implements `api schedule add|list|remove|run`.
+func RunScheduleCommand(cfg *ResolvedConfig, args []string) error {
+	if len(args) == 0 {
+		return NewCliError(ExitRequestBuild, "Usage: api schedule <add <collection/request> --every <duration>|list|remove <id>|run [--once]>")
+	}
+	switch args[0] {
+	case "add":
+		return scheduleAdd(cfg, args[1:])
+	case "list":
+		jobs, err := LoadSchedules(cfg)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No schedules.")
+			return nil
+		}
+		for _, j := range jobs {
+			fmt.Printf("%s  every %-6s %s\n", j.ID, j.Every, j.Request)
+		}
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return NewCliError(ExitRequestBuild, "Usage: api schedule remove <id>")
+		}
+		unlock, err := lockState(schedulesPath(cfg))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		jobs, err := LoadSchedules(cfg)
+		if err != nil {
+			return err
+		}
+		kept := make([]ScheduledJob, 0, len(jobs))
+		for _, j := range jobs {
+			if j.ID != args[1] {
+				kept = append(kept, j)
+			}
+		}
+		if len(kept) == len(jobs) {
+			return NewCliError(ExitNotFound, fmt.Sprintf("Schedule not found: %s", args[1]))
+		}
+		return saveSchedules(cfg, kept)
+	case "run":
+		once := false
+		for _, a := range args[1:] {
+			if a != "--once" {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown schedule run option: %s", a))
+			}
+			once = true
+		}
+		return runScheduler(cfg, once)
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown schedule action: %s (expected add|list|remove|run)", args[0]))
+	}
+}
+
+func scheduleAdd(cfg *ResolvedConfig, args []string) error {
+	ref, every := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--every":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --every")
+			}
+			every = args[i]
+		default:
+			if ref != "" {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown schedule option: %s", args[i]))
+			}
+			ref = args[i]
+		}
+	}
+	if ref == "" || every == "" {
+		return NewCliError(ExitRequestBuild, "Usage: api schedule add <collection/request> --every <duration>")
+	}
+	if _, err := parseScheduleInterval(every); err != nil {
+		return err
+	}
+	suite, err := LoadSavedRequest(cfg, ref)
+	if err != nil {
+		return err
+	}
+	if suite.Steps[0].Confirm {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("%s requires confirmation and cannot run unattended", ref))
+	}
+	unlock, err := lockState(schedulesPath(cfg))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jobs, err := LoadSchedules(cfg)
+	if err != nil {
+		return err
+	}
+	job := ScheduledJob{ID: newHistoryID(), Request: ref, Every: every, AddedAt: time.Now().UTC()}
+	if err := saveSchedules(cfg, append(jobs, job)); err != nil {
+		return err
+	}
+	fmt.Printf("Scheduled %s every %s (id %s). Start the runner with: api schedule run\n", ref, every, job.ID)
+	return nil
+}
+
+// runScheduler executes due jobs until interrupted. The schedule file is
+// re-read every tick so add/remove take effect without a restart; each job
+// first runs when the runner starts. Jobs run one at a time, results go to
+// stdout as NDJSON and every call is appended to the history.
+func runScheduler(cfg *ResolvedConfig, once bool) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	lastRun := map[string]time.Time{}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	logger.Info("schedule runner started", "project", cfg.ActiveProject, "env", cfg.ActiveEnv, "api_mode", cfg.APIMode)
+	for {
+		jobs, err := LoadSchedules(cfg)
+		if err != nil {
+			return err
+		}
+		if once && len(jobs) == 0 {
+			return NewCliError(ExitNotFound, "No schedules to run")
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].AddedAt.Before(jobs[j].AddedAt) })
+		for _, job := range jobs {
+			every, err := parseScheduleInterval(job.Every)
+			if err != nil {
+				logger.Warn("schedule skipped", "schedule", job.ID, "error", ExitMessage(err))
+				continue
+			}
+			if last, ok := lastRun[job.ID]; ok && time.Since(last) < every {
+				continue
+			}
+			lastRun[job.ID] = time.Now()
+			runScheduledJob(cfg, job)
+		}
+		if once {
+			return nil
+		}
+		select {
+		case <-sigs:
+			logger.Info("schedule runner stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runScheduledJob(cfg *ResolvedConfig, job ScheduledJob) {
+	run := ScheduleRun{Time: time.Now().UTC(), Schedule: job.ID, Request: job.Request}
+	suite, err := LoadSavedRequest(cfg, job.Request)
+	if err == nil && suite.Steps[0].Confirm {
+		err = NewCliError(ExitRequestBuild, "requires confirmation and cannot run unattended")
+	}
+	if err != nil {
+		run.StepResult = StepResult{Name: job.Request, Outcome: outcomeFailed, Failures: []string{ExitMessage(err)}}
+	} else {
+		r := newSuiteRunner(cfg, suite.Vars)
+		r.source = "schedule:" + job.ID
+		run.StepResult = r.runStep(suite.Steps[0])
+		run.Name = job.Request
+	}
+	b, _ := json.Marshal(run)
+	fmt.Println(string(b))
+}
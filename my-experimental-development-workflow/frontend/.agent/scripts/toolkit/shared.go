@@ -1,34 +1,17 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	toml "github.com/pelletier/go-toml/v2"
-	"gopkg.in/yaml.v3"
-)
-
-const (
-	ExitSuccess         = 0
-	ExitUnexpected      = 1
-	ExitConfig          = 2
-	ExitToken           = 3
-	ExitOpenAPIFetch    = 4
-	ExitOpenAPIParse    = 5
-	ExitNotFound        = 6
-	ExitBlockedByMode   = 7
-	ExitMarkerMissing   = 8
-	ExitRequestBuild    = 9
-	ExitHTTPErrorStatus = 10
+	"agent-api-toolkit/agentapi"
 )
 
 var (
@@ -41,425 +24,241 @@ var (
 		"HEAD":    {},
 		"OPTIONS": {},
 	}
-	openapiMethods = map[string]struct{}{
-		"get":     {},
-		"post":    {},
-		"put":     {},
-		"patch":   {},
-		"delete":  {},
-		"head":    {},
-		"options": {},
-		"trace":   {},
-	}
 )
 
 const APIHelp = `NAME
   api - OpenAPI discovery and inspection
 
 USAGE
-  api find <query> [--method <HTTP_METHOD>]
-  api show <operationId|"METHOD /path">`
+  api [--quiet | --verbose | --log-level debug|info|warn|error] [--log-file <path>] [--no-daemon] [--chaos <spec>] [--offline <cassette>] [--json] [--wide] <command> ...
+  api find <query> [--method <HTTP_METHOD>] [--limit <n>] [--offset <n>] [--all | --envs <env1>,<env2> | --env-tag <tag>] [--concurrency <n>] [--group-versions] [--no-history] [--format table|json|ndjson|csv]
+  api show <operationId|"METHOD /path"> [--resolved]
+  api ui
+  api proxy [--port <port>] [--metrics-port <port>]
+  api test <suite.yaml> [--report text|json|junit] [--yes]
+  api scenario <file.yaml> [--report text|json|junit] [--yes]
+  api listen [--port <port>] [--host <host>] [--expose]
+  api serve [--port <port>] [--allow-origin <origin>]
+  api daemon [start|stop|status]
+  api collection list [name] | run <collection/request> [--report ...] [--yes]
+  api spec infer --out <file.yaml|.json> [--cassette <file>]... [--no-history] [--all]
+  api spec pull [--all | --envs <env1>,<env2> | --env-tag <tag>] [--concurrency <n>] [--force] [--format table|json|ndjson|csv]
+  api spec drift --envs <env1>,<env2>[,...] | --env-tag <tag> | --all [--concurrency <n>] [--format table|json|ndjson|csv]
+  api spec params <METHOD> <path> | <operationId> [--format table|csv|json|ndjson]
+  api spec verify [--sample <n>] [--seed <n>]
+  api spec tools [query] [--method <HTTP_METHOD>] [--format openai|anthropic]
+  api history export --format har [--out <file.har>] [--last <n>] [--source <name>] [--session <id>] [--all-envs]
+  api history top [--limit <n>] [--session <id>] [--all-envs] [--format table|csv|json|ndjson]
+  api context env-export [--env <env>] [--format shell|json]
+  api import-curl '<curl command>' [--save <collection>/<request>]
+  api query '<expression>' [--from last|history:<id>|<file>|-] [--raw]
+  api assert status <code|2xx>[,...] | json '<expression>' [--from last|history:<id>|<file>|-]
+  api describe-response [--from last|history:<id>|<file>|-] [--yaml]
+  api graphql schema pull | search <query> [--format ...] | show <Type>
+  api whoami [--token <name> | --all-tokens] [--raw | --format table|csv|json|ndjson]
+  api policy explain [METHOD] <path> [-d <json_body>] [--token <name>] [--preflight] [--format table|csv|json|ndjson]
+  api token list [--check] [--envs <env1>,<env2> | --env-tag <tag> | --all] [--format table|csv|json|ndjson]
+  api token stats [--session <id>] [--envs <env1>,<env2> | --env-tag <tag> | --all] [--format table|csv|json|ndjson]
+  api call many --path '/things/{id}' --ids <id1>,<id2>,... | --ids-file <file|-> [--concurrency <n>] [--token <name>] [--query key=value]...
+  api call --request <request.yaml> [--var name=value]... [--token <name>]
+  api call raw --method <METHOD> <path> [-d <body> | --data-file <file|->] [-H 'Name: value']... [--token <name>] --unsafe
+  api session [status | new | list [--format table|csv|json|ndjson]]
+  api record on [--max-bytes <n>] | off | status
+  api health [--path <path>] [--envs <env1>,<env2> | --env-tag <tag>] [--format table|json|ndjson|csv]
+  api diff-env [GET] <path> --envs <env1>,<env2>[,...] | --env-tag <tag> [--ignore <field|$.path>]...
+  api resource [--format table|csv|json|ndjson] | <list|create> <collection> | <get|update|delete> <collection> <id> [acurl options]
+  api edit <path> --set <field>=<value>... [--unset <field>]... [--method PUT|PATCH] [--token <name>] [-H "Key: Value"]... [--dry-run]
+  api seed <apply|teardown> <fixtures.yaml> [--session <id>]
+  api schedule add <collection/request> --every <duration> | list | remove <id> | run [--once]
+  api config validate [--format table|csv|json|ndjson]
+  api config init [--force]
+  api project use <name> [--env <env>] | list [--format table|csv|json|ndjson]
+  api env use <name> | list [--project <name> | --all] [--format table|csv|json|ndjson]
+  api completion <bash|zsh|fish>
+  api version [--format text|json]
+  api self-update [--version <tag>] [--from <url|dir>] [--check]`
+
+const findUsage = "Usage: api find <query> [--method <HTTP_METHOD>] [--limit <n>] [--offset <n>] [--all | --envs <env1>,<env2> | --env-tag <tag>] [--concurrency <n>] [--group-versions] [--no-history] [--format table|json|ndjson|csv]"
 
 const ACurlHelp = `NAME
   acurl - Config-aware curl wrapper with mode guardrails
 
 USAGE
-  acurl [METHOD] <path> [--token <token_name>] [-d <json_body>] [-H "Key: Value"]
+  acurl [METHOD] <path> [--token <token_name>] [-d <json_body>] [--edit] [-H "Key: Value"] [--query key=value]...
+        [--patch-op '<op> <pointer> [value]']... [--merge '<json>'] [--accept <media-type>] [--reuse] [--soft | --plan] [--read-fallback] [--follow-created]
+        [--content-type <media-type>] [--proto-descriptor <file.pb>]...
+        [--format table|csv|json|ndjson [--fields <field1>,<field2>]] [--raw | --xml-json] [--summarize]
+        [--record <cassette.json> | --replay <cassette.json>]
+        [--snapshot <name> [--snapshot-ignore <field|$.path>]... [--update-snapshot]]
+        [--max-bytes <n>]
+        [--quiet | --verbose | --log-level debug|info|warn|error] [--log-file <path>] [--no-daemon]
+        [--chaos <percent>[:latency[=<max>],429,reset]] [--offline <cassette.json>] [--json]
 
 NOTES
-  METHOD defaults to GET when omitted.
-  Path must start with '/'.
-  Outputs backend response as compact JSON when response body is JSON.`
-
-type CliError struct {
-	Code    int
-	Message string
-}
-
-func (e *CliError) Error() string {
-	return e.Message
-}
-
-func NewCliError(code int, msg string) error {
-	return &CliError{Code: code, Message: msg}
-}
-
-func ExitCode(err error) int {
-	if err == nil {
-		return ExitSuccess
-	}
-	var ce *CliError
-	if errors.As(err, &ce) {
-		return ce.Code
-	}
-	return ExitUnexpected
-}
-
-func ExitMessage(err error) string {
-	if err == nil {
-		return ""
-	}
-	var ce *CliError
-	if errors.As(err, &ce) {
-		return ce.Message
-	}
-	return fmt.Sprintf("Unexpected error: %v", err)
-}
-
-type fileConfig struct {
-	ActiveProject string                  `toml:"active_project"`
-	ActiveEnv     string                  `toml:"active_env"`
-	DefaultToken  string                  `toml:"default_token"`
-	AgentMarker   string                  `toml:"agent_marker"`
-	Strict        *bool                   `toml:"strict"`
-	Projects      map[string]projectEntry `toml:"projects"`
-}
-
-type projectEntry struct {
-	Envs map[string]envEntry `toml:"envs"`
-}
-
-type envEntry struct {
-	APIBase    string            `toml:"api_base"`
-	APIMode    string            `toml:"api_mode"`
-	OpenAPIURL string            `toml:"openapi_url"`
-	Tokens     map[string]string `toml:"tokens"`
-}
-
-type ResolvedConfig struct {
-	ActiveProject    string
-	ActiveEnv        string
-	DefaultTokenName string
-	AgentMarker      string
-	Strict           bool
-	APIBase          string
-	APIMode          string
-	OpenAPIURL       string
-	Tokens           map[string]string
-}
-
-func ResolveConfig(configPath string) (*ResolvedConfig, error) {
-	raw, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Config file not found: %s", configPath))
-	}
-
-	var fc fileConfig
-	if err := toml.Unmarshal(raw, &fc); err != nil {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Failed to parse TOML config %s: %v", configPath, err))
-	}
-
-	if strings.TrimSpace(fc.ActiveProject) == "" {
-		return nil, NewCliError(ExitConfig, "Missing/invalid 'active_project' in config")
-	}
-	if strings.TrimSpace(fc.ActiveEnv) == "" {
-		return nil, NewCliError(ExitConfig, "Missing/invalid 'active_env' in config")
-	}
-	if strings.TrimSpace(fc.DefaultToken) == "" {
-		return nil, NewCliError(ExitConfig, "Missing/invalid 'default_token' in config")
-	}
-	if strings.TrimSpace(fc.AgentMarker) == "" {
-		return nil, NewCliError(ExitConfig, "Missing/invalid 'agent_marker' in config")
-	}
-	if fc.Strict == nil {
-		return nil, NewCliError(ExitConfig, "Missing/invalid 'strict' in config (expected true/false)")
-	}
+  Without METHOD, GET is sent; a path the spec defines only other methods
+  for is an error listing them, never an implied write.
+  Path must start with '/'. --query appends a URL-encoded param; the values
+  @now, @today, @-7d / @+2h (units s, m, h, d, w) expand to ISO-8601 UTC
+  timestamps and @uuid to a random UUID (@@ sends a literal @).
+  --format lays out a JSON array response in rows, one column per field of
+  its objects (id first, then by name) or the --fields given, which may be
+  dotted paths such as owner.name; nested values are compact JSON.
+  --accept asks for another media type than JSON (e.g. text/csv); CSV and
+  TSV bodies, and bodies of the type asked for, are printed verbatim, and a
+  response of another type is noted on stderr.
+  --content-type sends -d, given as JSON, converted to msgpack
+  (application/msgpack), CBOR (application/cbor) or protobuf
+  (application/x-protobuf; proto=<message>, with the descriptor set of
+  --proto-descriptor); responses in those types are printed as JSON.
+  XML bodies are indented (--xml-json converts them to JSON) and HTML bodies,
+  usually error pages, are reduced to their title and text; --raw prints
+  either as received.
+  --summarize prints the size and structure of the body instead of it: the
+  keys of objects, array lengths with the keys of their items and a few
+  samples, for choosing what to query next.
+  A response that is one page of several (a Link rel="next" header, or a
+  next cursor or URL field in the body) is noted on stderr with how to get
+  the next page; --summarize reports it as next_page.
+  A GET identical to one made in the last 10 seconds (same URL, token,
+  headers) is noted on stderr with its history id; --reuse prints that
+  response instead of sending the request again.
+  --soft turns a DELETE into the env's soft_delete request (e.g. PATCH with
+  {"status": "archived"}), which safe-updates allows.
+  --plan previews a DELETE without sending it: the policy verdict, the
+  responses the spec declares, operations on the same path, below it and
+  on its collection, and the resource as a GET returns it now.
+  A write the env's api_mode blocks fails with exit 7, suggesting the GET
+  of the same path when the spec has one; --read-fallback sends that GET
+  and prints its response (still exiting 7), so reading can go on.
+  The Location of a 201, 202 or 3xx answer to a write is noted on stderr and
+  kept in the history, as a path when the env serves it; {{last.location}}
+  in later arguments stands for the newest one of the session.
+  --follow-created prints the GET of that Location instead of the write's
+  response.
+  --patch-op (repeatable, e.g. 'replace /price 9.99') builds a JSON Patch
+  body and --merge '{"price": 9.99}' a JSON Merge Patch one, sent as PATCH
+  with their Content-Type; when the spec lists the media types of the
+  operation's request body, the patch type must be among them.
+  --edit opens the body in $VISUAL/$EDITOR (vi by default), starting from
+  -d or a template built from the operation's request schema, checks it is
+  JSON matching the schema when saved and then sends it.
+  Outputs backend response as compact JSON when response body is JSON,
+  streamed as it arrives so large bodies never sit in memory; --max-bytes
+  stops after that many bytes of output.
+  --record appends the exchange to a cassette; --replay serves it back from
+  the cassette without network access (matched on method, path and body).
+  Calls go through a running 'api daemon' unless --no-daemon is given.
+  --snapshot stores the response as a golden file on first run and fails
+  with a structural diff (exit 11) when a later response differs.
+  --chaos injects latency, 429s or connection resets into that percentage
+  of requests for resilience testing; every injected fault is logged.`
 
-	project, ok := fc.Projects[fc.ActiveProject]
-	if !ok {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Active project '%s' not found under [projects]", fc.ActiveProject))
-	}
-	envCfg, ok := project.Envs[fc.ActiveEnv]
+func schemaToText(schemaAny any) string {
+	schema, ok := agentapi.AsMap(schemaAny)
 	if !ok {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Active env '%s' not found under project '%s'", fc.ActiveEnv, fc.ActiveProject))
-	}
-
-	if strings.TrimSpace(envCfg.APIBase) == "" {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Missing/invalid api_base for %s/%s", fc.ActiveProject, fc.ActiveEnv))
-	}
-	if strings.TrimSpace(envCfg.OpenAPIURL) == "" {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Missing/invalid openapi_url for %s/%s", fc.ActiveProject, fc.ActiveEnv))
-	}
-	if envCfg.APIMode != "read-only" && envCfg.APIMode != "safe-updates" && envCfg.APIMode != "full-access" {
-		return nil, NewCliError(ExitConfig, fmt.Sprintf("Missing/invalid api_mode for %s/%s (expected read-only|safe-updates|full-access)", fc.ActiveProject, fc.ActiveEnv))
-	}
-
-	normalizedTokens := make(map[string]string)
-	for k, v := range envCfg.Tokens {
-		k = strings.TrimSpace(k)
-		v = strings.TrimSpace(v)
-		if k != "" && v != "" {
-			normalizedTokens[k] = v
-		}
+		return "-"
 	}
-	if len(normalizedTokens) == 0 {
-		return nil, NewCliError(ExitToken, fmt.Sprintf("No usable tokens defined for %s/%s", fc.ActiveProject, fc.ActiveEnv))
+	if ref, ok := schema["$ref"].(string); ok && ref != "" {
+		return ref
 	}
-
-	return &ResolvedConfig{
-		ActiveProject:    fc.ActiveProject,
-		ActiveEnv:        fc.ActiveEnv,
-		DefaultTokenName: fc.DefaultToken,
-		AgentMarker:      fc.AgentMarker,
-		Strict:           *fc.Strict,
-		APIBase:          strings.TrimRight(envCfg.APIBase, "/"),
-		APIMode:          envCfg.APIMode,
-		OpenAPIURL:       envCfg.OpenAPIURL,
-		Tokens:           normalizedTokens,
-	}, nil
-}
-
-func ResolveToken(cfg *ResolvedConfig, tokenNameOverride string) (string, string, error) {
-	tokenName := strings.TrimSpace(tokenNameOverride)
-	if tokenName == "" {
-		tokenName = cfg.DefaultTokenName
+	t := agentapi.AsString(schema["type"])
+	f := agentapi.AsString(schema["format"])
+	if t != "" && f != "" {
+		return fmt.Sprintf("%s (%s)", t, f)
 	}
-	value, ok := cfg.Tokens[tokenName]
-	if !ok {
-		return "", "", NewCliError(ExitToken, fmt.Sprintf("Token '%s' not found for %s/%s", tokenName, cfg.ActiveProject, cfg.ActiveEnv))
+	if t != "" {
+		return t
 	}
-	if strings.TrimSpace(value) == "" {
-		return "", "", NewCliError(ExitToken, fmt.Sprintf("Token '%s' is empty", tokenName))
+	b, _ := json.Marshal(schema)
+	if len(b) == 0 {
+		return "-"
 	}
-	return tokenName, value, nil
+	return string(b)
 }
 
-func FetchOpenAPISpec(openapiURL string) (map[string]any, error) {
-	req, err := http.NewRequest(http.MethodGet, openapiURL, nil)
-	if err != nil {
-		return nil, NewCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err))
-	}
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, NewCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err))
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, NewCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch OpenAPI spec: %v", err))
+// FindResultsTable converts search results into a Table. others, when
+// not nil, holds the other versions GroupVersions folded into each result
+// and adds an OTHER_VERSIONS column.
+func FindResultsTable(ops []Operation, others [][]string) *Table {
+	t := &Table{
+		Columns: []string{"METHOD", "PATH", "SUMMARY", "OPERATION_ID"},
+		Keys:    []string{"method", "path", "summary", "operation_id"},
+		Empty:   "No matching endpoints found.",
 	}
-	if resp.StatusCode >= 400 {
-		return nil, NewCliError(ExitOpenAPIFetch, fmt.Sprintf("Failed to fetch OpenAPI spec: HTTP %d", resp.StatusCode))
-	}
-
-	var spec map[string]any
-	if err := json.Unmarshal(body, &spec); err != nil {
-		if errY := yaml.Unmarshal(body, &spec); errY != nil {
-			return nil, NewCliError(ExitOpenAPIParse, fmt.Sprintf("Failed to parse OpenAPI spec as JSON/YAML: %v", errY))
-		}
-	}
-	paths, ok := asMap(spec["paths"])
-	if !ok || len(paths) == 0 {
-		return nil, NewCliError(ExitOpenAPIParse, "OpenAPI spec is missing a valid 'paths' object")
+	for _, op := range ops {
+		t.Rows = append(t.Rows, []string{op.Method, op.Path, op.Summary, op.OperationID})
 	}
-	return spec, nil
+	addOtherVersions(t, others)
+	return t
 }
 
-type Operation struct {
-	Method      string
-	Path        string
-	OperationID string
-	Summary     string
-	Description string
-	Tags        []string
-	Raw         map[string]any
-	Score       int
-}
-
-func IterOperations(spec map[string]any) []Operation {
-	pathsAny, ok := asMap(spec["paths"])
-	if !ok {
-		return nil
+// addOtherVersions appends the OTHER_VERSIONS column of grouped results.
+func addOtherVersions(t *Table, others [][]string) {
+	if others == nil {
+		return
 	}
-	out := make([]Operation, 0)
-	for p, pathItemAny := range pathsAny {
-		pathItem, ok := asMap(pathItemAny)
-		if !ok {
-			continue
-		}
-		for method, opAny := range pathItem {
-			if _, ok := openapiMethods[strings.ToLower(method)]; !ok {
-				continue
-			}
-			op, _ := asMap(opAny)
-			tags := make([]string, 0)
-			if tagsAny, ok := asSlice(op["tags"]); ok {
-				for _, t := range tagsAny {
-					if ts, ok := t.(string); ok {
-						tags = append(tags, ts)
-					}
-				}
-			}
-			out = append(out, Operation{
-				Method:      strings.ToUpper(method),
-				Path:        p,
-				OperationID: asString(op["operationId"]),
-				Summary:     asString(op["summary"]),
-				Description: asString(op["description"]),
-				Tags:        tags,
-				Raw:         op,
-			})
-		}
+	t.Columns = append(t.Columns, "OTHER_VERSIONS")
+	t.Keys = append(t.Keys, "other_versions")
+	for i := range t.Rows {
+		t.Rows[i] = append(t.Rows[i], strings.Join(others[i], ", "))
 	}
-	return out
 }
 
-func termVariants(term string) []string {
-	variants := map[string]struct{}{term: {}}
-	if strings.HasSuffix(term, "y") && len(term) > 1 {
-		variants[term[:len(term)-1]+"ies"] = struct{}{}
-	}
-	if strings.HasSuffix(term, "ies") && len(term) > 3 {
-		variants[term[:len(term)-3]+"y"] = struct{}{}
-	}
-	if !strings.HasSuffix(term, "s") {
-		variants[term+"s"] = struct{}{}
+func PrintFindResults(ops []Operation, others [][]string, format string) error {
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
 	}
-	out := make([]string, 0, len(variants))
-	for v := range variants {
-		if v != "" {
-			out = append(out, v)
-		}
+	if err := f.Format(os.Stdout, FindResultsTable(ops, others)); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
 	}
-	return out
-}
-
-func scoreOperation(op Operation, query string) int {
-	terms := strings.Fields(strings.ToLower(query))
-	if len(terms) == 0 {
-		return 0
-	}
-	hay := []string{
-		strings.ToLower(op.Path),
-		strings.ToLower(op.OperationID),
-		strings.ToLower(op.Summary),
-		strings.ToLower(op.Description),
-		strings.ToLower(strings.Join(op.Tags, " ")),
-	}
-	score := 0
-	for _, term := range terms {
-		vars := termVariants(term)
-		for i, h := range hay {
-			for _, v := range vars {
-				if strings.Contains(h, v) {
-					score += 10 - min(i, 4)
-					break
-				}
-			}
-		}
-	}
-	return score
+	return nil
 }
 
-func FindOperations(spec map[string]any, query string, methodFilter string) []Operation {
-	methodFilter = strings.ToUpper(strings.TrimSpace(methodFilter))
-	ops := IterOperations(spec)
-	out := make([]Operation, 0)
-	for _, op := range ops {
-		if methodFilter != "" && op.Method != methodFilter {
-			continue
-		}
-		score := scoreOperation(op, query)
-		if score > 0 {
-			op.Score = score
-			out = append(out, op)
-		}
+// notePage tells, on stderr, that `api find` printed only part of its
+// total matches, and how to get the rest.
+func notePage(total, offset, shown, rest int) {
+	switch {
+	case rest > 0:
+		infof("Showing matches %d-%d of %d; --offset %d shows the next page, --limit 0 shows all.\n", offset+1, offset+shown, total, offset+shown)
+	case shown == 0 && offset > 0 && total > 0:
+		infof("No matches past --offset %d (%d in total).\n", offset, total)
 	}
-	sort.Slice(out, func(i, j int) bool {
-		if out[i].Score != out[j].Score {
-			return out[i].Score > out[j].Score
-		}
-		if out[i].Path != out[j].Path {
-			return out[i].Path < out[j].Path
-		}
-		return out[i].Method < out[j].Method
-	})
-	return out
 }
 
-func FindOperationByRef(spec map[string]any, ref string) (*Operation, error) {
-	ref = strings.TrimSpace(ref)
-	if ref == "" {
-		return nil, NewCliError(ExitNotFound, "Empty endpoint reference")
-	}
-	parts := strings.SplitN(ref, " ", 2)
-	if len(parts) == 2 {
-		method := strings.ToUpper(strings.TrimSpace(parts[0]))
-		path := strings.TrimSpace(parts[1])
-		if _, ok := httpMethods[method]; ok && strings.HasPrefix(path, "/") {
-			for _, op := range IterOperations(spec) {
-				if op.Method == method && op.Path == path {
-					cp := op
-					return &cp, nil
-				}
-			}
-			return nil, NewCliError(ExitNotFound, fmt.Sprintf("Endpoint not found: %s %s", method, path))
-		}
+// SpecMatchesTable converts the merged results of a multi-env search into
+// a Table, best first; others is as for FindResultsTable.
+func SpecMatchesTable(matches []agentapi.SpecMatch, others [][]string) *Table {
+	t := &Table{
+		Columns: []string{"ENV", "METHOD", "PATH", "SUMMARY", "OPERATION_ID", "RELEVANCE"},
+		Keys:    []string{"env", "method", "path", "summary", "operation_id", "relevance"},
+		Empty:   "No matching endpoints found.",
 	}
-	for _, op := range IterOperations(spec) {
-		if op.OperationID == ref {
-			cp := op
-			return &cp, nil
-		}
+	for _, m := range matches {
+		t.Rows = append(t.Rows, []string{m.Env, m.Method, m.Path, m.Summary, m.OperationID, strconv.FormatFloat(m.Relevance, 'f', 2, 64)})
 	}
-	return nil, NewCliError(ExitNotFound, fmt.Sprintf("Operation not found for ref: %s", ref))
+	addOtherVersions(t, others)
+	return t
 }
 
-func schemaToText(schemaAny any) string {
-	schema, ok := asMap(schemaAny)
-	if !ok {
-		return "-"
-	}
-	if ref, ok := schema["$ref"].(string); ok && ref != "" {
-		return ref
-	}
-	t := asString(schema["type"])
-	f := asString(schema["format"])
-	if t != "" && f != "" {
-		return fmt.Sprintf("%s (%s)", t, f)
+func PrintSpecMatches(matches []agentapi.SpecMatch, others [][]string, format string) error {
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
 	}
-	if t != "" {
-		return t
+	if err := f.Format(os.Stdout, SpecMatchesTable(matches, others)); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
 	}
-	b, _ := json.Marshal(schema)
-	if len(b) == 0 {
-		return "-"
-	}
-	return string(b)
+	return nil
 }
 
-func PrintFindResults(ops []Operation) {
-	if len(ops) == 0 {
-		fmt.Println("No matching endpoints found.")
-		return
-	}
-	methodW := 6
-	pathW := 20
-	for _, op := range ops {
-		if len(op.Method) > methodW {
-			methodW = len(op.Method)
-		}
-		if len(op.Path) > pathW {
-			pathW = len(op.Path)
-		}
-	}
-	if pathW > 80 {
-		pathW = 80
-	}
-
-	fmt.Printf("%-*s  %-*s  SUMMARY  OPERATION_ID\n", methodW, "METHOD", pathW, "PATH")
-	fmt.Printf("%-*s  %-*s  -------  ------------\n", methodW, strings.Repeat("-", methodW), pathW, strings.Repeat("-", pathW))
-	for _, op := range ops {
-		p := op.Path
-		if len(p) > pathW {
-			p = p[:pathW-1] + "…"
-		}
-		fmt.Printf("%-*s  %-*s  %s  %s\n", methodW, op.Method, pathW, p, op.Summary, op.OperationID)
+func printJSONIndent(v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode output: %v", err), err)
 	}
+	fmt.Println(string(b))
+	return nil
 }
 
 func PrintOperationDetails(op *Operation) {
@@ -476,37 +275,28 @@ func PrintOperationDetails(op *Operation) {
 	}
 
 	fmt.Println("\nPARAMETERS:")
-	paramsAny, _ := asSlice(raw["parameters"])
-	if len(paramsAny) == 0 {
+	if len(op.Parameters) == 0 {
 		fmt.Println("  -")
 	} else {
-		for _, pAny := range paramsAny {
-			p, ok := asMap(pAny)
-			if !ok {
-				continue
-			}
-			name := asString(p["name"])
-			pin := asString(p["in"])
-			required, _ := p["required"].(bool)
-			schemaText := schemaToText(p["schema"])
-			fmt.Printf("  - %s (%s), required=%t, schema=%s\n", name, pin, required, schemaText)
+		for _, p := range op.Parameters {
+			fmt.Printf("  - %s (%s), required=%t, schema=%s\n", p.Name, p.In, p.Required, schemaToText(p.Schema))
 		}
 	}
 
 	fmt.Println("\nREQUEST BODY:")
-	rb, ok := asMap(raw["requestBody"])
+	rb, ok := agentapi.AsMap(raw["requestBody"])
 	if !ok {
 		fmt.Println("  -")
 	} else {
 		required, _ := rb["required"].(bool)
 		fmt.Printf("  required=%t\n", required)
-		content, _ := asMap(rb["content"])
+		content, _ := agentapi.AsMap(rb["content"])
 		if len(content) == 0 {
 			fmt.Println("  content: -")
 		} else {
-			keys := sortedKeys(content)
+			keys := agentapi.SortedKeys(content)
 			for _, ctype := range keys {
-				cval, _ := asMap(content[ctype])
+				cval, _ := agentapi.AsMap(content[ctype])
 				schemaText := schemaToText(cval["schema"])
 				fmt.Printf("  - %s: %s\n", ctype, schemaText)
 			}
@@ -514,18 +304,18 @@ func PrintOperationDetails(op *Operation) {
 	}
 
 	fmt.Println("\nRESPONSES:")
-	responses, _ := asMap(raw["responses"])
+	responses, _ := agentapi.AsMap(raw["responses"])
 	if len(responses) == 0 {
 		fmt.Println("  -")
 		return
 	}
-	for _, status := range sortedKeys(responses) {
-		respObj, _ := asMap(responses[status])
-		desc := asString(respObj["description"])
+	for _, status := range agentapi.SortedKeys(responses) {
+		respObj, _ := agentapi.AsMap(responses[status])
+		desc := agentapi.AsString(respObj["description"])
 		fmt.Printf("  %s: %s\n", status, desc)
-		content, _ := asMap(respObj["content"])
-		for _, ctype := range sortedKeys(content) {
-			cval, _ := asMap(content[ctype])
+		content, _ := agentapi.AsMap(respObj["content"])
+		for _, ctype := range agentapi.SortedKeys(content) {
+			cval, _ := agentapi.AsMap(content[ctype])
 			schemaText := schemaToText(cval["schema"])
 			fmt.Printf("    - %s: %s\n", ctype, schemaText)
 		}
@@ -536,12 +326,65 @@ type acurlOptions struct {
 	TokenName string
 	Data      string
 	Headers   []string
+	// Query holds "key=value" params appended to the path, values expanded
+	// by expandQueryValue.
+	Query  []string
+	Record string
+	Replay string
+	// Snapshot names a golden response to create or compare against.
+	Snapshot       string
+	SnapshotIgnore []string
+	UpdateSnapshot bool
+	// MaxBytes caps the printed body; 0 prints all of it.
+	MaxBytes int64
+	// Edit composes the body in $VISUAL/$EDITOR before sending.
+	Edit bool
+	// Format renders an array response as a table (see ArrayTable) instead
+	// of printing the body; Fields picks its columns.
+	Format string
+	Fields []string
+	// Raw prints XML and HTML bodies as received; XMLJSON converts XML
+	// bodies to JSON instead of indenting them.
+	Raw     bool
+	XMLJSON bool
+	// Summarize prints the structure of the body (see bodySummarizer)
+	// instead of the body.
+	Summarize bool
+	// Accept is sent as the Accept header instead of application/json.
+	Accept string
+	// Reuse prints the response of an identical GET made moments ago, if
+	// there is one, instead of calling again.
+	Reuse bool
+	// Soft sends the env's soft_delete request in place of a DELETE.
+	Soft bool
+	// Plan prints a DeletePlan instead of sending a DELETE.
+	Plan bool
+	// ReadFallback sends the GET of the path when api_mode blocks the
+	// write (see blockedWrite).
+	ReadFallback bool
+	// FollowCreated prints the GET of the Location a write answers with
+	// (201, 202 or 3xx) instead of the write's own response.
+	FollowCreated bool
+	// PatchOps ("replace /price 9.99") and Merge build a JSON Patch or a
+	// JSON Merge Patch body (see applyPatchOptions).
+	PatchOps []string
+	Merge    string
+	// ContentType sends -d converted from JSON to a binary media type (see
+	// codecs); ProtoDescriptors are the descriptor sets protobuf needs.
+	ContentType      string
+	ProtoDescriptors []string
 }
 
+// normalizeMethodAndPath splits "[METHOD] <path> ..."; method is "" when
+// omitted, for the caller to default or infer. As with curl, the method
+// may also be given as -X/--request METHOD.
 func normalizeMethodAndPath(args []string) (method string, path string, rest []string, err error) {
 	if len(args) == 0 {
 		return "", "", nil, NewCliError(ExitRequestBuild, "acurl requires [METHOD] <path>")
 	}
+	if (args[0] == "-X" || args[0] == "--request") && len(args) > 1 {
+		args = args[1:]
+	}
 	first := strings.TrimSpace(args[0])
 	if _, ok := httpMethods[strings.ToUpper(first)]; ok {
 		if len(args) < 2 {
@@ -551,7 +394,6 @@ func normalizeMethodAndPath(args []string) (method string, path string, rest []s
 		path = args[1]
 		rest = args[2:]
 	} else {
-		method = "GET"
 		path = args[0]
 		rest = args[1:]
 	}
@@ -561,6 +403,27 @@ func normalizeMethodAndPath(args []string) (method string, path string, rest []s
 	return method, path, rest, nil
 }
 
+// inferMethod picks the method of a call that names none: GET, unless the
+// spec defines operations for path and none of them is a GET. A write is
+// never implied, so that case is an error listing the operations.
+func inferMethod(spec map[string]any, path string) (string, error) {
+	ops := agentapi.OperationsForPath(spec, path)
+	routes := make([]string, len(ops))
+	for i, op := range ops {
+		if op.Method == "GET" {
+			return "GET", nil
+		}
+		routes[i] = op.Method + " " + op.Path
+		if op.OperationID != "" {
+			routes[i] += " (" + op.OperationID + ")"
+		}
+	}
+	if len(ops) == 0 {
+		return "GET", nil
+	}
+	return "", NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("No method given and %s has no GET operation: %s", path, strings.Join(routes, ", ")), fmt.Sprintf("Give the method with the path, e.g. %s %s.", ops[0].Method, path))
+}
+
 func parseACurlOptions(rest []string) (*acurlOptions, error) {
 	opts := &acurlOptions{}
 	for i := 0; i < len(rest); i++ {
@@ -584,6 +447,111 @@ func parseACurlOptions(rest []string) (*acurlOptions, error) {
 				return nil, NewCliError(ExitRequestBuild, "Missing value for -H/--header")
 			}
 			opts.Headers = append(opts.Headers, rest[i])
+		case "--query":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --query")
+			}
+			opts.Query = append(opts.Query, rest[i])
+		case "--record":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --record")
+			}
+			opts.Record = rest[i]
+		case "--replay":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --replay")
+			}
+			opts.Replay = rest[i]
+		case "--snapshot":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --snapshot")
+			}
+			opts.Snapshot = rest[i]
+		case "--snapshot-ignore":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --snapshot-ignore")
+			}
+			opts.SnapshotIgnore = append(opts.SnapshotIgnore, rest[i])
+		case "--update-snapshot":
+			opts.UpdateSnapshot = true
+		case "--edit":
+			opts.Edit = true
+		case "--accept":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --accept")
+			}
+			opts.Accept = rest[i]
+		case "--reuse":
+			opts.Reuse = true
+		case "--soft":
+			opts.Soft = true
+		case "--plan":
+			opts.Plan = true
+		case "--read-fallback":
+			opts.ReadFallback = true
+		case "--follow-created":
+			opts.FollowCreated = true
+		case "--patch-op":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --patch-op")
+			}
+			opts.PatchOps = append(opts.PatchOps, rest[i])
+		case "--merge":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --merge")
+			}
+			opts.Merge = rest[i]
+		case "--content-type":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --content-type")
+			}
+			opts.ContentType = rest[i]
+		case "--proto-descriptor":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --proto-descriptor")
+			}
+			opts.ProtoDescriptors = append(opts.ProtoDescriptors, rest[i])
+		case "--raw":
+			opts.Raw = true
+		case "--xml-json":
+			opts.XMLJSON = true
+		case "--summarize":
+			opts.Summarize = true
+		case "--format":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			if _, err := LookupFormatter(rest[i]); err != nil {
+				return nil, err
+			}
+			opts.Format = rest[i]
+		case "--fields":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --fields")
+			}
+			opts.Fields = splitFields(rest[i])
+		case "--max-bytes":
+			i++
+			if i >= len(rest) {
+				return nil, NewCliError(ExitRequestBuild, "Missing value for --max-bytes")
+			}
+			n, err := strconv.ParseInt(rest[i], 10, 64)
+			if err != nil || n < 1 {
+				return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --max-bytes: %s (expected a positive integer)", rest[i]))
+			}
+			opts.MaxBytes = n
 		default:
 			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown acurl option: %s", a))
 		}
@@ -591,286 +559,391 @@ func parseACurlOptions(rest []string) (*acurlOptions, error) {
 	return opts, nil
 }
 
-func headersListToMap(items []string) (map[string]string, error) {
-	out := make(map[string]string)
-	for _, h := range items {
-		parts := strings.SplitN(h, ":", 2)
-		if len(parts) != 2 {
-			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid header format (expected 'Key: Value'): %s", h))
-		}
-		k := strings.TrimSpace(parts[0])
-		v := strings.TrimSpace(parts[1])
-		if k == "" {
-			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid header key: %s", h))
-		}
-		out[k] = v
-	}
-	return out, nil
+func emitCompactBackendPayload(raw []byte) {
+	cw := newCompactWriter(os.Stdout, 0)
+	_, _ = cw.Write(raw)
+	_ = cw.Close()
 }
 
-func enforceMode(cfg *ResolvedConfig, method string, body string) error {
-	allowed := map[string]struct{}{}
-	switch cfg.APIMode {
-	case "read-only":
-		allowed["GET"] = struct{}{}
-	case "safe-updates":
-		allowed["GET"] = struct{}{}
-		allowed["POST"] = struct{}{}
-		allowed["PUT"] = struct{}{}
-		allowed["PATCH"] = struct{}{}
-	default: // full-access
-		for m := range httpMethods {
-			allowed[m] = struct{}{}
-		}
-	}
-	if _, ok := allowed[method]; !ok {
-		return NewCliError(ExitBlockedByMode, fmt.Sprintf("Method %s blocked by api_mode=%s", method, cfg.APIMode))
-	}
-	if cfg.APIMode == "safe-updates" && (method == "POST" || method == "PUT" || method == "PATCH") {
-		if body == "" || !strings.Contains(body, cfg.AgentMarker) {
-			return NewCliError(ExitMarkerMissing, fmt.Sprintf("Missing required agent_marker '%s' in request body", cfg.AgentMarker))
-		}
+func RunAPI(configPath string, args []string) (err error) {
+	args, globalOpts, err := extractGlobalFlags(args)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func normalizeSegments(path string) []string {
-	if path != "/" && strings.HasSuffix(path, "/") {
-		path = strings.TrimSuffix(path, "/")
+	jsonErrors = globalOpts.JSONErrors
+	wideTables = globalOpts.Wide
+	closeLog, err := configureLogging(globalOpts)
+	if err != nil {
+		return err
 	}
-	stripped := strings.Trim(path, "/")
-	if stripped == "" {
-		return []string{}
+	defer closeLog()
+	if err := enableChaos(globalOpts); err != nil {
+		return err
 	}
-	return strings.Split(stripped, "/")
-}
-
-func matchOpenAPIPath(templatePath, requestPath string) (map[string]string, bool) {
-	tSeg := normalizeSegments(templatePath)
-	rSeg := normalizeSegments(requestPath)
-	if len(tSeg) != len(rSeg) {
-		return nil, false
-	}
-	params := make(map[string]string)
-	for i := range tSeg {
-		ts := tSeg[i]
-		rs := rSeg[i]
-		if strings.HasPrefix(ts, "{") && strings.HasSuffix(ts, "}") && len(ts) > 2 {
-			name := strings.TrimSpace(ts[1 : len(ts)-1])
-			if name == "" || rs == "" {
-				return nil, false
-			}
-			decoded, err := url.PathUnescape(rs)
-			if err != nil {
-				return nil, false
-			}
-			params[name] = decoded
-		} else if ts != rs {
-			return nil, false
-		}
+	if err := enableOffline(configPath, globalOpts); err != nil {
+		return err
 	}
-	return params, true
-}
 
-func mergeParameters(pathItem map[string]any, op map[string]any) []map[string]any {
-	merged := make(map[string]map[string]any)
-	for _, source := range []any{pathItem["parameters"], op["parameters"]} {
-		items, _ := asSlice(source)
-		for _, pAny := range items {
-			p, ok := asMap(pAny)
-			if !ok {
-				continue
-			}
-			name := asString(p["name"])
-			pin := asString(p["in"])
-			if name == "" || pin == "" {
-				continue
-			}
-			merged[pin+":"+name] = p
-		}
-	}
-	out := make([]map[string]any, 0, len(merged))
-	for _, p := range merged {
-		out = append(out, p)
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Println(APIHelp)
+		return nil
 	}
-	return out
-}
 
-func ValidateAgainstOpenAPI(spec map[string]any, method string, pathWithQuery string) error {
-	pathsAny, ok := asMap(spec["paths"])
-	if !ok {
-		return NewCliError(ExitOpenAPIParse, "OpenAPI spec is missing a valid 'paths' object")
+	if args[0] == completeCommand {
+		return runComplete(configPath, "api", args[1:])
 	}
-	u, err := url.Parse(pathWithQuery)
-	if err != nil {
-		return NewCliError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err))
-	}
-	requestPath := u.Path
-	query := u.Query()
-
-	methodKey := strings.ToLower(method)
-	var matchedTemplate string
-	var matchedPathItem map[string]any
-	var matchedOp map[string]any
-	matchedPathParams := map[string]string{}
-
-	for templatePath, pathItemAny := range pathsAny {
-		pathItem, ok := asMap(pathItemAny)
-		if !ok {
-			continue
-		}
-		opAny, ok := pathItem[methodKey]
-		if !ok {
-			continue
-		}
-		op, ok := asMap(opAny)
-		if !ok {
-			continue
-		}
-		params, matched := matchOpenAPIPath(templatePath, requestPath)
-		if !matched {
-			continue
-		}
-		matchedTemplate = templatePath
-		matchedPathItem = pathItem
-		matchedOp = op
-		matchedPathParams = params
-		break
-	}
-	if matchedTemplate == "" {
-		return NewCliError(ExitRequestBuild, fmt.Sprintf("Strict mode: endpoint not found in OpenAPI spec for %s %s", method, requestPath))
-	}
-
-	missing := make([]string, 0)
-	for _, p := range mergeParameters(matchedPathItem, matchedOp) {
-		name := asString(p["name"])
-		pin := asString(p["in"])
-		required, _ := p["required"].(bool)
-		if !required || name == "" || pin == "" {
-			continue
-		}
-		switch pin {
-		case "path":
-			if strings.TrimSpace(matchedPathParams[name]) == "" {
-				missing = append(missing, "path:"+name)
-			}
-		case "query":
-			vals, ok := query[name]
-			if !ok || len(vals) == 0 {
-				missing = append(missing, "query:"+name)
-				continue
-			}
-			nonEmpty := false
-			for _, v := range vals {
-				if strings.TrimSpace(v) != "" {
-					nonEmpty = true
-					break
-				}
-			}
-			if !nonEmpty {
-				missing = append(missing, "query:"+name)
-			}
+	if args[0] == "completion" {
+		if len(args) < 2 {
+			return NewCliError(ExitRequestBuild, "Usage: api completion <bash|zsh|fish>")
 		}
+		return PrintCompletionScript(args[1])
 	}
-	if len(missing) > 0 {
-		return NewCliError(ExitRequestBuild, fmt.Sprintf("Strict mode: missing required params: %s", strings.Join(missing, ", ")))
+	if args[0] == "version" || args[0] == "--version" {
+		return RunVersion(args[1:])
 	}
-	return nil
-}
-
-func emitCompactBackendPayload(raw []byte) {
-	trimmed := bytes.TrimSpace(raw)
-	if len(trimmed) == 0 {
-		return
+	if args[0] == "config" {
+		return RunConfigCommand(configPath, args[1:])
 	}
-	var compact bytes.Buffer
-	if json.Compact(&compact, trimmed) == nil {
-		_, _ = os.Stdout.Write(compact.Bytes())
-		_, _ = os.Stdout.Write([]byte("\n"))
-		return
+	if args[0] == "project" {
+		return RunProjectCommand(configPath, args[1:])
 	}
-	_, _ = os.Stdout.Write(trimmed)
-	_, _ = os.Stdout.Write([]byte("\n"))
-}
-
-func RunAPI(configPath string, args []string) error {
-	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
-		fmt.Println(APIHelp)
-		return nil
+	if args[0] == "env" {
+		return RunEnvCommand(configPath, args[1:])
+	}
+	if args[0] == "self-update" {
+		if globalOpts.Offline != "" {
+			return NewCliError(ExitRequestBuild, "self-update needs the network; drop --offline")
+		}
+		defer cancelOnSignal()()
+		return RunSelfUpdate(args[1:])
 	}
 
-	cfg, err := ResolveConfig(configPath)
+	cmd := args[0]
+	endTrace := enableTracing("api", cmd, !selfSignalledCommands[cmd])
+	defer func() { endTrace(err) }()
+	cfg, err := loadTracedConfig(configPath)
 	if err != nil {
 		return err
 	}
+	if args, err = expandAlias(cfg, args); err != nil {
+		return err
+	}
+	cmd = args[0]
 
-	cmd := args[0]
+	if !selfSignalledCommands[cmd] {
+		defer cancelOnSignal()()
+	}
 	switch cmd {
 	case "find":
 		if len(args) < 2 {
-			return NewCliError(ExitRequestBuild, "Usage: api find <query> [--method <HTTP_METHOD>]")
+			return NewCliError(ExitRequestBuild, findUsage)
 		}
 		queryParts := make([]string, 0)
-		methodFilter := ""
+		methodFilter, format, envList, envTag := "", "table", "", ""
+		all, groupVersions, noHistory := false, false, false
+		concurrency := agentapi.DefaultPullConcurrency
+		limit, offset := agentapi.DefaultSearchLimit, 0
 		for i := 1; i < len(args); i++ {
 			a := args[i]
-			if a == "--method" {
-				i++
-				if i >= len(args) {
-					return NewCliError(ExitRequestBuild, "Missing value for --method")
-				}
+			switch a {
+			case "--all":
+				all = true
+				continue
+			case "--group-versions":
+				groupVersions = true
+				continue
+			case "--no-history":
+				noHistory = true
+				continue
+			case "--format", "--method", "--envs", "--env-tag", "--concurrency", "--limit", "--offset":
+			default:
+				queryParts = append(queryParts, a)
+				continue
+			}
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", a))
+			}
+			switch a {
+			case "--format":
+				format = args[i]
+			case "--method":
 				m := strings.ToUpper(strings.TrimSpace(args[i]))
 				if _, ok := httpMethods[m]; !ok {
 					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid HTTP method for --method: %s", m))
 				}
 				methodFilter = m
-				continue
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			case "--concurrency":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --concurrency: %s (expected a positive integer)", args[i]))
+				}
+				concurrency = n
+			case "--limit", "--offset":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 0 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid %s: %s (expected a non-negative integer)", a, args[i]))
+				}
+				if a == "--limit" {
+					limit = n
+				} else {
+					offset = n
+				}
 			}
-			queryParts = append(queryParts, a)
 		}
 		query := strings.TrimSpace(strings.Join(queryParts, " "))
 		if query == "" {
 			return NewCliError(ExitRequestBuild, "Query cannot be empty")
 		}
-		spec, err := FetchOpenAPISpec(cfg.OpenAPIURL)
+		envList, err := taggedEnvList(configPath, envTag, envList, all)
 		if err != nil {
 			return err
 		}
-		ops := FindOperations(spec, query, methodFilter)
-		PrintFindResults(ops)
+		if all && envList != "" {
+			return NewCliError(ExitRequestBuild, "--all and --envs are mutually exclusive")
+		}
+		if _, err := LookupFormatter(format); err != nil {
+			return err
+		}
+		if all || envList != "" {
+			cfgs, err := selectEnvConfigs(configPath, cfg, all, envList)
+			if err != nil {
+				return err
+			}
+			matches, searches := agentapi.SearchSpecs(runCtx, cfgs, query, methodFilter, concurrency)
+			var others [][]string
+			if groupVersions {
+				matches, others = agentapi.GroupVersions(matches, func(m agentapi.SpecMatch) *Operation { return &m.Operation }, func(m agentapi.SpecMatch) string { return m.Env })
+				others, _ = agentapi.Page(others, offset, limit)
+			}
+			page, rest := agentapi.Page(matches, offset, limit)
+			if err := PrintSpecMatches(page, others, format); err != nil {
+				return err
+			}
+			notePage(len(matches), offset, len(page), rest)
+			return agentapi.SearchError(searches)
+		}
+		var ops []Operation
+		if d := daemonFor(cfg, globalOpts); d != nil {
+			found, err := d.Find(query, methodFilter)
+			if err != nil && err != errDaemonUnavailable {
+				return err
+			}
+			if found != nil && !noHistory {
+				// Scores are not sent over the socket; the history boost
+				// adds to them. Rescoring the matches gives the daemon's.
+				found = agentapi.SearchOperations(found, query, methodFilter)
+			}
+			ops = found
+		}
+		if ops == nil {
+			spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
+			if err != nil {
+				return err
+			}
+			ops = agentapi.FindOperations(spec, query, methodFilter)
+		}
+		if !noHistory {
+			ops = rankByHistory(cfg, ops)
+		}
+		var others [][]string
+		if groupVersions {
+			ops, others = agentapi.GroupVersions(ops, func(op Operation) *Operation { return &op }, func(Operation) string { return "" })
+			others, _ = agentapi.Page(others, offset, limit)
+		}
+		page, rest := agentapi.Page(ops, offset, limit)
+		if err := PrintFindResults(page, others, format); err != nil {
+			return err
+		}
+		notePage(len(ops), offset, len(page), rest)
 		return nil
 
 	case "show":
 		if len(args) < 2 {
-			return NewCliError(ExitRequestBuild, `Usage: api show <operationId|"METHOD /path">`)
+			return NewCliError(ExitRequestBuild, `Usage: api show <operationId|"METHOD /path"> [--resolved]`)
+		}
+		resolved := false
+		refParts := make([]string, 0, len(args)-1)
+		for _, a := range args[1:] {
+			if a == "--resolved" {
+				resolved = true
+				continue
+			}
+			refParts = append(refParts, a)
 		}
-		ref := strings.TrimSpace(strings.Join(args[1:], " "))
-		spec, err := FetchOpenAPISpec(cfg.OpenAPIURL)
+		ref := strings.TrimSpace(strings.Join(refParts, " "))
+		if ref == "" {
+			return NewCliError(ExitRequestBuild, `Usage: api show <operationId|"METHOD /path"> [--resolved]`)
+		}
+		if d := daemonFor(cfg, globalOpts); d != nil && resolved {
+			details, err := d.Show(ref)
+			if err != errDaemonUnavailable {
+				if err != nil {
+					return err
+				}
+				return printJSONIndent(details)
+			}
+		} else if d != nil {
+			op, err := d.Operation(ref)
+			if err != errDaemonUnavailable {
+				if err != nil {
+					return err
+				}
+				PrintOperationDetails(op)
+				return nil
+			}
+		}
+		spec, err := agentapi.LoadSpec(runCtx, cfg)
 		if err != nil {
 			return err
 		}
-		op, err := FindOperationByRef(spec, ref)
+		op, err := agentapi.FindOperationByRef(spec, ref)
 		if err != nil {
 			return err
 		}
+		if resolved {
+			ro, err := openResolvedCache(cfg, spec).resolve(spec, op)
+			if err != nil {
+				return err
+			}
+			return printJSONIndent(OperationDetails(op, ro))
+		}
 		PrintOperationDetails(op)
 		return nil
+
+	case "ui":
+		return RunUI(cfg)
+
+	case "proxy":
+		return RunProxy(cfg, args[1:])
+
+	case "test":
+		return RunTestCommand(cfg, args[1:])
+
+	case "scenario":
+		return RunScenarioCommand(cfg, args[1:])
+
+	case "listen":
+		return RunListen(cfg, args[1:])
+
+	case "serve":
+		return RunServe(cfg, args[1:])
+
+	case "daemon":
+		return RunDaemon(cfg, args[1:])
+
+	case "collection":
+		return RunCollectionCommand(cfg, args[1:])
+
+	case "schedule":
+		return RunScheduleCommand(cfg, args[1:])
+
+	case "seed":
+		return RunSeedCommand(cfg, args[1:])
+
+	case "diff-env":
+		return RunDiffEnv(configPath, args[1:])
+
+	case "edit":
+		return RunEditResource(cfg, args[1:])
+
+	case "resource":
+		return RunResourceCommand(cfg, globalOpts, args[1:])
+
+	case "health":
+		return RunHealth(configPath, args[1:])
+
+	case "spec":
+		return RunSpecCommand(configPath, cfg, args[1:])
+
+	case "graphql":
+		return RunGraphQLCommand(cfg, args[1:])
+
+	case "query":
+		return RunQueryCommand(cfg, args[1:])
+
+	case "assert":
+		return RunAssertCommand(cfg, args[1:])
+
+	case "describe-response":
+		return RunDescribeResponse(cfg, args[1:])
+
+	case "whoami":
+		return RunWhoami(cfg, args[1:])
+
+	case "token":
+		return RunTokenCommand(configPath, cfg, args[1:])
+
+	case "policy":
+		return RunPolicyCommand(cfg, args[1:])
+
+	case "call":
+		return RunCallCommand(cfg, args[1:])
+
+	case "session":
+		return RunSessionCommand(cfg, args[1:])
+
+	case "record":
+		return RunRecordCommand(cfg, args[1:])
+
+	case "import-curl":
+		return RunImportCurl(cfg, args[1:])
+
+	case "history":
+		return RunHistoryCommand(cfg, args[1:])
+
+	case "context":
+		return RunContextCommand(configPath, cfg, args[1:])
+
 	default:
-		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown api command: %s", cmd))
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown api command: %s%s", cmd, agentapi.DidYouMean(cmd, append(aliasNames(cfg), apiCommands...))))
 	}
 }
 
-func RunACurl(configPath string, args []string) error {
+func RunACurl(configPath string, args []string) (err error) {
+	args, globalOpts, err := extractGlobalFlags(args)
+	if err != nil {
+		return err
+	}
+	jsonErrors = globalOpts.JSONErrors
+	closeLog, err := configureLogging(globalOpts)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	if err := enableChaos(globalOpts); err != nil {
+		return err
+	}
+	if err := enableOffline(configPath, globalOpts); err != nil {
+		return err
+	}
+
 	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
 		fmt.Println(ACurlHelp)
 		return nil
 	}
+	if args[0] == "--version" {
+		return RunVersion(args[1:])
+	}
+	if args[0] == completeCommand {
+		return runComplete(configPath, "acurl", args[1:])
+	}
+	endTrace := enableTracing("acurl", "", true)
+	defer func() { endTrace(err) }()
+	defer cancelOnSignal()()
 
-	cfg, err := ResolveConfig(configPath)
+	cfg, err := loadTracedConfig(configPath)
 	if err != nil {
 		return err
 	}
 
+	if args, err = expandLastLocation(cfg, args); err != nil {
+		return err
+	}
 	method, path, rest, err := normalizeMethodAndPath(args)
 	if err != nil {
 		return err
@@ -879,65 +952,265 @@ func RunACurl(configPath string, args []string) error {
 	if err != nil {
 		return err
 	}
+	return sendACurl(cfg, globalOpts, method, path, opts, "acurl")
+}
 
-	if err := enforceMode(cfg, method, opts.Data); err != nil {
+// sendACurl sends one acurl call and prints its response; method is
+// inferred from the spec when empty. Source labels the history entry.
+func sendACurl(cfg *ResolvedConfig, globalOpts GlobalOptions, method, path string, opts *acurlOptions, source string) (err error) {
+	if opts.Record != "" && opts.Replay != "" {
+		return NewCliError(ExitRequestBuild, "--record and --replay are mutually exclusive")
+	}
+	if opts.Snapshot == "" && (opts.UpdateSnapshot || len(opts.SnapshotIgnore) > 0) {
+		return NewCliError(ExitRequestBuild, "--update-snapshot and --snapshot-ignore require --snapshot <name>")
+	}
+	if opts.Format == "" && len(opts.Fields) > 0 {
+		return NewCliError(ExitRequestBuild, "--fields requires --format <name>")
+	}
+	if opts.Raw && opts.XMLJSON {
+		return NewCliError(ExitRequestBuild, "--raw and --xml-json are mutually exclusive")
+	}
+	if opts.Summarize && (opts.Format != "" || opts.Snapshot != "") {
+		return NewCliError(ExitRequestBuild, "--summarize cannot be combined with --format or --snapshot")
+	}
+	if opts.Accept != "" {
+		for _, h := range opts.Headers {
+			if k, _, _ := strings.Cut(h, ":"); strings.EqualFold(strings.TrimSpace(k), "Accept") {
+				return NewCliError(ExitRequestBuild, "--accept and -H \"Accept: ...\" both set the Accept header; use one")
+			}
+		}
+		opts.Headers = append(opts.Headers, "Accept: "+opts.Accept)
+	}
+	if path, err = appendQuery(path, opts.Query); err != nil {
 		return err
 	}
-	if cfg.Strict {
-		spec, err := FetchOpenAPISpec(cfg.OpenAPIURL)
+	if len(opts.PatchOps) > 0 || opts.Merge != "" {
+		if method, err = applyPatchOptions(cfg, method, path, opts); err != nil {
+			return err
+		}
+	}
+	if method == "" {
+		spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
 		if err != nil {
+			// Without a spec there is nothing to infer from; keep GET.
+			logger.Debug("method not inferred, spec unavailable", "error", err)
+			method = "GET"
+		} else if method, err = inferMethod(spec, path); err != nil {
 			return err
 		}
-		if err := ValidateAgainstOpenAPI(spec, method, path); err != nil {
+	}
+	if opts.Plan {
+		switch {
+		case method != http.MethodDelete:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("--plan previews a DELETE, not %s", method))
+		case opts.Soft:
+			return NewCliError(ExitRequestBuild, "--plan and --soft are mutually exclusive")
+		}
+		return planDelete(cfg, path, opts.TokenName)
+	}
+	if opts.Soft {
+		switch {
+		case method != http.MethodDelete:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("--soft replaces a DELETE, not %s", method))
+		case cfg.SoftDelete == nil:
+			return NewCliErrorHint(ExitConfig, fmt.Sprintf("No soft_delete declared for %s/%s", cfg.ActiveProject, cfg.ActiveEnv), fmt.Sprintf(`Declare how the API archives under [projects.%s.envs.%s.soft_delete], e.g. method = "PATCH" and body = { status = "archived" }.`, cfg.ActiveProject, cfg.ActiveEnv))
+		case opts.Data != "" || opts.Edit:
+			return NewCliError(ExitRequestBuild, "--soft sends the body declared in soft_delete; drop -d/--edit")
+		}
+		method, path, opts.Data = cfg.SoftDelete.Request(path, cfg.AgentMarker)
+		infof("Soft delete: %s %s %s instead of DELETE.\n", method, path, opts.Data)
+	}
+	if err := agentapi.EnforceMode(cfg, method, opts.Data); ExitCode(err) == ExitBlockedByMode {
+		return blockedWrite(cfg, globalOpts, method, path, opts, source, err)
+	}
+	if opts.Edit {
+		if opts.Data, err = editBody(cfg, method, path, opts.Data); err != nil {
 			return err
 		}
 	}
 
-	_, tokenValue, err := ResolveToken(cfg, opts.TokenName)
-	if err != nil {
-		return err
+	if opts.ContentType != "" {
+		if err := applyContentType(opts); err != nil {
+			return err
+		}
+	}
+	if opts.TokenName != "" {
+		warnTokenSecurity(cfg, method, path, opts.TokenName)
 	}
 
-	headers, err := headersListToMap(opts.Headers)
-	if err != nil {
-		return err
+	headers, requestID := agentapi.WithRequestID(cfg, opts.Headers)
+	apiReq := APIRequest{
+		Method:    method,
+		Path:      path,
+		TokenName: opts.TokenName,
+		Body:      opts.Data,
+		Headers:   headers,
+		Source:    source,
 	}
-	if _, ok := headers["Authorization"]; !ok {
-		headers["Authorization"] = "Bearer " + tokenValue
+	if opts.Record != "" {
+		c, err := OpenRecordCassette(opts.Record)
+		if err != nil {
+			return err
+		}
+		c.redact, apiReq.Transport = cfg.RedactFields, c
 	}
-	if _, ok := headers["Accept"]; !ok {
-		headers["Accept"] = "application/json"
+	if opts.Replay != "" {
+		if apiReq.Transport, err = OpenReplayCassette(opts.Replay); err != nil {
+			return err
+		}
+		apiReq.Offline = true
+	}
+
+	// An identical GET moments ago is usually an agent that lost track of
+	// its last response: say so, and with --reuse print that response.
+	var reused *HistoryEntry
+	if method == http.MethodGet && apiReq.Transport == nil && offline == nil {
+		if dup := recentDuplicate(cfg, requestFingerprint(cfg, apiReq), duplicateWindow); dup != nil {
+			age := time.Since(dup.Time).Round(time.Second)
+			if opts.Reuse && !dup.Truncated && !dup.MetadataOnly {
+				reused = dup
+				infof("Reusing the response of the same GET %s ago (history:%s); nothing was sent.\n", age, dup.ID)
+			} else if !opts.Reuse {
+				infof("The same GET ran %s ago (history:%s, HTTP %d); --reuse prints that response instead of calling again.\n", age, dup.ID, dup.Status)
+			}
+		}
 	}
 
-	var body io.Reader
-	if opts.Data != "" {
-		body = strings.NewReader(opts.Data)
-		if _, ok := headers["Content-Type"]; !ok {
-			headers["Content-Type"] = "application/json"
+	// The body is printed as it arrives, except for --snapshot, which
+	// compares the whole of it, and --format, which lays it out.
+	out := newCompactWriter(os.Stdout, opts.MaxBytes)
+	defer out.Close()
+	var sink io.Writer = out
+	render := func(h http.Header) io.Writer {
+		out.verbatim = verbatimBody(h.Get("Content-Type"), opts.Accept)
+		sink = bodyWriter(out, h, opts)
+		return sink
+	}
+	// A body acurl has a codec for (msgpack, CBOR, protobuf) is buffered
+	// and printed as JSON once decoded, unless --raw.
+	decodes := func(h http.Header) bool { return !opts.Raw && hasCodec(h.Get("Content-Type")) }
+	var summary *bodySummarizer
+	switch {
+	case opts.Summarize:
+		apiReq.Stream = func(status int, h http.Header) io.Writer {
+			if decodes(h) {
+				return nil
+			}
+			summary = newBodySummarizer(status, h.Get("Content-Type"))
+			return summary
+		}
+	case opts.Snapshot == "" && opts.Format == "":
+		apiReq.Stream = func(_ int, h http.Header) io.Writer {
+			if decodes(h) {
+				return nil
+			}
+			return render(h)
 		}
 	}
 
-	fullURL := cfg.APIBase + path
-	req, err := http.NewRequest(method, fullURL, body)
-	if err != nil {
-		return NewCliError(ExitRequestBuild, fmt.Sprintf("Request build error: %v", err))
+	// With --follow-created a write answered with a Location is not
+	// printed: the GET of that Location is.
+	follows := func(status int, h http.Header) bool {
+		return opts.FollowCreated && strings.HasPrefix(createdLocation(cfg, cfg.BuildURL(path), status, h), "/")
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	if stream := apiReq.Stream; stream != nil && opts.FollowCreated {
+		apiReq.Stream = func(status int, h http.Header) io.Writer {
+			if follows(status, h) {
+				return io.Discard
+			}
+			return stream(status, h)
+		}
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	var resp *APIResponse
+	err = errDaemonUnavailable
+	start := time.Now()
+	if reused != nil {
+		resp, err = storedResponse(reused), nil
+		requestID, apiReq.Stream = reused.RequestID, nil
+	} else if d := daemonFor(cfg, globalOpts); d != nil && apiReq.Transport == nil {
+		// The daemon sends the request: hand it this run's trace.
+		call := apiReq
+		if tp := agentapi.TraceParent(runCtx); tp != "" {
+			call.Headers = append(call.Headers[:len(call.Headers):len(call.Headers)], "traceparent: "+tp)
+		}
+		resp, err = d.Call(call)
+	}
+	if err == errDaemonUnavailable {
+		resp, err = PerformRequest(cfg, apiReq)
+	}
 	if err != nil {
-		return NewCliError(ExitUnexpected, fmt.Sprintf("HTTP request failed: %v", err))
+		return err
+	}
+	contentType, decoded := resp.Header.Get("Content-Type"), false
+	if decodes(resp.Header) {
+		if err := decodeResponse(resp, opts, cfg.RedactFields); err != nil {
+			infof("Cannot decode the %s body, printing it as received: %v\n", contentType, err)
+		} else {
+			decoded = true
+		}
+	}
+	var next *NextPage
+	if resp.StatusCode < 400 {
+		body := resp.Body
+		if resp.Size > int64(len(body)) {
+			body = nil // only a prefix of a streamed body is kept
+		}
+		next = detectNextPage(resp.Header, body)
+	}
+	location := createdLocation(cfg, cfg.BuildURL(path), resp.StatusCode, resp.Header)
+	switch {
+	case follows(resp.StatusCode, resp.Header):
+	case opts.Summarize:
+		if summary == nil {
+			summary = newBodySummarizer(resp.StatusCode, resp.Header.Get("Content-Type"))
+			_, _ = summary.Write(resp.Body)
+		}
+		s := summary.Summary()
+		s.NextPage = next
+		s.RequestBytes, s.DurationMS = int64(len(apiReq.Body)), time.Since(start).Milliseconds()
+		if reused != nil {
+			s.DurationMS = reused.DurationMS
+		}
+		if err := s.Print(os.Stdout); err != nil {
+			return err
+		}
+	case apiReq.Stream != nil && !decoded:
+	case opts.Format != "" && resp.StatusCode < 400:
+		// Error bodies are printed as they are: they are rarely arrays.
+		if err := printArray(resp.Body, opts.Format, opts.Fields); err != nil {
+			return err
+		}
+	default:
+		_, _ = render(resp.Header).Write(resp.Body)
+	}
+	if m, ok := sink.(*markupRenderer); ok {
+		_ = m.Close()
+	}
+	_ = out.Close()
+	if out.truncated {
+		logger.Warn("output truncated by --max-bytes", "max_bytes", opts.MaxBytes, "read_bytes", resp.Size)
+	}
+	reportRequestID(requestID, agentapi.ResponseRequestID(cfg, resp.Header))
+	if opts.Accept != "" && resp.StatusCode < 400 && !acceptMatches(opts.Accept, contentType) {
+		infof("Asked for %s but the response is %s.\n", opts.Accept, contentType)
+	}
+	if next != nil && !opts.Summarize {
+		infof("%s\n", nextPageHint(cfg, method, next))
+	}
+	switch {
+	case follows(resp.StatusCode, resp.Header):
+		infof("%s %s answered %d; following its Location: GET %s\n", method, path, resp.StatusCode, location)
+		return sendACurl(cfg, globalOpts, http.MethodGet, location, readOptions(opts), source)
+	case location != "" && method != http.MethodGet:
+		infof("Location: %s (%s in later calls; --follow-created GETs it)\n", location, lastLocationVar)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return NewCliError(ExitUnexpected, fmt.Sprintf("HTTP request failed: %v", err))
+	if opts.Snapshot != "" {
+		if err := CheckSnapshot(cfg, opts.Snapshot, method, path, resp, opts.SnapshotIgnore, opts.UpdateSnapshot); err != nil {
+			return err
+		}
 	}
-	emitCompactBackendPayload(respBody)
 
 	if resp.StatusCode >= 400 {
 		return NewCliError(ExitHTTPErrorStatus, "")
@@ -945,52 +1218,162 @@ func RunACurl(configPath string, args []string) error {
 	return nil
 }
 
-func asMap(v any) (map[string]any, bool) {
-	m, ok := v.(map[string]any)
-	if ok {
-		return m, true
-	}
-	// yaml can produce map[interface{}]interface{} in some cases
-	m2, ok := v.(map[any]any)
-	if !ok {
-		return nil, false
-	}
-	out := make(map[string]any, len(m2))
-	for k, val := range m2 {
-		ks, ok := k.(string)
-		if !ok {
-			continue
-		}
-		out[ks] = val
-	}
-	return out, true
+// APIRequest is a single call against the active env, relative to api_base.
+type APIRequest struct {
+	Method    string
+	Path      string
+	TokenName string
+	Body      string
+	Headers   []string
+	// Transport overrides the default HTTP transport (e.g. a cassette).
+	Transport http.RoundTripper
+	// Offline validates strict mode against the cached spec instead of
+	// fetching it.
+	Offline bool
+	// Spec, when set, is used for strict validation as-is (long-running
+	// commands load it once).
+	Spec map[string]any
+	// Source labels the history entry (e.g. "schedule:<id>").
+	Source string
+	// Stream, when set, receives the body as it arrives (see
+	// agentapi.Request.Stream); the response then holds only a prefix.
+	// While redact_fields is set, JSON bodies reach it only once masked.
+	Stream func(status int, header http.Header) io.Writer
+	// Unredacted leaves redact_fields out of the returned body, for a
+	// caller that writes the body back; the history is masked regardless.
+	Unredacted bool
+	// Raw allows any method and skips strict mode (agentapi.Request.Raw).
+	Raw bool
 }
 
-func asSlice(v any) ([]any, bool) {
-	s, ok := v.([]any)
-	if ok {
-		return s, true
+// reportRequestID prints the id to look a call up by in the backend's
+// logs: the one the backend answered with, else the one sent.
+func reportRequestID(sent, server string) {
+	switch {
+	case server != "" && sent != "" && server != sent:
+		infof("Request id: %s (sent %s)\n", server, sent)
+	case server != "":
+		infof("Request id: %s\n", server)
+	case sent != "":
+		infof("Request id: %s\n", sent)
 	}
-	return nil, false
 }
 
-func asString(v any) string {
-	s, _ := v.(string)
-	return s
+// policySpec loads the spec for strict validation of r: r.Spec when set,
+// otherwise the (cached, when Offline) spec of the env.
+func policySpec(cfg *ResolvedConfig, r APIRequest) (map[string]any, error) {
+	if !cfg.Strict || r.Raw {
+		return nil, nil
+	}
+	if r.Spec != nil {
+		metrics.Inc("agent_api_spec_cache_requests_total", "result", "hit")
+		return r.Spec, nil
+	}
+	metrics.Inc("agent_api_spec_cache_requests_total", "result", "miss")
+	if r.Offline {
+		return agentapi.LoadCachedSpecPaths(cfg)
+	}
+	return agentapi.LoadSpecPaths(runCtx, cfg)
 }
 
-func sortedKeys(m map[string]any) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+// CheckPolicy evaluates api_mode and required_headers and, when strict is
+// on, validates the request against the spec, without sending anything.
+func CheckPolicy(cfg *ResolvedConfig, r APIRequest) error {
+	if err := agentapi.EnforceMode(cfg, r.Method, r.Body); err != nil {
+		return err
+	}
+	if err := agentapi.EnforceHeaders(cfg, r.Method, r.Headers); err != nil {
+		return err
 	}
-	sort.Strings(keys)
-	return keys
+	if !cfg.Strict {
+		return nil
+	}
+	spec, err := policySpec(cfg, r)
+	if err != nil {
+		return err
+	}
+	return agentapi.ValidateAgainstOpenAPI(spec, r.Method, r.Path)
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// PerformRequest applies api_mode and strict guardrails, injects the token
+// and executes the request through agentapi.Client. Shared by acurl and the
+// interactive commands. Every request that reaches the network is appended
+// to the history.
+func PerformRequest(cfg *ResolvedConfig, r APIRequest) (*APIResponse, error) {
+	enforce := agentapi.EnforceMode
+	if r.Raw {
+		enforce = agentapi.EnforceRawMode
+	}
+	if err := enforce(cfg, r.Method, r.Body); err != nil {
+		return nil, err
+	}
+	spec, err := policySpec(cfg, r)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := r.Transport
+	if transport == nil && offline != nil {
+		transport = offline
+	}
+	if chaos != nil && !r.Offline && offline == nil {
+		transport = chaos.Wrap(transport)
+	}
+	if transport != nil {
+		transport = traced(transport)
+	}
+	// A body that may carry redact_fields is masked whole, so it is
+	// buffered and handed to r.Stream after the call.
+	stream, buffered := r.Stream, false
+	if len(cfg.RedactFields) > 0 && r.Stream != nil {
+		stream = func(status int, h http.Header) io.Writer {
+			if maskableBody(h.Get("Content-Type")) {
+				buffered = true
+				return nil
+			}
+			return r.Stream(status, h)
+		}
+	}
+	client := &agentapi.Client{
+		Config:    cfg,
+		Transport: transport,
+		Spec:      spec,
+		OnExchange: func(x agentapi.Exchange) {
+			entry := HistoryEntry{Time: x.Start, Source: r.Source, Method: r.Method, URL: x.Request.URL.String(), RequestHeaders: redactHeaders(x.Request.Header), RequestBody: string(redactEncoded(cfg.RedactFields, x.Request.Header.Get("Content-Type"), []byte(x.RequestBody))), RequestBytes: int64(len(x.RequestBody)), DurationMS: x.Duration.Milliseconds()}
+			entry.Token, entry.Fingerprint = r.TokenName, requestFingerprint(cfg, r)
+			if entry.Token == "" {
+				entry.Token = cfg.DefaultTokenName
+			}
+			if cfg.RequestIDHeader != "" {
+				entry.RequestID = x.Request.Header.Get(cfg.RequestIDHeader)
+			}
+			if x.Err != nil {
+				entry.Error = x.Err.Error()
+			} else {
+				// x.Response is the response Do returns: masking it here
+				// masks what the caller prints as well.
+				body := redactEncoded(cfg.RedactFields, x.Response.Header.Get("Content-Type"), x.Response.Body)
+				if !r.Unredacted {
+					x.Response.Body = body
+				}
+				entry.Status, entry.ResponseHeaders, entry.ResponseBody = x.Response.StatusCode, redactHeaders(x.Response.Header), string(body)
+				entry.Truncated, entry.ResponseBytes = x.Response.Truncated, x.Response.Size
+				entry.ServerRequestID = agentapi.ResponseRequestID(cfg, x.Response.Header)
+				entry.Location = createdLocation(cfg, x.Request.URL.String(), x.Response.StatusCode, x.Response.Header)
+			}
+			AppendHistory(cfg, entry)
+		},
+	}
+	resp, err := client.Do(runCtx, agentapi.Request{Method: r.Method, Path: r.Path, TokenName: r.TokenName, Body: r.Body, Headers: r.Headers, Stream: stream, Raw: r.Raw})
+	if err == nil && buffered {
+		if w := r.Stream(resp.StatusCode, resp.Header); w != nil {
+			if _, werr := w.Write(resp.Body); werr != nil && !errors.Is(werr, agentapi.ErrStopBody) {
+				logger.Debug("masked body not written", "error", werr)
+			}
+		}
+	}
+	if err != nil && transport == offline && ExitCode(err) == ExitUnexpected {
+		return nil, &CliError{Code: ExitUnexpected, Message: ExitMessage(err), Suggestion: fmt.Sprintf("Record it online first: acurl %s %s --record %s", r.Method, r.Path, offline.fixtures.path), Cause: err}
 	}
-	return b
+	return resp, err
 }
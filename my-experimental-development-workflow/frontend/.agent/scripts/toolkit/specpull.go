@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const (
+	specUsage      = "Usage: api spec <infer|pull|drift|params|verify|tools> ... (see api --help)"
+	specInferUsage = "Usage: api spec infer --out <inferred.yaml|.json> [--cassette <file>]... [--no-history] [--all]"
+)
+
+// RunSpecCommand implements `api spec infer|pull|drift|params|verify ...`.
+func RunSpecCommand(configPath string, cfg *ResolvedConfig, args []string) error {
+	if len(args) == 0 {
+		return NewCliError(ExitRequestBuild, specUsage)
+	}
+	switch args[0] {
+	case "infer":
+		return runSpecInfer(cfg, args[1:])
+	case "pull":
+		return runSpecPull(configPath, cfg, args[1:])
+	case "drift":
+		return runSpecDrift(configPath, cfg, args[1:])
+	case "params":
+		return runSpecParams(cfg, args[1:])
+	case "verify":
+		return RunVerify(cfg, args[1:])
+	case "tools":
+		return RunTools(cfg, args[1:])
+	default:
+		return NewCliError(ExitRequestBuild, specUsage)
+	}
+}
+
+// runSpecPull refreshes the spec cache of the active env, or of several
+// envs concurrently: `--all` warms every env of the active project in one
+// command, `--force` gets past HTTP caches too.
+func runSpecPull(configPath string, cfg *ResolvedConfig, args []string) error {
+	envList, envTag, format := "", "", "table"
+	all, force := false, false
+	concurrency := agentapi.DefaultPullConcurrency
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--all":
+			all = true
+		case "--force":
+			force = true
+		case "--envs", "--env-tag", "--concurrency", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			case "--concurrency":
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --concurrency: %s (expected a positive integer)", args[i]))
+				}
+				concurrency = n
+			default:
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown spec pull option: %s", args[i]))
+		}
+	}
+	envList, err := taggedEnvList(configPath, envTag, envList, all)
+	if err != nil {
+		return err
+	}
+	if all && envList != "" {
+		return NewCliError(ExitRequestBuild, "--all and --envs are mutually exclusive")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+
+	cfgs, err := selectEnvConfigs(configPath, cfg, all, envList)
+	if err != nil {
+		return err
+	}
+
+	pulls := agentapi.PullSpecs(runCtx, cfgs, concurrency, force)
+	t := &Table{
+		Columns: []string{"ENV", "STATUS", "OPERATIONS", "BYTES", "DURATION", "URL"},
+		Keys:    []string{"env", "status", "operations", "bytes", "duration", "url"},
+		Empty:   "No envs configured.",
+	}
+	for _, p := range pulls {
+		status, ops, size := "ok", strconv.Itoa(p.Operations), strconv.Itoa(p.Bytes)
+		if p.Err != nil {
+			status, ops, size = "error: "+ExitMessage(p.Err), "", ""
+		}
+		t.Rows = append(t.Rows, []string{p.Config.ActiveEnv, status, ops, size, p.Duration.Round(time.Millisecond).String(), p.Config.OpenAPIURL})
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return agentapi.PullError(pulls)
+}
+
+// selectEnvConfigs loads the configs of every env of the active project
+// (all), of a comma-separated envList, or else of the active env alone.
+func selectEnvConfigs(configPath string, cfg *ResolvedConfig, all bool, envList string) ([]*ResolvedConfig, error) {
+	envs := []string{cfg.ActiveEnv}
+	switch {
+	case all:
+		var err error
+		if envs, err = agentapi.ProjectEnvNames(configPath); err != nil {
+			return nil, err
+		}
+	case envList != "":
+		envs = envs[:0]
+		for _, e := range strings.Split(envList, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				envs = append(envs, e)
+			}
+		}
+	}
+	cfgs := make([]*ResolvedConfig, 0, len(envs))
+	for _, env := range envs {
+		c, err := agentapi.LoadConfigForEnv(configPath, env)
+		if err != nil {
+			return nil, err
+		}
+		cfgs = append(cfgs, c)
+	}
+	return cfgs, nil
+}
+
+// taggedEnvList turns an --env-tag into the --envs list of the envs of the
+// active project carrying the tag; without one, envList is returned as is.
+func taggedEnvList(configPath, tag, envList string, all bool) (string, error) {
+	if tag == "" {
+		return envList, nil
+	}
+	if all || envList != "" {
+		return "", NewCliError(ExitRequestBuild, "--env-tag cannot be combined with --envs or --all")
+	}
+	envs, err := agentapi.EnvsTagged(configPath, tag)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(envs, ","), nil
+}
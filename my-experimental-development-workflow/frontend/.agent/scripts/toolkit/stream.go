@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// compactWriter renders a response body the way acurl prints it, one chunk
+// at a time so memory stays bounded however large the body: a JSON body
+// (one starting with '{' or '[') loses its insignificant whitespace, any
+// other body passes through. Leading and trailing whitespace is trimmed and
+// Close ends non-empty output with a newline. With a limit, output stops
+// after that many bytes and Write returns agentapi.ErrStopBody. A verbatim
+// writer leaves the body byte for byte as it is, limit aside.
+type compactWriter struct {
+	w        io.Writer
+	limit    int64
+	verbatim bool
+
+	written   int64
+	started   bool
+	json      bool
+	inString  bool
+	escaped   bool
+	pending   []byte
+	buf       []byte
+	truncated bool
+	closed    bool
+}
+
+func newCompactWriter(w io.Writer, limit int64) *compactWriter {
+	return &compactWriter{w: w, limit: limit}
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func isSpace(b byte) bool {
+	return isJSONSpace(b) || b == '\v' || b == '\f'
+}
+
+func (c *compactWriter) Write(p []byte) (int, error) {
+	if c.truncated {
+		return 0, agentapi.ErrStopBody
+	}
+	out, in := c.buf[:0], p
+	if c.verbatim {
+		out, in = append(out, p...), nil
+	}
+	for _, b := range in {
+		switch {
+		case !c.started:
+			if isSpace(b) {
+				continue
+			}
+			c.started = true
+			c.json = b == '{' || b == '['
+			out = append(out, b)
+		case c.json && c.inString:
+			out = append(out, b)
+			switch {
+			case c.escaped:
+				c.escaped = false
+			case b == '\\':
+				c.escaped = true
+			case b == '"':
+				c.inString = false
+			}
+		case c.json:
+			if isJSONSpace(b) {
+				continue
+			}
+			c.inString = b == '"'
+			out = append(out, b)
+		case isSpace(b):
+			// Held back until more text follows, so trailing
+			// whitespace is dropped.
+			c.pending = append(c.pending, b)
+		default:
+			out = append(out, c.pending...)
+			c.pending = c.pending[:0]
+			out = append(out, b)
+		}
+	}
+	c.buf = out
+	if c.limit > 0 && c.written+int64(len(out)) > c.limit {
+		out = out[:c.limit-c.written]
+		c.truncated = true
+	}
+	n, err := c.w.Write(out)
+	c.written += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	if c.truncated {
+		return len(p), agentapi.ErrStopBody
+	}
+	return len(p), nil
+}
+
+// Close terminates the output with a newline when anything was written,
+// unless the writer is verbatim. Closing again is a no-op.
+func (c *compactWriter) Close() error {
+	if c.closed || c.written == 0 || c.verbatim {
+		return nil
+	}
+	c.closed = true
+	_, err := c.w.Write([]byte("\n"))
+	return err
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// TestSuite is the YAML format consumed by `api test`: ordered steps that
+// call the API under the active guardrails, capture values and assert on
+// the response.
+type TestSuite struct {
+	Name  string            `yaml:"name"`
+	Vars  map[string]string `yaml:"vars"`
+	Steps []TestStep        `yaml:"steps"`
+}
+
+type TestStep struct {
+	Name string `yaml:"name"`
+	// Request is "METHOD /path"; alternatively Operation names an
+	// operationId and Params fills its path params (the rest become query).
+	Request   string            `yaml:"request"`
+	Operation string            `yaml:"operation"`
+	Params    map[string]string `yaml:"params"`
+	Token     string            `yaml:"token"`
+	Headers   map[string]string `yaml:"headers"`
+	Body      any               `yaml:"body"`
+	Capture   map[string]string `yaml:"capture"`
+	Assert    StepAssertions    `yaml:"assert"`
+	// Confirm requires an explicit yes (prompt or --yes) before sending.
+	Confirm bool `yaml:"confirm"`
+	// Rollback is registered once the step passes and runs, newest first,
+	// when a later step fails.
+	Rollback *TestStep `yaml:"rollback"`
+	// Use takes the request and its assertions from a request file (see
+	// LoadRequestFile), relative to the suite; the step may add a name,
+	// captures, confirm and a rollback.
+	Use string `yaml:"use"`
+}
+
+type StepAssertions struct {
+	Status int          `yaml:"status"`
+	JSON   []JSONAssert `yaml:"json"`
+}
+
+type JSONAssert struct {
+	Path     string `yaml:"path"`
+	Equals   any    `yaml:"equals"`
+	Exists   *bool  `yaml:"exists"`
+	Contains string `yaml:"contains"`
+	Length   *int   `yaml:"length"`
+}
+
+type StepResult struct {
+	Name       string   `json:"name"`
+	Method     string   `json:"method,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	Status     int      `json:"status,omitempty"`
+	RequestID  string   `json:"request_id,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+	Outcome    string   `json:"outcome"`
+	Failures   []string `json:"failures,omitempty"`
+}
+
+// SuiteResult counts the steps of a suite by outcome. Rollback steps are
+// counted apart: RolledBack those that passed, RollbackFailed those that
+// did not, which may have left agent data behind.
+type SuiteResult struct {
+	Name           string       `json:"name"`
+	Passed         int          `json:"passed"`
+	Failed         int          `json:"failed"`
+	Skipped        int          `json:"skipped"`
+	RolledBack     int          `json:"rolled_back"`
+	RollbackFailed int          `json:"rollback_failed"`
+	Steps          []StepResult `json:"steps"`
+}
+
+// err is the error a command running the suite exits with, nil when
+// every step passed.
+func (res *SuiteResult) err() error {
+	switch {
+	case res.RollbackFailed > 0:
+		return NewCliErrorHint(ExitAssertionFailed, fmt.Sprintf("%s: %d failed, and %d of %d rollback steps failed: what the suite wrote may be left behind", res.Name, res.Failed, res.RollbackFailed, res.RolledBack+res.RollbackFailed), "Undo by hand what the failed rollback steps above would have.")
+	case res.Failed > 0:
+		return NewCliError(ExitAssertionFailed, "")
+	}
+	return nil
+}
+
+const (
+	outcomePassed  = "passed"
+	outcomeFailed  = "failed"
+	outcomeSkipped = "skipped"
+)
+
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// LoadTestSuite reads and validates a suite file.
+func LoadTestSuite(path string) (*TestSuite, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Suite file not found: %s", path))
+	}
+	var suite TestSuite
+	if err := yaml.Unmarshal(raw, &suite); err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to parse suite %s: %v", path, err), err)
+	}
+	if len(suite.Steps) == 0 {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Suite %s has no steps", path))
+	}
+	for i := range suite.Steps {
+		if err := resolveUse(&suite.Steps[i], filepath.Dir(path)); err != nil {
+			return nil, WrapCliError(ExitCode(err), fmt.Sprintf("Step %d of %s: %s", i+1, path, ExitMessage(err)), err)
+		}
+		st := suite.Steps[i]
+		if (st.Request == "") == (st.Operation == "") {
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Step %d of %s needs exactly one of 'request' or 'operation'", i+1, path))
+		}
+		if rb := st.Rollback; rb != nil && (rb.Request == "") == (rb.Operation == "") {
+			return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Rollback of step %d of %s needs exactly one of 'request' or 'operation'", i+1, path))
+		}
+	}
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(path, ".yaml")
+	}
+	return &suite, nil
+}
+
+// suiteRunner executes steps in order, sharing captured variables.
+type suiteRunner struct {
+	cfg  *ResolvedConfig
+	spec map[string]any
+	vars map[string]string
+	// source labels the history entries of the calls made.
+	source string
+}
+
+func newSuiteRunner(cfg *ResolvedConfig, initial map[string]string) *suiteRunner {
+	vars := map[string]string{"agent_marker": cfg.AgentMarker}
+	for k, v := range initial {
+		vars[k] = v
+	}
+	return &suiteRunner{cfg: cfg, vars: vars, source: "test"}
+}
+
+// ConfirmFunc asks whether a step marked `confirm: true` may be sent.
+type ConfirmFunc func(prompt string) bool
+
+// RunTestSuite runs every step; after the first failing step the remaining
+// ones are skipped because later steps usually depend on earlier captures,
+// and the rollbacks of passed steps run in reverse order. A nil confirm
+// rejects every step that requires confirmation.
+func RunTestSuite(cfg *ResolvedConfig, suite *TestSuite, confirm ConfirmFunc) *SuiteResult {
+	r := newSuiteRunner(cfg, suite.Vars)
+	res := &SuiteResult{Name: suite.Name}
+	rollbacks := make([]TestStep, 0)
+	rollbackNames := make([]string, 0)
+	failed := false
+	for i, st := range suite.Steps {
+		name := stepName(st, i)
+		if failed {
+			res.Steps = append(res.Steps, StepResult{Name: name, Outcome: outcomeSkipped})
+			res.Skipped++
+			continue
+		}
+		sr := r.runConfirmedStep(st, name, confirm)
+		if sr.Outcome == outcomeFailed {
+			failed = true
+			res.Failed++
+		} else {
+			res.Passed++
+			if st.Rollback != nil {
+				rollbacks = append(rollbacks, *st.Rollback)
+				rollbackNames = append(rollbackNames, name)
+			}
+		}
+		res.Steps = append(res.Steps, sr)
+	}
+	if failed {
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			sr := r.runStep(rollbacks[i])
+			sr.Name = "rollback: " + rollbackNames[i]
+			res.Steps = append(res.Steps, sr)
+			if sr.Outcome == outcomeFailed {
+				res.RollbackFailed++
+			} else {
+				res.RolledBack++
+			}
+		}
+	}
+	return res
+}
+
+func stepName(st TestStep, i int) string {
+	if st.Name != "" {
+		return st.Name
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+func (r *suiteRunner) runConfirmedStep(st TestStep, name string, confirm ConfirmFunc) StepResult {
+	if st.Confirm {
+		req, err := r.buildRequest(st)
+		if err != nil {
+			return StepResult{Name: name, Outcome: outcomeFailed, Failures: []string{ExitMessage(err)}}
+		}
+		if confirm == nil || !confirm(fmt.Sprintf("%s: %s %s", name, req.Method, req.Path)) {
+			return StepResult{Name: name, Method: req.Method, Path: req.Path, Outcome: outcomeFailed, Failures: []string{"not confirmed (answer y or pass --yes)"}}
+		}
+	}
+	sr := r.runStep(st)
+	sr.Name = name
+	return sr
+}
+
+func (r *suiteRunner) interpolate(s string) string {
+	return templateVarPattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := templateVarPattern.FindStringSubmatch(m)[1]
+		if v, ok := r.vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// interpolateValue interpolates the keys and string values of a decoded
+// YAML or JSON value, at any depth.
+func (r *suiteRunner) interpolateValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.interpolate(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[r.interpolate(k)] = r.interpolateValue(e)
+		}
+		return out
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[r.interpolate(fmt.Sprint(k))] = r.interpolateValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = r.interpolateValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func (r *suiteRunner) buildRequest(st TestStep) (APIRequest, error) {
+	req := APIRequest{TokenName: r.interpolate(st.Token)}
+	if st.Operation != "" {
+		if r.spec == nil {
+			spec, err := agentapi.LoadSpecPaths(runCtx, r.cfg)
+			if err != nil {
+				return req, err
+			}
+			r.spec = spec
+		}
+		op, err := agentapi.FindOperationByRef(r.spec, r.interpolate(st.Operation))
+		if err != nil {
+			return req, err
+		}
+		req.Method, req.Path = op.Method, op.Path
+	} else {
+		method, path, _, err := normalizeMethodAndPath(strings.Fields(r.interpolate(st.Request)))
+		if err != nil {
+			return req, err
+		}
+		if method == "" {
+			method = "GET"
+		}
+		req.Method, req.Path = method, path
+	}
+	// Params fill the {name} placeholders of the path; the rest become
+	// query params.
+	query := url.Values{}
+	for _, k := range sortedStringKeys(st.Params) {
+		v := r.interpolate(st.Params[k])
+		if strings.Contains(req.Path, "{"+k+"}") {
+			req.Path = strings.ReplaceAll(req.Path, "{"+k+"}", url.PathEscape(v))
+			continue
+		}
+		v, err := expandQueryValue(v)
+		if err != nil {
+			return req, err
+		}
+		query.Add(k, v)
+	}
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(req.Path, "?") {
+			sep = "&"
+		}
+		req.Path += sep + query.Encode()
+	}
+
+	switch b := st.Body.(type) {
+	case nil:
+	case string:
+		req.Body = r.interpolate(b)
+	default:
+		// Variables go into the strings of the body, not into its JSON,
+		// so a captured value holding quotes stays one string.
+		raw, err := json.Marshal(r.interpolateValue(b))
+		if err != nil {
+			return req, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid step body: %v", err), err)
+		}
+		req.Body = string(raw)
+	}
+	for _, k := range sortedStringKeys(st.Headers) {
+		req.Headers = append(req.Headers, k+": "+r.interpolate(st.Headers[k]))
+	}
+	req.Spec = r.spec
+	req.Source = r.source
+	return req, nil
+}
+
+func (r *suiteRunner) runStep(st TestStep) StepResult {
+	sr, _, _ := r.exchange(st)
+	return sr
+}
+
+// exchange sends the request of st and checks the response against its
+// assertions and captures. The response is nil, and the error says why,
+// when the request could not be built or sent.
+func (r *suiteRunner) exchange(st TestStep) (StepResult, *APIResponse, error) {
+	start := time.Now()
+	sr := StepResult{Outcome: outcomePassed}
+	req, err := r.buildRequest(st)
+	if err != nil {
+		sr.Outcome = outcomeFailed
+		sr.Failures = []string{ExitMessage(err)}
+		return sr, nil, err
+	}
+	sr.Method, sr.Path = req.Method, req.Path
+	req.Headers, sr.RequestID = agentapi.WithRequestID(r.cfg, req.Headers)
+
+	resp, err := PerformRequest(r.cfg, req)
+	sr.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		sr.Outcome = outcomeFailed
+		sr.Failures = []string{ExitMessage(err)}
+		return sr, nil, err
+	}
+	sr.Status = resp.StatusCode
+	if id := agentapi.ResponseRequestID(r.cfg, resp.Header); id != "" {
+		sr.RequestID = id
+	}
+
+	if loc := createdLocation(r.cfg, r.cfg.BuildURL(req.Path), resp.StatusCode, resp.Header); loc != "" {
+		r.vars["last.location"] = loc
+	}
+
+	var doc any
+	hasJSON := json.Unmarshal(resp.Body, &doc) == nil
+
+	if st.Assert.Status != 0 && resp.StatusCode != st.Assert.Status {
+		sr.Failures = append(sr.Failures, fmt.Sprintf("status: expected %d, got %d", st.Assert.Status, resp.StatusCode))
+	} else if st.Assert.Status == 0 && resp.StatusCode >= 400 {
+		sr.Failures = append(sr.Failures, fmt.Sprintf("status: got HTTP %d", resp.StatusCode))
+	}
+	for _, a := range st.Assert.JSON {
+		if msg := checkJSONAssert(doc, hasJSON, a); msg != "" {
+			sr.Failures = append(sr.Failures, msg)
+		}
+	}
+	for _, name := range sortedStringKeys(st.Capture) {
+		v, ok := LookupJSONPath(doc, st.Capture[name])
+		if !hasJSON || !ok {
+			sr.Failures = append(sr.Failures, fmt.Sprintf("capture %s: %s not found in response", name, st.Capture[name]))
+			continue
+		}
+		r.vars[name] = jsonScalarString(v)
+	}
+	if len(sr.Failures) > 0 {
+		sr.Outcome = outcomeFailed
+	}
+	return sr, resp, nil
+}
+
+func checkJSONAssert(doc any, hasJSON bool, a JSONAssert) string {
+	if !hasJSON {
+		return fmt.Sprintf("%s: response is not JSON", a.Path)
+	}
+	v, found := LookupJSONPath(doc, a.Path)
+	if a.Exists != nil {
+		if found != *a.Exists {
+			return fmt.Sprintf("%s: expected exists=%t", a.Path, *a.Exists)
+		}
+		if !found {
+			return ""
+		}
+	}
+	if !found {
+		return fmt.Sprintf("%s: not found", a.Path)
+	}
+	if a.Equals != nil && !jsonEqual(v, a.Equals) {
+		return fmt.Sprintf("%s: expected %s, got %s", a.Path, jsonScalarString(a.Equals), jsonScalarString(v))
+	}
+	if a.Contains != "" && !strings.Contains(jsonScalarString(v), a.Contains) {
+		return fmt.Sprintf("%s: expected to contain %q", a.Path, a.Contains)
+	}
+	if a.Length != nil {
+		n := -1
+		switch t := v.(type) {
+		case []any:
+			n = len(t)
+		case map[string]any:
+			n = len(t)
+		case string:
+			n = len(t)
+		}
+		if n != *a.Length {
+			return fmt.Sprintf("%s: expected length %d, got %d", a.Path, *a.Length, n)
+		}
+	}
+	return ""
+}
+
+// jsonEqual compares values after a JSON round trip so YAML integers match
+// JSON numbers.
+func jsonEqual(a, b any) bool {
+	norm := func(v any) any {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return v
+		}
+		var out any
+		_ = json.Unmarshal(raw, &out)
+		return out
+	}
+	return reflect.DeepEqual(norm(a), norm(b))
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Time    string        `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Skipped *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// PrintSuiteResult writes the result as text, json or junit XML.
+func PrintSuiteResult(res *SuiteResult, report string) {
+	switch report {
+	case "text":
+		for _, st := range res.Steps {
+			line := fmt.Sprintf("%-7s %s", strings.ToUpper(st.Outcome), st.Name)
+			if st.Method != "" {
+				line += fmt.Sprintf("  (%s %s", st.Method, st.Path)
+				if st.Status != 0 {
+					line += fmt.Sprintf(" -> %d", st.Status)
+				}
+				line += ")"
+			}
+			fmt.Println(line)
+			for _, f := range st.Failures {
+				fmt.Printf("        - %s\n", f)
+			}
+			if st.Outcome == outcomeFailed && st.RequestID != "" {
+				fmt.Printf("        request id: %s\n", st.RequestID)
+			}
+		}
+		summary := fmt.Sprintf("\n%s: %d passed, %d failed, %d skipped", res.Name, res.Passed, res.Failed, res.Skipped)
+		if res.RolledBack > 0 {
+			summary += fmt.Sprintf(", %d rolled back", res.RolledBack)
+		}
+		if res.RollbackFailed > 0 {
+			summary += fmt.Sprintf(", %d ROLLBACK FAILED (agent data may be left behind)", res.RollbackFailed)
+		}
+		fmt.Println(summary)
+	case "json":
+		b, _ := json.Marshal(res)
+		fmt.Println(string(b))
+	case "junit":
+		js := junitTestSuite{Name: res.Name, Tests: len(res.Steps), Skipped: res.Skipped}
+		for _, st := range res.Steps {
+			tc := junitTestCase{Name: st.Name, Time: fmt.Sprintf("%.3f", float64(st.DurationMS)/1000)}
+			switch st.Outcome {
+			case outcomeFailed:
+				js.Failures++
+				tc.Failure = &junitFailure{Message: st.Failures[0], Text: strings.Join(st.Failures, "\n")}
+			case outcomeSkipped:
+				tc.Skipped = &struct{}{}
+			}
+			js.Cases = append(js.Cases, tc)
+		}
+		b, _ := xml.MarshalIndent(js, "", "  ")
+		fmt.Println(xml.Header + string(b))
+	}
+}
+
+// parseSuiteFlags splits `--report` and `--yes` from positional arguments.
+func parseSuiteFlags(args []string) (positional []string, report string, assumeYes bool, err error) {
+	report = "text"
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--yes":
+			assumeYes = true
+		case "--report":
+			i++
+			if i >= len(args) {
+				return nil, "", false, NewCliError(ExitRequestBuild, "Missing value for --report")
+			}
+			report = args[i]
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if report != "text" && report != "json" && report != "junit" {
+		return nil, "", false, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --report: %s (expected text|json|junit)", report))
+	}
+	return positional, report, assumeYes, nil
+}
+
+// executeSuite runs a suite, prints the report and maps failures to
+// ExitAssertionFailed.
+func executeSuite(cfg *ResolvedConfig, suite *TestSuite, report string, assumeYes bool) error {
+	var confirm ConfirmFunc
+	if assumeYes {
+		confirm = func(string) bool { return true }
+	}
+	res := RunTestSuite(cfg, suite, confirm)
+	PrintSuiteResult(res, report)
+	return res.err()
+}
+
+// RunTestCommand implements `api test <suite.yaml> [--report text|json|junit] [--yes]`.
+func RunTestCommand(cfg *ResolvedConfig, args []string) error {
+	positional, report, assumeYes, err := parseSuiteFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return NewCliError(ExitRequestBuild, "Usage: api test <suite.yaml> [--report text|json|junit] [--yes]")
+	}
+	if len(positional) > 1 {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown test option: %s", positional[1]))
+	}
+	suite, err := LoadTestSuite(positional[0])
+	if err != nil {
+		return err
+	}
+	return executeSuite(cfg, suite, report, assumeYes)
+}
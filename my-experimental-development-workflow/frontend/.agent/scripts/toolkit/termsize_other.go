@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// ttyColumns reports 0 (unknown) where the width cannot be queried; COLUMNS
+// still applies.
+func ttyColumns(f *os.File) int {
+	return 0
+}
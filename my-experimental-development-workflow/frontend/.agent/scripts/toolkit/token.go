@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Token check outcomes of `api token list --check`.
+const (
+	tokenValid     = "valid"
+	tokenExpired   = "expired"
+	tokenForbidden = "forbidden"
+)
+
+// TokenStatus is one configured token as listed by `api token list`.
+type TokenStatus struct {
+	Env     string
+	Token   string
+	Default bool
+	// Expires is the exp claim of a JWT, zero for opaque tokens.
+	Expires time.Time
+	// Status is set by --check: tokenValid, tokenExpired, tokenForbidden or
+	// "error: ..." with the probed path in Probe.
+	Status string
+	Probe  string
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0).UTC(), true
+}
+
+// checkToken GETs the identity path of cfg, else its health path, with
+// the named token. Like a health probe it is not an API operation: it
+// skips strict validation and the history.
+func checkToken(cfg *ResolvedConfig, name string) (status, probe string) {
+	probe = cfg.IdentityPath
+	if probe == "" {
+		probe = cfg.HealthPath
+	}
+	_, token, err := agentapi.ResolveToken(cfg, name)
+	if err != nil {
+		return "error: " + ExitMessage(err), probe
+	}
+	req, err := http.NewRequestWithContext(runCtx, http.MethodGet, cfg.APIBase+probe, nil)
+	if err != nil {
+		return "error: " + err.Error(), probe
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := agentapi.NewDoer(healthTimeout).Do(req)
+	if err != nil {
+		return "error: " + err.Error(), probe
+	}
+	resp.Body.Close()
+	logger.Debug("token check", "env", cfg.ActiveEnv, "token", name, "path", probe, "status", resp.StatusCode)
+	switch {
+	case resp.StatusCode < 400:
+		return tokenValid, probe
+	case resp.StatusCode == http.StatusUnauthorized:
+		return tokenExpired, probe
+	case resp.StatusCode == http.StatusForbidden:
+		return tokenForbidden, probe
+	}
+	return fmt.Sprintf("error: HTTP %d", resp.StatusCode), probe
+}
+
+// RunTokenCommand implements `api token list [--check] [--envs a,b | --all] [--format ...]`
+// and `api token stats` (see runTokenStats).
+func RunTokenCommand(configPath string, cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api token list [--check] [--envs <env1>,<env2> | --env-tag <tag> | --all] [--format table|csv|json|ndjson]"
+	if len(args) > 0 && args[0] == "stats" {
+		return runTokenStats(configPath, cfg, args[1:])
+	}
+	if len(args) == 0 || args[0] != "list" {
+		return NewCliError(ExitRequestBuild, usage+" | "+strings.TrimPrefix(tokenStatsUsage, "Usage: api token "))
+	}
+	envList, envTag, format := "", "", "table"
+	all, check := false, false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--check":
+			check = true
+		case "--all":
+			all = true
+		case "--envs", "--env-tag", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			default:
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, usage)
+		}
+	}
+	envList, err := taggedEnvList(configPath, envTag, envList, all)
+	if err != nil {
+		return err
+	}
+	if all && envList != "" {
+		return NewCliError(ExitRequestBuild, "--all and --envs are mutually exclusive")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	cfgs, err := selectEnvConfigs(configPath, cfg, all, envList)
+	if err != nil {
+		return err
+	}
+
+	tokens := make([]TokenStatus, 0)
+	envCfgs := make([]*ResolvedConfig, 0)
+	for _, c := range cfgs {
+		names := make([]string, 0, len(c.Tokens))
+		for name := range c.Tokens {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := TokenStatus{Env: c.ActiveEnv, Token: name, Default: name == c.DefaultTokenName}
+			t.Expires, _ = jwtExpiry(c.Tokens[name])
+			tokens = append(tokens, t)
+			envCfgs = append(envCfgs, c)
+		}
+	}
+	if check {
+		var wg sync.WaitGroup
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tokens[i].Status, tokens[i].Probe = checkToken(envCfgs[i], tokens[i].Token)
+			}(i)
+		}
+		wg.Wait()
+		if runCtx.Err() != nil {
+			return NewCliError(ExitInterrupted, "Interrupted: token check cancelled")
+		}
+	}
+
+	t := &Table{
+		Columns: []string{"ENV", "TOKEN", "DEFAULT", "EXPIRES"},
+		Keys:    []string{"env", "token", "default", "expires"},
+		Empty:   "No tokens configured.",
+	}
+	if check {
+		t.Columns = append(t.Columns, "STATUS", "PROBE")
+		t.Keys = append(t.Keys, "status", "probe")
+	}
+	failed := make([]string, 0)
+	for _, tok := range tokens {
+		def, expires := "", ""
+		if tok.Default {
+			def = "yes"
+		}
+		if !tok.Expires.IsZero() {
+			expires = tok.Expires.Format(time.RFC3339)
+			if tok.Expires.Before(time.Now()) {
+				expires += " (past)"
+			}
+		}
+		row := []string{tok.Env, tok.Token, def, expires}
+		if check {
+			row = append(row, tok.Status, tok.Probe)
+			if tok.Status != tokenValid {
+				failed = append(failed, tok.Env+"/"+tok.Token)
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	if check {
+		for _, c := range cfgs {
+			if c.IdentityPath == "" {
+				infof("%s has no identity_path: its tokens were checked against %s, which may accept any token.\n", c.ActiveEnv, c.HealthPath)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return NewCliErrorHint(ExitToken, fmt.Sprintf("Token(s) not valid: %s", strings.Join(failed, ", ")), "A 401 usually means the token is expired or revoked and a 403 that it lacks access; update it in config.toml.")
+	}
+	return nil
+}
+
+// tokenSecurityMismatch checks a token declared in token_security against
+// the security requirements of method on path (its own, else the spec's
+// root ones). It returns those requirements spelled out when none names
+// the token's scheme with scopes it holds; "" when one does, when the
+// operation needs no auth or when the spec does not say.
+func tokenSecurityMismatch(spec map[string]any, method, path string, ts agentapi.TokenSecurity) string {
+	var op *Operation
+	for _, o := range agentapi.OperationsForPath(spec, path) {
+		if o.Method == method {
+			op = o
+		}
+	}
+	if op == nil {
+		return ""
+	}
+	reqs, ok := agentapi.AsSlice(spec["security"])
+	if _, own := op.Raw["security"]; own {
+		reqs, ok = agentapi.AsSlice(op.Raw["security"])
+	}
+	if !ok || len(reqs) == 0 {
+		return ""
+	}
+	schemes := map[string]any{}
+	if components, ok := agentapi.AsMap(spec["components"]); ok {
+		if m, ok := agentapi.AsMap(components["securitySchemes"]); ok {
+			schemes = m
+		}
+	}
+	held := map[string]bool{}
+	for _, s := range ts.Scopes {
+		held[s] = true
+	}
+	alternatives := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		req, _ := agentapi.AsMap(r)
+		if len(req) == 0 {
+			return "" // {} makes auth optional
+		}
+		parts := make([]string, 0, len(req))
+		for _, name := range agentapi.SortedKeys(req) {
+			scheme, _ := agentapi.AsMap(schemes[name])
+			scheme = derefSchema(spec, scheme)
+			list, _ := agentapi.AsSlice(req[name])
+			scopes := make([]string, 0, len(list))
+			granted := true
+			for _, s := range list {
+				scopes = append(scopes, fmt.Sprint(s))
+				granted = granted && held[fmt.Sprint(s)]
+			}
+			if securitySchemeMatches(ts.Scheme, name, scheme) && (ts.Scopes == nil || granted) {
+				return ""
+			}
+			part := name
+			if t := agentapi.AsString(scheme["type"]); t != "" {
+				part += " (" + t + ")"
+			}
+			if len(scopes) > 0 {
+				part += " [" + strings.Join(scopes, " ") + "]"
+			}
+			parts = append(parts, part)
+		}
+		alternatives = append(alternatives, strings.Join(parts, " + "))
+	}
+	return strings.Join(alternatives, " or ")
+}
+
+// securitySchemeMatches reports whether a token_security scheme designates
+// the securitySchemes entry name: by that name or by its type, with
+// "bearer" and "basic" standing for the http scheme of that name.
+func securitySchemeMatches(declared, name string, scheme map[string]any) bool {
+	switch {
+	case strings.EqualFold(declared, name):
+		return true
+	case strings.EqualFold(declared, agentapi.AsString(scheme["type"])):
+		return true
+	}
+	return agentapi.AsString(scheme["type"]) == "http" && strings.EqualFold(declared, agentapi.AsString(scheme["scheme"]))
+}
+
+// warnTokenSecurity logs a warning before a call with --token when the
+// token's token_security does not fit the operation. The full spec is
+// loaded only for tokens declared there, since the paths view has no
+// security.
+func warnTokenSecurity(cfg *ResolvedConfig, method, path, token string) {
+	ts, ok := cfg.TokenSecurity[token]
+	if !ok {
+		return
+	}
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		logger.Debug("token security not checked, spec unavailable", "error", err)
+		return
+	}
+	if want := tokenSecurityMismatch(spec, method, path, ts); want != "" {
+		have := ts.Scheme
+		if ts.Scopes != nil {
+			have += " [" + strings.Join(ts.Scopes, " ") + "]"
+		}
+		logger.Warn("token does not fit the operation's security", "token", token, "token_security", have, "operation", method+" "+path, "requires", want)
+	}
+}
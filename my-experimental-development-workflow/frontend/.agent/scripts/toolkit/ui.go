@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const untaggedLabel = "(untagged)"
+
+// uiSession holds the state of one interactive `api ui` run.
+type uiSession struct {
+	cfg  *ResolvedConfig
+	spec map[string]any
+	in   *bufio.Reader
+	out  io.Writer
+}
+
+// RunUI starts a line-driven browser over the active spec for humans
+// supervising agent sessions: tags -> operations -> details -> request form.
+// Requests are fired through PerformRequest, so api_mode and strict apply.
+func RunUI(cfg *ResolvedConfig) error {
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	s := &uiSession{cfg: cfg, spec: spec, in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Fprintf(s.out, "%s/%s  api_mode=%s  strict=%t\n", cfg.ActiveProject, cfg.ActiveEnv, cfg.APIMode, cfg.Strict)
+	return s.tagsScreen()
+}
+
+func (s *uiSession) prompt(label string) (string, bool) {
+	fmt.Fprintf(s.out, "%s> ", label)
+	line, err := s.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(s.out)
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+func (s *uiSession) tagsScreen() error {
+	byTag := map[string][]Operation{}
+	for _, op := range agentapi.IterOperations(s.spec) {
+		if len(op.Tags) == 0 {
+			byTag[untaggedLabel] = append(byTag[untaggedLabel], op)
+			continue
+		}
+		for _, t := range op.Tags {
+			byTag[t] = append(byTag[t], op)
+		}
+	}
+	tags := make([]string, 0, len(byTag))
+	for t := range byTag {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+
+	for {
+		fmt.Fprintln(s.out, "\nTAGS:")
+		for i, t := range tags {
+			fmt.Fprintf(s.out, "  %3d) %s (%d)\n", i+1, t, len(byTag[t]))
+		}
+		line, ok := s.prompt("tag # | /search | q")
+		if !ok || line == "q" {
+			return nil
+		}
+		if strings.HasPrefix(line, "/") {
+			query := strings.TrimSpace(line[1:])
+			if query == "" {
+				continue
+			}
+			if done := s.operationsScreen("search: "+query, agentapi.FindOperations(s.spec, query, "")); done {
+				return nil
+			}
+			continue
+		}
+		idx, err := strconv.Atoi(line)
+		if err != nil || idx < 1 || idx > len(tags) {
+			fmt.Fprintln(s.out, "Invalid selection.")
+			continue
+		}
+		ops := byTag[tags[idx-1]]
+		sortOperations(ops)
+		if done := s.operationsScreen(tags[idx-1], ops); done {
+			return nil
+		}
+	}
+}
+
+// operationsScreen returns true when the user asked to quit.
+func (s *uiSession) operationsScreen(title string, ops []Operation) bool {
+	for {
+		fmt.Fprintf(s.out, "\n%s:\n", strings.ToUpper(title))
+		if len(ops) == 0 {
+			fmt.Fprintln(s.out, "  No matching endpoints found.")
+		}
+		for i, op := range ops {
+			fmt.Fprintf(s.out, "  %3d) %-7s %s  %s\n", i+1, op.Method, op.Path, op.Summary)
+		}
+		line, ok := s.prompt("op # | b | q")
+		if !ok || line == "q" {
+			return true
+		}
+		if line == "b" {
+			return false
+		}
+		idx, err := strconv.Atoi(line)
+		if err != nil || idx < 1 || idx > len(ops) {
+			fmt.Fprintln(s.out, "Invalid selection.")
+			continue
+		}
+		if done := s.operationScreen(&ops[idx-1]); done {
+			return true
+		}
+	}
+}
+
+func (s *uiSession) operationScreen(op *Operation) bool {
+	for {
+		fmt.Fprintln(s.out)
+		PrintOperationDetails(op)
+		line, ok := s.prompt("c(all) | b | q")
+		if !ok || line == "q" {
+			return true
+		}
+		switch line {
+		case "b":
+			return false
+		case "c":
+			if err := s.requestForm(op); err != nil {
+				fmt.Fprintln(s.out, ExitMessage(err))
+			}
+		default:
+			fmt.Fprintln(s.out, "Invalid selection.")
+		}
+	}
+}
+
+// requestForm prompts for every declared parameter and the body, then fires
+// the call after an explicit confirmation.
+func (s *uiSession) requestForm(op *Operation) error {
+	path := op.Path
+	query := url.Values{}
+	headers := make([]string, 0)
+	for _, p := range op.Parameters {
+		name, pin := p.Name, p.In
+		label := fmt.Sprintf("%s (%s, %s)", name, pin, schemaToText(p.Schema))
+		if p.Required {
+			label += " *"
+		}
+		val, ok := s.prompt(label)
+		if !ok {
+			return nil
+		}
+		if val == "" {
+			continue
+		}
+		switch pin {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(val))
+		case "query":
+			query.Add(name, val)
+		case "header":
+			headers = append(headers, name+": "+val)
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	body := ""
+	if _, ok := agentapi.AsMap(op.Raw["requestBody"]); ok {
+		for {
+			val, ok := s.prompt("body JSON (one line)")
+			if !ok {
+				return nil
+			}
+			if val == "" || json.Valid([]byte(val)) {
+				body = val
+				break
+			}
+			fmt.Fprintln(s.out, "Body is not valid JSON.")
+		}
+	}
+
+	tokenName, ok := s.prompt(fmt.Sprintf("token [%s]", s.cfg.DefaultTokenName))
+	if !ok {
+		return nil
+	}
+
+	fmt.Fprintf(s.out, "\n%s %s\n", op.Method, path)
+	confirm, ok := s.prompt("send? y/N")
+	if !ok || !strings.EqualFold(confirm, "y") {
+		fmt.Fprintln(s.out, "Cancelled.")
+		return nil
+	}
+
+	resp, err := PerformRequest(s.cfg, APIRequest{
+		Method:    op.Method,
+		Path:      path,
+		TokenName: tokenName,
+		Body:      body,
+		Headers:   headers,
+		Spec:      s.spec,
+		Source:    "ui",
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "HTTP %d\n", resp.StatusCode)
+	emitCompactBackendPayload(resp.Body)
+	return nil
+}
+
+func sortOperations(ops []Operation) {
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+}
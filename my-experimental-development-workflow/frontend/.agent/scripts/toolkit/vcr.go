@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Cassette is a recorded set of HTTP interactions. In record mode it wraps a
+// real transport and appends every exchange; in replay mode it serves the
+// stored responses and never touches the network.
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+
+	path   string
+	replay bool
+	// redact masks redact_fields in the recorded bodies.
+	redact []string
+	next   http.RoundTripper
+	used   map[int]bool
+	mu     sync.Mutex
+}
+
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// OpenRecordCassette returns a cassette that records into path, keeping any
+// interactions already stored there.
+func OpenRecordCassette(path string) (*Cassette, error) {
+	c := &Cassette{path: path, next: http.DefaultTransport}
+	raw, err := os.ReadFile(path)
+	if err == nil && len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, c); err != nil {
+			return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid cassette %s: %v", path, err), err)
+		}
+	}
+	return c, nil
+}
+
+// OpenReplayCassette loads a cassette for offline replay.
+func OpenReplayCassette(path string) (*Cassette, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Cassette not found: %s", path))
+	}
+	c := &Cassette{path: path, replay: true, used: map[int]bool{}}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid cassette %s: %v", path, err), err)
+	}
+	return c, nil
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		raw, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		body = string(raw)
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+	}
+	key := CassetteRequest{Method: req.Method, Path: req.URL.RequestURI(), Body: normalizeCassetteBody(body)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replay {
+		return c.serve(req, key)
+	}
+	return c.record(req, key)
+}
+
+// serve returns matching interactions in recorded order, so repeated
+// identical calls replay the sequence that was captured.
+func (c *Cassette) serve(req *http.Request, key CassetteRequest) (*http.Response, error) {
+	for i, it := range c.Interactions {
+		if c.used[i] || it.Request != key {
+			continue
+		}
+		c.used[i] = true
+		header := http.Header{}
+		for k, v := range it.Response.Headers {
+			header.Set(k, v)
+		}
+		return &http.Response{
+			StatusCode:    it.Response.Status,
+			Status:        fmt.Sprintf("%d %s", it.Response.Status, http.StatusText(it.Response.Status)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(it.Response.Body)),
+			ContentLength: int64(len(it.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction in %s for %s %s", c.path, key.Method, key.Path)
+}
+
+func (c *Cassette) record(req *http.Request, key CassetteRequest) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+
+	headers := make(map[string]string, len(resp.Header))
+	for k, v := range resp.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	c.Interactions = append(c.Interactions, CassetteInteraction{
+		Request:  key,
+		Response: CassetteResponse{Status: resp.StatusCode, Headers: headers, Body: string(redactEncoded(c.redact, resp.Header.Get("Content-Type"), raw))},
+	})
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Cassette) save() error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := agentapi.WriteFileAtomic(c.path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// normalizeCassetteBody compacts JSON bodies so formatting differences do not
+// break matching.
+func normalizeCassetteBody(body string) string {
+	trimmed := bytes.TrimSpace([]byte(body))
+	var compact bytes.Buffer
+	if len(trimmed) > 0 && json.Compact(&compact, trimmed) == nil {
+		return compact.String()
+	}
+	return string(trimmed)
+}
@@ -0,0 +1,77 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+usage() {
+  cat <<'EOF_USAGE'
+Usage: scripts/release-toolkit.sh <version> [--out <dir>]
+
+Cross-build the toolkit (standalone-experimental-workflow/toolkit) as the
+release assets `api self-update` downloads: one agent-api_<os>_<arch>
+binary per platform, stamped with the version and commit, plus a
+checksums.txt in sha256sum format. Upload the whole directory to the
+release tagged <version>.
+
+Options:
+  --out <dir>  Output directory (default: dist/<version>)
+  -h, --help   Show this help
+EOF_USAGE
+}
+
+source_dir="standalone-experimental-workflow/toolkit"
+platforms=(
+  "linux/amd64"
+  "linux/arm64"
+  "darwin/amd64"
+  "darwin/arm64"
+  "windows/amd64"
+)
+version=""
+out=""
+
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --out)
+      out="${2:?--out needs a directory}"
+      shift 2
+      ;;
+    -h|--help)
+      usage
+      exit 0
+      ;;
+    -*)
+      echo "Unknown option: $1" >&2
+      usage >&2
+      exit 1
+      ;;
+    *)
+      version="$1"
+      shift
+      ;;
+  esac
+done
+
+if [[ -z "${version}" ]]; then
+  usage >&2
+  exit 1
+fi
+if [[ ! -f "${source_dir}/go.mod" ]]; then
+  echo "Canonical toolkit not found: ${source_dir} (run from the repo root)" >&2
+  exit 1
+fi
+
+out="$(mkdir -p "${out:-dist/${version}}" && cd "${out:-dist/${version}}" && pwd)"
+commit="$(git rev-parse HEAD)"
+build_date="$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+ldflags="-s -w -X main.version=${version} -X main.commit=${commit} -X main.buildDate=${build_date}"
+
+for platform in "${platforms[@]}"; do
+  goos="${platform%/*}"
+  goarch="${platform#*/}"
+  asset="agent-api_${goos}_${goarch}"
+  [[ "${goos}" == "windows" ]] && asset+=".exe"
+  echo "==> ${asset}"
+  (cd "${source_dir}" && CGO_ENABLED=0 GOOS="${goos}" GOARCH="${goarch}" go build -trimpath -ldflags "${ldflags}" -o "${out}/${asset}" .)
+done
+
+(cd "${out}" && sha256sum agent-api_* > checksums.txt)
+echo "Release ${version} written to ${out}."
@@ -0,0 +1,85 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+usage() {
+  cat <<'EOF_USAGE'
+Usage: scripts/sync-toolkit.sh [--check]
+
+Mirror the canonical Go toolkit (standalone-experimental-workflow/toolkit)
+into the workflow copies under my-experimental-development-workflow, so a
+fix or feature is written once.
+
+Options:
+  --check     Only report copies that differ from the canonical sources (exit 1 if any)
+  -h, --help  Show this help
+EOF_USAGE
+}
+
+source_dir="standalone-experimental-workflow/toolkit"
+copies=(
+  "my-experimental-development-workflow/frontend/.agent/scripts/toolkit"
+  "my-experimental-development-workflow/backend/.agent/scripts/toolkit"
+)
+check=false
+
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --check)
+      check=true
+      shift
+      ;;
+    -h|--help)
+      usage
+      exit 0
+      ;;
+    *)
+      echo "Unknown option: $1" >&2
+      usage >&2
+      exit 1
+      ;;
+  esac
+done
+
+if [[ ! -f "${source_dir}/go.mod" ]]; then
+  echo "Canonical toolkit not found: ${source_dir} (run from the repo root)" >&2
+  exit 1
+fi
+
+# Only sources are mirrored; binaries and local state stay per copy.
+list_sources() {
+  (cd "$1" && find . -type f \( -name '*.go' -o -name 'go.mod' -o -name 'go.sum' \) | sort)
+}
+
+stale=0
+for copy in "${copies[@]}"; do
+  if [[ "${check}" == "true" ]]; then
+    if ! diff -q <(list_sources "${source_dir}") <(list_sources "${copy}") >/dev/null; then
+      echo "==> ${copy}: file list differs" >&2
+      stale=1
+      continue
+    fi
+    while read -r f; do
+      if ! cmp -s "${source_dir}/${f}" "${copy}/${f}"; then
+        echo "==> ${copy}: ${f#./} differs" >&2
+        stale=1
+      fi
+    done < <(list_sources "${source_dir}")
+    continue
+  fi
+
+  echo "==> ${copy}"
+  mkdir -p "${copy}"
+  list_sources "${copy}" | (cd "${copy}" && xargs -r rm -f)
+  list_sources "${source_dir}" | (cd "${source_dir}" && xargs -r cp --parents -t "${OLDPWD}/${copy}")
+done
+
+if [[ "${check}" == "true" ]]; then
+  if [[ "${stale}" -ne 0 ]]; then
+    echo "Toolkit copies are out of date; run: make sync-toolkit" >&2
+    exit 1
+  fi
+  echo "Toolkit copies match ${source_dir}."
+  exit 0
+fi
+
+echo "Sync complete."
@@ -0,0 +1,169 @@
+package agentapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// tableHeader starts the first table of a TOML file; the top-level keys
+// are the lines before it.
+var tableHeader = regexp.MustCompile(`(?m)^[ \t]*\[`)
+
+// SetActive makes project and env the active ones of the config file, for
+// `api project use` and `api env use`. Only the active_project and
+// active_env lines are rewritten, in any ConfigFormat, so comments and
+// layout are kept. An empty
+// env keeps the active env when the project has it. It returns the
+// previous project and env.
+func SetActive(configPath, project, env string) (string, string, error) {
+	unlock, err := LockFile(configPath)
+	if err != nil {
+		return "", "", WrapError(ExitConfig, fmt.Sprintf("Failed to update %s: %v", configPath, err), err)
+	}
+	defer unlock()
+	fc, raw, err := parseFileConfig(configPath)
+	if err != nil {
+		return "", "", err
+	}
+	if project == "" {
+		project = fc.ActiveProject
+	}
+	p, ok := fc.Projects[project]
+	if !ok {
+		return "", "", NewErrorHint(ExitConfig, fmt.Sprintf("Project '%s' not found under [projects]%s", project, DidYouMean(project, sortedNames(fc.Projects))), fmt.Sprintf("Use one of: %s.", strings.Join(sortedNames(fc.Projects), ", ")))
+	}
+	envs := sortedNames(p.Envs)
+	if env == "" {
+		if _, ok := p.Envs[fc.ActiveEnv]; !ok {
+			return "", "", NewErrorHint(ExitConfig, fmt.Sprintf("Project '%s' has no env '%s'", project, fc.ActiveEnv), fmt.Sprintf("Name the env to use with --env: %s.", strings.Join(envs, ", ")))
+		}
+		env = fc.ActiveEnv
+	}
+	if _, ok := p.Envs[env]; !ok {
+		return "", "", NewErrorHint(ExitConfig, fmt.Sprintf("Env '%s' not found under project '%s'%s", env, project, DidYouMean(env, envs)), fmt.Sprintf("Use one of the configured envs: %s.", strings.Join(envs, ", ")))
+	}
+
+	set := setTopLevelKey
+	switch ConfigFormat(configPath) {
+	case "YAML":
+		set = setYAMLKey
+	case "JSON":
+		set = setJSONKey
+	}
+	text := set(string(raw), "active_project", project)
+	text = set(text, "active_env", env)
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return "", "", WrapError(ExitConfig, fmt.Sprintf("Failed to update %s: %v", configPath, err), err)
+	}
+	if err := WriteFileAtomic(configPath, []byte(text), info.Mode().Perm()); err != nil {
+		return "", "", WrapError(ExitConfig, fmt.Sprintf("Failed to update %s: %v", configPath, err), err)
+	}
+	return fc.ActiveProject, fc.ActiveEnv, nil
+}
+
+// EnvInfo describes one configured env as written, for listings: unlike
+// LoadConfigForEnv it does not check that the env is usable.
+type EnvInfo struct {
+	Project string   `json:"project"`
+	Env     string   `json:"env"`
+	APIBase string   `json:"api_base"`
+	APIMode string   `json:"api_mode"`
+	Tags    []string `json:"tags,omitempty"`
+	Active  bool     `json:"active"`
+	// Source is the config file defining the env, as in EnvReport.
+	Source string `json:"source"`
+}
+
+// ListEnvs lists the envs of every project of the config, in project then
+// env order, marking the active one. It reads a config whose active
+// project or env is broken, so the way out can be listed.
+func ListEnvs(configPath string) ([]EnvInfo, error) {
+	fc, _, err := parseFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EnvInfo, 0)
+	for _, project := range sortedNames(fc.Projects) {
+		envs := fc.Projects[project].Envs
+		if len(envs) == 0 {
+			out = append(out, EnvInfo{Project: project, Active: project == fc.ActiveProject, Source: fc.source("projects", project)})
+		}
+		for _, env := range sortedNames(envs) {
+			e := envs[env]
+			out = append(out, EnvInfo{Project: project, Env: env, APIBase: strings.TrimRight(e.APIBase, "/"), APIMode: e.APIMode, Tags: e.Tags, Active: project == fc.ActiveProject && env == fc.ActiveEnv, Source: fc.source("projects", project, "envs", env)})
+		}
+	}
+	return out, nil
+}
+
+// parseFileConfig reads config.toml, merged over the global config,
+// without the checks of loadFileConfig. The bytes are those of
+// configPath alone, for SetActive to rewrite.
+func parseFileConfig(configPath string) (*fileConfig, []byte, error) {
+	fc, _, err := decodeLayered(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, WrapError(ExitConfig, fmt.Sprintf("Failed to read %s: %v", configPath, err), err)
+	}
+	return fc, raw, nil
+}
+
+// setTopLevelKey sets key to the string value among the top-level keys of
+// a TOML text, keeping a trailing comment, or adds it first when absent.
+func setTopLevelKey(text, key, value string) string {
+	quoted, _ := json.Marshal(value) // JSON string escapes are valid TOML
+	head, tables := text, ""
+	if loc := tableHeader.FindStringIndex(text); loc != nil {
+		head, tables = text[:loc[0]], text[loc[0]:]
+	}
+	line := regexp.MustCompile(`(?m)^([ \t]*` + regexp.QuoteMeta(key) + `[ \t]*=[ \t]*)("(?:[^"\\]|\\.)*"|'[^']*')`)
+	if line.MatchString(head) {
+		return line.ReplaceAllString(head, "${1}"+strings.ReplaceAll(string(quoted), "$", "$$")) + tables
+	}
+	return key + " = " + string(quoted) + "\n" + text
+}
+
+// yamlKeyLine matches a top-level YAML key and its scalar value, quoted or
+// plain, up to a comment.
+var yamlKeyLine = `(?m)^(%s[ \t]*:[ \t]*)("(?:[^"\\]|\\.)*"|'(?:[^']|'')*'|[^\s#][^#\n]*?)?[ \t]*(#.*)?$`
+
+// setYAMLKey is setTopLevelKey for a YAML text: only a key at the start of
+// a line is top-level.
+func setYAMLKey(text, key, value string) string {
+	quoted, _ := json.Marshal(value) // a JSON string is a YAML scalar
+	line := regexp.MustCompile(fmt.Sprintf(yamlKeyLine, regexp.QuoteMeta(key)))
+	if loc := line.FindStringSubmatchIndex(text); loc != nil {
+		out := text[:loc[0]] + text[loc[2]:loc[3]] + string(quoted)
+		if loc[6] >= 0 {
+			out += " " + text[loc[6]:loc[7]]
+		}
+		return out + text[loc[1]:]
+	}
+	return key + ": " + string(quoted) + "\n" + text
+}
+
+// setJSONKey is setTopLevelKey for a JSON text. The schema nests no
+// active_* keys, so the first occurrence is the top-level one.
+func setJSONKey(text, key, value string) string {
+	quoted, _ := json.Marshal(value)
+	line := regexp.MustCompile(`("` + regexp.QuoteMeta(key) + `"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	if loc := line.FindStringSubmatchIndex(text); loc != nil {
+		return text[:loc[3]] + string(quoted) + text[loc[1]:]
+	}
+	if i := strings.Index(text, "{"); i >= 0 {
+		rest := strings.TrimLeft(text[i+1:], " \t\r\n")
+		sep := ",\n  "
+		if strings.HasPrefix(rest, "}") {
+			sep = "\n"
+		}
+		return text[:i+1] + "\n  \"" + key + "\": " + string(quoted) + sep + rest
+	}
+	return text
+}
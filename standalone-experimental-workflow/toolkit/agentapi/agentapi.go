@@ -0,0 +1,19 @@
+// Package agentapi is the guardrailed core of the agent API toolkit:
+// config resolution (Config), api_mode and strict checks (Policy), OpenAPI
+// discovery (SpecIndex) and request execution (Client). The api and acurl
+// CLIs are built on it; other tools can embed it instead of shelling out.
+//
+// Errors are *Error values carrying one of the Exit* codes. The package
+// never exits the process and never writes to stdout; diagnostics go to
+// Logger, which discards them unless replaced. LoadSpec refreshes the spec
+// cache under the config directory.
+package agentapi
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Logger receives debug traces of config loading, spec fetches, policy
+// decisions and HTTP calls. Token values are never logged.
+var Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
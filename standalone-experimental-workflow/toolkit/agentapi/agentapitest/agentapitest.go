@@ -0,0 +1,189 @@
+// Package agentapitest runs the agentapi pipeline without a live API: a
+// Backend is an in-process fake server exposing an OpenAPI spec and canned
+// routes, and Fixtures is a Doer answering from memory without any
+// network. Both work with agentapi.Client and agentapi.DefaultDoer, and a
+// Backend can write a config.toml for driving the api/acurl binaries.
+package agentapitest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Token is the token value every generated config uses.
+const Token = "test-token"
+
+// Marker is the agent_marker every generated config uses.
+const Marker = "[agent-test]"
+
+// DefaultSpec is served when NewBackend is given no spec.
+const DefaultSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "agentapitest", "version": "1"},
+  "paths": {
+    "/health": {"get": {"operationId": "health", "responses": {"200": {"description": "ok"}}}},
+    "/users": {
+      "get": {"operationId": "listUsers", "summary": "List users", "tags": ["users"],
+        "parameters": [{"name": "limit", "in": "query", "schema": {"type": "integer"}}],
+        "responses": {"200": {"description": "ok"}}},
+      "post": {"operationId": "createUser", "summary": "Create user", "tags": ["users"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object"}}}},
+        "responses": {"201": {"description": "created"}}}
+    },
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {"operationId": "getUser", "summary": "Get user", "tags": ["users"], "responses": {"200": {"description": "ok"}}},
+      "delete": {"operationId": "deleteUser", "summary": "Delete user", "tags": ["users"], "responses": {"204": {"description": "deleted"}}}
+    }
+  }
+}`
+
+// Route is a canned response.
+type Route struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// Received is a request as seen by a Backend.
+type Received struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// Backend is a fake API: the spec at /openapi.json and canned routes under
+// /api. Unknown routes answer 404.
+type Backend struct {
+	*httptest.Server
+	Spec []byte
+
+	mu       sync.Mutex
+	routes   map[string]Route
+	received []Received
+}
+
+// NewBackend starts a Backend serving spec (DefaultSpec when nil). Close
+// it when done.
+func NewBackend(spec []byte) *Backend {
+	if spec == nil {
+		spec = []byte(DefaultSpec)
+	}
+	b := &Backend{Spec: spec, routes: map[string]Route{}}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+	return b
+}
+
+// Handle makes method + path (relative to api_base, without query) answer
+// with status and body.
+func (b *Backend) Handle(method, path string, status int, body string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.routes[strings.ToUpper(method)+" "+path] = Route{Status: status, Body: body}
+}
+
+// Received returns the API requests served so far, oldest first.
+func (b *Backend) Received() []Received {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Received(nil), b.received...)
+}
+
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.json" {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b.Spec)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	b.mu.Lock()
+	b.received = append(b.received, Received{Method: r.Method, Path: path, Header: r.Header.Clone(), Body: string(body)})
+	route, ok := b.routes[r.Method+" "+path]
+	b.mu.Unlock()
+	if !ok {
+		route = Route{Status: http.StatusNotFound, Body: fmt.Sprintf(`{"error":"no route for %s %s"}`, r.Method, path)}
+	}
+	writeRoute(w, route)
+}
+
+func writeRoute(w http.ResponseWriter, route Route) {
+	for k, v := range route.Header {
+		w.Header()[k] = v
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(route.Status)
+	_, _ = io.WriteString(w, route.Body)
+}
+
+// Config returns a resolved config for the backend, as LoadConfig would:
+// token "default", agent_marker Marker, spec cache under dir.
+func (b *Backend) Config(dir, mode string, strict bool) *agentapi.Config {
+	return &agentapi.Config{
+		ConfigDir:        dir,
+		ActiveProject:    "test",
+		ActiveEnv:        "local",
+		DefaultTokenName: "default",
+		AgentMarker:      Marker,
+		Strict:           strict,
+		APIBase:          b.URL + "/api",
+		APIMode:          mode,
+		OpenAPIURL:       b.URL + "/openapi.json",
+		HealthPath:       agentapi.DefaultHealthPath,
+		Tokens:           map[string]string{"default": Token},
+	}
+}
+
+// WriteConfig writes dir/config.toml pointing at the backend, for running
+// the api and acurl binaries from dir, and returns its path.
+func (b *Backend) WriteConfig(dir, mode string, strict bool) (string, error) {
+	cfg := fmt.Sprintf(`active_project = "test"
+active_env = "local"
+default_token = "default"
+agent_marker = %q
+strict = %t
+
+[projects.test.envs.local]
+api_base = %q
+openapi_url = %q
+api_mode = %q
+tokens = { default = %q }
+`, Marker, strict, b.URL+"/api", b.URL+"/openapi.json", mode, Token)
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Fixtures answers requests from memory, keyed by "METHOD /path" with the
+// full request path (api_base path included, query excluded). Requests
+// without a fixture fail, so nothing reaches the network.
+type Fixtures map[string]Route
+
+func (f Fixtures) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	route, ok := f[req.Method+" "+req.URL.Path]
+	if !ok {
+		return nil, fmt.Errorf("agentapitest: no fixture for %s %s", req.Method, req.URL.Path)
+	}
+	rec := httptest.NewRecorder()
+	writeRoute(rec, route)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,667 @@
+package agentapi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultHealthPath is probed when an env sets no health_path.
+const DefaultHealthPath = "/health"
+
+// fileConfig mirrors config.toml.
+type fileConfig struct {
+	ActiveProject   string                  `toml:"active_project"`
+	ActiveEnv       string                  `toml:"active_env"`
+	DefaultToken    string                  `toml:"default_token"`
+	AgentMarker     string                  `toml:"agent_marker"`
+	Strict          *bool                   `toml:"strict"`
+	TunnelCommand   string                  `toml:"tunnel_command"`
+	DiffIgnore      []string                `toml:"diff_ignore"`
+	RedactFields    []string                `toml:"redact_fields"`
+	RequestIDHeader *string                 `toml:"request_id_header"`
+	Aliases         map[string]string       `toml:"aliases"`
+	Projects        map[string]projectEntry `toml:"projects"`
+
+	// layers and sources are where the settings were read from
+	// (decodeLayered, source).
+	layers  []string
+	sources map[string][]string
+}
+
+type projectEntry struct {
+	Aliases map[string]string   `toml:"aliases"`
+	Envs    map[string]envEntry `toml:"envs"`
+}
+
+type envEntry struct {
+	APIBase      string            `toml:"api_base"`
+	APIMode      string            `toml:"api_mode"`
+	OpenAPIURL   string            `toml:"openapi_url"`
+	GraphQLURL   string            `toml:"graphql_url"`
+	HealthPath   string            `toml:"health_path"`
+	IdentityPath string            `toml:"identity_path"`
+	PathBases    map[string]string `toml:"path_bases"`
+	// AllowSpecServers are the servers off api_base's host that the spec
+	// may send calls to with the env's token.
+	AllowSpecServers []string         `toml:"allow_spec_servers"`
+	SoftDelete       *softDeleteEntry `toml:"soft_delete"`
+	// RequiredHeaders is keyed by header name.
+	RequiredHeaders map[string]requiredHeaderEntry `toml:"required_headers"`
+	Tokens          map[string]string              `toml:"tokens"`
+	// Tags group envs for the commands taking --env-tag.
+	Tags []string `toml:"tags"`
+	// TokenSecurity is keyed by token name.
+	TokenSecurity map[string]TokenSecurity `toml:"token_security"`
+}
+
+type requiredHeaderEntry struct {
+	Pattern string `toml:"pattern"`
+	Example string `toml:"example"`
+}
+
+type softDeleteEntry struct {
+	Method string         `toml:"method"`
+	Path   string         `toml:"path"`
+	Body   map[string]any `toml:"body"`
+}
+
+// Config is one env of the active project, resolved from config.toml and
+// validated: every field a guardrailed call needs, including the tokens.
+type Config struct {
+	ConfigDir        string
+	ActiveProject    string
+	ActiveEnv        string
+	DefaultTokenName string
+	AgentMarker      string
+	Strict           bool
+	APIBase          string
+	APIMode          string
+	OpenAPIURL       string
+	// Tags are the env's tags as configured (see EnvsTagged).
+	Tags []string
+	// Tokens map names to values, ${VAR} references expanded (see
+	// expandTokenEnv); tokenErrors holds why a reference could not be,
+	// for ResolveToken to report.
+	Tokens        map[string]string
+	tokenErrors   map[string]error
+	TunnelCommand string
+	// GraphQLURL is optional; a configured value starting with "/" is
+	// resolved against APIBase.
+	GraphQLURL string
+	// HealthPath is probed by `api health` (default /health).
+	HealthPath string
+	// IdentityPath is called by `api whoami`; empty when not configured.
+	IdentityPath string
+	// PathBases send the paths under their prefix to another base URL than
+	// APIBase, longest prefix first (see BuildURL).
+	PathBases []PathBase
+	// AllowSpecServers are the scheme://host of the spec servers off
+	// APIBase's host that the env's token is sent to (see Client.Do).
+	AllowSpecServers []string
+	// SoftDelete, when the env's API archives rather than deletes, is the
+	// request acurl --soft sends in place of a DELETE.
+	SoftDelete *SoftDelete
+	// RequiredHeaders must be sent with every write, sorted by name.
+	RequiredHeaders []RequiredHeader
+	// TokenSecurity declares what some tokens are, by token name, so a
+	// --token can be checked against the security of the operation.
+	TokenSecurity map[string]TokenSecurity
+	// DiffIgnore lists volatile fields skipped by diff-env: bare key names
+	// match at any depth, "$..." paths match exactly ([*] for any index).
+	DiffIgnore []string
+	// RedactFields lists the response fields masked in all output and
+	// history, in the patterns of DiffIgnore (see resolveRedactFields).
+	RedactFields []string
+	// RequestIDHeader carries the id attached to every call, to find it in
+	// the backend's logs; empty when request ids are turned off.
+	RequestIDHeader string
+	// Aliases map short names to api command lines: [aliases] overridden
+	// by the active project's [projects.<name>.aliases].
+	Aliases map[string]string
+	// MarkerTemplate is agent_marker as configured. AgentMarker is the
+	// same with {session} replaced by Session (see ResolveSession), which
+	// is set only when the template has the placeholder.
+	MarkerTemplate string
+	Session        string
+	// ConfigHash fingerprints the config file so a daemon started from an
+	// older version is never used.
+	ConfigHash string
+}
+
+// LoadConfig resolves the active env of the active project.
+func LoadConfig(configPath string) (*Config, error) {
+	fc, hash, err := loadFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return resolveEnv(configPath, fc, hash, fc.ActiveEnv)
+}
+
+// LoadConfigForEnv resolves another env of the active project, for
+// commands that compare or sweep environments.
+func LoadConfigForEnv(configPath string, env string) (*Config, error) {
+	fc, hash, err := loadFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return resolveEnv(configPath, fc, hash, env)
+}
+
+// ProjectEnvNames lists the envs configured for the active project.
+func ProjectEnvNames(configPath string) ([]string, error) {
+	fc, _, err := loadFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return sortedNames(fc.Projects[fc.ActiveProject].Envs), nil
+}
+
+// validTag is what an env tag may be: one word, so lists of them can be
+// written and matched without quoting.
+var validTag = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// EnvsTagged lists the envs of the active project whose tags include tag,
+// so a command can run over a group of envs (all the previews, say)
+// without naming each. No env carrying it is an error naming the tags
+// that are in use.
+func EnvsTagged(configPath, tag string) ([]string, error) {
+	fc, _, err := loadFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	envs := fc.Projects[fc.ActiveProject].Envs
+	tagged := make([]string, 0)
+	known := map[string]bool{}
+	for _, env := range sortedNames(envs) {
+		for _, t := range envs[env].Tags {
+			known[t] = true
+			if t == tag {
+				tagged = append(tagged, env)
+				break
+			}
+		}
+	}
+	if len(tagged) == 0 {
+		if len(known) == 0 {
+			return nil, NewErrorHint(ExitConfig, fmt.Sprintf("No env of project '%s' is tagged '%s'", fc.ActiveProject, tag), fmt.Sprintf(`Tag envs with tags = ["%s"] under [projects.%s.envs.<env>].`, tag, fc.ActiveProject))
+		}
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("No env of project '%s' is tagged '%s'%s", fc.ActiveProject, tag, DidYouMean(tag, sortedNames(known))), fmt.Sprintf("Tags in use: %s.", strings.Join(sortedNames(known), ", ")))
+	}
+	return tagged, nil
+}
+
+func loadFileConfig(configPath string) (*fileConfig, string, error) {
+	fc, layers, err := decodeLayered(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if strings.TrimSpace(fc.ActiveProject) == "" {
+		return nil, "", NewErrorHint(ExitConfig, "Missing/invalid 'active_project' in config", `Add active_project = "<name>" naming a [projects.<name>] table.`)
+	}
+	if strings.TrimSpace(fc.ActiveEnv) == "" {
+		return nil, "", NewErrorHint(ExitConfig, "Missing/invalid 'active_env' in config", `Add active_env = "<env>" naming an env of the active project.`)
+	}
+	if strings.TrimSpace(fc.DefaultToken) == "" {
+		return nil, "", NewErrorHint(ExitConfig, "Missing/invalid 'default_token' in config", `Add default_token = "<name>" naming one of the env's tokens.`)
+	}
+	if strings.TrimSpace(fc.AgentMarker) == "" {
+		return nil, "", NewErrorHint(ExitConfig, "Missing/invalid 'agent_marker' in config", `Add agent_marker = "[agent-test]" (any string the backend tolerates in write bodies).`)
+	}
+	if fc.Strict == nil {
+		return nil, "", NewErrorHint(ExitConfig, "Missing/invalid 'strict' in config (expected true/false)", "Add strict = true to validate calls against the spec, or strict = false.")
+	}
+
+	if fc.RequestIDHeader != nil && strings.ContainsAny(*fc.RequestIDHeader, " \t:") {
+		return nil, "", NewErrorHint(ExitConfig, fmt.Sprintf("Invalid request_id_header %q (must be a header name)", *fc.RequestIDHeader), `Use a header name such as request_id_header = "X-Request-Id", or "" to send none.`)
+	}
+
+	if _, ok := fc.Projects[fc.ActiveProject]; !ok {
+		return nil, "", NewErrorHint(ExitConfig, fmt.Sprintf("Active project '%s'%s not found under [projects]%s", fc.ActiveProject, fc.setIn("active_project"), DidYouMean(fc.ActiveProject, sortedNames(fc.Projects))), fmt.Sprintf("Set active_project to one of: %s.", strings.Join(sortedNames(fc.Projects), ", ")))
+	}
+	return fc, fmt.Sprintf("%x", sha256.Sum256(layers)), nil
+}
+
+func resolveEnv(configPath string, fc *fileConfig, hash string, env string) (*Config, error) {
+	project := fc.Projects[fc.ActiveProject]
+	envCfg, ok := project.Envs[env]
+	if !ok {
+		label := "Env"
+		if env == fc.ActiveEnv {
+			label = "Active env"
+		}
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("%s '%s' not found under project '%s'%s", label, env, fc.ActiveProject, DidYouMean(env, sortedNames(project.Envs))), fmt.Sprintf("Use one of the configured envs: %s.", strings.Join(sortedNames(project.Envs), ", ")))
+	}
+
+	if strings.TrimSpace(envCfg.APIBase) == "" {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Missing/invalid api_base for %s/%s", fc.ActiveProject, env), fmt.Sprintf(`Add api_base = "https://host/api" under [projects.%s.envs.%s].`, fc.ActiveProject, env))
+	}
+	if strings.TrimSpace(envCfg.OpenAPIURL) == "" {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Missing/invalid openapi_url for %s/%s", fc.ActiveProject, env), fmt.Sprintf(`Add openapi_url = "https://host/openapi.json" under [projects.%s.envs.%s].`, fc.ActiveProject, env))
+	}
+	if envCfg.APIMode != "read-only" && envCfg.APIMode != "safe-updates" && envCfg.APIMode != "full-access" {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Missing/invalid api_mode for %s/%s (expected read-only|safe-updates|full-access)", fc.ActiveProject, env), fmt.Sprintf(`Add api_mode = "read-only" under [projects.%s.envs.%s] (the safest choice).`, fc.ActiveProject, env))
+	}
+
+	normalizedTokens := make(map[string]string)
+	tokenErrors := map[string]error{}
+	interpolated := false
+	for k, v := range envCfg.Tokens {
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		if k == "" || v == "" {
+			continue
+		}
+		expanded, err := expandTokenEnv(v)
+		if err != nil {
+			// Kept by name: the error is for the call that uses it.
+			tokenErrors[k] = NewErrorHint(ExitToken, fmt.Sprintf("Token '%s' of %s/%s: %s", k, fc.ActiveProject, env, err), fmt.Sprintf("Export the variable before running, or put the value under [projects.%s.envs.%s.tokens].", fc.ActiveProject, env))
+			expanded = ""
+		}
+		interpolated = interpolated || expanded != v
+		normalizedTokens[k] = expanded
+	}
+	if len(normalizedTokens) == 0 {
+		return nil, NewErrorHint(ExitToken, fmt.Sprintf("No usable tokens defined for %s/%s", fc.ActiveProject, env), fmt.Sprintf(`Add a non-empty token: [projects.%s.envs.%s.tokens] %s = "<token>".`, fc.ActiveProject, env, fc.DefaultToken))
+	}
+
+	healthPath := strings.TrimSpace(envCfg.HealthPath)
+	if healthPath == "" {
+		healthPath = DefaultHealthPath
+	}
+	if !strings.HasPrefix(healthPath, "/") {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid health_path for %s/%s (must start with '/')", fc.ActiveProject, env), fmt.Sprintf(`Use an absolute path such as health_path = "/%s".`, strings.TrimLeft(healthPath, "/")))
+	}
+
+	identityPath := strings.TrimSpace(envCfg.IdentityPath)
+	if identityPath != "" && !strings.HasPrefix(identityPath, "/") {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid identity_path for %s/%s (must start with '/')", fc.ActiveProject, env), fmt.Sprintf(`Use an absolute path such as identity_path = "/%s".`, strings.TrimLeft(identityPath, "/")))
+	}
+
+	pathBases, err := resolvePathBases(envCfg.PathBases)
+	if err != nil {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid path_bases for %s/%s: %s", fc.ActiveProject, env, ExitMessage(err)), fmt.Sprintf(`Map path prefixes to absolute URLs under [projects.%s.envs.%s.path_bases], e.g. "/auth" = "https://auth.example.com".`, fc.ActiveProject, env))
+	}
+
+	allowSpecServers := make([]string, 0, len(envCfg.AllowSpecServers))
+	for _, server := range envCfg.AllowSpecServers {
+		u, err := url.Parse(strings.TrimSpace(server))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid allow_spec_servers entry %q for %s/%s: not an absolute http(s) URL", server, fc.ActiveProject, env), `List the servers by scheme and host, e.g. allow_spec_servers = ["https://files.example.com"].`)
+		}
+		allowSpecServers = append(allowSpecServers, u.Scheme+"://"+u.Host)
+	}
+
+	for name, ts := range envCfg.TokenSecurity {
+		if _, ok := normalizedTokens[name]; !ok {
+			return nil, NewErrorHint(ExitConfig, fmt.Sprintf("token_security names token '%s', which %s/%s does not define%s", name, fc.ActiveProject, env, DidYouMean(name, sortedNames(normalizedTokens))), fmt.Sprintf("Declare token_security only for the tokens under [projects.%s.envs.%s.tokens].", fc.ActiveProject, env))
+		}
+		if strings.TrimSpace(ts.Scheme) == "" {
+			return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Missing scheme in token_security.%s for %s/%s", name, fc.ActiveProject, env), `Set scheme to a securitySchemes name of the spec or a type, e.g. scheme = "oauth2".`)
+		}
+	}
+
+	for _, tag := range envCfg.Tags {
+		if !validTag.MatchString(tag) {
+			return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid tag %q for %s/%s", tag, fc.ActiveProject, env), `Tags are single words of letters, digits, '.', '_' and '-', e.g. tags = ["ephemeral", "ci"].`)
+		}
+	}
+
+	softDelete, err := resolveSoftDelete(envCfg.SoftDelete)
+	if err != nil {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid soft_delete for %s/%s: %s", fc.ActiveProject, env, ExitMessage(err)), fmt.Sprintf(`Declare it as [projects.%s.envs.%s.soft_delete] with method = "PATCH" and body = { status = "archived" }.`, fc.ActiveProject, env))
+	}
+
+	requiredHeaders, err := resolveRequiredHeaders(envCfg.RequiredHeaders)
+	if err != nil {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid required_headers for %s/%s: %s", fc.ActiveProject, env, ExitMessage(err)), fmt.Sprintf(`Declare each header as [projects.%s.envs.%s.required_headers.X-Change-Ticket] with an optional pattern = "^CHG-[0-9]+$" and example = "CHG-1234".`, fc.ActiveProject, env))
+	}
+
+	redactFields, err := resolveRedactFields(fc.RedactFields)
+	if err != nil {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid redact_fields: %s", ExitMessage(err)), `Name a key at any depth ("ssn" or "*.ssn") or a path from the root ("$.customer.ssn", "$.items[*].ssn").`)
+	}
+
+	marker, session := fc.AgentMarker, ""
+	if strings.Contains(marker, SessionPlaceholder) {
+		if session, err = ResolveSession(filepath.Dir(configPath)); err != nil {
+			return nil, err
+		}
+		marker = strings.ReplaceAll(marker, SessionPlaceholder, session)
+		// A daemon running for another session must not send this one's
+		// calls: make it look like another config.
+		hash = fmt.Sprintf("%x", sha256.Sum256([]byte(hash+"\n"+session)))
+	}
+
+	if interpolated {
+		// Tokens read from the environment belong to this process: a
+		// daemon started with other values must look like another config.
+		names := sortedNames(normalizedTokens)
+		for _, name := range names {
+			hash += "\n" + name + "=" + normalizedTokens[name]
+		}
+		hash = fmt.Sprintf("%x", sha256.Sum256([]byte(hash)))
+	}
+
+	aliases, err := resolveAliases(fc.Aliases, project.Aliases)
+	if err != nil {
+		return nil, NewErrorHint(ExitConfig, fmt.Sprintf("Invalid aliases: %s", ExitMessage(err)), `Map a one-word name to an api command, e.g. open-orders = "resource list orders --query status=open".`)
+	}
+
+	// request_id_header = "" turns request ids off; unset means the default.
+	requestIDHeader := DefaultRequestIDHeader
+	if fc.RequestIDHeader != nil {
+		requestIDHeader = strings.TrimSpace(*fc.RequestIDHeader)
+	}
+
+	Logger.Debug("config loaded", "path", configPath, "project", fc.ActiveProject, "env", env, "api_mode", envCfg.APIMode, "strict", *fc.Strict)
+	return &Config{
+		ConfigDir:        filepath.Dir(configPath),
+		ActiveProject:    fc.ActiveProject,
+		ActiveEnv:        env,
+		DefaultTokenName: fc.DefaultToken,
+		AgentMarker:      marker,
+		MarkerTemplate:   fc.AgentMarker,
+		Session:          session,
+		Strict:           *fc.Strict,
+		APIBase:          strings.TrimRight(envCfg.APIBase, "/"),
+		APIMode:          envCfg.APIMode,
+		OpenAPIURL:       envCfg.OpenAPIURL,
+		Tags:             envCfg.Tags,
+		GraphQLURL:       graphQLURL(strings.TrimRight(envCfg.APIBase, "/"), strings.TrimSpace(envCfg.GraphQLURL)),
+		HealthPath:       healthPath,
+		IdentityPath:     identityPath,
+		PathBases:        pathBases,
+		AllowSpecServers: allowSpecServers,
+		SoftDelete:       softDelete,
+		RequiredHeaders:  requiredHeaders,
+		TokenSecurity:    envCfg.TokenSecurity,
+		Tokens:           normalizedTokens,
+		tokenErrors:      tokenErrors,
+		TunnelCommand:    strings.TrimSpace(fc.TunnelCommand),
+		DiffIgnore:       fc.DiffIgnore,
+		RedactFields:     redactFields,
+		RequestIDHeader:  requestIDHeader,
+		Aliases:          aliases,
+		ConfigHash:       hash,
+	}, nil
+}
+
+// PathBase sends the calls whose path starts with Prefix to Base instead
+// of api_base. The path is appended whole, as to api_base.
+type PathBase struct {
+	Prefix string
+	Base   string
+}
+
+// resolvePathBases validates the path_bases of an env and orders them
+// longest prefix first. "/auth", "/auth/" and "/auth/**" are the same
+// prefix.
+func resolvePathBases(m map[string]string) ([]PathBase, error) {
+	out := make([]PathBase, 0, len(m))
+	for _, prefix := range sortedNames(m) {
+		p := strings.TrimRight(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(prefix), "**"), "*"), "/")
+		if !strings.HasPrefix(p, "/") {
+			return nil, NewError(ExitConfig, fmt.Sprintf("prefix %q must start with '/' below the root", prefix))
+		}
+		base := strings.TrimRight(strings.TrimSpace(m[prefix]), "/")
+		if u, err := url.Parse(base); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, NewError(ExitConfig, fmt.Sprintf("base %q of %s is not an absolute http(s) URL", m[prefix], prefix))
+		}
+		out = append(out, PathBase{Prefix: p, Base: base})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].Prefix) > len(out[j].Prefix) })
+	return out, nil
+}
+
+// resolveRedactFields normalizes redact_fields to the patterns of
+// DiffIgnore: "*.ssn" and "$..ssn" are the bare key "ssn", which matches
+// at any depth; "$..." paths match from the root.
+func resolveRedactFields(fields []string) ([]string, error) {
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		p := strings.TrimSpace(f)
+		switch {
+		case strings.HasPrefix(p, "*."):
+			p = p[2:]
+		case strings.HasPrefix(p, "$.."):
+			p = p[3:]
+		}
+		if p == "" || p == "$" || (!strings.HasPrefix(p, "$") && strings.ContainsAny(p, ".[]*$")) {
+			return nil, NewError(ExitConfig, fmt.Sprintf("%q is neither a key name nor a path from the root", f))
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// TokenSecurity is what a token is, in the terms of the spec's security:
+// Scheme is the name of one of its securitySchemes or a scheme type
+// (apiKey, http, bearer, basic, oauth2, openIdConnect); Scopes, when set,
+// are the scopes the token was granted.
+type TokenSecurity struct {
+	Scheme string   `toml:"scheme"`
+	Scopes []string `toml:"scopes"`
+}
+
+// resolveAliases merges the global and the project aliases, the project's
+// winning.
+func resolveAliases(global, project map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(global)+len(project))
+	for _, m := range []map[string]string{global, project} {
+		for _, name := range sortedNames(m) {
+			command := strings.TrimSpace(m[name])
+			switch {
+			case name == "" || strings.ContainsAny(name, " \t") || strings.HasPrefix(name, "-"):
+				return nil, NewError(ExitConfig, fmt.Sprintf("%q is not a command name", name))
+			case command == "":
+				return nil, NewError(ExitConfig, fmt.Sprintf("alias %s has no command", name))
+			}
+			out[name] = command
+		}
+	}
+	return out, nil
+}
+
+// RequiredHeader is a header every write of an env must carry. Pattern,
+// when set, is what its value must match; Example shows a valid value.
+type RequiredHeader struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Example string
+}
+
+func resolveRequiredHeaders(m map[string]requiredHeaderEntry) ([]RequiredHeader, error) {
+	out := make([]RequiredHeader, 0, len(m))
+	for _, name := range sortedNames(m) {
+		e := m[name]
+		h := RequiredHeader{Name: http.CanonicalHeaderKey(strings.TrimSpace(name)), Example: strings.TrimSpace(e.Example)}
+		if h.Name == "" || strings.ContainsAny(h.Name, " \t:") {
+			return nil, NewError(ExitConfig, fmt.Sprintf("%q is not a header name", name))
+		}
+		if e.Pattern != "" {
+			re, err := regexp.Compile(e.Pattern)
+			if err != nil {
+				return nil, NewError(ExitConfig, fmt.Sprintf("pattern of %s does not compile: %v", name, err))
+			}
+			h.Pattern = re
+		}
+		if h.Example != "" && h.Pattern != nil && !h.Pattern.MatchString(h.Example) {
+			return nil, NewError(ExitConfig, fmt.Sprintf("example %q of %s does not match its pattern %s", h.Example, name, e.Pattern))
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// SoftDelete is the request that archives a resource instead of deleting
+// it. Path is a template where {path} is the path of the DELETE; Body is
+// JSON in which {{agent_marker}} stands for the marker.
+type SoftDelete struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+func resolveSoftDelete(e *softDeleteEntry) (*SoftDelete, error) {
+	if e == nil {
+		return nil, nil
+	}
+	sd := &SoftDelete{Method: strings.ToUpper(strings.TrimSpace(e.Method)), Path: strings.TrimSpace(e.Path)}
+	switch sd.Method {
+	case "":
+		sd.Method = "PATCH"
+	case "PATCH", "PUT", "POST":
+	default:
+		return nil, NewError(ExitConfig, fmt.Sprintf("method %q must be PATCH, PUT or POST", e.Method))
+	}
+	if sd.Path == "" {
+		sd.Path = "{path}"
+	}
+	if !strings.HasPrefix(sd.Path, "{path}") && !strings.HasPrefix(sd.Path, "/") {
+		return nil, NewError(ExitConfig, fmt.Sprintf("path %q must start with {path} or '/'", e.Path))
+	}
+	if len(e.Body) == 0 {
+		return nil, NewError(ExitConfig, "body is required, e.g. { status = \"archived\" }")
+	}
+	raw, err := json.Marshal(e.Body)
+	if err != nil {
+		return nil, NewError(ExitConfig, fmt.Sprintf("body is not JSON-encodable: %v", err))
+	}
+	sd.Body = string(raw)
+	return sd, nil
+}
+
+// Request returns the method, path and body that soft-delete the resource
+// at path (query kept) for an env whose marker is marker.
+func (sd *SoftDelete) Request(path, marker string) (string, string, string) {
+	p, query, hasQuery := strings.Cut(path, "?")
+	target := strings.ReplaceAll(sd.Path, "{path}", p)
+	if hasQuery {
+		target += "?" + query
+	}
+	quoted, _ := json.Marshal(marker)
+	body := strings.ReplaceAll(sd.Body, "{{agent_marker}}", strings.Trim(string(quoted), `"`))
+	return sd.Method, target, body
+}
+
+// BaseFor returns the base URL serving path (relative to api_base, query
+// allowed): the base of the longest path_bases prefix it falls under, or
+// APIBase.
+func (c *Config) BaseFor(path string) string {
+	p, _, _ := strings.Cut(path, "?")
+	for _, pb := range c.PathBases {
+		if p == pb.Prefix || strings.HasPrefix(p, pb.Prefix+"/") {
+			return pb.Base
+		}
+	}
+	return c.APIBase
+}
+
+// BuildURL returns the URL a call to path is sent to.
+func (c *Config) BuildURL(path string) string {
+	return c.BaseFor(path) + path
+}
+
+// Bases lists every base URL of the env, APIBase first.
+func (c *Config) Bases() []string {
+	out := []string{c.APIBase}
+	for _, pb := range c.PathBases {
+		out = append(out, pb.Base)
+	}
+	return out
+}
+
+// PathOf is the reverse of BuildURL: the path, relative to api_base, whose
+// call is sent to rawURL, or false when no base of the env serves it.
+func (c *Config) PathOf(rawURL string) (string, bool) {
+	for _, base := range c.Bases() {
+		path, ok := strings.CutPrefix(rawURL, base)
+		if !ok {
+			continue
+		}
+		if path == "" || path[0] == '?' {
+			path = "/" + path
+		}
+		if strings.HasPrefix(path, "/") && c.BaseFor(path) == base {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// ResolveToken returns the name and value of the named token, or of the
+// default token when tokenNameOverride is empty.
+func ResolveToken(cfg *Config, tokenNameOverride string) (string, string, error) {
+	tokenName := strings.TrimSpace(tokenNameOverride)
+	if tokenName == "" {
+		tokenName = cfg.DefaultTokenName
+	}
+	value, ok := cfg.Tokens[tokenName]
+	if err := cfg.tokenErrors[tokenName]; err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", NewErrorHint(ExitToken, fmt.Sprintf("Token '%s' not found for %s/%s%s", tokenName, cfg.ActiveProject, cfg.ActiveEnv, DidYouMean(tokenName, sortedNames(cfg.Tokens))), fmt.Sprintf("Use --token with one of: %s.", strings.Join(sortedNames(cfg.Tokens), ", ")))
+	}
+	if strings.TrimSpace(value) == "" {
+		return "", "", NewError(ExitToken, fmt.Sprintf("Token '%s' is empty", tokenName))
+	}
+	return tokenName, value, nil
+}
+
+// tokenEnvRef matches a ${NAME} reference in a token value.
+var tokenEnvRef = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// validEnvName is the shape of an environment variable name.
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandTokenEnv replaces the ${NAME} references of a token value with the
+// environment variables they name, so secrets can stay out of the file.
+// Any other $ is part of the value. A variable that is unset or empty is
+// an error, as is a reference that is not closed or names no variable.
+func expandTokenEnv(value string) (string, error) {
+	if i := strings.LastIndex(value, "${"); i >= 0 && !strings.Contains(value[i:], "}") {
+		return "", fmt.Errorf("%s has no closing }", value[i:])
+	}
+	var failed error
+	out := tokenEnvRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		switch {
+		case failed != nil:
+		case !validEnvName.MatchString(name):
+			failed = fmt.Errorf("%s does not name an environment variable", ref)
+		case os.Getenv(name) == "":
+			failed = fmt.Errorf("environment variable %s is not set or empty", name)
+		default:
+			return os.Getenv(name)
+		}
+		return ref
+	})
+	return out, failed
+}
+
+// graphQLURL resolves a configured graphql_url against api_base.
+func graphQLURL(apiBase, configured string) string {
+	if strings.HasPrefix(configured, "/") {
+		return apiBase + configured
+	}
+	return configured
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
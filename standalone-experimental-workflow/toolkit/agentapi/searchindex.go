@@ -0,0 +1,252 @@
+package agentapi
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchFields are the operation fields a query term is matched against,
+// in weight order: a hit in field i scores 10-min(i, 4).
+const searchFields = 5
+
+// searchIndex answers the same queries as SearchOperations without scanning
+// every field of every operation per term. Each field is split into
+// tokens, its runs of letters and digits (so "/user_profiles/{id}" yields
+// user, profiles and id, and listActivities stays one token), and a term
+// made only of letters and digits is a substring of a field exactly when
+// it is a substring of one of the field's tokens. The index therefore
+// keeps each distinct token once, with the operations and fields it occurs
+// in, and finds the tokens containing a term through their trigrams.
+// Terms with other characters ("/orders", "order_id") fall back to a scan.
+type searchIndex struct {
+	ops []Operation
+	// fields holds each operation's lower-cased fields for fallback scans.
+	fields [][searchFields]string
+
+	// order is each operation's position by path and method, the
+	// tie-break between equal scores.
+	order []int32
+
+	tokens   []string
+	postings [][]tokenPosting
+	grams    map[string][]int32
+}
+
+// tokenPosting records that a token occurs in operation op, in the fields
+// whose bits are set in mask.
+type tokenPosting struct {
+	op   int32
+	mask uint8
+}
+
+func newSearchIndex(ops []Operation) *searchIndex {
+	ix := &searchIndex{ops: ops, fields: make([][searchFields]string, len(ops)), grams: map[string][]int32{}}
+	byToken := map[string]int32{}
+	type tokenFields struct {
+		id   int32
+		mask uint8
+	}
+	var seen []tokenFields // this operation's tokens, few enough to search linearly
+	for i, op := range ops {
+		f := searchFieldsOf(op)
+		ix.fields[i] = f
+		seen = seen[:0]
+		for field, text := range f {
+			forEachToken(text, func(tok string) {
+				id, ok := byToken[tok]
+				if !ok {
+					id = int32(len(ix.tokens))
+					byToken[tok] = id
+					ix.tokens = append(ix.tokens, tok)
+					ix.postings = append(ix.postings, nil)
+					forEachTrigram(tok, func(g string) {
+						// A token repeating a trigram would add its id twice.
+						if list := ix.grams[g]; len(list) == 0 || list[len(list)-1] != id {
+							ix.grams[g] = append(list, id)
+						}
+					})
+				}
+				for k := range seen {
+					if seen[k].id == id {
+						seen[k].mask |= 1 << field
+						return
+					}
+				}
+				seen = append(seen, tokenFields{id: id, mask: 1 << field})
+			})
+		}
+		for _, t := range seen {
+			ix.postings[t.id] = append(ix.postings[t.id], tokenPosting{op: int32(i), mask: t.mask})
+		}
+	}
+	byPath := make([]int32, len(ops))
+	for i := range byPath {
+		byPath[i] = int32(i)
+	}
+	sort.Slice(byPath, func(a, b int) bool {
+		x, y := &ops[byPath[a]], &ops[byPath[b]]
+		if x.Path != y.Path {
+			return x.Path < y.Path
+		}
+		return x.Method < y.Method
+	})
+	ix.order = make([]int32, len(ops))
+	for pos, i := range byPath {
+		ix.order[i] = int32(pos)
+	}
+	return ix
+}
+
+func searchFieldsOf(op Operation) [searchFields]string {
+	return [searchFields]string{
+		strings.ToLower(op.Path),
+		strings.ToLower(op.OperationID),
+		strings.ToLower(op.Summary),
+		strings.ToLower(op.Description),
+		strings.ToLower(strings.Join(op.Tags, " ")),
+	}
+}
+
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// forEachToken calls fn with each run of letters and digits in text.
+func forEachToken(text string, fn func(string)) {
+	start := -1
+	for i, r := range text {
+		switch {
+		case isTokenRune(r) && start < 0:
+			start = i
+		case !isTokenRune(r) && start >= 0:
+			fn(text[start:i])
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fn(text[start:])
+	}
+}
+
+// forEachTrigram calls fn with each three-rune substring of s, in order.
+func forEachTrigram(s string, fn func(string)) {
+	var starts [3]int
+	n := 0
+	for i := range s {
+		if n >= 3 {
+			fn(s[starts[n%3]:i])
+		}
+		starts[n%3] = i
+		n++
+	}
+	if n >= 3 {
+		fn(s[starts[n%3]:])
+	}
+}
+
+// match returns, per operation, the fields that contain v.
+func (ix *searchIndex) match(v string, masks map[int32]uint8) {
+	for _, r := range v {
+		if !isTokenRune(r) {
+			for i, f := range ix.fields {
+				for field, text := range f {
+					if strings.Contains(text, v) {
+						masks[int32(i)] |= 1 << field
+					}
+				}
+			}
+			return
+		}
+	}
+	for _, id := range ix.tokensContaining(v) {
+		for _, p := range ix.postings[id] {
+			masks[p.op] |= p.mask
+		}
+	}
+}
+
+// tokensContaining returns the ids of the tokens v is a substring of.
+func (ix *searchIndex) tokensContaining(v string) []int32 {
+	grams := make([]string, 0, len(v))
+	forEachTrigram(v, func(g string) { grams = append(grams, g) })
+	if len(grams) == 0 {
+		// Too short for a trigram: the token list is far smaller than the
+		// text it came from, so scan it.
+		out := make([]int32, 0)
+		for id, tok := range ix.tokens {
+			if strings.Contains(tok, v) {
+				out = append(out, int32(id))
+			}
+		}
+		return out
+	}
+	lists := make([][]int32, 0, len(grams))
+	for _, g := range grams {
+		list := ix.grams[g]
+		if len(list) == 0 {
+			return nil
+		}
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	out := make([]int32, 0, len(lists[0]))
+	for _, id := range lists[0] {
+		inAll := true
+		for _, list := range lists[1:] {
+			k := sort.Search(len(list), func(k int) bool { return list[k] >= id })
+			if k == len(list) || list[k] != id {
+				inAll = false
+				break
+			}
+		}
+		// Shared trigrams do not make a substring ("abcab" has every
+		// trigram of "abcabc"), so confirm.
+		if inAll && strings.Contains(ix.tokens[id], v) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// search ranks the indexed operations like SearchOperations.
+func (ix *searchIndex) search(query, methodFilter string) []Operation {
+	methodFilter = strings.ToUpper(strings.TrimSpace(methodFilter))
+	scores := map[int32]int{}
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		masks := map[int32]uint8{}
+		for _, v := range TermVariants(term) {
+			ix.match(v, masks)
+		}
+		for op, mask := range masks {
+			for field := 0; field < searchFields; field++ {
+				if mask&(1<<field) != 0 {
+					scores[op] += 10 - min(field, 4)
+				}
+			}
+		}
+	}
+	type hit struct {
+		op    int32
+		score int
+	}
+	hits := make([]hit, 0, len(scores))
+	for i, score := range scores {
+		if methodFilter != "" && ix.ops[i].Method != methodFilter {
+			continue
+		}
+		hits = append(hits, hit{i, score})
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].score != hits[b].score {
+			return hits[a].score > hits[b].score
+		}
+		return ix.order[hits[a].op] < ix.order[hits[b].op]
+	})
+	out := make([]Operation, len(hits))
+	for k, h := range hits {
+		out[k] = ix.ops[h.op]
+		out[k].Score = h.score
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package agentapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The state and cache files under the config directory are shared by every
+// process of a config: agents running side by side, the daemon, the
+// proxy. They are replaced whole with WriteFileAtomic, so a reader never
+// sees half a file, and read-modify-write sequences hold LockFile. Both
+// only use what every platform has (exclusive create and rename), so they
+// behave the same on Windows agents. Modes such as 0o600 are applied where
+// the platform has them; on Windows a file takes the access list of its
+// directory, which under a user's profile is that user's only.
+
+const (
+	// lockWait is how long LockFile waits for another process's lock.
+	lockWait = 10 * time.Second
+	// lockStale is the age past which a lock is taken to be left over by
+	// a process that died holding it.
+	lockStale = 30 * time.Second
+	lockRetry = 10 * time.Millisecond
+)
+
+// WriteFileAtomic replaces path with data: written to a temporary file
+// next to it, flushed, then renamed over it. The directory must exist.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err != nil {
+		return err
+	}
+	return renameRetry(tmp, path)
+}
+
+// renameRetry renames, retrying briefly on Windows, where replacing a file
+// another process has open fails until it closes it.
+func renameRetry(from, to string) error {
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := os.Rename(from, to)
+		if err == nil || runtime.GOOS != "windows" || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// LockFile takes the lock of path, a path+".lock" file created
+// exclusively, waiting up to lockWait for another holder and breaking a
+// lock older than lockStale. The lock holds a token unique to this taking
+// and is touched while held, so a slow holder's lock never looks stale. The
+// returned func releases it, removing the file only while it still holds
+// the token: a lock broken as stale and taken by another process is left
+// to that process.
+func LockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	token := fmt.Sprintf("%d %s\n", os.Getpid(), hex.EncodeToString(b))
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(lock)
+				return nil, err
+			}
+			return holdLock(lock, token), nil
+		}
+		// On Windows, a lock being deleted reports access denied: wait
+		// for it as for one that exists.
+		if !errors.Is(err, os.ErrExist) && !(runtime.GOOS == "windows" && os.IsPermission(err)) {
+			return nil, err
+		}
+		if info, serr := os.Stat(lock); serr == nil && time.Since(info.ModTime()) > lockStale {
+			Logger.Debug("breaking stale lock", "lock", lock, "age", time.Since(info.ModTime()).Round(time.Second).String())
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another process (remove it if none is running)", lock)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// holdLock touches lock while it holds token and returns the func that
+// stops doing so and removes it.
+func holdLock(lock, token string) func() {
+	owned := func() bool {
+		raw, err := os.ReadFile(lock)
+		return err == nil && string(raw) == token
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockStale / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !owned() {
+					return
+				}
+				now := time.Now()
+				_ = os.Chtimes(lock, now, now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if owned() {
+				os.Remove(lock)
+			} else {
+				Logger.Debug("lock taken over, left in place", "lock", lock)
+			}
+		})
+	}
+}
+
+// SafeFileName makes a project or env name usable in a file name on every
+// platform: characters other than letters, digits, '.', '_' and '-' (':'
+// or '\' are not allowed on Windows, '/' nowhere) become '_'.
+func SafeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return r
+		}
+		return '_'
+	}, name)
+}
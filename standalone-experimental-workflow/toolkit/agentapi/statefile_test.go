@@ -0,0 +1,49 @@
+package agentapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFileRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Fatalf("lock not created: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock left after release: %v", err)
+	}
+	// Taken again once released.
+	unlock, err = LockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestLockFileReleaseKeepsTakenOverLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another process broke the lock as stale and took it.
+	other := []byte("99999 0123456789abcdef\n")
+	if err := os.WriteFile(path+".lock", other, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	raw, err := os.ReadFile(path + ".lock")
+	if err != nil {
+		t.Fatalf("release removed another process's lock: %v", err)
+	}
+	if string(raw) != string(other) {
+		t.Fatalf("lock rewritten: %q", raw)
+	}
+}
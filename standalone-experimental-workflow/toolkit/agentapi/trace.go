@@ -0,0 +1,36 @@
+package agentapi
+
+import "context"
+
+// Tracer records the steps of a call as spans. The CLIs install one that
+// exports OpenTelemetry spans when OTLP is configured; without one, spans
+// cost nothing.
+type Tracer interface {
+	// Start opens a span as a child of the span in ctx, if any, and returns
+	// the context carrying it and the function ending it. Attributes are
+	// alternating keys and values, as for Logger.
+	Start(ctx context.Context, name string, attrs ...any) (context.Context, func(err error, attrs ...any))
+	// TraceParent is the W3C traceparent header of the span in ctx, or "".
+	TraceParent(ctx context.Context) string
+}
+
+// DefaultTracer, when set, traces spec fetches and Client calls, and the
+// requests they send carry its traceparent header.
+var DefaultTracer Tracer
+
+// StartSpan opens a span with DefaultTracer, or does nothing without one.
+func StartSpan(ctx context.Context, name string, attrs ...any) (context.Context, func(err error, attrs ...any)) {
+	if DefaultTracer == nil {
+		return ctx, func(error, ...any) {}
+	}
+	return DefaultTracer.Start(ctx, name, attrs...)
+}
+
+// TraceParent returns the traceparent header for requests made in ctx, or
+// "" when nothing is traced.
+func TraceParent(ctx context.Context) string {
+	if DefaultTracer == nil {
+		return ""
+	}
+	return DefaultTracer.TraceParent(ctx)
+}
@@ -0,0 +1,88 @@
+package agentapi
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// EnvReport is what ValidateConfig found wrong with one env; no Problems
+// means it loads and is usable.
+type EnvReport struct {
+	Project string
+	Env     string
+	Active  bool
+	APIMode string
+	// Source is the config file the env is defined in: the files, global
+	// one first, when layers each set part of it.
+	Source   string
+	Problems []Problem
+}
+
+// Problem is one thing wrong with an env and the config file it is in.
+type Problem struct {
+	Err    error
+	Source string
+}
+
+// ValidateConfig checks every env of every project of the config, not only
+// the active one: whatever loading it checks (api_mode, tokens, paths,
+// soft_delete, ...), then that api_base and openapi_url are absolute
+// http(s) URLs, that default_token is one of its tokens and that the
+// ${VAR} references of its tokens resolve. Envs are in project then env
+// order. Each report and problem names the config file it comes from, as
+// the global config is a layer under the project's (ConfigLayers). The
+// error is for a file that cannot be loaded at all.
+func ValidateConfig(configPath string) ([]EnvReport, error) {
+	fc, hash, err := loadFileConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]EnvReport, 0)
+	for _, project := range sortedNames(fc.Projects) {
+		envs := fc.Projects[project].Envs
+		if len(envs) == 0 {
+			source := fc.source("projects", project)
+			reports = append(reports, EnvReport{Project: project, Active: project == fc.ActiveProject, Source: source, Problems: []Problem{{
+				Err:    NewErrorHint(ExitConfig, fmt.Sprintf("Project '%s' has no envs", project), fmt.Sprintf("Add one under [projects.%s.envs.<env>].", project)),
+				Source: source,
+			}}})
+			continue
+		}
+		pfc := *fc
+		pfc.ActiveProject = project
+		for _, env := range sortedNames(envs) {
+			r := EnvReport{Project: project, Env: env, Active: project == fc.ActiveProject && env == fc.ActiveEnv, APIMode: envs[env].APIMode, Source: fc.source("projects", project, "envs", env)}
+			// add reports err against the file setting key of the env, or
+			// the env's own files when no one file does.
+			add := func(err error, key ...string) {
+				source := ""
+				if len(key) > 0 {
+					source = fc.source(append([]string{"projects", project, "envs", env}, key...)...)
+				}
+				if source == "" {
+					source = r.Source
+				}
+				r.Problems = append(r.Problems, Problem{Err: err, Source: source})
+			}
+			cfg, err := resolveEnv(configPath, &pfc, hash, env)
+			if err != nil {
+				add(err)
+				reports = append(reports, r)
+				continue
+			}
+			for _, u := range []struct{ key, value string }{{"api_base", cfg.APIBase}, {"openapi_url", cfg.OpenAPIURL}} {
+				if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+					add(NewErrorHint(ExitConfig, fmt.Sprintf("Invalid %s for %s/%s: %q is not an absolute http(s) URL", u.key, project, env, u.value), fmt.Sprintf(`Use a full URL such as %s = "https://host/...".`, u.key)), u.key)
+				}
+			}
+			if _, ok := cfg.Tokens[cfg.DefaultTokenName]; !ok {
+				add(NewErrorHint(ExitToken, fmt.Sprintf("default_token '%s' is not a token of %s/%s%s", cfg.DefaultTokenName, project, env, DidYouMean(cfg.DefaultTokenName, sortedNames(cfg.Tokens))), fmt.Sprintf("Add it under [projects.%s.envs.%s.tokens], or calls there need --token.", project, env)), "tokens")
+			}
+			for _, name := range sortedNames(cfg.tokenErrors) {
+				add(cfg.tokenErrors[name], "tokens", name)
+			}
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
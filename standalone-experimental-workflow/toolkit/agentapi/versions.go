@@ -0,0 +1,112 @@
+package agentapi
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionSegment matches a path segment naming an API version: v2, v1.1,
+// v2beta, v1alpha3.
+var versionSegment = regexp.MustCompile(`^[vV](\d+)(?:\.(\d+))?(?:(alpha|beta)(\d*))?$`)
+
+// apiVersion orders the versions of a path; an unversioned path is older
+// than any versioned one, and a prerelease older than its release.
+type apiVersion struct {
+	versioned         bool
+	major, minor      int
+	stage, prerelease int // stage: 0 alpha, 1 beta, 2 release
+}
+
+func (v apiVersion) less(o apiVersion) bool {
+	switch {
+	case v.versioned != o.versioned:
+		return !v.versioned
+	case v.major != o.major:
+		return v.major < o.major
+	case v.minor != o.minor:
+		return v.minor < o.minor
+	case v.stage != o.stage:
+		return v.stage < o.stage
+	}
+	return v.prerelease < o.prerelease
+}
+
+// splitVersion removes the version segment of path, so /v1/products and
+// /v2/products, and /products too, share one unversioned path.
+func splitVersion(path string) (string, apiVersion) {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		m := versionSegment.FindStringSubmatch(seg)
+		if m == nil {
+			continue
+		}
+		v := apiVersion{versioned: true, stage: 2}
+		v.major, _ = strconv.Atoi(m[1])
+		v.minor, _ = strconv.Atoi(m[2])
+		switch m[3] {
+		case "alpha":
+			v.stage = 0
+		case "beta":
+			v.stage = 1
+		}
+		v.prerelease, _ = strconv.Atoi(m[4])
+		return strings.Join(append(segments[:i:i], segments[i+1:]...), "/"), v
+	}
+	return path, apiVersion{}
+}
+
+// Deprecated reports whether the spec marks the operation deprecated.
+func (op *Operation) Deprecated() bool {
+	d, _ := op.Raw["deprecated"].(bool)
+	return d
+}
+
+// GroupVersions collapses ranked search results that are versions of one
+// operation (the same method on /v1/products, /v2/products or /products)
+// to the one to call: the latest version not deprecated, else the latest.
+// It keeps the position of the group's best-ranked member and returns,
+// for each item kept, the paths of the versions it stands for, in rank
+// order and marked when deprecated. scope separates items that never
+// group, such as matches of different envs.
+func GroupVersions[T any](items []T, operation func(T) *Operation, scope func(T) string) ([]T, [][]string) {
+	type group struct {
+		members []int
+		best    int
+		version apiVersion
+	}
+	groups := make([]*group, 0, len(items))
+	byKey := map[string]*group{}
+	for i, item := range items {
+		op := operation(item)
+		path, version := splitVersion(op.Path)
+		key := scope(item) + " " + op.Method + " " + path
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{best: i, version: version}
+			byKey[key] = g
+			groups = append(groups, g)
+		} else if best := operation(items[g.best]); best.Deprecated() && !op.Deprecated() ||
+			best.Deprecated() == op.Deprecated() && g.version.less(version) {
+			g.best, g.version = i, version
+		}
+		g.members = append(g.members, i)
+	}
+	out := make([]T, len(groups))
+	others := make([][]string, len(groups))
+	for n, g := range groups {
+		out[n] = items[g.best]
+		for _, i := range g.members {
+			if i == g.best {
+				continue
+			}
+			op := operation(items[i])
+			alt := op.Path
+			if op.Deprecated() {
+				alt += " (deprecated)"
+			}
+			others[n] = append(others[n], alt)
+		}
+	}
+	return out, others
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// expandAlias replaces an alias of the config with the api command line it
+// stands for, followed by the words given after the alias. Built-in
+// commands win over aliases of the same name, and an alias does not expand
+// to another alias.
+func expandAlias(cfg *ResolvedConfig, args []string) ([]string, error) {
+	line, ok := cfg.Aliases[args[0]]
+	if !ok || isAPICommand(args[0]) {
+		return args, nil
+	}
+	words, err := splitShellWords(line)
+	if err != nil {
+		return nil, NewCliError(ExitConfig, fmt.Sprintf("Invalid alias %s: %v", args[0], err))
+	}
+	// The command may be written as typed in a shell, "api" first.
+	if len(words) > 0 && words[0] == "api" {
+		words = words[1:]
+	}
+	if len(words) == 0 || !isAPICommand(words[0]) {
+		return nil, NewCliErrorHint(ExitConfig, fmt.Sprintf("Alias %s = %q does not start with an api command", args[0], line), fmt.Sprintf("Start it with one of: %s.", strings.Join(apiCommands, ", ")))
+	}
+	logger.Debug("alias expanded", "alias", args[0], "command", line)
+	return append(words, args[1:]...), nil
+}
+
+// aliasNames lists the aliases that do not clash with a built-in command.
+func aliasNames(cfg *ResolvedConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Aliases))
+	for name := range cfg.Aliases {
+		if !isAPICommand(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isAPICommand(name string) bool {
+	for _, c := range apiCommands {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
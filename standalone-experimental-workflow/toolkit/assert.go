@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const assertUsage = "Usage: api assert status <code|2xx>[,...] | json '<expression>' [--from last|history:<id>|<file>|-]"
+
+// RunAssertCommand implements `api assert status|json ... [--from ...]`:
+// a check of a stored response that exits 0 when it holds and 11
+// (ERR_ASSERTION_FAILED) with the actual value when it does not.
+func RunAssertCommand(cfg *ResolvedConfig, args []string) error {
+	if len(args) < 2 {
+		return NewCliError(ExitRequestBuild, assertUsage)
+	}
+	kind, want, from := args[0], args[1], "last"
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--from":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --from")
+			}
+			from = args[i]
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown assert option: %s", args[i]))
+		}
+	}
+	switch kind {
+	case "status":
+		return assertStatus(cfg, want, from)
+	case "json":
+		return assertJSON(cfg, want, from)
+	}
+	return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown assertion: %s%s", kind, agentapi.DidYouMean(kind, []string{"status", "json"})))
+}
+
+func assertStatus(cfg *ResolvedConfig, want, from string) error {
+	if from != "last" && !strings.HasPrefix(from, "history:") {
+		return NewCliError(ExitRequestBuild, "assert status reads the status from the history: use --from last or history:<id>")
+	}
+	codes := strings.Split(want, ",")
+	for _, c := range codes {
+		if _, err := statusMatches(c, 0); err != nil {
+			return err
+		}
+	}
+	e, err := historySource(cfg, from, func(e HistoryEntry) bool { return e.Status != 0 })
+	if err != nil {
+		return err
+	}
+	for _, c := range codes {
+		if ok, _ := statusMatches(c, e.Status); ok {
+			infof("ok: status %d (%s)\n", e.Status, historyLabel(e))
+			return nil
+		}
+	}
+	return NewCliError(ExitAssertionFailed, fmt.Sprintf("Assertion failed: status %d, expected %s (%s)", e.Status, want, historyLabel(e)))
+}
+
+// statusMatches checks status against a code ("201") or a class ("2xx").
+func statusMatches(code string, status int) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) == 3 && strings.HasSuffix(code, "xx") && code[0] >= '1' && code[0] <= '5' {
+		return status/100 == int(code[0]-'0'), nil
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 100 || n > 599 {
+		return false, NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid status: %s (expected a code such as 201 or a class such as 2xx)", code))
+	}
+	return status == n, nil
+}
+
+// Assertion expressions are an api query expression, optionally piped
+// through `length` or `type`, optionally compared (queryOps) with a JSON or
+// 'quoted' literal: `.items | length > 0`, `$.status == 'paid'`. Without a
+// comparison the value must exist and be neither null nor false.
+func assertJSON(cfg *ResolvedConfig, expr, from string) error {
+	body, label, err := loadQuerySource(cfg, from)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Response of %s is not JSON", label))
+	}
+	lhs, op, rhs := splitComparison(expr)
+	var want any
+	if op != "" {
+		if want, err = parseQueryLiteral(rhs); err != nil {
+			return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Invalid assertion %q: cannot read %s as a value", expr, rhs), `Compare with JSON (0, true, "paid") or a 'quoted' string.`)
+		}
+	}
+	stages := splitPipes(lhs)
+	v, found, err := EvaluateQuery(doc, stages[0])
+	if err != nil {
+		return err
+	}
+	for _, fn := range stages[1:] {
+		if v, err = applyAssertFunc(fn, v, found); err != nil {
+			return err
+		}
+		found = true
+	}
+	holds := found && v != nil && v != false
+	if op != "" {
+		holds = found && compareJSON(v, op, want)
+	}
+	if holds {
+		infof("ok: %s (%s)\n", expr, label)
+		return nil
+	}
+	got := "nothing"
+	if found {
+		got = jsonScalarString(v)
+	}
+	return NewCliError(ExitAssertionFailed, fmt.Sprintf("Assertion failed: %s, got %s (%s)", strings.TrimSpace(expr), got, label))
+}
+
+// splitComparison splits expr at its comparison operator.
+func splitComparison(expr string) (lhs, op, rhs string) {
+	i, op := topLevelIndex(expr, queryOps)
+	if i < 0 {
+		return strings.TrimSpace(expr), "", ""
+	}
+	return strings.TrimSpace(expr[:i]), op, strings.TrimSpace(expr[i+len(op):])
+}
+
+// splitPipes splits expr at its pipes.
+func splitPipes(expr string) []string {
+	stages := make([]string, 0, 2)
+	for {
+		i, _ := topLevelIndex(expr, []string{"|"})
+		if i < 0 {
+			return append(stages, strings.TrimSpace(expr))
+		}
+		stages = append(stages, strings.TrimSpace(expr[:i]))
+		expr = expr[i+1:]
+	}
+}
+
+// topLevelIndex finds the first of tokens in expr outside brackets and
+// parentheses (filters have their own operators) and quotes.
+func topLevelIndex(expr string, tokens []string) (int, string) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0:
+			for _, t := range tokens {
+				if strings.HasPrefix(expr[i:], t) {
+					return i, t
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func applyAssertFunc(fn string, v any, found bool) (any, error) {
+	switch fn {
+	case "length":
+		switch t := v.(type) {
+		case []any:
+			return float64(len(t)), nil
+		case map[string]any:
+			return float64(len(t)), nil
+		case string:
+			return float64(len([]rune(t))), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, NewCliError(ExitAssertionFailed, fmt.Sprintf("Assertion failed: length of %s", jsonTypeName(v)))
+	case "type":
+		if !found {
+			return "missing", nil
+		}
+		return jsonTypeName(v), nil
+	}
+	return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown assertion function: %s%s", fn, agentapi.DidYouMean(fn, []string{"length", "type"})))
+}
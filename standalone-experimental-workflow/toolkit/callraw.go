@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const callRawUsage = "Usage: api call raw --method <METHOD> <path> [-d <body> | --data-file <file|->] [-H 'Name: value']... [--token <name>] --unsafe"
+
+// runCallRaw implements `api call raw`: a request acurl cannot express (a
+// WebDAV PROPFIND, a body in any format) sent with the env's token and
+// appended to the history like any call. Methods acurl knows keep their
+// api_mode rules; others need full-access (agentapi.EnforceRawMode).
+// Strict mode is skipped, so --unsafe must acknowledge it. The path must
+// stay under the base it is sent to. The body is printed as received.
+func runCallRaw(cfg *ResolvedConfig, args []string) error {
+	var method, path, data, dataFile, token string
+	var headers []string
+	unsafe := false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--unsafe":
+			unsafe = true
+		case "--method", "-d", "--data", "--data-file", "-H", "--header", "--token":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--method":
+				method = args[i]
+			case "-d", "--data":
+				data = args[i]
+			case "--data-file":
+				dataFile = args[i]
+			case "-H", "--header":
+				headers = append(headers, args[i])
+			default:
+				token = args[i]
+			}
+		default:
+			if path != "" || strings.HasPrefix(args[i], "-") {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown call raw option: %s", args[i]))
+			}
+			path = args[i]
+		}
+	}
+	switch {
+	case method == "" || path == "":
+		return NewCliError(ExitRequestBuild, callRawUsage)
+	case data != "" && dataFile != "":
+		return NewCliError(ExitRequestBuild, "-d and --data-file are mutually exclusive")
+	case !unsafe:
+		return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("call raw sends %s %s without the strict spec check", method, path), "Add --unsafe to acknowledge it; acurl covers the standard methods with every check.")
+	}
+	if err := checkUnderBase(cfg, path); err != nil {
+		return err
+	}
+	if dataFile != "" {
+		var b []byte
+		var err error
+		if dataFile == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(dataFile)
+		}
+		if err != nil {
+			return WrapCliError(ExitRequestBuild, fmt.Sprintf("Cannot read --data-file: %v", err), err)
+		}
+		data = string(b)
+	}
+	if token != "" {
+		warnTokenSecurity(cfg, method, path, token)
+	}
+
+	hdrs, requestID := agentapi.WithRequestID(cfg, headers)
+	resp, err := PerformRequest(cfg, APIRequest{Method: method, Path: path, TokenName: token, Body: data, Headers: hdrs, Source: "call raw", Raw: true})
+	if err != nil {
+		return err
+	}
+	infof("HTTP %d %s\n", resp.StatusCode, resp.Header.Get("Content-Type"))
+	if _, err := os.Stdout.Write(resp.Body); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	if len(resp.Body) > 0 && resp.Body[len(resp.Body)-1] != '\n' {
+		fmt.Println()
+	}
+	reportRequestID(requestID, "")
+	if resp.StatusCode >= 400 {
+		return NewCliError(ExitHTTPErrorStatus, "")
+	}
+	return nil
+}
+
+// checkUnderBase rejects a raw path that would leave the base URL it is
+// sent to, e.g. through dot segments: acurl paths are checked against the
+// spec, raw ones only by this.
+func checkUnderBase(cfg *ResolvedConfig, path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Path must start with '/': %s", path))
+	}
+	base, err := url.Parse(cfg.BaseFor(path))
+	if err != nil {
+		return WrapCliError(ExitConfig, fmt.Sprintf("Invalid api_base: %v", err), err)
+	}
+	u, err := url.Parse(cfg.BuildURL(path))
+	if err != nil {
+		return WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid path %s: %v", path, err), err)
+	}
+	root := strings.TrimRight(base.Path, "/")
+	clean := pathpkg.Clean("/" + u.Path)
+	if u.Scheme != base.Scheme || u.Host != base.Host || (clean != root && !strings.HasPrefix(clean, root+"/")) {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Path %s leaves %s", path, base.String()))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// codecCase is a JSON body encoded with a codec and decoded back: want is
+// the JSON it comes back as, the input itself when empty.
+type codecCase struct {
+	name, json, want string
+}
+
+func testRoundTrip(t *testing.T, codec bodyCodec, cases []codecCase) {
+	t.Helper()
+	for _, tc := range cases {
+		encoded, err := encodeBody(codec, "test", tc.json)
+		if err != nil {
+			t.Errorf("%s: encode %s: %v", tc.name, tc.json, err)
+			continue
+		}
+		decoded, err := decodeBody(codec, []byte(encoded))
+		if err != nil {
+			t.Errorf("%s: decode % x: %v", tc.name, encoded, err)
+			continue
+		}
+		want := tc.want
+		if want == "" {
+			want = tc.json
+		}
+		if string(decoded) != want {
+			t.Errorf("%s: round trip of %s gave %s, want %s", tc.name, tc.json, decoded, want)
+		}
+	}
+}
+
+// testDecodeErrors checks that each body fails to decode, without panicking.
+func testDecodeErrors(t *testing.T, codec bodyCodec, bodies map[string][]byte) {
+	t.Helper()
+	for name, body := range bodies {
+		if v, err := codec.Decode(body); err == nil {
+			t.Errorf("%s: % x decoded to %v, want an error", name, body, v)
+		}
+	}
+}
+
+// testPrefixesFail checks that no strict prefix of an encoded value
+// decodes: a self-delimiting format must report it truncated.
+func testPrefixesFail(t *testing.T, codec bodyCodec, json string) {
+	t.Helper()
+	encoded, err := encodeBody(codec, "test", json)
+	if err != nil {
+		t.Fatalf("encode %s: %v", json, err)
+	}
+	for n := 0; n < len(encoded); n++ {
+		if v, err := codec.Decode([]byte(encoded[:n])); err == nil {
+			t.Errorf("%d of %d bytes of %s decoded to %v, want an error", n, len(encoded), json, v)
+		}
+	}
+}
+
+// nestedJSON is depth arrays or objects around a 1, e.g. [[1]] for 2.
+func nestedJSON(depth int, object bool) string {
+	open, close := "[", "]"
+	if object {
+		open, close = `{"a":`, "}"
+	}
+	return strings.Repeat(open, depth) + "1" + strings.Repeat(close, depth)
+}
+
+// testDepthLimit checks that values nested maxCodecDepth deep decode and
+// deeper ones are refused.
+func testDepthLimit(t *testing.T, codec bodyCodec) {
+	t.Helper()
+	for _, object := range []bool{false, true} {
+		ok, err := encodeBody(codec, "test", nestedJSON(maxCodecDepth, object))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := codec.Decode([]byte(ok)); err != nil {
+			t.Errorf("nested %d deep (object %v): %v", maxCodecDepth, object, err)
+		}
+		deep, err := encodeBody(codec, "test", nestedJSON(maxCodecDepth+1, object))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := codec.Decode([]byte(deep)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+			t.Errorf("nested %d deep (object %v): %v, want the depth error", maxCodecDepth+1, object, err)
+		}
+	}
+}
+
+// fuzzDecode is the body of the FuzzDecode targets: a decoder must never
+// panic, and what it accepts must print as JSON.
+func fuzzDecode(t *testing.T, codec bodyCodec, body []byte) {
+	v, err := codec.Decode(body)
+	if err != nil {
+		return
+	}
+	if _, err := decodeBody(codec, body); err != nil {
+		t.Fatalf("% x decoded to %#v but does not print as JSON: %v", body, v, err)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// completeCommand is the hidden entry point the generated shell scripts call
+// with the words typed so far; it prints one candidate per line.
+const completeCommand = "__complete"
+
+var (
+	apiCommands     = []string{"find", "show", "ui", "proxy", "test", "scenario", "listen", "serve", "daemon", "collection", "schedule", "seed", "diff-env", "edit", "resource", "health", "spec", "graphql", "query", "assert", "describe-response", "whoami", "token", "policy", "call", "session", "record", "import-curl", "history", "context", "config", "project", "env", "completion", "version", "self-update"}
+	completionMenus = []string{"bash", "zsh", "fish"}
+	acurlFlags      = []string{"--token", "-d", "--data", "-H", "--header", "--query", "--record", "--replay", "--snapshot", "--snapshot-ignore", "--update-snapshot", "--edit", "--format", "--fields", "--accept", "--reuse", "--soft", "--plan", "--read-fallback", "--follow-created", "--patch-op", "--merge", "--content-type", "--proto-descriptor", "--raw", "--xml-json", "--summarize", "--max-bytes", "--quiet", "--verbose"}
+)
+
+const bashCompletion = `# bash completion for api/acurl
+_agent_api_toolkit() {
+  local cur words
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  words=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+  local IFS=$'\n'
+  COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" __complete "${words[@]}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _agent_api_toolkit api acurl ./api ./acurl
+`
+
+const zshCompletion = `#compdef api acurl
+_agent_api_toolkit() {
+  local -a candidates
+  candidates=(${(f)"$(${words[1]} __complete ${words[2,CURRENT-1]} 2>/dev/null)"})
+  compadd -a candidates
+}
+compdef _agent_api_toolkit api acurl ./api ./acurl
+`
+
+const fishCompletion = `# fish completion for api/acurl
+function __agent_api_toolkit_complete
+  set -l tokens (commandline -opc)
+  set -l cmd $tokens[1]
+  set -e tokens[1]
+  $cmd __complete $tokens 2>/dev/null
+end
+complete -c api -f -a '(__agent_api_toolkit_complete)'
+complete -c acurl -f -a '(__agent_api_toolkit_complete)'
+`
+
+// PrintCompletionScript writes the completion script for the given shell.
+func PrintCompletionScript(shell string) error {
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unsupported shell for completion: %s (expected bash|zsh|fish)", shell))
+	}
+	return nil
+}
+
+// runComplete never fails: a missing config or spec cache simply yields
+// fewer candidates. Operations come from the spec cache so completion never
+// waits on the network.
+func runComplete(configPath string, tool string, words []string) error {
+	cfg, _ := agentapi.LoadConfig(configPath)
+	var out []string
+	if tool == "acurl" {
+		out = completeACurl(cfg, words)
+	} else {
+		out = completeAPI(cfg, words)
+	}
+	for _, c := range out {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+func completeAPI(cfg *ResolvedConfig, words []string) []string {
+	if len(words) == 0 {
+		return append(aliasNames(cfg), apiCommands...)
+	}
+	if cfg != nil {
+		if expanded, err := expandAlias(cfg, words); err == nil {
+			words = expanded
+		}
+	}
+	prev := words[len(words)-1]
+	if prev == "--method" {
+		return sortedHTTPMethods()
+	}
+	switch words[0] {
+	case "show":
+		if len(words) == 1 {
+			return completionOperationIDs(cfg)
+		}
+		return []string{"--resolved"}
+	case "find":
+		if prev == "--format" {
+			return FormatterNames()
+		}
+		return []string{"--method", "--format", "--limit", "--offset", "--all", "--envs", "--env-tag", "--concurrency", "--group-versions", "--no-history"}
+	case "test", "scenario":
+		if prev == "--report" {
+			return []string{"text", "json", "junit"}
+		}
+		return []string{"--report", "--yes"}
+	case "proxy":
+		return []string{"--port", "--metrics-port"}
+	case "listen":
+		return []string{"--port", "--host", "--expose"}
+	case "serve":
+		return []string{"--port", "--allow-origin"}
+	case "daemon":
+		if len(words) == 1 {
+			return []string{"start", "stop", "status"}
+		}
+	case "collection":
+		if len(words) == 1 {
+			return []string{"list", "run"}
+		}
+		if words[1] == "run" && prev == "--report" {
+			return []string{"text", "json", "junit"}
+		}
+	case "schedule":
+		if len(words) == 1 {
+			return []string{"add", "list", "remove", "run"}
+		}
+		switch words[1] {
+		case "add":
+			return []string{"--every"}
+		case "run":
+			return []string{"--once"}
+		}
+	case "diff-env":
+		if len(words) == 1 {
+			return completionPaths(cfg)
+		}
+		return []string{"--envs", "--env-tag", "--ignore", "--token"}
+	case "edit":
+		if len(words) == 1 {
+			return completionPaths(cfg)
+		}
+		switch prev {
+		case "--method":
+			return []string{"PUT", "PATCH"}
+		case "--token":
+			return completionTokenNames(cfg)
+		}
+		return []string{"--set", "--unset", "--method", "--token", "-H", "--dry-run"}
+	case "resource":
+		if len(words) == 1 {
+			return append([]string{"--format"}, agentapi.ResourceActions...)
+		}
+		if words[1] == "--format" {
+			return FormatterNames()
+		}
+		if len(words) == 2 {
+			return completionResourceNames(cfg)
+		}
+		return acurlFlags
+	case "whoami":
+		switch prev {
+		case "--format":
+			return FormatterNames()
+		case "--token":
+			return completionTokenNames(cfg)
+		}
+		return []string{"--token", "--all-tokens", "--raw", "--format"}
+	case "policy":
+		switch {
+		case len(words) == 1:
+			return []string{"explain"}
+		case len(words) == 2:
+			return completionPaths(cfg)
+		case prev == "--format":
+			return FormatterNames()
+		case prev == "--token":
+			return completionTokenNames(cfg)
+		}
+		return []string{"-d", "--token", "--preflight", "--format"}
+	case "token":
+		if len(words) == 1 {
+			return []string{"list", "stats"}
+		}
+		if prev == "--format" {
+			return FormatterNames()
+		}
+		if words[1] == "stats" {
+			return []string{"--session", "--envs", "--env-tag", "--all", "--format"}
+		}
+		return []string{"--check", "--envs", "--env-tag", "--all", "--format"}
+	case "call":
+		switch {
+		case len(words) == 1:
+			return []string{"many", "raw", "--request"}
+		case prev == "--method" && words[1] == "raw":
+			return []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "REPORT", "SEARCH"}
+		case prev == "--path":
+			return completionPaths(cfg)
+		case prev == "--token":
+			return completionTokenNames(cfg)
+		case prev == "--request":
+			return nil
+		case words[1] == "--request":
+			return []string{"--var", "--token"}
+		case words[1] == "raw":
+			return []string{"--method", "-d", "--data-file", "-H", "--token", "--unsafe"}
+		}
+		return []string{"--path", "--ids", "--ids-file", "--concurrency", "--token", "--query"}
+	case "session":
+		if len(words) == 1 {
+			return []string{"status", "new", "list"}
+		}
+		if words[1] == "list" {
+			if prev == "--format" {
+				return FormatterNames()
+			}
+			return []string{"--format"}
+		}
+	case "record":
+		if len(words) == 1 {
+			return []string{"on", "off", "status"}
+		}
+		if words[1] == "on" {
+			return []string{"--max-bytes"}
+		}
+	case "health":
+		if prev == "--format" {
+			return FormatterNames()
+		}
+		return []string{"--path", "--envs", "--env-tag", "--format"}
+	case "spec":
+		if len(words) == 1 {
+			return []string{"infer", "pull", "drift", "params", "verify", "tools"}
+		}
+		if words[1] == "verify" {
+			return []string{"--sample", "--seed"}
+		}
+		if words[1] == "tools" {
+			if prev == "--format" {
+				return []string{"openai", "anthropic"}
+			}
+			return []string{"--format", "--method"}
+		}
+		if words[1] == "params" {
+			switch {
+			case prev == "--format":
+				return FormatterNames()
+			case len(words) == 2:
+				return append([]string{"GET", "POST", "PUT", "PATCH", "DELETE"}, completionOperationIDs(cfg)...)
+			case len(words) == 3 && !strings.HasPrefix(words[2], "-"):
+				return completionPaths(cfg)
+			}
+			return []string{"--format"}
+		}
+		if words[1] == "pull" || words[1] == "drift" {
+			if prev == "--format" {
+				return FormatterNames()
+			}
+			if words[1] == "pull" {
+				return []string{"--all", "--envs", "--env-tag", "--concurrency", "--force", "--format"}
+			}
+			return []string{"--all", "--envs", "--env-tag", "--concurrency", "--format"}
+		}
+		return []string{"--out", "--cassette", "--no-history", "--all"}
+	case "seed":
+		if len(words) == 1 {
+			return []string{"apply", "teardown"}
+		}
+		if words[1] == "teardown" && len(words) > 2 {
+			return []string{"--session"}
+		}
+	case "history":
+		if len(words) == 1 {
+			return []string{"export", "top"}
+		}
+		if words[1] == "top" {
+			if prev == "--format" {
+				return FormatterNames()
+			}
+			return []string{"--limit", "--session", "--all-envs", "--format"}
+		}
+		if prev == "--format" {
+			return []string{"har"}
+		}
+		return []string{"--format", "--out", "--last", "--source", "--session", "--all-envs"}
+	case "import-curl":
+		return []string{"--save"}
+	case "assert":
+		if len(words) == 1 {
+			return []string{"status", "json"}
+		}
+		if len(words) > 2 {
+			return []string{"--from"}
+		}
+	case "query":
+		if prev == "--from" {
+			return []string{"last", "history:"}
+		}
+		return []string{"--from", "--raw"}
+	case "describe-response":
+		if prev == "--from" {
+			return []string{"last", "history:"}
+		}
+		return []string{"--from", "--yaml"}
+	case "graphql":
+		switch len(words) {
+		case 1:
+			return []string{"schema"}
+		case 2:
+			return []string{"pull", "search", "show"}
+		}
+		if words[2] == "search" {
+			return []string{"--format"}
+		}
+	case "context":
+		switch {
+		case len(words) == 1:
+			return []string{"env-export"}
+		case prev == "--format":
+			return []string{"shell", "json"}
+		}
+		return []string{"--env", "--format"}
+	case "project", "env":
+		switch {
+		case len(words) == 1:
+			return []string{"use", "list"}
+		case prev == "--format":
+			return FormatterNames()
+		case words[1] == "list" && words[0] == "env":
+			return []string{"--project", "--all", "--format"}
+		case words[1] == "list":
+			return []string{"--format"}
+		case words[0] == "project" && len(words) > 2:
+			return []string{"--env"}
+		}
+		return nil
+	case "config":
+		switch {
+		case len(words) == 1:
+			return []string{"validate", "init"}
+		case words[1] == "init":
+			return []string{"--force"}
+		case prev == "--format":
+			return FormatterNames()
+		}
+		return []string{"--format"}
+	case "completion":
+		if len(words) == 1 {
+			return completionMenus
+		}
+	}
+	return nil
+}
+
+func completeACurl(cfg *ResolvedConfig, words []string) []string {
+	if len(words) == 0 {
+		return append(sortedHTTPMethods(), completionPaths(cfg)...)
+	}
+	prev := words[len(words)-1]
+	if prev == "--token" {
+		return completionTokenNames(cfg)
+	}
+	if len(words) == 1 {
+		if _, ok := httpMethods[strings.ToUpper(prev)]; ok {
+			return completionPaths(cfg)
+		}
+	}
+	return acurlFlags
+}
+
+func completionTokenNames(cfg *ResolvedConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Tokens))
+	for name := range cfg.Tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func completionOperationIDs(cfg *ResolvedConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	spec, err := agentapi.LoadCachedSpecPaths(cfg)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0)
+	for _, op := range agentapi.IterOperations(spec) {
+		if op.OperationID != "" {
+			ids = append(ids, op.OperationID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func completionPaths(cfg *ResolvedConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	spec, err := agentapi.LoadCachedSpecPaths(cfg)
+	if err != nil {
+		return nil
+	}
+	paths, _ := agentapi.AsMap(spec["paths"])
+	return agentapi.SortedKeys(paths)
+}
+
+// completionResourceNames lists the REST collections of the cached spec.
+func completionResourceNames(cfg *ResolvedConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	spec, err := agentapi.LoadCachedSpecPaths(cfg)
+	if err != nil {
+		return nil
+	}
+	out := make([]string, 0)
+	for _, r := range agentapi.Resources(spec) {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func sortedHTTPMethods() []string {
+	out := make([]string, 0, len(httpMethods))
+	for m := range httpMethods {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
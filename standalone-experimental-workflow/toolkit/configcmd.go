@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const configUsage = "Usage: api config validate [--format table|csv|json|ndjson] | init [--force]"
+
+// RunConfigCommand implements `api config init` (see runConfigInit) and
+// `api config validate`: a report on every env
+// of every project, one row per problem (or an "ok" row), exiting with the
+// code of the first problem so scripts can tell a bad token (3) from a bad
+// setting (2). It runs before the config is loaded, so a broken active env
+// does not stop it.
+func RunConfigCommand(configPath string, args []string) error {
+	if len(args) > 0 && args[0] == "init" {
+		return runConfigInit(configPath, args[1:])
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		return NewCliError(ExitRequestBuild, configUsage)
+	}
+	format := "table"
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			format = args[i]
+		default:
+			return NewCliError(ExitRequestBuild, configUsage)
+		}
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	reports, err := agentapi.ValidateConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	t := &Table{
+		Columns: []string{"PROJECT", "ENV", "ACTIVE", "API_MODE", "STATUS", "PROBLEM", "SUGGESTION", "SOURCE"},
+		Keys:    []string{"project", "env", "active", "api_mode", "status", "problem", "suggestion", "source"},
+		Empty:   "No projects configured.",
+	}
+	var first *agentapi.Problem
+	bad := 0
+	for _, r := range reports {
+		active := ""
+		if r.Active {
+			active = "yes"
+		}
+		if len(r.Problems) == 0 {
+			t.Rows = append(t.Rows, []string{r.Project, r.Env, active, r.APIMode, "ok", "", "", r.Source})
+			continue
+		}
+		bad++
+		for i, p := range r.Problems {
+			t.Rows = append(t.Rows, []string{r.Project, r.Env, active, r.APIMode, agentapi.ExitCodeName(ExitCode(p.Err)), ExitMessage(p.Err), agentapi.Suggestion(p.Err), p.Source})
+			if first == nil {
+				first = &r.Problems[i]
+			}
+		}
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	if layers := agentapi.ConfigLayers(configPath); len(layers) > 1 {
+		infof("%s is merged over the global config %s.\n", layers[1], layers[0])
+	}
+	if first != nil {
+		return NewCliErrorHint(ExitCode(first.Err), fmt.Sprintf("%d of %d envs have problems; first, in %s: %s", bad, len(reports), first.Source, ExitMessage(first.Err)), agentapi.Suggestion(first.Err))
+	}
+	infof("All %d envs are valid.\n", len(reports))
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// The guardrailed core lives in package agentapi so other Go programs can
+// import it; these aliases keep the CLI's vocabulary.
+
+type (
+	CliError       = agentapi.Error
+	ResolvedConfig = agentapi.Config
+	Operation      = agentapi.Operation
+	APIResponse    = agentapi.Response
+)
+
+const (
+	ExitSuccess         = agentapi.ExitSuccess
+	ExitUnexpected      = agentapi.ExitUnexpected
+	ExitConfig          = agentapi.ExitConfig
+	ExitToken           = agentapi.ExitToken
+	ExitOpenAPIFetch    = agentapi.ExitOpenAPIFetch
+	ExitOpenAPIParse    = agentapi.ExitOpenAPIParse
+	ExitNotFound        = agentapi.ExitNotFound
+	ExitBlockedByMode   = agentapi.ExitBlockedByMode
+	ExitMarkerMissing   = agentapi.ExitMarkerMissing
+	ExitRequestBuild    = agentapi.ExitRequestBuild
+	ExitHTTPErrorStatus = agentapi.ExitHTTPErrorStatus
+	ExitAssertionFailed = agentapi.ExitAssertionFailed
+	ExitSpecUnavailable = agentapi.ExitSpecUnavailable
+	ExitInterrupted     = agentapi.ExitInterrupted
+)
+
+func NewCliError(code int, msg string) error { return agentapi.NewError(code, msg) }
+
+func NewCliErrorHint(code int, msg, suggestion string) error {
+	return agentapi.NewErrorHint(code, msg, suggestion)
+}
+
+func WrapCliError(code int, msg string, cause error) error {
+	return agentapi.WrapError(code, msg, cause)
+}
+
+func ExitCode(err error) int { return agentapi.ExitCode(err) }
+
+func ExitMessage(err error) string { return agentapi.ExitMessage(err) }
+
+// jsonErrors is set by the global --json flag.
+var jsonErrors bool
+
+// errorLine is the machine-readable form of a failed command.
+type errorLine struct {
+	Code       string `json:"code"`
+	ExitCode   int    `json:"exit_code"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// writeError reports err on w: a single JSON line under --json or when w is
+// not a terminal (agents and pipes), otherwise the bare message followed by
+// a "hint:" line with the suggested next step. Errors without a message
+// (HTTP error statuses, whose body is already on stdout) print nothing.
+func writeError(w *os.File, err error) {
+	msg := ExitMessage(err)
+	if msg == "" {
+		return
+	}
+	suggestion := agentapi.Suggestion(err)
+	if !jsonErrors && isTerminal(w) {
+		fmt.Fprintln(w, msg)
+		if suggestion != "" {
+			fmt.Fprintln(w, "hint: "+suggestion)
+		}
+		return
+	}
+	code := ExitCode(err)
+	line, _ := json.Marshal(errorLine{Code: agentapi.ExitCodeName(code), ExitCode: code, Message: msg, Suggestion: suggestion})
+	_, _ = io.WriteString(w, string(line)+"\n")
+}
+
+// staleSpecLine is the machine-readable form of a stale spec notice.
+type staleSpecLine struct {
+	Notice          string `json:"notice"`
+	Stale           bool   `json:"stale"`
+	Env             string `json:"env"`
+	CachedAt        string `json:"cached_at"`
+	CacheAgeSeconds int64  `json:"cache_age_seconds"`
+	Error           string `json:"error"`
+	Refresh         string `json:"refresh"`
+}
+
+// reportStaleSpecs notes on w each spec the command used from a stale cache
+// (see agentapi.StaleSpecs) with its age and how to refresh it, as a JSON
+// line under the same conditions as writeError.
+func reportStaleSpecs(w *os.File) {
+	for _, s := range agentapi.StaleSpecs() {
+		age := time.Since(s.CachedAt)
+		refresh := "api spec pull --force --envs " + s.Env
+		if !jsonErrors && isTerminal(w) {
+			if !quiet {
+				fmt.Fprintf(w, "Note: the %s/%s spec came from a cache %s old (%s); results may be outdated. Refresh it with: %s\n", s.Project, s.Env, age.Round(time.Second), s.Err, refresh)
+			}
+			continue
+		}
+		line, _ := json.Marshal(staleSpecLine{Notice: "stale_spec", Stale: true, Env: s.Project + "/" + s.Env, CachedAt: s.CachedAt.UTC().Format(time.RFC3339), CacheAgeSeconds: int64(age.Seconds()), Error: s.Err, Refresh: refresh})
+		_, _ = io.WriteString(w, string(line)+"\n")
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
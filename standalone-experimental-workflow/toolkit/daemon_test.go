@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestACurlDoesNotResendAfterDaemonDrop runs a POST through a daemon that
+// sends it on to the backend and then drops the connection: the call must
+// fail rather than be made again in-process.
+func TestACurlDoesNotResendAfterDaemonDrop(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev", APIBase: backend.URL, APIMode: "full-access", DefaultTokenName: "dev", Tokens: map[string]string{"dev": "secret"}}
+
+	socket := daemonSocketPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Post(backend.URL+"/items", "application/json", strings.NewReader(`{"note":"x"}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})}
+	go daemon.Serve(ln)
+	defer daemon.Close()
+
+	err = sendACurl(cfg, GlobalOptions{}, http.MethodPost, "/items", &acurlOptions{Data: `{"note":"x"}`}, "acurl")
+	if err == nil || err == errDaemonUnavailable {
+		t.Fatalf("sendACurl through a dropped daemon = %v, want the failure reported", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("backend saw %d requests, want exactly 1", n)
+	}
+}
+
+// TestACurlFallsBackWithoutDaemon checks that a stale socket, which refuses
+// connections, still means doing the call in-process.
+func TestACurlFallsBackWithoutDaemon(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), ActiveProject: "p", ActiveEnv: "dev", APIBase: backend.URL, APIMode: "full-access", DefaultTokenName: "dev", Tokens: map[string]string{"dev": "secret"}}
+
+	socket := daemonSocketPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	if err := sendACurl(cfg, GlobalOptions{}, http.MethodPost, "/items", &acurlOptions{Data: `{"note":"x"}`}, "acurl"); err != nil {
+		t.Fatalf("sendACurl with a stale socket: %v", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("backend saw %d requests, want exactly 1", n)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// DeletePlan is what `acurl DELETE <path> --plan` prints instead of
+// sending the DELETE: the verdict of local policy, what the spec says the
+// delete answers and which operations it may affect, and the resource as
+// a GET returns it now.
+type DeletePlan struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	OperationID string          `json:"operation_id,omitempty"`
+	Summary     string          `json:"summary,omitempty"`
+	Deprecated  bool            `json:"deprecated,omitempty"`
+	Policy      string          `json:"policy"`
+	Allowed     bool            `json:"allowed"`
+	Responses   []PlanResponse  `json:"responses,omitempty"`
+	Related     []PlanOperation `json:"related,omitempty"`
+	Current     *PlanState      `json:"current,omitempty"`
+	Notes       []string        `json:"notes,omitempty"`
+}
+
+// PlanResponse is a response the spec declares for the operation.
+type PlanResponse struct {
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+}
+
+// PlanOperation is an operation sharing the deleted path's prefix:
+// another method of the same path ("same path"), a path below it
+// ("nested"), or the collection it belongs to ("collection").
+type PlanOperation struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operation_id,omitempty"`
+	Relation    string `json:"relation"`
+}
+
+// PlanState is the answer of a GET of the path before the delete.
+type PlanState struct {
+	Status int    `json:"status,omitempty"`
+	Body   any    `json:"body,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// planDelete builds and prints the DeletePlan of path. Only the GET of
+// the current state reaches the server.
+func planDelete(cfg *ResolvedConfig, path, token string) error {
+	plan := DeletePlan{Method: http.MethodDelete, Path: path}
+	for _, e := range explainPolicy(cfg, path, "", token, http.MethodDelete, nil) {
+		plan.Policy, plan.Allowed = e.Policy, e.Allowed
+	}
+
+	readable := true
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		plan.Notes = append(plan.Notes, "spec unavailable: "+ExitMessage(err))
+	} else {
+		var target *Operation
+		readable = false
+		for _, op := range agentapi.OperationsForPath(spec, path) {
+			switch op.Method {
+			case http.MethodDelete:
+				target = op
+			case http.MethodGet:
+				readable = true
+			}
+		}
+		if target == nil {
+			plan.Notes = append(plan.Notes, "the spec declares no DELETE for this path")
+		} else {
+			plan.OperationID, plan.Summary, plan.Deprecated = target.OperationID, target.Summary, target.Deprecated()
+			plan.Responses = planResponses(spec, target.Raw)
+			plan.Related = relatedOperations(spec, target.Path)
+		}
+		if !readable {
+			plan.Notes = append(plan.Notes, "the spec declares no GET for this path; current state not read")
+		}
+	}
+
+	if readable {
+		state := &PlanState{}
+		resp, err := PerformRequest(cfg, APIRequest{Method: http.MethodGet, Path: path, TokenName: token, Source: "delete plan"})
+		if err != nil {
+			state.Error = ExitMessage(err)
+		} else {
+			state.Status = resp.StatusCode
+			if len(resp.Body) > 0 {
+				if json.Valid(resp.Body) {
+					state.Body = json.RawMessage(resp.Body)
+				} else {
+					state.Body = string(resp.Body)
+				}
+			}
+			if resp.StatusCode == http.StatusNotFound {
+				plan.Notes = append(plan.Notes, "the resource does not exist; the DELETE has nothing to remove")
+			}
+		}
+		plan.Current = state
+	}
+	return printJSONIndent(plan)
+}
+
+// planResponses lists the responses of an operation, with $refs resolved
+// for their descriptions.
+func planResponses(spec, op map[string]any) []PlanResponse {
+	responses, _ := agentapi.AsMap(op["responses"])
+	out := make([]PlanResponse, 0, len(responses))
+	for _, status := range agentapi.SortedKeys(responses) {
+		r, _ := agentapi.AsMap(responses[status])
+		if ref := agentapi.AsString(r["$ref"]); ref != "" {
+			if resolved, ok := agentapi.ResolveRef(spec, ref); ok {
+				r = resolved
+			}
+		}
+		out = append(out, PlanResponse{Status: status, Description: agentapi.AsString(r["description"])})
+	}
+	return out
+}
+
+// relatedOperations lists the operations on template's own path, below
+// it and on its parent collection, by path and method.
+func relatedOperations(spec map[string]any, template string) []PlanOperation {
+	parent := template[:strings.LastIndex(template, "/")]
+	out := make([]PlanOperation, 0)
+	for _, op := range agentapi.IterOperations(spec) {
+		var relation string
+		switch {
+		case op.Path == template && op.Method == http.MethodDelete:
+			continue
+		case op.Path == template:
+			relation = "same path"
+		case strings.HasPrefix(op.Path, template+"/"):
+			relation = "nested"
+		case op.Path == parent:
+			relation = "collection"
+		default:
+			continue
+		}
+		out = append(out, PlanOperation{Method: op.Method, Path: op.Path, OperationID: op.OperationID, Relation: relation})
+	}
+	return out
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// DiffEntry is one structural difference between two JSON documents.
+type DiffEntry struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Left  any    `json:"left,omitempty"`
+	Right any    `json:"right,omitempty"`
+}
+
+const (
+	diffChanged = "changed"
+	diffRemoved = "removed"
+	diffAdded   = "added"
+)
+
+var (
+	plainKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+)
+
+// JSONDiff compares two decoded JSON documents. ignore entries are either
+// bare key names (matched at any depth) or "$..." paths, where [*] matches
+// any array index; an ignored path hides its whole subtree.
+func JSONDiff(left, right any, ignore []string) []DiffEntry {
+	out := make([]DiffEntry, 0)
+	diffAt(left, right, "$", "", ignore, &out)
+	return out
+}
+
+func diffIgnored(path, key string, ignore []string) bool {
+	wild := arrayIndexPattern.ReplaceAllString(path, "[*]")
+	for _, pat := range ignore {
+		if !strings.HasPrefix(pat, "$") {
+			if key != "" && key == pat {
+				return true
+			}
+			continue
+		}
+		for _, p := range []string{path, wild} {
+			if p == pat || strings.HasPrefix(p, pat+".") || strings.HasPrefix(p, pat+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func childPath(parent, key string) string {
+	if plainKeyPattern.MatchString(key) {
+		return parent + "." + key
+	}
+	b, _ := json.Marshal(key)
+	return parent + "[" + string(b) + "]"
+}
+
+func diffAt(left, right any, path, key string, ignore []string, out *[]DiffEntry) {
+	if diffIgnored(path, key, ignore) {
+		return
+	}
+	lm, lok := left.(map[string]any)
+	rm, rok := right.(map[string]any)
+	if lok && rok {
+		keys := map[string]struct{}{}
+		for k := range lm {
+			keys[k] = struct{}{}
+		}
+		for k := range rm {
+			keys[k] = struct{}{}
+		}
+		for _, k := range sortedMapKeys(keys) {
+			p := childPath(path, k)
+			lv, inL := lm[k]
+			rv, inR := rm[k]
+			switch {
+			case inL && inR:
+				diffAt(lv, rv, p, k, ignore, out)
+			case inL:
+				if !diffIgnored(p, k, ignore) {
+					*out = append(*out, DiffEntry{Path: p, Kind: diffRemoved, Left: lv})
+				}
+			default:
+				if !diffIgnored(p, k, ignore) {
+					*out = append(*out, DiffEntry{Path: p, Kind: diffAdded, Right: rv})
+				}
+			}
+		}
+		return
+	}
+	ls, lok := left.([]any)
+	rs, rok := right.([]any)
+	if lok && rok {
+		for i := 0; i < len(ls) || i < len(rs); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i < len(ls) && i < len(rs):
+				diffAt(ls[i], rs[i], p, "", ignore, out)
+			case i < len(ls):
+				if !diffIgnored(p, "", ignore) {
+					*out = append(*out, DiffEntry{Path: p, Kind: diffRemoved, Left: ls[i]})
+				}
+			default:
+				if !diffIgnored(p, "", ignore) {
+					*out = append(*out, DiffEntry{Path: p, Kind: diffAdded, Right: rs[i]})
+				}
+			}
+		}
+		return
+	}
+	if !jsonEqual(left, right) {
+		*out = append(*out, DiffEntry{Path: path, Kind: diffChanged, Left: left, Right: right})
+	}
+}
+
+// PrintDiff writes one line per entry to stdout.
+func PrintDiff(entries []DiffEntry, leftLabel, rightLabel string) {
+	for _, e := range entries {
+		fmt.Println(formatDiffEntry(e, leftLabel, rightLabel))
+	}
+}
+
+// formatDiffEntry renders "~" changed, "-" only on the left, "+" only on
+// the right. Values are compact JSON so "1" and 1 differ visibly.
+func formatDiffEntry(e DiffEntry, leftLabel, rightLabel string) string {
+	switch e.Kind {
+	case diffRemoved:
+		return fmt.Sprintf("- %s: %s (only in %s)", e.Path, diffValue(e.Left), leftLabel)
+	case diffAdded:
+		return fmt.Sprintf("+ %s: %s (only in %s)", e.Path, diffValue(e.Right), rightLabel)
+	}
+	return fmt.Sprintf("~ %s: %s (%s) -> %s (%s)", e.Path, diffValue(e.Left), leftLabel, diffValue(e.Right), rightLabel)
+}
+
+func diffValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// decodeResponseBody returns the JSON document of a body, or the raw text
+// as a string so non-JSON responses still compare.
+func decodeResponseBody(body []byte) any {
+	var doc any
+	if len(body) > 0 && json.Unmarshal(body, &doc) == nil {
+		return doc
+	}
+	return string(body)
+}
+
+// RunDiffEnv implements `api diff-env [GET] <path> --envs a,b`: the same
+// read against two envs of the active project, compared structurally.
+// With more envs (or an --env-tag), the first is the baseline each of the
+// others is compared with.
+func RunDiffEnv(configPath string, args []string) error {
+	usage := "Usage: api diff-env [GET] <path> --envs <env1>,<env2>[,...] | --env-tag <tag> [--ignore <field|$.path>]... [--token <name>]"
+	envs, envTag := "", ""
+	tokenName := ""
+	ignore := make([]string, 0)
+	rest := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--envs", "--env-tag", "--ignore", "--token":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--envs":
+				envs = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			case "--ignore":
+				ignore = append(ignore, args[i])
+			default:
+				tokenName = args[i]
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	envs, err := taggedEnvList(configPath, envTag, envs, false)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 || envs == "" {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	method, path, extra, err := normalizeMethodAndPath(rest)
+	if err != nil {
+		return err
+	}
+	if len(extra) > 0 {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown diff-env option: %s", extra[0]))
+	}
+	if method == "" {
+		method = "GET"
+	}
+	if method != "GET" && method != "HEAD" {
+		return NewCliError(ExitBlockedByMode, fmt.Sprintf("diff-env only performs reads (GET/HEAD), got %s", method))
+	}
+	names := make([]string, 0)
+	for _, name := range strings.Split(envs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 2 {
+		if envTag != "" {
+			return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("Only %s is tagged '%s': diff-env needs two envs or more", names[0], envTag), "Tag another env, or name both with --envs.")
+		}
+		return NewCliError(ExitRequestBuild, "--envs needs at least two env names, e.g. --envs dev,staging")
+	}
+
+	docs := make([]any, len(names))
+	statuses := make([]int, len(names))
+	for i, name := range names {
+		cfg, err := agentapi.LoadConfigForEnv(configPath, name)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			ignore = append(ignore, cfg.DiffIgnore...)
+		}
+		resp, err := PerformRequest(cfg, APIRequest{Method: method, Path: path, TokenName: tokenName, Source: "diff-env"})
+		if err != nil {
+			return WrapCliError(ExitCode(err), fmt.Sprintf("%s: %s", name, ExitMessage(err)), err)
+		}
+		statuses[i] = resp.StatusCode
+		docs[i] = decodeResponseBody(resp.Body)
+	}
+
+	total := 0
+	differing := make([]string, 0)
+	for i := 1; i < len(names); i++ {
+		if i > 1 {
+			fmt.Println()
+		}
+		fmt.Printf("%s %s  %s: HTTP %d  %s: HTTP %d\n", method, path, names[0], statuses[0], names[i], statuses[i])
+		entries := JSONDiff(docs[0], docs[i], ignore)
+		if statuses[0] != statuses[i] {
+			entries = append([]DiffEntry{{Path: "status", Kind: diffChanged, Left: statuses[0], Right: statuses[i]}}, entries...)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No differences.")
+			continue
+		}
+		PrintDiff(entries, names[0], names[i])
+		total += len(entries)
+		differing = append(differing, names[i])
+	}
+	if total == 0 {
+		return nil
+	}
+	return NewCliError(ExitAssertionFailed, fmt.Sprintf("%d differences between %s and %s", total, names[0], strings.Join(differing, ", ")))
+}
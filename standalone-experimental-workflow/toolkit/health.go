@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// healthTimeout bounds each probe so one unreachable env cannot stall the
+// sweep.
+const healthTimeout = 10 * time.Second
+
+// EnvHealth is the readiness of one env as reported by `api health`.
+type EnvHealth struct {
+	Env       string
+	Mode      string
+	URL       string
+	Status    int
+	LatencyMS int64
+	Error     string
+	SpecOps   int
+	SpecError string
+}
+
+func (h EnvHealth) healthy() bool {
+	return h.Error == "" && h.SpecError == "" && h.Status >= 200 && h.Status < 400
+}
+
+// probeHealth GETs the health path with the default token and fetches the
+// spec (refreshing its cache). Like the spec fetch, the probe is not an API
+// operation, so strict validation does not apply to it.
+func probeHealth(cfg *ResolvedConfig, path string) EnvHealth {
+	if path == "" {
+		path = cfg.HealthPath
+	}
+	h := EnvHealth{Env: cfg.ActiveEnv, Mode: cfg.APIMode, URL: cfg.APIBase + path}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		spec, err := agentapi.LoadFreshSpecPaths(runCtx, cfg)
+		if err != nil {
+			h.SpecError = ExitMessage(err)
+			return
+		}
+		h.SpecOps = len(agentapi.IterOperations(spec))
+	}()
+	h.Status, h.LatencyMS, h.Error = getHealth(cfg, h.URL)
+	wg.Wait()
+	return h
+}
+
+func getHealth(cfg *ResolvedConfig, url string) (status int, latencyMS int64, errMsg string) {
+	req, err := http.NewRequestWithContext(runCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, err.Error()
+	}
+	if _, token, err := agentapi.ResolveToken(cfg, ""); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	start := time.Now()
+	resp, err := agentapi.NewDoer(healthTimeout).Do(req)
+	latencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		return 0, latencyMS, err.Error()
+	}
+	resp.Body.Close()
+	logger.Debug("health probe", "env", cfg.ActiveEnv, "url", url, "status", resp.StatusCode, "duration_ms", latencyMS)
+	return resp.StatusCode, latencyMS, ""
+}
+
+// SweepHealth probes every env concurrently, in the order given.
+func SweepHealth(configPath string, envs []string, path string) []EnvHealth {
+	out := make([]EnvHealth, len(envs))
+	var wg sync.WaitGroup
+	for i, env := range envs {
+		wg.Add(1)
+		go func(i int, env string) {
+			defer wg.Done()
+			cfg, err := agentapi.LoadConfigForEnv(configPath, env)
+			if err != nil {
+				out[i] = EnvHealth{Env: env, Error: ExitMessage(err)}
+				return
+			}
+			out[i] = probeHealth(cfg, path)
+		}(i, env)
+	}
+	wg.Wait()
+	return out
+}
+
+func healthTable(results []EnvHealth) *Table {
+	t := &Table{
+		Columns: []string{"ENV", "MODE", "STATUS", "LATENCY", "SPEC", "URL"},
+		Keys:    []string{"env", "mode", "status", "latency", "spec", "url"},
+		Empty:   "No envs configured.",
+	}
+	for _, h := range results {
+		status := strconv.Itoa(h.Status)
+		if h.Error != "" {
+			status = "error: " + h.Error
+		}
+		latency := ""
+		if h.Status != 0 {
+			latency = fmt.Sprintf("%dms", h.LatencyMS)
+		}
+		spec := fmt.Sprintf("ok (%d operations)", h.SpecOps)
+		switch {
+		case h.SpecError != "":
+			spec = "error: " + h.SpecError
+		case h.Mode == "":
+			spec = ""
+		}
+		t.Rows = append(t.Rows, []string{h.Env, h.Mode, status, latency, spec, h.URL})
+	}
+	return t
+}
+
+// RunHealth implements `api health [--path <path>] [--envs a,b | --env-tag t] [--format ...]`.
+func RunHealth(configPath string, args []string) error {
+	path, envList, envTag, format := "", "", "", "table"
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--path", "--envs", "--env-tag", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--path":
+				path = args[i]
+			case "--envs":
+				envList = args[i]
+			case "--env-tag":
+				envTag = args[i]
+			default:
+				format = args[i]
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown health option: %s", args[i]))
+		}
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return NewCliError(ExitRequestBuild, "Health path must start with '/'")
+	}
+	envList, err := taggedEnvList(configPath, envTag, envList, false)
+	if err != nil {
+		return err
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	envs, err := agentapi.ProjectEnvNames(configPath)
+	if err != nil {
+		return err
+	}
+	if envList != "" {
+		envs = envs[:0]
+		for _, e := range strings.Split(envList, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				envs = append(envs, e)
+			}
+		}
+	}
+
+	results := SweepHealth(configPath, envs, path)
+	if runCtx.Err() != nil {
+		return NewCliError(ExitInterrupted, "Interrupted: health sweep cancelled")
+	}
+	if err := f.Format(os.Stdout, healthTable(results)); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	failed := make([]string, 0)
+	for _, h := range results {
+		if !h.healthy() {
+			failed = append(failed, h.Env)
+		}
+	}
+	if len(failed) > 0 {
+		return NewCliError(ExitAssertionFailed, fmt.Sprintf("Unhealthy envs: %s", strings.Join(failed, ", ")))
+	}
+	return nil
+}
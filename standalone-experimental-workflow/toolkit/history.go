@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// maxHistoryBody caps each stored request/response body unless `api record
+// on --max-bytes` sets another cap; larger bodies are cut and flagged as
+// truncated.
+const maxHistoryBody = 1 << 20
+
+// maxHistoryBytes is the size past which history.jsonl is rotated to
+// history.1.jsonl, replacing the previous one, so the history stays
+// bounded at about twice this.
+const maxHistoryBytes = 32 << 20
+
+// duplicateWindow is how recent an identical GET must be for acurl to warn
+// about it (and for --reuse to print it instead of calling).
+const duplicateWindow = 10 * time.Second
+
+// redactedHeaders never reach the history file with their real value.
+var redactedHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Set-Cookie":          {},
+	"X-Api-Key":           {},
+}
+
+// HistoryEntry is one performed call, stored as a JSON line in
+// state/history.jsonl.
+type HistoryEntry struct {
+	ID              string            `json:"id"`
+	Time            time.Time         `json:"time"`
+	Source          string            `json:"source,omitempty"`
+	Session         string            `json:"session,omitempty"`
+	Token           string            `json:"token,omitempty"`
+	Fingerprint     string            `json:"fingerprint,omitempty"`
+	Project         string            `json:"project"`
+	Env             string            `json:"env"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestID       string            `json:"request_id,omitempty"`
+	ServerRequestID string            `json:"server_request_id,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	RequestBytes    int64             `json:"request_bytes,omitempty"`
+	Status          int               `json:"status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	ResponseBytes   int64             `json:"response_bytes,omitempty"`
+	// Location is where a 201, 202 or 3xx response put the resource (see
+	// createdLocation).
+	Location  string `json:"location,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// MetadataOnly entries were recorded without their bodies (see
+	// RunRecordCommand).
+	MetadataOnly bool   `json:"metadata_only,omitempty"`
+	DurationMS   int64  `json:"duration_ms"`
+	Error        string `json:"error,omitempty"`
+}
+
+var historyMu sync.Mutex
+
+func historyPath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "state", "history.jsonl")
+}
+
+// rotatedHistoryPath holds the entries of history.jsonl before it last
+// reached maxHistoryBytes.
+func rotatedHistoryPath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "state", "history.1.jsonl")
+}
+
+// lockState takes the lock of a state file (agentapi.LockFile) for a
+// read-modify-write of it, creating its directory first.
+func lockState(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err), err)
+	}
+	unlock, err := agentapi.LockFile(path)
+	if err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to lock %s: %v", path, err), err)
+	}
+	return unlock, nil
+}
+
+func newHistoryID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if _, secret := redactedHeaders[http.CanonicalHeaderKey(k)]; secret {
+			out[k] = "[redacted]"
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+func capHistoryBody(b string, limit int, truncated *bool) string {
+	if len(b) > limit {
+		*truncated = true
+		return b[:limit]
+	}
+	return b
+}
+
+// AppendHistory records a call, with its bodies only while the session
+// records them. History is best effort: failures are logged at debug level
+// and never fail the call itself.
+func AppendHistory(cfg *ResolvedConfig, e HistoryEntry) {
+	e.ID = newHistoryID()
+	e.Project, e.Env, e.Session = cfg.ActiveProject, cfg.ActiveEnv, cfg.Session
+	if rec := currentRecording(cfg); rec.On {
+		e.RequestBody = capHistoryBody(e.RequestBody, rec.maxBytes(), &e.Truncated)
+		e.ResponseBody = capHistoryBody(e.ResponseBody, rec.maxBytes(), &e.Truncated)
+	} else {
+		e.RequestBody, e.ResponseBody = "", ""
+		e.MetadataOnly = true
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		logger.Debug("history encode failed", "error", err.Error())
+		return
+	}
+	path := historyPath(cfg)
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		logger.Debug("history write failed", "path", path, "error", err.Error())
+		return
+	}
+	// Other processes append too; one line must not land inside another.
+	unlock, err := agentapi.LockFile(path)
+	if err != nil {
+		logger.Debug("history write failed", "path", path, "error", err.Error())
+		return
+	}
+	defer unlock()
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) >= maxHistoryBytes {
+		if err := os.Rename(path, rotatedHistoryPath(cfg)); err != nil {
+			logger.Debug("history rotation failed", "path", path, "error", err.Error())
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		logger.Debug("history write failed", "path", path, "error", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logger.Debug("history write failed", "path", path, "error", err.Error())
+	}
+}
+
+// LoadHistory reads all entries, the rotated ones included, oldest first.
+// A missing file is empty history; undecodable lines are skipped.
+func LoadHistory(cfg *ResolvedConfig) ([]HistoryEntry, error) {
+	out := make([]HistoryEntry, 0)
+	for _, path := range []string{rotatedHistoryPath(cfg), historyPath(cfg)} {
+		raw, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read history: %v", err), err)
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var e HistoryEntry
+			if json.Unmarshal([]byte(line), &e) == nil {
+				out = append(out, e)
+			}
+		}
+	}
+	return out, nil
+}
+
+// historyChunk is how much of the history file scanHistoryBackward reads
+// at a time.
+const historyChunk = 64 << 10
+
+// scanHistoryBackward calls fn with the entries, newest first, until it
+// returns false, reading the file from its end so that a caller after the
+// latest calls does not parse the whole history. Undecodable lines are
+// skipped.
+func scanHistoryBackward(cfg *ResolvedConfig, fn func(HistoryEntry) bool) error {
+	for _, path := range []string{historyPath(cfg), rotatedHistoryPath(cfg)} {
+		more, err := scanLinesBackward(path, func(line []byte) bool {
+			var e HistoryEntry
+			if json.Unmarshal(line, &e) != nil {
+				return true
+			}
+			return fn(e)
+		})
+		if err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read history: %v", err), err)
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// scanLinesBackward calls fn with the non-blank lines of path, last first,
+// until it returns false, and reports whether it never did. A missing file
+// has no lines.
+func scanLinesBackward(path string, fn func(line []byte) bool) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	// rest is the start of the earliest line read so far, which may
+	// continue before the chunk it came from.
+	var rest []byte
+	for end := info.Size(); end > 0; {
+		start := max(0, end-historyChunk)
+		buf := make([]byte, end-start, end-start+int64(len(rest)))
+		if _, err := f.ReadAt(buf, start); err != nil {
+			return false, err
+		}
+		buf = append(buf, rest...)
+		for {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			if line := buf[i+1:]; len(bytes.TrimSpace(line)) > 0 && !fn(line) {
+				return false, nil
+			}
+			buf = buf[:i]
+		}
+		rest, end = buf, start
+	}
+	if len(bytes.TrimSpace(rest)) > 0 && !fn(rest) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// requestFingerprint identifies a call by what decides its response: the
+// method, URL, token, body and given headers, less the request id and
+// traceparent that differ on every call.
+func requestFingerprint(cfg *ResolvedConfig, r APIRequest) string {
+	token := r.TokenName
+	if token == "" {
+		token = cfg.DefaultTokenName
+	}
+	headers := make([]string, 0, len(r.Headers))
+	for _, h := range r.Headers {
+		k, v, _ := strings.Cut(h, ":")
+		k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+		if k == "Traceparent" || cfg.RequestIDHeader != "" && k == http.CanonicalHeaderKey(cfg.RequestIDHeader) {
+			continue
+		}
+		headers = append(headers, k+": "+strings.TrimSpace(v))
+	}
+	sort.Strings(headers)
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{r.Method, cfg.BuildURL(r.Path), token, r.Body}, headers...), "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// recentDuplicate returns the latest call of the active env with the given
+// fingerprint that got a response within the window, or nil. Only the
+// entries of the window are read.
+func recentDuplicate(cfg *ResolvedConfig, fingerprint string, window time.Duration) *HistoryEntry {
+	cutoff := time.Now().Add(-window)
+	var found *HistoryEntry
+	err := scanHistoryBackward(cfg, func(e HistoryEntry) bool {
+		if !e.Time.After(cutoff) {
+			return false
+		}
+		if e.Fingerprint == fingerprint && e.Error == "" && e.Project == cfg.ActiveProject && e.Env == cfg.ActiveEnv {
+			found = &e
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil
+	}
+	return found
+}
+
+// storedResponse rebuilds the response recorded in e.
+func storedResponse(e *HistoryEntry) *APIResponse {
+	header := make(http.Header, len(e.ResponseHeaders))
+	for k, v := range e.ResponseHeaders {
+		header.Set(k, v)
+	}
+	return &APIResponse{StatusCode: e.Status, Header: header, Body: []byte(e.ResponseBody), Size: int64(len(e.ResponseBody))}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LookupJSONPath evaluates a simple JSONPath against a decoded JSON document.
+// Supported syntax: an optional leading `$`, `.key`, `["key"]` and `[index]`
+// (negative indexes count from the end), e.g. `$.items[0].id`.
+func LookupJSONPath(doc any, path string) (any, bool) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false
+	}
+	cur := doc
+	for _, st := range steps {
+		switch v := cur.(type) {
+		case map[string]any:
+			if st.isIndex {
+				return nil, false
+			}
+			next, ok := v[st.key]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			if !st.isIndex {
+				return nil, false
+			}
+			idx := st.index
+			if idx < 0 {
+				idx += len(v)
+			}
+			if idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			cur = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	steps := make([]jsonPathStep, 0)
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			if j == i {
+				if i >= len(p) {
+					return steps, nil
+				}
+				return nil, fmt.Errorf("empty key at offset %d in %q", i, path)
+			}
+			steps = append(steps, jsonPathStep{key: p[i:j]})
+			i = j
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '[' in %q", path)
+			}
+			inner := strings.TrimSpace(p[i+1 : i+end])
+			i += end + 1
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in %q", inner, path)
+			}
+			steps = append(steps, jsonPathStep{index: n, isIndex: true})
+		default:
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			steps = append(steps, jsonPathStep{key: p[i:j]})
+			i = j
+		}
+	}
+	return steps, nil
+}
+
+// jsonScalarString renders a JSON value the way it is interpolated into
+// paths and bodies: strings verbatim, everything else as compact JSON.
+func jsonScalarString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
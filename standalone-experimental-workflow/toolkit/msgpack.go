@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// msgpackCodec converts between JSON and MessagePack. Binary values decode
+// to base64 strings, timestamps (extension -1) to RFC 3339 strings and
+// other extensions to {"ext_type": n, "data": "<base64>"}.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(v any) ([]byte, error) {
+	return appendMsgpack(nil, v)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if t {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case string:
+		n := len(t)
+		switch {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+		}
+		return append(b, t...), nil
+	case []any:
+		n := len(t)
+		switch {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+		}
+		var err error
+		for _, e := range t {
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		n := len(t)
+		switch {
+		case n < 16:
+			b = append(b, 0x80|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+		}
+		var err error
+		for _, k := range agentapi.SortedKeys(t) {
+			b, _ = appendMsgpack(b, k)
+			if b, err = appendMsgpack(b, t[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	i, u, f, kind, ok := codecNumber(v)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unsupported value %T", v)
+	case kind == 'u':
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+	case kind == 'f':
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case i >= 0 && i < 128:
+		return append(b, byte(i)), nil
+	case i >= 0 && i <= math.MaxUint8:
+		return append(b, 0xcc, byte(i)), nil
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(i)), nil
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(i)), nil
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(i)), nil
+	case i >= -32:
+		return append(b, byte(i)), nil
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i)), nil
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i)), nil
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i)), nil
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i)), nil
+}
+
+func (msgpackCodec) Decode(body []byte) (any, error) {
+	d := &msgpackDecoder{b: body}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(body) {
+		return nil, fmt.Errorf("msgpack: %d trailing bytes", len(body)-d.pos)
+	}
+	return v, nil
+}
+
+// maxCodecDepth bounds the nesting the binary decoders follow.
+const maxCodecDepth = 256
+
+type msgpackDecoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || len(d.b)-d.pos < n {
+		return nil, fmt.Errorf("msgpack: truncated at byte %d", d.pos)
+	}
+	out := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return out, nil
+}
+
+// size reads a big-endian length of n bytes.
+func (d *msgpackDecoder) size(n int) (int, error) {
+	p, err := d.take(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return int(p[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(p)), nil
+	}
+	return int(binary.BigEndian.Uint32(p)), nil
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxCodecDepth {
+		return nil, fmt.Errorf("msgpack: nested deeper than %d", maxCodecDepth)
+	}
+	p, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.object(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.size(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.size(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		p, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p))), nil
+	case 0xcb:
+		p, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), nil
+	case 0xcc, 0xcd, 0xce:
+		n, err := d.size(1 << (c - 0xcc))
+		return int64(n), err
+	case 0xcf:
+		p, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		u := binary.BigEndian.Uint64(p)
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		p, err := d.take(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		switch len(p) {
+		case 1:
+			return int64(int8(p[0])), nil
+		case 2:
+			return int64(int16(binary.BigEndian.Uint16(p))), nil
+		case 4:
+			return int64(int32(binary.BigEndian.Uint32(p))), nil
+		}
+		return int64(binary.BigEndian.Uint64(p)), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.size(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.size(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.size(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unknown type byte 0x%02x at byte %d", c, d.pos-1)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	p, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (any, error) {
+	if n > len(d.b)-d.pos {
+		return nil, fmt.Errorf("msgpack: truncated at byte %d", d.pos)
+	}
+	out := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) object(n int, depth int) (any, error) {
+	if n > len(d.b)-d.pos {
+		return nil, fmt.Errorf("msgpack: truncated at byte %d", d.pos)
+	}
+	out := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out[codecKey(k)] = v
+	}
+	return out, nil
+}
+
+// ext reads an extension of n data bytes: the timestamp type as RFC 3339,
+// any other as its type and base64 data.
+func (d *msgpackDecoder) ext(n int) (any, error) {
+	p, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	typ := int8(p[0])
+	data, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if typ == -1 {
+		var t time.Time
+		switch n {
+		case 4:
+			t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			t = time.Unix(int64(v&0x3ffffffff), int64(v>>34))
+		case 12:
+			t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data[:4])))
+		}
+		if !t.IsZero() {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return map[string]any{"ext_type": int64(typ), "data": base64.StdEncoding.EncodeToString(data)}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// offline is set by the global --offline flag; PerformRequest routes every
+// API call through it instead of the network.
+var offline *offlineTransport
+
+// offlineTransport serves each env's openapi_url from its spec cache and
+// every other request from a replay cassette, so whole commands (acurl,
+// test, verify, find, ...) run without a live backend. Requests with no
+// recorded answer fail instead of reaching the network.
+type offlineTransport struct {
+	specs    map[string]string // openapi_url -> spec cache file
+	fixtures *Cassette
+}
+
+func (t *offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if path, ok := t.specs[req.URL.String()]; ok && req.Method == http.MethodGet {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("offline: no cached spec for %s (fetch it once online)", req.URL)
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          io.NopCloser(strings.NewReader(string(body))),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	resp, err := t.fixtures.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("offline: %w", err)
+	}
+	return resp, nil
+}
+
+// enableOffline installs the offline transport for --offline <cassette>,
+// for the package-level agentapi calls as well as PerformRequest.
+func enableOffline(configPath string, opts GlobalOptions) error {
+	if opts.Offline == "" {
+		return nil
+	}
+	fixtures, err := OpenReplayCassette(opts.Offline)
+	if err != nil {
+		return err
+	}
+	t := &offlineTransport{specs: map[string]string{}, fixtures: fixtures}
+	envs, err := agentapi.ProjectEnvNames(configPath)
+	if err != nil {
+		return err
+	}
+	for _, env := range envs {
+		if cfg, err := agentapi.LoadConfigForEnv(configPath, env); err == nil {
+			t.specs[cfg.OpenAPIURL] = agentapi.SpecCachePath(cfg)
+		}
+	}
+	offline = t
+	agentapi.DefaultDoer = &http.Client{Transport: traced(t), Timeout: 30 * time.Second}
+	logger.Debug("offline mode", "fixtures", opts.Offline, "interactions", len(fixtures.Interactions))
+	return nil
+}
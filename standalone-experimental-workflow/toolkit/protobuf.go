@@ -0,0 +1,767 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Field types of FieldDescriptorProto.
+const (
+	protoDouble   = 1
+	protoFloat    = 2
+	protoInt64    = 3
+	protoUint64   = 4
+	protoInt32    = 5
+	protoFixed64  = 6
+	protoFixed32  = 7
+	protoBool     = 8
+	protoString   = 9
+	protoGroup    = 10
+	protoMessage  = 11
+	protoBytes    = 12
+	protoUint32   = 13
+	protoEnum     = 14
+	protoSfixed32 = 15
+	protoSfixed64 = 16
+	protoSint32   = 17
+	protoSint64   = 18
+)
+
+// Wire types.
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+// protoCodec converts between JSON, in the proto3 JSON mapping (lowerCamel
+// names, 64-bit integers as strings, bytes as base64, enums by name), and
+// one message type of the descriptor sets given with --proto-descriptor.
+type protoCodec struct {
+	types *protoTypes
+	msg   *protoMessageType
+}
+
+type protoTypes struct {
+	messages map[string]*protoMessageType
+	enums    map[string]*protoEnumType
+}
+
+type protoMessageType struct {
+	name     string
+	fields   []*protoField
+	byNumber map[uint64]*protoField
+	byName   map[string]*protoField
+	mapEntry bool
+}
+
+type protoField struct {
+	name, jsonName string
+	number         uint64
+	typ            int
+	typeName       string
+	repeated       bool
+	packed         bool
+}
+
+type protoEnumType struct {
+	byNumber map[int32]string
+	byName   map[string]int32
+}
+
+// newProtoCodec builds the codec of the message named by the proto (or
+// messageType) parameter of the media type.
+func newProtoCodec(params map[string]string, descriptors []string) (bodyCodec, error) {
+	name := strings.TrimPrefix(params["proto"], ".")
+	if name == "" {
+		name = strings.TrimPrefix(params["messagetype"], ".")
+	}
+	if name == "" {
+		return nil, NewCliErrorHint(ExitRequestBuild, "A protobuf body needs its message type", `Name it in the media type, e.g. --content-type 'application/x-protobuf; proto=shop.v1.Product'.`)
+	}
+	if len(descriptors) == 0 {
+		return nil, NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("No descriptor set to encode or decode %s with", name), "Pass the output of protoc --include_imports --descriptor_set_out=<file> with --proto-descriptor <file>.")
+	}
+	types := &protoTypes{messages: map[string]*protoMessageType{}, enums: map[string]*protoEnumType{}}
+	for _, path := range descriptors {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Cannot read --proto-descriptor: %v", err), err)
+		}
+		if err := types.addSet(raw); err != nil {
+			return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid descriptor set %s: %v", path, err), err)
+		}
+	}
+	msg, ok := types.messages[name]
+	if !ok {
+		// A name without its package is enough when only one message has it.
+		for full, m := range types.messages {
+			if strings.HasSuffix(full, "."+name) {
+				msg, ok = m, msg == nil
+			}
+		}
+	}
+	if !ok {
+		names := make([]string, 0, len(types.messages))
+		for n := range types.messages {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		message := fmt.Sprintf("Message %s is not in the descriptor sets%s", name, agentapi.DidYouMean(name, names))
+		if len(names) > 10 {
+			names = append(names[:10], "...")
+		}
+		return nil, NewCliErrorHint(ExitRequestBuild, message, fmt.Sprintf("Use the full name, package included; the sets define %s.", strings.Join(names, ", ")))
+	}
+	return &protoCodec{types: types, msg: msg}, nil
+}
+
+// protoReader walks the fields of an encoded message.
+type protoReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("protobuf: bad varint at byte %d", r.pos)
+	}
+	r.pos += n
+	return v, nil
+}
+
+// next reads a field: its number, wire type and, as raw bytes, its value
+// (the varint itself for wireVarint).
+func (r *protoReader) next() (num uint64, wire int, val []byte, err error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	num, wire = key>>3, int(key&7)
+	start := r.pos
+	var n int
+	switch wire {
+	case wireVarint:
+		if _, err := r.varint(); err != nil {
+			return 0, 0, nil, err
+		}
+		return num, wire, r.b[start:r.pos], nil
+	case wire64:
+		n = 8
+	case wire32:
+		n = 4
+	case wireBytes:
+		l, err := r.varint()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if l > uint64(len(r.b)-r.pos) {
+			return 0, 0, nil, fmt.Errorf("protobuf: field %d overruns the message", num)
+		}
+		start, n = r.pos, int(l)
+	default:
+		return 0, 0, nil, fmt.Errorf("protobuf: unsupported wire type %d of field %d", wire, num)
+	}
+	if n > len(r.b)-r.pos {
+		return 0, 0, nil, fmt.Errorf("protobuf: field %d overruns the message", num)
+	}
+	r.pos = start + n
+	return num, wire, r.b[start:r.pos], nil
+}
+
+// addSet adds the messages and enums of a FileDescriptorSet.
+func (t *protoTypes) addSet(raw []byte) error {
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return err
+		}
+		if num == 1 && wire == wireBytes {
+			if err := t.addFile(val); err != nil {
+				return err
+			}
+		}
+	}
+	if len(t.messages) == 0 {
+		return fmt.Errorf("no message types (is it a FileDescriptorSet?)")
+	}
+	return nil
+}
+
+func (t *protoTypes) addFile(raw []byte) error {
+	pkg, proto3 := "", false
+	var messages, enums [][]byte
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return err
+		}
+		if wire != wireBytes {
+			continue
+		}
+		switch num {
+		case 2:
+			pkg = string(val)
+		case 4:
+			messages = append(messages, val)
+		case 5:
+			enums = append(enums, val)
+		case 12:
+			proto3 = string(val) == "proto3"
+		}
+	}
+	for _, e := range enums {
+		if err := t.addEnum(pkg, e); err != nil {
+			return err
+		}
+	}
+	for _, m := range messages {
+		if err := t.addMessage(pkg, m, proto3); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (t *protoTypes) addEnum(scope string, raw []byte) error {
+	e := &protoEnumType{byNumber: map[int32]string{}, byName: map[string]int32{}}
+	name := ""
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case num == 1 && wire == wireBytes:
+			name = string(val)
+		case num == 2 && wire == wireBytes:
+			vname, vnum := "", int32(0)
+			vr := &protoReader{b: val}
+			for vr.pos < len(vr.b) {
+				n, w, v, err := vr.next()
+				if err != nil {
+					return err
+				}
+				switch {
+				case n == 1 && w == wireBytes:
+					vname = string(v)
+				case n == 2 && w == wireVarint:
+					u, _ := binary.Uvarint(v)
+					vnum = int32(u)
+				}
+			}
+			if _, seen := e.byNumber[vnum]; !seen {
+				e.byNumber[vnum] = vname
+			}
+			e.byName[vname] = vnum
+		}
+	}
+	t.enums[qualify(scope, name)] = e
+	return nil
+}
+
+func (t *protoTypes) addMessage(scope string, raw []byte, proto3 bool) error {
+	m := &protoMessageType{byNumber: map[uint64]*protoField{}, byName: map[string]*protoField{}}
+	var nested, enums [][]byte
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return err
+		}
+		if wire != wireBytes {
+			continue
+		}
+		switch num {
+		case 1:
+			m.name = qualify(scope, string(val))
+		case 2:
+			f, err := parseProtoField(val, proto3)
+			if err != nil {
+				return err
+			}
+			m.fields = append(m.fields, f)
+		case 3:
+			nested = append(nested, val)
+		case 4:
+			enums = append(enums, val)
+		case 7:
+			or := &protoReader{b: val}
+			for or.pos < len(or.b) {
+				n, w, v, err := or.next()
+				if err != nil {
+					return err
+				}
+				if n == 7 && w == wireVarint {
+					m.mapEntry = v[0] == 1
+				}
+			}
+		}
+	}
+	for _, f := range m.fields {
+		m.byNumber[f.number] = f
+		m.byName[f.name] = f
+		m.byName[f.jsonName] = f
+	}
+	t.messages[m.name] = m
+	for _, e := range enums {
+		if err := t.addEnum(m.name, e); err != nil {
+			return err
+		}
+	}
+	for _, n := range nested {
+		if err := t.addMessage(m.name, n, proto3); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseProtoField(raw []byte, proto3 bool) (*protoField, error) {
+	f := &protoField{}
+	packed := -1
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		u, _ := binary.Uvarint(val)
+		switch {
+		case num == 1 && wire == wireBytes:
+			f.name = string(val)
+		case num == 3 && wire == wireVarint:
+			f.number = u
+		case num == 4 && wire == wireVarint:
+			f.repeated = u == 3
+		case num == 5 && wire == wireVarint:
+			f.typ = int(u)
+		case num == 6 && wire == wireBytes:
+			f.typeName = strings.TrimPrefix(string(val), ".")
+		case num == 10 && wire == wireBytes:
+			f.jsonName = string(val)
+		case num == 8 && wire == wireBytes:
+			or := &protoReader{b: val}
+			for or.pos < len(or.b) {
+				n, w, v, err := or.next()
+				if err != nil {
+					return nil, err
+				}
+				if n == 2 && w == wireVarint {
+					packed = int(v[0])
+				}
+			}
+		}
+	}
+	if f.jsonName == "" {
+		f.jsonName = protoJSONName(f.name)
+	}
+	f.packed = f.repeated && isPackable(f.typ) && (packed == 1 || packed == -1 && proto3)
+	return f, nil
+}
+
+// protoJSONName is the JSON name protoc derives from a field name.
+func protoJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		switch {
+		case c == '_':
+			upper = true
+		case upper && c >= 'a' && c <= 'z':
+			b.WriteRune(c - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(c)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+func (c *protoCodec) Decode(body []byte) (any, error) {
+	return c.decodeMessage(c.msg, body, 0)
+}
+
+func (c *protoCodec) decodeMessage(m *protoMessageType, raw []byte, depth int) (map[string]any, error) {
+	if depth > maxCodecDepth {
+		return nil, fmt.Errorf("protobuf: nested deeper than %d", maxCodecDepth)
+	}
+	out := map[string]any{}
+	r := &protoReader{b: raw}
+	for r.pos < len(r.b) {
+		num, wire, val, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		f, ok := m.byNumber[num]
+		if !ok {
+			continue // unknown fields are dropped, as in the JSON mapping
+		}
+		if f.repeated && wire == wireBytes && isPackable(f.typ) {
+			// Packed; parsers accept it whatever the descriptor says.
+			pr := &protoReader{b: val}
+			list, _ := out[f.jsonName].([]any)
+			for pr.pos < len(pr.b) {
+				v, err := c.decodePacked(f, pr)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			out[f.jsonName] = list
+			continue
+		}
+		v, err := c.decodeValue(f, wire, val, depth)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", m.name, f.name, err)
+		}
+		switch {
+		case f.repeated && c.isMap(f):
+			obj, _ := out[f.jsonName].(map[string]any)
+			if obj == nil {
+				obj = map[string]any{}
+			}
+			entry := v.(map[string]any)
+			obj[codecKey(entry["key"])] = entry["value"]
+			out[f.jsonName] = obj
+		case f.repeated:
+			list, _ := out[f.jsonName].([]any)
+			out[f.jsonName] = append(list, v)
+		default:
+			out[f.jsonName] = v
+		}
+	}
+	return out, nil
+}
+
+func isPackable(typ int) bool {
+	return typ != protoString && typ != protoBytes && typ != protoMessage && typ != protoGroup
+}
+
+func (c *protoCodec) isMap(f *protoField) bool {
+	m, ok := c.types.messages[f.typeName]
+	return ok && m.mapEntry && f.typ == protoMessage
+}
+
+// decodePacked reads one element of a packed repeated field.
+func (c *protoCodec) decodePacked(f *protoField, r *protoReader) (any, error) {
+	var val []byte
+	switch f.typ {
+	case protoDouble, protoFixed64, protoSfixed64:
+		if len(r.b)-r.pos < 8 {
+			return nil, fmt.Errorf("protobuf: packed field %s overruns", f.name)
+		}
+		val = r.b[r.pos : r.pos+8]
+		r.pos += 8
+		return c.decodeValue(f, wire64, val, 0)
+	case protoFloat, protoFixed32, protoSfixed32:
+		if len(r.b)-r.pos < 4 {
+			return nil, fmt.Errorf("protobuf: packed field %s overruns", f.name)
+		}
+		val = r.b[r.pos : r.pos+4]
+		r.pos += 4
+		return c.decodeValue(f, wire32, val, 0)
+	}
+	start := r.pos
+	if _, err := r.varint(); err != nil {
+		return nil, err
+	}
+	return c.decodeValue(f, wireVarint, r.b[start:r.pos], 0)
+}
+
+func (c *protoCodec) decodeValue(f *protoField, wire int, val []byte, depth int) (any, error) {
+	want := wireVarint
+	switch f.typ {
+	case protoDouble, protoFixed64, protoSfixed64:
+		want = wire64
+	case protoFloat, protoFixed32, protoSfixed32:
+		want = wire32
+	case protoString, protoBytes, protoMessage:
+		want = wireBytes
+	case protoGroup:
+		return nil, fmt.Errorf("groups are not supported")
+	}
+	if wire != want {
+		return nil, fmt.Errorf("wire type %d, expected %d", wire, want)
+	}
+	u, _ := binary.Uvarint(val)
+	switch f.typ {
+	case protoDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(val)), nil
+	case protoFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(val))), nil
+	case protoInt64:
+		return strconv.FormatInt(int64(u), 10), nil
+	case protoUint64:
+		return strconv.FormatUint(u, 10), nil
+	case protoInt32:
+		return int64(int32(u)), nil
+	case protoFixed64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(val), 10), nil
+	case protoFixed32:
+		return int64(binary.LittleEndian.Uint32(val)), nil
+	case protoBool:
+		return u != 0, nil
+	case protoString:
+		return string(val), nil
+	case protoBytes:
+		return base64.StdEncoding.EncodeToString(val), nil
+	case protoUint32:
+		return int64(uint32(u)), nil
+	case protoEnum:
+		if e, ok := c.types.enums[f.typeName]; ok {
+			if name, ok := e.byNumber[int32(u)]; ok {
+				return name, nil
+			}
+		}
+		return int64(int32(u)), nil
+	case protoSfixed32:
+		return int64(int32(binary.LittleEndian.Uint32(val))), nil
+	case protoSfixed64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(val)), 10), nil
+	case protoSint32:
+		return int64(int32(u>>1) ^ -int32(u&1)), nil
+	case protoSint64:
+		return strconv.FormatInt(int64(u>>1)^-int64(u&1), 10), nil
+	case protoMessage:
+		m, ok := c.types.messages[f.typeName]
+		if !ok {
+			return nil, fmt.Errorf("message type %s is not in the descriptor sets", f.typeName)
+		}
+		return c.decodeMessage(m, val, depth+1)
+	}
+	return nil, fmt.Errorf("unknown field type %d", f.typ)
+}
+
+func (c *protoCodec) Encode(v any) ([]byte, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("a %s message is a JSON object, got %s", c.msg.name, jsonTypeName(v))
+	}
+	return c.encodeMessage(nil, c.msg, obj)
+}
+
+func (c *protoCodec) encodeMessage(b []byte, m *protoMessageType, obj map[string]any) ([]byte, error) {
+	var err error
+	for _, key := range agentapi.SortedKeys(obj) {
+		f, ok := m.byName[key]
+		if !ok {
+			names := make([]string, 0, len(m.fields))
+			for _, f := range m.fields {
+				names = append(names, f.jsonName)
+			}
+			return nil, fmt.Errorf("%s has no field %q%s", m.name, key, agentapi.DidYouMean(key, names))
+		}
+		val := obj[key]
+		switch {
+		case val == nil:
+		case f.repeated && c.isMap(f):
+			entries, ok := val.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s is a map, given %s", m.name, f.name, jsonTypeName(val))
+			}
+			entry := c.types.messages[f.typeName]
+			for _, k := range agentapi.SortedKeys(entries) {
+				kv, err := c.encodeMessage(nil, entry, map[string]any{"key": mapKeyValue(entry, k), "value": entries[k]})
+				if err != nil {
+					return nil, err
+				}
+				b = binary.AppendUvarint(binary.AppendUvarint(b, f.number<<3|wireBytes), uint64(len(kv)))
+				b = append(b, kv...)
+			}
+		case f.repeated:
+			list, ok := val.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s is repeated, given %s", m.name, f.name, jsonTypeName(val))
+			}
+			if f.packed {
+				var packed []byte
+				for _, e := range list {
+					if packed, _, err = c.encodeValue(packed, f, e); err != nil {
+						return nil, fmt.Errorf("%s.%s: %w", m.name, f.name, err)
+					}
+				}
+				b = binary.AppendUvarint(binary.AppendUvarint(b, f.number<<3|wireBytes), uint64(len(packed)))
+				b = append(b, packed...)
+				continue
+			}
+			for _, e := range list {
+				if b, err = c.appendField(b, f, e); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", m.name, f.name, err)
+				}
+			}
+		default:
+			if b, err = c.appendField(b, f, val); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", m.name, f.name, err)
+			}
+		}
+	}
+	return b, nil
+}
+
+// mapKeyValue types a JSON object key as the key field of a map entry:
+// JSON object keys are always strings.
+func mapKeyValue(entry *protoMessageType, k string) any {
+	if f, ok := entry.byName["key"]; ok && f.typ != protoString {
+		if f.typ == protoBool {
+			return k == "true"
+		}
+		return k // encodeValue reads integers from strings
+	}
+	return k
+}
+
+// appendField appends the key and value of one field.
+func (c *protoCodec) appendField(b []byte, f *protoField, v any) ([]byte, error) {
+	val, wire, err := c.encodeValue(nil, f, v)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.AppendUvarint(b, f.number<<3|uint64(wire))
+	if wire == wireBytes {
+		b = binary.AppendUvarint(b, uint64(len(val)))
+	}
+	return append(b, val...), nil
+}
+
+// encodeValue appends the value of f (no key, no length) and reports its
+// wire type.
+func (c *protoCodec) encodeValue(b []byte, f *protoField, v any) ([]byte, int, error) {
+	switch f.typ {
+	case protoString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("expected a string, got %s", jsonTypeName(v))
+		}
+		return append(b, s...), wireBytes, nil
+	case protoBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("expected a base64 string, got %s", jsonTypeName(v))
+		}
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if raw, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, 0, fmt.Errorf("invalid base64: %v", err)
+			}
+		}
+		return append(b, raw...), wireBytes, nil
+	case protoMessage:
+		m, ok := c.types.messages[f.typeName]
+		if !ok {
+			return nil, 0, fmt.Errorf("message type %s is not in the descriptor sets", f.typeName)
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, 0, fmt.Errorf("expected an object, got %s", jsonTypeName(v))
+		}
+		out, err := c.encodeMessage(b, m, obj)
+		return out, wireBytes, err
+	case protoBool:
+		t, ok := v.(bool)
+		if !ok {
+			return nil, 0, fmt.Errorf("expected a boolean, got %s", jsonTypeName(v))
+		}
+		if t {
+			return append(b, 1), wireVarint, nil
+		}
+		return append(b, 0), wireVarint, nil
+	case protoEnum:
+		if name, ok := v.(string); ok {
+			if e, ok := c.types.enums[f.typeName]; ok {
+				n, ok := e.byName[name]
+				if !ok {
+					return nil, 0, fmt.Errorf("%s has no value %s", f.typeName, name)
+				}
+				return binary.AppendUvarint(b, uint64(int64(n))), wireVarint, nil
+			}
+		}
+	case protoGroup:
+		return nil, 0, fmt.Errorf("groups are not supported")
+	}
+
+	// Numbers: JSON numbers, or strings as proto3 JSON writes 64-bit ones.
+	num := v
+	if s, ok := v.(string); ok {
+		num = jsonNumberString(s)
+	}
+	i, u, fl, kind, ok := codecNumber(num)
+	if !ok {
+		return nil, 0, fmt.Errorf("expected a number, got %s", jsonTypeName(v))
+	}
+	switch f.typ {
+	case protoDouble:
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(numberFloat(i, u, fl, kind))), wire64, nil
+	case protoFloat:
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(numberFloat(i, u, fl, kind)))), wire32, nil
+	}
+	if kind == 'f' {
+		if fl != math.Trunc(fl) {
+			return nil, 0, fmt.Errorf("expected an integer, got %v", fl)
+		}
+		i, kind = int64(fl), 'i'
+	}
+	if kind == 'u' {
+		i = int64(u)
+	}
+	switch f.typ {
+	case protoInt64, protoUint64, protoInt32, protoUint32, protoEnum:
+		return binary.AppendUvarint(b, uint64(i)), wireVarint, nil
+	case protoSint32, protoSint64:
+		return binary.AppendUvarint(b, uint64(i<<1^i>>63)), wireVarint, nil
+	case protoFixed64, protoSfixed64:
+		return binary.LittleEndian.AppendUint64(b, uint64(i)), wire64, nil
+	case protoFixed32, protoSfixed32:
+		return binary.LittleEndian.AppendUint32(b, uint32(i)), wire32, nil
+	}
+	return nil, 0, fmt.Errorf("unknown field type %d", f.typ)
+}
+
+// jsonNumberString reads a number given as a string; the special floats
+// of proto3 JSON become float64s.
+func jsonNumberString(s string) any {
+	switch s {
+	case "NaN":
+		return math.NaN()
+	case "Infinity":
+		return math.Inf(1)
+	case "-Infinity":
+		return math.Inf(-1)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return s
+	}
+	return json.Number(s)
+}
+
+func numberFloat(i int64, u uint64, f float64, kind byte) float64 {
+	switch kind {
+	case 'i':
+		return float64(i)
+	case 'u':
+		return float64(u)
+	}
+	return f
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// Query expressions extend the JSONPath subset of LookupJSONPath with
+// wildcards (`.*`, `[*]`), slices (`[1:3]`, `[-2:]`) and filters
+// (`[?(@.status == 'paid')]`, `[?@.note]`). Once a wildcard, slice or
+// filter is applied the result is a flat list of every match.
+type queryStep struct {
+	kind   int
+	key    string
+	index  int
+	start  *int
+	end    *int
+	filter *queryFilter
+}
+
+const (
+	queryKey = iota
+	queryIndex
+	queryWildcard
+	querySlice
+	queryFilterStep
+)
+
+// queryFilter is `@.path`, optionally compared with a JSON literal.
+type queryFilter struct {
+	path  string
+	op    string
+	value any
+}
+
+var queryOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// EvaluateQuery runs expr against doc. Expressions that can yield several
+// values always return a list (possibly empty); otherwise found is false
+// when the path does not exist.
+func EvaluateQuery(doc any, expr string) (result any, found bool, err error) {
+	steps, err := parseQuery(expr)
+	if err != nil {
+		return nil, false, WrapCliError(ExitRequestBuild, fmt.Sprintf("Invalid query %q: %v", expr, err), err)
+	}
+	nodes := []any{doc}
+	many := false
+	for _, st := range steps {
+		next := make([]any, 0, len(nodes))
+		for _, n := range nodes {
+			next = append(next, applyQueryStep(n, st)...)
+		}
+		if st.kind != queryKey && st.kind != queryIndex {
+			many = true
+		}
+		nodes = next
+	}
+	if many {
+		return nodes, true, nil
+	}
+	if len(nodes) == 0 {
+		return nil, false, nil
+	}
+	return nodes[0], true, nil
+}
+
+func applyQueryStep(n any, st queryStep) []any {
+	switch st.kind {
+	case queryKey:
+		if m, ok := n.(map[string]any); ok {
+			if v, ok := m[st.key]; ok {
+				return []any{v}
+			}
+		}
+	case queryIndex:
+		if s, ok := n.([]any); ok {
+			idx := st.index
+			if idx < 0 {
+				idx += len(s)
+			}
+			if idx >= 0 && idx < len(s) {
+				return []any{s[idx]}
+			}
+		}
+	case queryWildcard:
+		switch v := n.(type) {
+		case []any:
+			return v
+		case map[string]any:
+			out := make([]any, 0, len(v))
+			for _, k := range agentapi.SortedKeys(v) {
+				out = append(out, v[k])
+			}
+			return out
+		}
+	case querySlice:
+		if s, ok := n.([]any); ok {
+			lo, hi := 0, len(s)
+			if st.start != nil {
+				lo = clampIndex(*st.start, len(s))
+			}
+			if st.end != nil {
+				hi = clampIndex(*st.end, len(s))
+			}
+			if lo < hi {
+				return s[lo:hi]
+			}
+		}
+	case queryFilterStep:
+		items := make([]any, 0)
+		switch v := n.(type) {
+		case []any:
+			items = v
+		case map[string]any:
+			for _, k := range agentapi.SortedKeys(v) {
+				items = append(items, v[k])
+			}
+		}
+		out := make([]any, 0)
+		for _, it := range items {
+			if st.filter.match(it) {
+				out = append(out, it)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+func (f *queryFilter) match(item any) bool {
+	v, ok := LookupJSONPath(item, f.path)
+	if f.op == "" {
+		return ok && v != nil && v != false
+	}
+	if !ok {
+		return f.op == "!="
+	}
+	return compareJSON(v, f.op, f.value)
+}
+
+// compareJSON applies a queryOps comparison: numbers and strings are
+// ordered, any values may be equal.
+func compareJSON(v any, op string, value any) bool {
+	if a, aok := v.(float64); aok {
+		if b, bok := value.(float64); bok {
+			switch op {
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	if a, aok := v.(string); aok {
+		if b, bok := value.(string); bok {
+			switch op {
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return jsonEqual(v, value)
+	case "!=":
+		return !jsonEqual(v, value)
+	}
+	return false
+}
+
+func parseQuery(expr string) ([]queryStep, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	steps := make([]queryStep, 0)
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			if j == i {
+				switch {
+				case i >= len(p):
+					return steps, nil
+				case p[i] == '[':
+					continue // jq's .[0]
+				}
+				return nil, fmt.Errorf("empty key at offset %d", i)
+			}
+			steps = append(steps, keyOrWildcard(p[i:j]))
+			i = j
+		case '[':
+			end := closingBracket(p, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '['")
+			}
+			st, err := parseBracket(strings.TrimSpace(p[i+1 : end]))
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, st)
+			i = end + 1
+		default:
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			steps = append(steps, keyOrWildcard(p[i:j]))
+			i = j
+		}
+	}
+	return steps, nil
+}
+
+func keyOrWildcard(key string) queryStep {
+	if key == "*" {
+		return queryStep{kind: queryWildcard}
+	}
+	return queryStep{kind: queryKey, key: key}
+}
+
+// closingBracket finds the ']' matching p[open], skipping quoted strings
+// and nested brackets inside filters.
+func closingBracket(p string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseBracket(inner string) (queryStep, error) {
+	switch {
+	case inner == "*":
+		return queryStep{kind: queryWildcard}, nil
+	case strings.HasPrefix(inner, "?"):
+		f, err := parseQueryFilter(strings.TrimSpace(inner[1:]))
+		if err != nil {
+			return queryStep{}, err
+		}
+		return queryStep{kind: queryFilterStep, filter: f}, nil
+	case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+		return queryStep{kind: queryKey, key: inner[1 : len(inner)-1]}, nil
+	case strings.Contains(inner, ":"):
+		lo, hi, _ := strings.Cut(inner, ":")
+		st := queryStep{kind: querySlice}
+		for _, b := range []struct {
+			raw string
+			dst **int
+		}{{lo, &st.start}, {hi, &st.end}} {
+			raw := strings.TrimSpace(b.raw)
+			if raw == "" {
+				continue
+			}
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return queryStep{}, fmt.Errorf("invalid slice %q", inner)
+			}
+			*b.dst = &n
+		}
+		return st, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return queryStep{}, fmt.Errorf("invalid index %q", inner)
+	}
+	return queryStep{kind: queryIndex, index: n}, nil
+}
+
+func parseQueryFilter(s string) (*queryFilter, error) {
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	f := &queryFilter{}
+	lhs := s
+	for _, op := range queryOps {
+		if i := strings.Index(s, op); i >= 0 {
+			lhs, f.op = strings.TrimSpace(s[:i]), op
+			v, err := parseQueryLiteral(strings.TrimSpace(s[i+len(op):]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter value %q", strings.TrimSpace(s[i+len(op):]))
+			}
+			f.value = v
+			break
+		}
+	}
+	lhs = strings.TrimPrefix(lhs, "@")
+	if lhs == "" {
+		return nil, fmt.Errorf("filter needs a field, e.g. [?(@.status == 'paid')]")
+	}
+	f.path = lhs
+	return f, nil
+}
+
+// parseQueryLiteral reads the right side of a comparison: JSON, or a
+// 'single-quoted' string.
+func parseQueryLiteral(raw string) (any, error) {
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// loadQuerySource returns the body a query runs against: the latest call
+// of the active env (`last`), a history entry (`history:<id>`), a file, or
+// stdin (`-`).
+func loadQuerySource(cfg *ResolvedConfig, from string) ([]byte, string, error) {
+	if from == "last" || strings.HasPrefix(from, "history:") {
+		// A latest response recorded without its body must not make `last`
+		// fall back to an older one.
+		e, err := historySource(cfg, from, func(e HistoryEntry) bool { return e.ResponseBody != "" || e.MetadataOnly && e.ResponseBytes > 0 })
+		if err != nil {
+			if from == "last" && !currentRecording(cfg).On {
+				return nil, "", NewCliErrorHint(ExitNotFound, ExitMessage(err), recordHint)
+			}
+			return nil, "", err
+		}
+		if e.MetadataOnly {
+			return nil, "", NewCliErrorHint(ExitNotFound, fmt.Sprintf("History entry %s was recorded without its body", e.ID), recordHint)
+		}
+		if e.Truncated {
+			fmt.Fprintf(os.Stderr, "warning: history entry %s was truncated when recorded\n", e.ID)
+		}
+		return []byte(e.ResponseBody), historyLabel(e), nil
+	}
+	if from == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to read stdin: %v", err), err)
+		}
+		return b, "stdin", nil
+	}
+	b, err := os.ReadFile(from)
+	if err != nil {
+		return nil, "", NewCliError(ExitRequestBuild, fmt.Sprintf("File not found: %s", from))
+	}
+	return b, from, nil
+}
+
+// historySource finds the entry `history:<id>` names, or for `last` the
+// latest entry of the active env that keep accepts.
+func historySource(cfg *ResolvedConfig, from string, keep func(HistoryEntry) bool) (*HistoryEntry, error) {
+	entries, err := LoadHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimPrefix(from, "history:")
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if from == "last" {
+			if e.Project != cfg.ActiveProject || e.Env != cfg.ActiveEnv || !keep(e) {
+				continue
+			}
+		} else if e.ID != id {
+			continue
+		}
+		return &e, nil
+	}
+	if from == "last" {
+		return nil, NewCliError(ExitNotFound, fmt.Sprintf("No stored response for %s/%s in history", cfg.ActiveProject, cfg.ActiveEnv))
+	}
+	return nil, NewCliError(ExitNotFound, fmt.Sprintf("History entry not found: %s", id))
+}
+
+func historyLabel(e *HistoryEntry) string {
+	return fmt.Sprintf("%s %s (history:%s)", e.Method, e.URL, e.ID)
+}
+
+// RunQueryCommand implements `api query '<expr>' [--from ...] [--raw]`.
+func RunQueryCommand(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api query '<expression>' [--from last|history:<id>|<file>|-] [--raw | --format table|csv|json|ndjson [--fields <field1>,<field2>]]"
+	expr, from, raw, format := "", "last", false, ""
+	var fields []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			if _, err := LookupFormatter(args[i]); err != nil {
+				return err
+			}
+			format = args[i]
+		case "--fields":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --fields")
+			}
+			fields = splitFields(args[i])
+		case "--from":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --from")
+			}
+			from = args[i]
+		case "--raw":
+			raw = true
+		default:
+			if expr != "" {
+				return NewCliError(ExitRequestBuild, usage)
+			}
+			expr = args[i]
+		}
+	}
+	if expr == "" || (raw && format != "") || (format == "" && len(fields) > 0) {
+		return NewCliError(ExitRequestBuild, usage)
+	}
+	body, label, err := loadQuerySource(cfg, from)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Response of %s is not JSON", label))
+	}
+	result, found, err := EvaluateQuery(doc, expr)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return NewCliError(ExitNotFound, fmt.Sprintf("No match for %s in %s", expr, label))
+	}
+	if s, ok := result.(string); ok && raw {
+		fmt.Println(s)
+		return nil
+	}
+	if format != "" {
+		t, err := ArrayTable(result, fields)
+		if err != nil {
+			return err
+		}
+		f, _ := LookupFormatter(format)
+		if err := f.Format(os.Stdout, t); err != nil {
+			return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+		}
+		return nil
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
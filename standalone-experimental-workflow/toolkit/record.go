@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// recordHint points at recording when a stored body is missing.
+const recordHint = "History keeps request and response bodies only while recording is on: run `api record on`, then repeat the call."
+
+const recordUsage = "Usage: api record on [--max-bytes <n>] | off | status"
+
+// RecordState says whether the history of a session keeps request and
+// response bodies. MaxBytes caps each body (maxHistoryBody when 0).
+type RecordState struct {
+	On       bool      `json:"on"`
+	MaxBytes int       `json:"max_bytes,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+func (r RecordState) maxBytes() int {
+	if r.MaxBytes > 0 {
+		return r.MaxBytes
+	}
+	return maxHistoryBody
+}
+
+func recordPath(cfg *ResolvedConfig) string {
+	return filepath.Join(cfg.ConfigDir, "state", "record.json")
+}
+
+// loadRecordStates maps session ids ("" without a session) to their
+// state; sessions not listed record metadata only.
+func loadRecordStates(cfg *ResolvedConfig) (map[string]RecordState, error) {
+	raw, err := os.ReadFile(recordPath(cfg))
+	if os.IsNotExist(err) {
+		return map[string]RecordState{}, nil
+	}
+	if err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to read recording state: %v", err), err)
+	}
+	states := map[string]RecordState{}
+	if err := json.Unmarshal(raw, &states); err != nil {
+		return nil, WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to parse %s: %v", recordPath(cfg), err), err)
+	}
+	return states, nil
+}
+
+func saveRecordStates(cfg *ResolvedConfig, states map[string]RecordState) error {
+	path := recordPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err), err)
+	}
+	raw, _ := json.MarshalIndent(states, "", "  ")
+	if err := agentapi.WriteFileAtomic(path, append(raw, '\n'), 0o600); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write recording state: %v", err), err)
+	}
+	return nil
+}
+
+// currentRecording is the recording state of this session, read on every
+// call so long-running processes (daemon, proxy) follow a toggle; an
+// unreadable state records metadata only.
+func currentRecording(cfg *ResolvedConfig) RecordState {
+	states, err := loadRecordStates(cfg)
+	if err != nil {
+		logger.Debug("recording state unreadable", "error", err)
+		return RecordState{}
+	}
+	return states[cfg.Session]
+}
+
+// RunRecordCommand implements `api record on|off|status`: whether this
+// session's history keeps bodies, redacted and capped, or only metadata.
+func RunRecordCommand(cfg *ResolvedConfig, args []string) error {
+	sub := "status"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	maxBytes := 0
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--max-bytes" && sub == "on":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --max-bytes")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --max-bytes: %s (expected a positive integer)", args[i]))
+			}
+			maxBytes = n
+		default:
+			return NewCliError(ExitRequestBuild, recordUsage)
+		}
+	}
+	who := "this session"
+	if cfg.Session == "" {
+		who = "calls without a session"
+	}
+	if sub == "on" || sub == "off" {
+		unlock, err := lockState(recordPath(cfg))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	states, err := loadRecordStates(cfg)
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "on":
+		states[cfg.Session] = RecordState{On: true, MaxBytes: maxBytes, Since: time.Now().UTC()}
+		if err := saveRecordStates(cfg, states); err != nil {
+			return err
+		}
+		infof("Recording bodies for %s, up to %s each.\n", who, formatBytes(int64(states[cfg.Session].maxBytes())))
+	case "off":
+		delete(states, cfg.Session)
+		if err := saveRecordStates(cfg, states); err != nil {
+			return err
+		}
+		infof("Recording metadata only for %s.\n", who)
+	case "status":
+		if s, ok := states[cfg.Session]; ok && s.On {
+			fmt.Printf("Recording: bodies up to %s each, since %s (%s)\n", formatBytes(int64(s.maxBytes())), s.Since.Format(time.RFC3339), who)
+		} else {
+			fmt.Printf("Recording: metadata only (%s)\n", who)
+		}
+	default:
+		return NewCliError(ExitRequestBuild, recordUsage)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const callRequestUsage = "Usage: api call --request <request.yaml> [--var name=value]... [--token <name>]"
+
+// LoadRequestFile reads a request file: one test step on its own, in the
+// YAML of a suite step (request or operation, params, token, headers,
+// body, assert), so a call can be reviewed and versioned, run with
+// `api call --request` and reused by suites with `use:`.
+//
+//	name: create product
+//	request: POST /products
+//	headers: {X-Source: agent}
+//	body: {name: "Widget {{agent_marker}}"}
+//	assert: {status: 201}
+func LoadRequestFile(path string) (*TestStep, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Request file not found: %s", path))
+	}
+	var st TestStep
+	if err := yaml.Unmarshal(raw, &st); err != nil {
+		return nil, WrapCliError(ExitRequestBuild, fmt.Sprintf("Failed to parse request file %s: %v", path, err), err)
+	}
+	switch {
+	case (st.Request == "") == (st.Operation == ""):
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Request file %s needs exactly one of 'request' or 'operation'", path))
+	case st.Use != "" || st.Rollback != nil:
+		return nil, NewCliError(ExitRequestBuild, fmt.Sprintf("Request file %s defines one request: 'use' and 'rollback' belong to suite steps", path))
+	}
+	return &st, nil
+}
+
+// resolveUse replaces a step that uses a request file, and its rollback,
+// by the file's request with the step's name, captures, confirm and
+// rollback. dir is the directory paths are relative to.
+func resolveUse(st *TestStep, dir string) error {
+	if st.Rollback != nil {
+		if err := resolveUse(st.Rollback, dir); err != nil {
+			return err
+		}
+	}
+	if st.Use == "" {
+		return nil
+	}
+	if st.Request != "" || st.Operation != "" || st.Token != "" || st.Body != nil || len(st.Params) > 0 || len(st.Headers) > 0 || st.Assert.Status != 0 || len(st.Assert.JSON) > 0 {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("'use: %s' takes the request and its assertions from the file; the step may only add name, capture, confirm and rollback", st.Use))
+	}
+	path := st.Use
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	file, err := LoadRequestFile(path)
+	if err != nil {
+		return err
+	}
+	if st.Name != "" {
+		file.Name = st.Name
+	}
+	if len(st.Capture) > 0 {
+		file.Capture = st.Capture
+	}
+	file.Confirm = file.Confirm || st.Confirm
+	file.Rollback = st.Rollback
+	*st = *file
+	return nil
+}
+
+// runCallRequest implements `api call --request <file>`: the request of a
+// request file sent like an acurl call, its response body printed, then
+// checked against the file's assertions. A response that fails them
+// exits 11 (ERR_ASSERTION_FAILED); without assertions, a 4xx/5xx exits 10
+// as with acurl.
+func runCallRequest(cfg *ResolvedConfig, args []string) error {
+	var file, token string
+	vars := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--request", "--var", "--token":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			switch flag {
+			case "--request":
+				file = args[i]
+			case "--token":
+				token = args[i]
+			default:
+				name, value, ok := strings.Cut(args[i], "=")
+				if !ok || name == "" {
+					return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --var: %s (expected name=value)", args[i]))
+				}
+				vars[name] = value
+			}
+		default:
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown call option: %s", args[i]))
+		}
+	}
+	if file == "" {
+		return NewCliError(ExitRequestBuild, callRequestUsage)
+	}
+	st, err := LoadRequestFile(file)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		st.Token = token
+	}
+	if st.Confirm {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("%s asks for confirmation: run it as a scenario step (use: %s), which prompts or takes --yes", file, file))
+	}
+	r := newSuiteRunner(cfg, vars)
+	r.source = "call request"
+	sr, resp, err := r.exchange(*st)
+	if err != nil {
+		return err
+	}
+	emitCompactBackendPayload(resp.Body)
+	reportRequestID(sr.RequestID, "")
+	switch {
+	case len(sr.Failures) == 0:
+		return nil
+	case st.Assert.Status == 0 && len(st.Assert.JSON) == 0 && len(st.Capture) == 0:
+		return NewCliError(ExitHTTPErrorStatus, "")
+	}
+	return NewCliError(ExitAssertionFailed, fmt.Sprintf("Assertion failed (%s %s -> %d): %s", sr.Method, sr.Path, sr.Status, strings.Join(sr.Failures, "; ")))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const resourceUsage = "Usage: api resource [--format table|csv|json|ndjson] | api resource <list|create> <collection> [acurl options] | api resource <get|update|delete> <collection> <id> [acurl options]"
+
+// RunResourceCommand implements `api resource`: without an action it lists
+// the REST collections inferred from the spec; with one it sends the acurl
+// call serving `<action> <collection> [id]`, so CRUD needs no raw paths.
+func RunResourceCommand(cfg *ResolvedConfig, globalOpts GlobalOptions, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return listResources(cfg, args)
+	}
+	action := args[0]
+	switch action {
+	case "list", "get", "create", "update", "delete":
+	default:
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Unknown resource action: %s%s", action, agentapi.DidYouMean(action, agentapi.ResourceActions)))
+	}
+	if len(args) < 2 {
+		return NewCliError(ExitRequestBuild, resourceUsage)
+	}
+	ref, rest := args[1], args[2:]
+	id := ""
+	if action != "list" && action != "create" {
+		if len(rest) == 0 || strings.HasPrefix(rest[0], "-") {
+			return NewCliError(ExitRequestBuild, fmt.Sprintf("Usage: api resource %s <collection> <id> [acurl options]", action))
+		}
+		id, rest = rest[0], rest[1:]
+	}
+	opts, err := parseACurlOptions(rest)
+	if err != nil {
+		return err
+	}
+
+	spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	res, params, err := agentapi.FindResource(agentapi.Resources(spec), ref)
+	if err != nil {
+		return err
+	}
+	method, path, ok := res.Target(action)
+	if !ok {
+		return NewCliErrorHint(ExitRequestBuild, fmt.Sprintf("The spec declares no %s for %s", action, res.Path), fmt.Sprintf("%s offers: %s.", res.Name, strings.Join(resourceActionList(res), ", ")))
+	}
+	for name, v := range params {
+		path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(v))
+	}
+	if id != "" {
+		segs := agentapi.NormalizeSegments(res.ItemPath)
+		path = strings.TrimSuffix(path, segs[len(segs)-1]) + url.PathEscape(id)
+	}
+	infof("Using %s %s.\n", method, path)
+	return sendACurl(cfg, globalOpts, method, path, opts, "resource")
+}
+
+// listResources prints the collections of `api resource` with no action.
+func listResources(cfg *ResolvedConfig, args []string) error {
+	format := "table"
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			format = args[i]
+		default:
+			return NewCliError(ExitRequestBuild, resourceUsage)
+		}
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	spec, err := agentapi.LoadSpecPaths(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	t := &Table{
+		Columns: []string{"NAME", "PATH", "ITEM_PATH", "ACTIONS"},
+		Keys:    []string{"name", "path", "item_path", "actions"},
+		Empty:   "No REST collections (a /things path with a /things/{id} below it) in the spec.",
+	}
+	for _, r := range agentapi.Resources(spec) {
+		t.Rows = append(t.Rows, []string{r.Name, r.Path, r.ItemPath, strings.Join(resourceActionList(&r), " ")})
+	}
+	if err := f.Format(os.Stdout, t); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
+
+// resourceActionList names the actions of r, with update's method.
+func resourceActionList(r *agentapi.Resource) []string {
+	out := make([]string, 0, len(r.Actions))
+	for _, a := range agentapi.ResourceActions {
+		if m, ok := r.Actions[a]; ok {
+			if a == "update" {
+				a += "(" + m + ")"
+			}
+			out = append(out, a)
+		}
+	}
+	return out
+}
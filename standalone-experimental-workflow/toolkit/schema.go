@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// maxSchemaDepth bounds $ref expansion for recursive schemas.
+const maxSchemaDepth = 32
+
+// derefSchema follows $ref chains until a concrete schema is reached.
+func derefSchema(spec map[string]any, schema map[string]any) map[string]any {
+	for i := 0; i < maxSchemaDepth; i++ {
+		ref := agentapi.AsString(schema["$ref"])
+		if ref == "" {
+			return schema
+		}
+		next, ok := agentapi.ResolveRef(spec, ref)
+		if !ok {
+			return schema
+		}
+		schema = next
+	}
+	return schema
+}
+
+// ValidateSchema checks a decoded JSON value against an OpenAPI schema and
+// returns one message per violation, prefixed with the JSON path.
+func ValidateSchema(spec map[string]any, schemaAny any, value any) []string {
+	return validateSchemaAt(spec, schemaAny, value, "$", 0)
+}
+
+func validateSchemaAt(spec map[string]any, schemaAny any, value any, at string, depth int) []string {
+	schema, ok := agentapi.AsMap(schemaAny)
+	if !ok || depth > maxSchemaDepth {
+		return nil
+	}
+	schema = derefSchema(spec, schema)
+
+	if all, ok := agentapi.AsSlice(schema["allOf"]); ok {
+		out := make([]string, 0)
+		for _, sub := range all {
+			out = append(out, validateSchemaAt(spec, sub, value, at, depth+1)...)
+		}
+		return out
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts, ok := agentapi.AsSlice(schema[key]); ok && len(alts) > 0 {
+			var first []string
+			for i, sub := range alts {
+				errs := validateSchemaAt(spec, sub, value, at, depth+1)
+				if len(errs) == 0 {
+					return nil
+				}
+				if i == 0 {
+					first = errs
+				}
+			}
+			return append([]string{fmt.Sprintf("%s: matches none of %s", at, key)}, first...)
+		}
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schemaAllowsType(schema, "null") {
+			return nil
+		}
+		if schemaType(schema) == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: expected %s, got null", at, schemaType(schema))}
+	}
+
+	if enum, ok := agentapi.AsSlice(schema["enum"]); ok && len(enum) > 0 {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: value %s not in enum", at, jsonScalarString(value))}
+		}
+	}
+
+	t := schemaType(schema)
+	if t == "" {
+		if _, ok := schema["properties"]; ok {
+			t = "object"
+		} else if _, ok := schema["items"]; ok {
+			t = "array"
+		}
+	}
+	got := jsonTypeName(value)
+	switch t {
+	case "":
+		return nil
+	case "integer":
+		if f, ok := value.(float64); !ok || f != math.Trunc(f) {
+			return []string{fmt.Sprintf("%s: expected integer, got %s", at, got)}
+		}
+		return nil
+	case "number", "string", "boolean":
+		if got != t {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", at, t, got)}
+		}
+		return nil
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %s", at, got)}
+		}
+		out := make([]string, 0)
+		for i, it := range items {
+			out = append(out, validateSchemaAt(spec, schema["items"], it, fmt.Sprintf("%s[%d]", at, i), depth+1)...)
+		}
+		return out
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %s", at, got)}
+		}
+		out := make([]string, 0)
+		if req, ok := agentapi.AsSlice(schema["required"]); ok {
+			for _, r := range req {
+				name := agentapi.AsString(r)
+				if _, present := obj[name]; name != "" && !present {
+					out = append(out, fmt.Sprintf("%s.%s: required property missing", at, name))
+				}
+			}
+		}
+		props, _ := agentapi.AsMap(schema["properties"])
+		for _, name := range agentapi.SortedKeys(obj) {
+			if propSchema, ok := props[name]; ok {
+				out = append(out, validateSchemaAt(spec, propSchema, obj[name], at+"."+name, depth+1)...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// schemaType returns the primary type, accepting OpenAPI 3.1 type arrays.
+func schemaType(schema map[string]any) string {
+	if t := agentapi.AsString(schema["type"]); t != "" {
+		return t
+	}
+	if ts, ok := agentapi.AsSlice(schema["type"]); ok {
+		for _, t := range ts {
+			if s := agentapi.AsString(t); s != "" && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func schemaAllowsType(schema map[string]any, want string) bool {
+	ts, _ := agentapi.AsSlice(schema["type"])
+	for _, t := range ts {
+		if agentapi.AsString(t) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// responseSchema returns the JSON schema declared for a status code, falling
+// back to the "2XX" range and "default" entries.
+func responseSchema(spec map[string]any, op map[string]any, status int) (any, bool) {
+	responses, ok := agentapi.AsMap(op["responses"])
+	if !ok {
+		return nil, false
+	}
+	code := fmt.Sprintf("%d", status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		respObj, ok := agentapi.AsMap(responses[key])
+		if !ok {
+			continue
+		}
+		respObj = derefSchema(spec, respObj)
+		if schema, ok := respObj["schema"]; ok {
+			return schema, true
+		}
+		content, _ := agentapi.AsMap(respObj["content"])
+		for _, ctype := range agentapi.SortedKeys(content) {
+			if !strings.Contains(ctype, "json") {
+				continue
+			}
+			cval, _ := agentapi.AsMap(content[ctype])
+			if schema, ok := cval["schema"]; ok {
+				return schema, true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// InlineSchema returns a deep copy of schema with every local $ref replaced
+// by its target. Recursive references are cut off with a bare object schema.
+func InlineSchema(spec map[string]any, schemaAny any) any {
+	return inlineSchema(spec, schemaAny, map[string]bool{}, 0)
+}
+
+func inlineSchema(spec map[string]any, v any, seen map[string]bool, depth int) any {
+	if depth > maxSchemaDepth {
+		return map[string]any{"type": "object"}
+	}
+	switch t := v.(type) {
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			out[i] = inlineSchema(spec, item, seen, depth+1)
+		}
+		return out
+	case map[string]any, map[any]any:
+		m, _ := agentapi.AsMap(t)
+		if ref := agentapi.AsString(m["$ref"]); ref != "" {
+			target, ok := agentapi.ResolveRef(spec, ref)
+			if !ok || seen[ref] {
+				return map[string]any{"type": "object"}
+			}
+			seen[ref] = true
+			out := inlineSchema(spec, target, seen, depth+1)
+			delete(seen, ref)
+			return out
+		}
+		out := make(map[string]any, len(m))
+		for k, val := range m {
+			out[k] = inlineSchema(spec, val, seen, depth+1)
+		}
+		return out
+	}
+	return v
+}
+
+// requestBodySchema returns the JSON request body schema of op, if any.
+func requestBodySchema(spec map[string]any, op *Operation) (any, bool) {
+	rb, ok := agentapi.AsMap(op.Raw["requestBody"])
+	if !ok {
+		return nil, false
+	}
+	rb = derefSchema(spec, rb)
+	content, _ := agentapi.AsMap(rb["content"])
+	for _, ctype := range agentapi.SortedKeys(content) {
+		if !strings.Contains(ctype, "json") {
+			continue
+		}
+		cval, _ := agentapi.AsMap(content[ctype])
+		if schema, ok := cval["schema"]; ok {
+			return schema, true
+		}
+	}
+	return nil, false
+}
+
+// sampleFromSchema builds a value shaped like schema: its example, default
+// or first enum value where declared, otherwise an empty value of its type,
+// with every writable property of an object and one item of an array.
+func sampleFromSchema(spec map[string]any, schemaAny any) any {
+	return sampleAt(spec, schemaAny, 0)
+}
+
+func sampleAt(spec map[string]any, schemaAny any, depth int) any {
+	schema, ok := agentapi.AsMap(schemaAny)
+	if !ok || depth > maxSchemaDepth {
+		return nil
+	}
+	schema = derefSchema(spec, schema)
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum, ok := agentapi.AsSlice(schema["enum"]); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts, ok := agentapi.AsSlice(schema[key]); ok && len(alts) > 0 {
+			return sampleAt(spec, alts[0], depth+1)
+		}
+	}
+	if parts, ok := agentapi.AsSlice(schema["allOf"]); ok {
+		merged := map[string]any{}
+		for _, p := range parts {
+			if obj, ok := sampleAt(spec, p, depth+1).(map[string]any); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	typ := schemaType(schema)
+	if _, ok := schema["properties"]; ok && typ == "" {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		out := map[string]any{}
+		props, _ := agentapi.AsMap(schema["properties"])
+		for _, name := range agentapi.SortedKeys(props) {
+			prop, _ := agentapi.AsMap(props[name])
+			if readOnly, _ := derefSchema(spec, prop)["readOnly"].(bool); readOnly {
+				continue
+			}
+			out[name] = sampleAt(spec, prop, depth+1)
+		}
+		return out
+	case "array":
+		if item := sampleAt(spec, schema["items"], depth+1); item != nil {
+			return []any{item}
+		}
+		return []any{}
+	case "string":
+		return ""
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	return nil
+}
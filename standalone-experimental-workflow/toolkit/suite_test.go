@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildRequestInterpolatesBodyStrings(t *testing.T) {
+	r := newSuiteRunner(&ResolvedConfig{AgentMarker: "[agent-test]"}, map[string]string{
+		"name":  `x","role":"admin`,
+		"quote": `a\b"c`,
+	})
+	var body any
+	if err := yaml.Unmarshal([]byte("name: '{{name}}'\nnote: '{{agent_marker}} {{quote}}'\ntags: ['{{quote}}', 7]\n"), &body); err != nil {
+		t.Fatal(err)
+	}
+	req, err := r.buildRequest(TestStep{Request: "POST /users", Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(req.Body), &got); err != nil {
+		t.Fatalf("body %s is not JSON: %v", req.Body, err)
+	}
+	want := map[string]any{"name": `x","role":"admin`, "note": `[agent-test] a\b"c`, "tags": []any{`a\b"c`, float64(7)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("body = %s, want %v", req.Body, want)
+	}
+}
+
+func TestRunTestSuiteCountsFailedRollback(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+	cfg := &ResolvedConfig{ConfigDir: t.TempDir(), APIBase: backend.URL, APIMode: "full-access", DefaultTokenName: "dev", Tokens: map[string]string{"dev": "secret"}}
+	suite := &TestSuite{Name: "s", Steps: []TestStep{
+		{Name: "create", Request: "POST /items", Body: map[string]any{"note": "x"}, Rollback: &TestStep{Request: "DELETE /items/1"}},
+		{Name: "read", Request: "GET /items/1"},
+	}}
+
+	res := RunTestSuite(cfg, suite, nil)
+	if res.Failed != 1 || res.RolledBack != 0 || res.RollbackFailed != 1 {
+		t.Fatalf("result = %+v, want 1 failed step and 1 failed rollback", res)
+	}
+	if err := res.err(); ExitCode(err) != ExitAssertionFailed || !strings.Contains(ExitMessage(err), "rollback") {
+		t.Fatalf("err() = %v, want the failed rollback named", err)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"agent-api-toolkit/agentapi"
+)
+
+const (
+	// summaryDepth is how many levels of nested objects --summarize
+	// describes field by field; deeper objects only report their size.
+	summaryDepth = 3
+	// summarySamples is how many items of each array are shown.
+	summarySamples = 3
+	// summaryString caps strings in summaries and samples, in runes.
+	summaryString = 80
+	// summaryPreview is how much of a non-JSON body is shown.
+	summaryPreview = 512
+)
+
+// bodySummarizer reports the structure of a body instead of the body:
+// its size and, for JSON, the keys of objects, the lengths of arrays with
+// the keys their items use and a few sample items. The body is decoded as
+// it streams in, so the summary of a body of any size costs only the
+// samples it keeps.
+type bodySummarizer struct {
+	status      int
+	contentType string
+
+	size    int64
+	lines   int64
+	last    byte
+	preview []byte
+
+	pw   *io.PipeWriter
+	done chan struct{}
+	// shape and err are set by the decoding goroutine before done closes.
+	shape *bodyShape
+	err   error
+}
+
+// BodySummary is what --summarize prints.
+type BodySummary struct {
+	Status       int        `json:"status"`
+	Bytes        int64      `json:"bytes"`
+	RequestBytes int64      `json:"request_bytes"`
+	DurationMS   int64      `json:"duration_ms"`
+	ContentType  string     `json:"content_type,omitempty"`
+	Body         *bodyShape `json:"body"`
+	NextPage     *NextPage  `json:"next_page,omitempty"`
+}
+
+// bodyShape describes one JSON value, or a body that is not JSON.
+type bodyShape struct {
+	Type string `json:"type"`
+	// Value is a scalar, clipped to summaryString runes.
+	Value any `json:"value,omitempty"`
+	// Keys and Fields describe an object, Fields only above summaryDepth.
+	Keys   *int                  `json:"keys,omitempty"`
+	Fields map[string]*bodyShape `json:"fields,omitempty"`
+	// Length, ItemTypes, ItemKeys and Sample describe an array.
+	Length    *int     `json:"length,omitempty"`
+	ItemTypes []string `json:"item_types,omitempty"`
+	ItemKeys  []string `json:"item_keys,omitempty"`
+	Sample    []any    `json:"sample,omitempty"`
+	// Lines and Preview describe a text body.
+	Lines   int64  `json:"lines,omitempty"`
+	Preview string `json:"preview,omitempty"`
+}
+
+func newBodySummarizer(status int, contentType string) *bodySummarizer {
+	pr, pw := io.Pipe()
+	s := &bodySummarizer{status: status, contentType: contentType, pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		dec := json.NewDecoder(pr)
+		dec.UseNumber()
+		s.shape, s.err = summarizeValue(dec, 0)
+		if s.err == nil {
+			if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+				s.err = errors.New("data after the JSON value")
+			}
+		}
+		// Keep accepting writes after a decode error, so size and line
+		// counts cover the whole body.
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return s
+}
+
+func (s *bodySummarizer) Write(p []byte) (int, error) {
+	s.size += int64(len(p))
+	s.lines += int64(bytes.Count(p, []byte("\n")))
+	if len(p) > 0 {
+		s.last = p[len(p)-1]
+	}
+	if room := summaryPreview - len(s.preview); room > 0 {
+		s.preview = append(s.preview, p[:min(room, len(p))]...)
+	}
+	return s.pw.Write(p)
+}
+
+// Summary ends the body and returns its description.
+func (s *bodySummarizer) Summary() BodySummary {
+	_ = s.pw.Close()
+	<-s.done
+	out := BodySummary{Status: s.status, Bytes: s.size, ContentType: s.contentType}
+	switch {
+	case s.size == 0:
+		out.Body = &bodyShape{Type: "empty"}
+	case s.err != nil:
+		// Not JSON: describe it as text.
+		preview := s.preview
+		for !utf8.Valid(preview) && len(preview) > 0 {
+			preview = preview[:len(preview)-1]
+		}
+		lines := s.lines
+		if s.last != '\n' {
+			lines++
+		}
+		out.Body = &bodyShape{Type: "text", Lines: lines, Preview: string(preview)}
+	default:
+		out.Body = s.shape
+	}
+	return out
+}
+
+// Print writes the summary as indented JSON, leaving markup in previews
+// and samples readable.
+func (b BodySummary) Print(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	return nil
+}
+
+// summarizeValue consumes one JSON value from dec and describes it.
+func summarizeValue(dec *json.Decoder, depth int) (*bodyShape, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return summarizeObject(dec, depth)
+		}
+		return summarizeArray(dec, depth)
+	default:
+		return &bodyShape{Type: jsonTypeName(t), Value: clipScalar(t)}, nil
+	}
+}
+
+func summarizeObject(dec *json.Decoder, depth int) (*bodyShape, error) {
+	fields := map[string]*bodyShape{}
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		n++
+		if depth+1 < summaryDepth {
+			if fields[key], err = summarizeValue(dec, depth+1); err != nil {
+				return nil, err
+			}
+		} else if err := skipValue(dec); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	out := &bodyShape{Type: "object", Keys: &n}
+	if depth+1 < summaryDepth {
+		out.Fields = fields
+	}
+	return out, nil
+}
+
+func summarizeArray(dec *json.Decoder, depth int) (*bodyShape, error) {
+	length := 0
+	samples := make([]any, 0, summarySamples)
+	types := map[string]bool{}
+	keys := map[string]bool{}
+	for dec.More() {
+		length++
+		var typ string
+		var itemKeys []string
+		var err error
+		if len(samples) < summarySamples {
+			var v any
+			if v, err = sampleValue(dec, 0); err != nil {
+				return nil, err
+			}
+			samples = append(samples, v)
+			typ = jsonTypeName(v)
+			if obj, ok := v.(map[string]any); ok {
+				itemKeys = agentapi.SortedKeys(obj)
+			}
+		} else if typ, itemKeys, err = itemShape(dec); err != nil {
+			return nil, err
+		}
+		types[typ] = true
+		for _, k := range itemKeys {
+			keys[k] = true
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	out := &bodyShape{Type: "array", Length: &length, Sample: samples}
+	if length > 0 {
+		out.ItemTypes = sortedSet(types)
+	}
+	if len(keys) > 0 {
+		out.ItemKeys = sortedSet(keys)
+	}
+	return out, nil
+}
+
+// sampleValue consumes one JSON value and returns it cut down for a sample:
+// long strings clipped, arrays to their first items, objects below the
+// second level to their size.
+func sampleValue(dec *json.Decoder, depth int) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return clipScalar(tok), nil
+	}
+	if d == '{' {
+		obj := map[string]any{}
+		n := 0
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := kt.(string)
+			n++
+			if depth < 2 {
+				if obj[key], err = sampleValue(dec, depth+1); err != nil {
+					return nil, err
+				}
+			} else if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if depth >= 2 {
+			return fmt.Sprintf("{… %d keys}", n), nil
+		}
+		return obj, nil
+	}
+	items := make([]any, 0)
+	n := 0
+	for dec.More() {
+		n++
+		if n > summarySamples {
+			if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v, err := sampleValue(dec, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if n > summarySamples {
+		items = append(items, fmt.Sprintf("… %d more", n-summarySamples))
+	}
+	return items, nil
+}
+
+// itemShape consumes one array item and returns its type and, for an
+// object, its keys.
+func itemShape(dec *json.Decoder) (string, []string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return jsonTypeName(tok), nil, nil
+	}
+	if d == '[' {
+		for dec.More() {
+			if err := skipValue(dec); err != nil {
+				return "", nil, err
+			}
+		}
+		_, err := dec.Token()
+		return "array", nil, err
+	}
+	keys := make([]string, 0)
+	for dec.More() {
+		kt, err := dec.Token()
+		if err != nil {
+			return "", nil, err
+		}
+		key, _ := kt.(string)
+		keys = append(keys, key)
+		if err := skipValue(dec); err != nil {
+			return "", nil, err
+		}
+	}
+	_, err = dec.Token()
+	return "object", keys, err
+}
+
+// skipValue consumes one JSON value.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func clipScalar(v any) any {
+	s, ok := v.(string)
+	if !ok || utf8.RuneCountInString(s) <= summaryString {
+		return v
+	}
+	return string([]rune(s)[:summaryString]) + fmt.Sprintf("… (%d chars)", utf8.RuneCountInString(s))
+}
+
+func sortedSet(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
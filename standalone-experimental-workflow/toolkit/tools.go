@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+var toolNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// ToolDefinition is the framework-neutral form of one operation exposed as
+// an LLM tool; it is rendered as an OpenAI function or an Anthropic tool.
+type ToolDefinition struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// BuildToolDefinition converts an operation into a tool; ro is op resolved
+// by resolvedCache, which holds the input schema (see toolInputSchema).
+func BuildToolDefinition(op Operation, ro resolvedOperation) ToolDefinition {
+	desc := strings.TrimSpace(op.Summary)
+	if op.Description != "" && op.Description != op.Summary {
+		desc = strings.TrimSpace(desc + "\n\n" + op.Description)
+	}
+	desc = strings.TrimSpace(fmt.Sprintf("%s\n\n%s %s", desc, op.Method, op.Path))
+	return ToolDefinition{Name: toolName(op), Description: desc, Parameters: ro.ToolInput}
+}
+
+// toolInputSchema has one property per path/query/header parameter plus
+// `body` for the JSON request body, with all $refs inlined.
+func toolInputSchema(spec map[string]any, op Operation) map[string]any {
+	props := map[string]any{}
+	required := make([]string, 0)
+	for _, p := range op.Parameters {
+		if p.In == "cookie" {
+			continue
+		}
+		schema, ok := agentapi.AsMap(InlineSchema(spec, p.Raw["schema"]))
+		if !ok {
+			schema = map[string]any{"type": "string"}
+		}
+		schema["description"] = strings.TrimSpace(p.Description + fmt.Sprintf(" (%s parameter)", p.In))
+		props[p.Name] = schema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	if rb, ok := agentapi.AsMap(op.Raw["requestBody"]); ok {
+		rb = derefSchema(spec, rb)
+		content, _ := agentapi.AsMap(rb["content"])
+		for _, ctype := range agentapi.SortedKeys(content) {
+			if !strings.Contains(ctype, "json") {
+				continue
+			}
+			cval, _ := agentapi.AsMap(content[ctype])
+			schema, ok := agentapi.AsMap(InlineSchema(spec, cval["schema"]))
+			if !ok {
+				schema = map[string]any{"type": "object"}
+			}
+			schema["description"] = "JSON request body"
+			props["body"] = schema
+			if req, _ := rb["required"].(bool); req {
+				required = append(required, "body")
+			}
+			break
+		}
+	}
+	input := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		input["required"] = required
+	}
+	return input
+}
+
+// toolName uses the operationId when present, otherwise method and path,
+// restricted to the characters and length both providers accept. Distinct
+// operations may get the same name (GET /a.b and GET /a_b, long paths cut
+// alike): see uniqueToolName.
+func toolName(op Operation) string {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(op.Method) + "_" + op.Path
+	}
+	name = strings.Trim(toolNameUnsafe.ReplaceAllString(name, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// uniqueToolName returns name, or, when used already holds it, name cut
+// short with a suffix made from a hash of op's method and path (and a
+// counter if that is taken too), within the 64 characters providers accept:
+// both reject a tool list with a name twice. It adds the result to used.
+func uniqueToolName(used map[string]bool, name string, op Operation) string {
+	sum := sha256.Sum256([]byte(op.Method + " " + op.Path))
+	hash := hex.EncodeToString(sum[:3])
+	base := name
+	for n := 1; used[name]; n++ {
+		suffix := "_" + hash
+		if n > 1 {
+			suffix += fmt.Sprintf("_%d", n)
+		}
+		name = base[:min(len(base), 64-len(suffix))] + suffix
+	}
+	used[name] = true
+	return name
+}
+
+// RunTools implements `api spec tools [query] [--method M] [--format openai|anthropic]`.
+func RunTools(cfg *ResolvedConfig, args []string) error {
+	format := "openai"
+	methodFilter := ""
+	queryParts := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --format")
+			}
+			format = args[i]
+		case "--method":
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, "Missing value for --method")
+			}
+			m := strings.ToUpper(strings.TrimSpace(args[i]))
+			if _, ok := httpMethods[m]; !ok {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid HTTP method for --method: %s", m))
+			}
+			methodFilter = m
+		default:
+			queryParts = append(queryParts, args[i])
+		}
+	}
+	if format != "openai" && format != "anthropic" {
+		return NewCliError(ExitRequestBuild, fmt.Sprintf("Invalid --format: %s (expected openai|anthropic)", format))
+	}
+
+	spec, err := agentapi.LoadSpec(runCtx, cfg)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(strings.Join(queryParts, " "))
+	var ops []Operation
+	if query != "" {
+		ops = agentapi.FindOperations(spec, query, methodFilter)
+	} else {
+		for _, op := range agentapi.IterOperations(spec) {
+			if methodFilter == "" || op.Method == methodFilter {
+				ops = append(ops, op)
+			}
+		}
+		sortOperations(ops)
+	}
+
+	resolved := openResolvedCache(cfg, spec)
+	out := make([]map[string]any, 0, len(ops))
+	used := map[string]bool{}
+	for _, op := range ops {
+		ro, err := resolved.resolve(spec, &op)
+		if err != nil {
+			return err
+		}
+		td := BuildToolDefinition(op, ro)
+		td.Name = uniqueToolName(used, td.Name, op)
+		if format == "anthropic" {
+			out = append(out, map[string]any{
+				"name":         td.Name,
+				"description":  td.Description,
+				"input_schema": td.Parameters,
+			})
+			continue
+		}
+		out = append(out, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        td.Name,
+				"description": td.Description,
+				"parameters":  td.Parameters,
+			},
+		})
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to encode tools: %v", err), err)
+	}
+	fmt.Println(string(b))
+	return nil
+}
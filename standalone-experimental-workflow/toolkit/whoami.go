@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-api-toolkit/agentapi"
+)
+
+// identityWrappers are keys identity endpoints commonly nest the principal
+// under ({"data": {"user": {...}}}).
+var identityWrappers = []string{"data", "user", "me", "identity", "principal", "result"}
+
+// identitySubjectKeys, identityNameKeys and identityRoleKeys are the fields
+// read from an identity response, in order of preference.
+var (
+	identitySubjectKeys = []string{"id", "sub", "user_id", "userId", "uid", "_id", "client_id", "clientId"}
+	identityNameKeys    = []string{"email", "username", "preferred_username", "login", "name", "displayName", "display_name"}
+	identityRoleKeys    = []string{"roles", "role", "authorities", "groups", "scopes", "scope"}
+)
+
+// Identity is who a token acts as, as reported by `api whoami`.
+type Identity struct {
+	Env     string
+	Token   string
+	Status  int
+	Subject string
+	Name    string
+	Roles   []string
+	Error   string
+}
+
+// fetchIdentity calls the identity endpoint of cfg with the named token and
+// returns what it found with the decoded response, if JSON, and the error
+// of a call that got no response. The path comes from the config, not from
+// the agent, so like a health probe it is not checked against the spec in
+// strict mode.
+func fetchIdentity(cfg *ResolvedConfig, token string) (Identity, any, error) {
+	id := Identity{Env: cfg.ActiveEnv, Token: token}
+	unchecked := *cfg
+	unchecked.Strict = false
+	resp, err := PerformRequest(&unchecked, APIRequest{Method: http.MethodGet, Path: cfg.IdentityPath, TokenName: token, Source: "whoami"})
+	if err != nil {
+		id.Error = ExitMessage(err)
+		return id, nil, err
+	}
+	id.Status = resp.StatusCode
+	var doc any
+	jsonErr := json.Unmarshal(resp.Body, &doc)
+	switch {
+	case resp.StatusCode >= 400:
+		id.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return id, doc, nil
+	case jsonErr != nil:
+		id.Error = "response is not JSON"
+		return id, nil, nil
+	}
+	principal, _ := agentapi.AsMap(doc)
+	for depth := 0; principal != nil && depth < 3 && !hasIdentityField(principal); depth++ {
+		var inner map[string]any
+		for _, k := range identityWrappers {
+			if m, ok := agentapi.AsMap(principal[k]); ok {
+				inner = m
+				break
+			}
+		}
+		principal = inner
+	}
+	if principal == nil {
+		id.Error = "no identity fields in the response"
+		return id, doc, nil
+	}
+	id.Subject = firstScalar(principal, identitySubjectKeys)
+	id.Name = firstScalar(principal, identityNameKeys)
+	id.Roles = identityRoles(principal)
+	return id, doc, nil
+}
+
+func hasIdentityField(obj map[string]any) bool {
+	return firstScalar(obj, identitySubjectKeys) != "" || firstScalar(obj, identityNameKeys) != ""
+}
+
+func firstScalar(obj map[string]any, keys []string) string {
+	for _, k := range keys {
+		switch v := obj[k].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// identityRoles collects the roles, groups and scopes of a principal:
+// strings, lists of strings, space- or comma-separated strings, and lists
+// of objects named by name, key or id.
+func identityRoles(obj map[string]any) []string {
+	seen := map[string]bool{}
+	roles := make([]string, 0)
+	add := func(r string) {
+		if r = strings.TrimSpace(r); r != "" && !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	for _, k := range identityRoleKeys {
+		switch v := obj[k].(type) {
+		case string:
+			for _, r := range strings.FieldsFunc(v, func(c rune) bool { return c == ' ' || c == ',' }) {
+				add(r)
+			}
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					add(s)
+				} else if m, ok := agentapi.AsMap(item); ok {
+					add(firstScalar(m, []string{"name", "key", "id"}))
+				}
+			}
+		}
+	}
+	return roles
+}
+
+func identityTable(ids []Identity) *Table {
+	t := &Table{
+		Columns: []string{"ENV", "TOKEN", "STATUS", "SUBJECT", "NAME", "ROLES"},
+		Keys:    []string{"env", "token", "status", "subject", "name", "roles"},
+		Empty:   "No tokens configured.",
+	}
+	for _, id := range ids {
+		status := strconv.Itoa(id.Status)
+		if id.Error != "" {
+			status = "error: " + id.Error
+		}
+		t.Rows = append(t.Rows, []string{id.Env, id.Token, status, id.Subject, id.Name, strings.Join(id.Roles, ", ")})
+	}
+	return t
+}
+
+// RunWhoami implements `api whoami [--token <name> | --all-tokens] [--raw] [--format ...]`.
+func RunWhoami(cfg *ResolvedConfig, args []string) error {
+	usage := "Usage: api whoami [--token <name> | --all-tokens] [--raw | --format table|csv|json|ndjson]"
+	token, format := cfg.DefaultTokenName, "table"
+	all, raw := false, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--token", "--format":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				return NewCliError(ExitRequestBuild, fmt.Sprintf("Missing value for %s", flag))
+			}
+			if flag == "--token" {
+				token = args[i]
+			} else {
+				format = args[i]
+			}
+		case "--all-tokens":
+			all = true
+		case "--raw":
+			raw = true
+		default:
+			return NewCliError(ExitRequestBuild, usage)
+		}
+	}
+	if raw && all {
+		return NewCliError(ExitRequestBuild, "--raw shows one token's response; drop --all-tokens")
+	}
+	f, err := LookupFormatter(format)
+	if err != nil {
+		return err
+	}
+	if cfg.IdentityPath == "" {
+		return NewCliErrorHint(ExitConfig, fmt.Sprintf("No identity_path configured for %s/%s", cfg.ActiveProject, cfg.ActiveEnv), fmt.Sprintf(`Add identity_path = "/me" (the endpoint returning the caller) under [projects.%s.envs.%s].`, cfg.ActiveProject, cfg.ActiveEnv))
+	}
+	tokens := []string{token}
+	if all {
+		tokens = make([]string, 0, len(cfg.Tokens))
+		for name := range cfg.Tokens {
+			tokens = append(tokens, name)
+		}
+		sort.Strings(tokens)
+	} else if _, ok := cfg.Tokens[token]; !ok {
+		_, _, err := agentapi.ResolveToken(cfg, token)
+		return err
+	}
+
+	ids := make([]Identity, 0, len(tokens))
+	for _, name := range tokens {
+		id, doc, err := fetchIdentity(cfg, name)
+		if raw {
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				return NewCliError(ExitHTTPErrorStatus, fmt.Sprintf("Identity endpoint %s answered HTTP %d, not JSON", cfg.IdentityPath, id.Status))
+			}
+			if err := printJSONIndent(doc); err != nil {
+				return err
+			}
+			if id.Status >= 400 {
+				return NewCliError(ExitHTTPErrorStatus, "")
+			}
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	if runCtx.Err() != nil {
+		return NewCliError(ExitInterrupted, "Interrupted: whoami cancelled")
+	}
+	if err := f.Format(os.Stdout, identityTable(ids)); err != nil {
+		return WrapCliError(ExitUnexpected, fmt.Sprintf("Failed to write output: %v", err), err)
+	}
+	failed := make([]string, 0)
+	for _, id := range ids {
+		if id.Error != "" {
+			failed = append(failed, id.Token)
+		}
+	}
+	if len(failed) > 0 {
+		return NewCliErrorHint(ExitHTTPErrorStatus, fmt.Sprintf("Identity not resolved for token(s): %s", strings.Join(failed, ", ")), "A 401 or 403 usually means the token is expired or revoked; update it in config.toml.")
+	}
+	return nil
+}